@@ -0,0 +1,186 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ServerSnapshot 结构体，服务器主机及端口的最后已知值；管理器轮换时同步更新
+type ServerSnapshot struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ServerTable string `gorm:"column:server_table;type:varchar(255);uniqueIndex:unique_server_snapshot;not null" json:"server_table"`
+	ServerID    int    `gorm:"column:server_id;uniqueIndex:unique_server_snapshot;not null" json:"server_id"`
+	Host        string `gorm:"column:host;type:varchar(255);default:''" json:"host"`
+	Port        string `gorm:"column:port;type:varchar(16);default:''" json:"port"`
+	ServerPort  int    `gorm:"column:server_port;default:0" json:"server_port"`
+	UpdatedAt   int64  `gorm:"column:updated_at;not null" json:"updated_at"`
+}
+
+// ServerAnomaly 结构体，非管理器发起的主机或端口变更（如直接在面板中修改）
+type ServerAnomaly struct {
+	ID             uint   `gorm:"primaryKey" json:"id"`
+	ServerTable    string `gorm:"column:server_table;type:varchar(255);index:idx_server_anomaly;not null" json:"server_table"`
+	ServerID       int    `gorm:"column:server_id;index:idx_server_anomaly;not null" json:"server_id"`
+	OldHost        string `gorm:"column:old_host;type:varchar(255);default:''" json:"old_host"`
+	NewHost        string `gorm:"column:new_host;type:varchar(255);default:''" json:"new_host"`
+	OldPort        string `gorm:"column:old_port;type:varchar(16);default:''" json:"old_port"`
+	NewPort        string `gorm:"column:new_port;type:varchar(16);default:''" json:"new_port"`
+	OldServerPort  int    `gorm:"column:old_server_port;default:0" json:"old_server_port"`
+	NewServerPort  int    `gorm:"column:new_server_port;default:0" json:"new_server_port"`
+	LastSeenAt     int64  `gorm:"column:last_seen_at;not null" json:"last_seen_at"` // 变更前最后一次确认旧值的时间
+	DetectedAt     int64  `gorm:"column:detected_at;index;not null" json:"detected_at"`
+	AcknowledgedAt int64  `gorm:"column:acknowledged_at;default:0" json:"acknowledged_at"`
+	AcknowledgedBy string `gorm:"column:acknowledged_by;type:varchar(255);default:''" json:"acknowledged_by"`
+}
+
+// 保存服务器快照（轮换事务内调用，使管理器自身的变更不被视为异常）
+func saveServerSnapshot(tx *gorm.DB, table string, id int, host, port string, serverPort int, now int64) error {
+	snapshot := ServerSnapshot{ServerTable: table, ServerID: id}
+	if err := tx.Where("server_table = ? AND server_id = ?", table, id).First(&snapshot).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	snapshot.Host, snapshot.Port, snapshot.ServerPort, snapshot.UpdatedAt = host, port, serverPort, now
+	return tx.Save(&snapshot).Error
+}
+
+// 比对服务器当前主机、端口与快照，记录非管理器发起的变更；首次见到的服务器只建立快照
+func detectServerAnomalies(t *Tenant, now int64) int {
+	detected := 0
+	for _, table := range serverTables(t) {
+		var servers []struct {
+			ID         int
+			Host       string
+			Port       string
+			ServerPort int
+		}
+		if err := t.DB.Table(table).Select(serverSelect(table, "id", "host", "port", "server_port")).Find(&servers).Error; err != nil {
+			log.Printf("异常检测: 从表 %s 获取服务器失败: 租户=%s, 错误=%v", table, t.Name, err)
+			continue
+		}
+		var snapshots []ServerSnapshot
+		if err := t.DB.Where("server_table = ?", table).Find(&snapshots).Error; err != nil {
+			log.Printf("异常检测: 获取表 %s 的快照失败: 租户=%s, 错误=%v", table, t.Name, err)
+			continue
+		}
+		known := make(map[int]ServerSnapshot, len(snapshots))
+		for _, s := range snapshots {
+			known[s.ServerID] = s
+		}
+		for _, s := range servers {
+			snapshot, ok := known[s.ID]
+			if ok && snapshot.Host == s.Host && snapshot.Port == s.Port && snapshot.ServerPort == s.ServerPort {
+				if err := t.DB.Model(&ServerSnapshot{}).Where("id = ?", snapshot.ID).Update("updated_at", now).Error; err != nil {
+					log.Printf("异常检测: 更新快照失败: 表=%s, ID=%d, 错误=%v", table, s.ID, err)
+				}
+				continue
+			}
+			if ok {
+				anomaly := ServerAnomaly{
+					ServerTable:   table,
+					ServerID:      s.ID,
+					OldHost:       snapshot.Host,
+					NewHost:       s.Host,
+					OldPort:       snapshot.Port,
+					NewPort:       s.Port,
+					OldServerPort: snapshot.ServerPort,
+					NewServerPort: s.ServerPort,
+					LastSeenAt:    snapshot.UpdatedAt,
+					DetectedAt:    now,
+				}
+				if err := t.DB.Create(&anomaly).Error; err != nil {
+					log.Printf("异常检测: 记录异常失败: 表=%s, ID=%d, 错误=%v", table, s.ID, err)
+					continue
+				}
+				log.Printf("检测到非管理器发起的服务器变更: 租户=%s, 表=%s, ID=%d, 主机 %s -> %s, 端口 %s -> %s", t.Name, table, s.ID, snapshot.Host, s.Host, snapshot.Port, s.Port)
+				oldPort, _ := strconv.Atoi(snapshot.Port)
+				newPort, _ := strconv.Atoi(s.Port)
+				publishEvent(Event{Type: eventServerModified, Tenant: t.Name, ServerTable: table, ServerID: s.ID, OldHost: snapshot.Host, NewHost: s.Host, OldPort: oldPort, NewPort: newPort, Time: now})
+				detected++
+			}
+			if err := saveServerSnapshot(t.DB, table, s.ID, s.Host, s.Port, s.ServerPort, now); err != nil {
+				log.Printf("异常检测: 保存快照失败: 表=%s, ID=%d, 错误=%v", table, s.ID, err)
+			}
+		}
+	}
+	return detected
+}
+
+// 对所有租户执行异常检测
+func runAnomalyDetection() {
+	now := time.Now().Unix()
+	for _, t := range tenantList() {
+		if n := detectServerAnomalies(t, now); n > 0 {
+			log.Printf("异常检测完成: 租户=%s, 发现 %d 处变更", t.Name, n)
+		}
+	}
+}
+
+// 注册异常变更路由
+func registerAnomalyRoutes(r *gin.Engine) {
+	// 列出非管理器发起的服务器变更，可按 table、id 过滤，unacknowledged=1 只看未确认的
+	r.GET("/server-anomalies", authMiddleware, func(c *gin.Context) {
+		q := currentTenant(c).DB.Scopes(serverAccessScope(c)).Order("detected_at DESC, id DESC").Limit(200)
+		if table := c.Query("table"); table != "" {
+			q = q.Where("server_table = ?", table)
+		}
+		if id, err := strconv.Atoi(c.Query("id")); err == nil {
+			q = q.Where("server_id = ?", id)
+		}
+		if c.Query("unacknowledged") == "1" {
+			q = q.Where("acknowledged_at = 0")
+		}
+		var anomalies []ServerAnomaly
+		if err := q.Find(&anomalies).Error; err != nil {
+			log.Printf("获取服务器异常变更失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取异常变更失败："+err.Error())
+			return
+		}
+		// 逐字段列出变更，便于页面展示差异
+		type fieldDiff struct {
+			Field string `json:"field"`
+			Old   string `json:"old"`
+			New   string `json:"new"`
+		}
+		items := make([]gin.H, 0, len(anomalies))
+		for _, a := range anomalies {
+			var diff []fieldDiff
+			if a.OldHost != a.NewHost {
+				diff = append(diff, fieldDiff{"host", a.OldHost, a.NewHost})
+			}
+			if a.OldPort != a.NewPort {
+				diff = append(diff, fieldDiff{"port", a.OldPort, a.NewPort})
+			}
+			if a.OldServerPort != a.NewServerPort {
+				diff = append(diff, fieldDiff{"server_port", strconv.Itoa(a.OldServerPort), strconv.Itoa(a.NewServerPort)})
+			}
+			items = append(items, gin.H{"anomaly": a, "diff": diff})
+		}
+		c.JSON(http.StatusOK, gin.H{"anomalies": items})
+	})
+
+	// 确认异常变更
+	r.POST("/server-anomalies/ack", authMiddleware, func(c *gin.Context) {
+		id, err := strconv.Atoi(serverParam(c, "id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		result := currentTenant(c).DB.Model(&ServerAnomaly{}).Where("id = ? AND acknowledged_at = 0", id).
+			Updates(map[string]interface{}{"acknowledged_at": time.Now().Unix(), "acknowledged_by": operatorName(c)})
+		if result.Error != nil {
+			log.Printf("确认异常变更失败: ID=%d, 错误=%v", id, result.Error)
+			respondError(c, http.StatusInternalServerError, codeInternal, "确认失败："+result.Error.Error())
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "记录不存在或已确认")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "已确认"})
+	})
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 轮换审批状态
+const (
+	approvalPending  = "pending"  // 等待第二位操作员确认
+	approvalRejected = "rejected" // 已驳回
+	approvalExpired  = "expired"  // 超出确认时限
+	approvalExecuted = "executed" // 已确认并轮换成功
+	approvalFailed   = "failed"   // 已确认但轮换失败
+)
+
+// RotationApproval 结构体，手动轮换审批记录（双人复核），记录全部保留作为审计
+type RotationApproval struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ServerTable string `gorm:"column:server_table;type:varchar(255);index:idx_rotation_approval_server;not null" json:"server_table"`
+	ServerID    int    `gorm:"column:server_id;index:idx_rotation_approval_server;not null" json:"server_id"`
+	Status      string `gorm:"column:status;type:varchar(32);index;not null" json:"status"`
+	RequestedBy string `gorm:"column:requested_by;type:varchar(255);not null" json:"requested_by"`
+	// 申请人身份（见 requestPrincipal），审批人身份相同时拒绝
+	RequestedPrincipal string `gorm:"column:requested_principal;type:varchar(255);default:''" json:"requested_principal"`
+	RequestedAt        int64  `gorm:"column:requested_at;not null" json:"requested_at"`
+	RequestIP          string `gorm:"column:request_ip;type:varchar(64);default:''" json:"request_ip"`
+	Reason             string `gorm:"column:reason;type:varchar(255);default:''" json:"reason"`
+	ExpiresAt          int64  `gorm:"column:expires_at;not null" json:"expires_at"`
+	DecidedBy          string `gorm:"column:decided_by;type:varchar(255);default:''" json:"decided_by"`
+	// 审批人身份
+	DecidedPrincipal string `gorm:"column:decided_principal;type:varchar(255);default:''" json:"decided_principal"`
+	DecidedAt        int64  `gorm:"column:decided_at;default:0" json:"decided_at"`
+	DecideIP         string `gorm:"column:decide_ip;type:varchar(64);default:''" json:"decide_ip"`
+	Error            string `gorm:"column:error;type:varchar(1024);default:''" json:"error"`
+}
+
+// 服务器的手动轮换是否需要审批：approval.enabled 开启且服务器带有 approval.tag 标签（默认 production）
+func approvalRequired(tx *gorm.DB, table string, id int) bool {
+	if !viper.GetBool("approval.enabled") {
+		return false
+	}
+	tag := normalizeTags(viper.GetString("approval.tag"))
+	if tag == "" {
+		tag = "production"
+	}
+	return serverHasTag(tx, table, id, tag)
+}
+
+// 审批确认时限（秒），默认 30 分钟
+func approvalWindowSeconds() int64 {
+	if m := viper.GetInt64("approval.windowMinutes"); m > 0 {
+		return m * 60
+	}
+	return 1800
+}
+
+// 当前操作员（用于显示及审计）：API 令牌请求为 token:<名称>，页面请求为 user:<用户名>
+func operatorName(c *gin.Context) string {
+	if name, ok := c.Get("api_token"); ok {
+		return "token:" + name.(string)
+	}
+	if user, ok := currentUser(c); ok {
+		return "user:" + user.Username
+	}
+	return "unknown"
+}
+
+// 当前请求背后的身份，由认证中间件设置：会话登录为 user:<用户名>，API 令牌为其创建者的身份
+// （创建者未知的旧令牌为 token:<ID>），OIDC 访问令牌为 oidc:<客户端>。
+// 令牌名称可以随意填写，双人复核按身份而不是操作员名称判断是否为同一人
+func requestPrincipal(c *gin.Context) string {
+	if v, ok := c.Get("principal"); ok {
+		return v.(string)
+	}
+	return ""
+}
+
+// 命令行操作员：cli:<系统用户>
+func cliOperatorName() string {
+	if user := os.Getenv("USER"); user != "" {
+		return "cli:" + user
+	}
+	return "cli"
+}
+
+// 将超出时限的待审批记录标记为过期
+func expireRotationApprovals(tdb *gorm.DB, now int64) {
+	if err := tdb.Model(&RotationApproval{}).Where("status = ? AND expires_at <= ?", approvalPending, now).
+		Updates(map[string]interface{}{"status": approvalExpired, "decided_at": now}).Error; err != nil {
+		log.Printf("标记过期的轮换审批失败: %v", err)
+	}
+}
+
+// 提交轮换审批；服务器已有待审批记录时直接返回该记录
+func requestRotationApproval(t *Tenant, table string, id int, operator, principal, ip, reason string) (RotationApproval, bool, error) {
+	now := time.Now().Unix()
+	expireRotationApprovals(t.DB, now)
+	var approval RotationApproval
+	if err := t.DB.Where("server_table = ? AND server_id = ? AND status = ?", table, id, approvalPending).First(&approval).Error; err == nil {
+		return approval, false, nil
+	}
+	approval = RotationApproval{
+		ServerTable:        table,
+		ServerID:           id,
+		Status:             approvalPending,
+		RequestedBy:        operator,
+		RequestedPrincipal: principal,
+		RequestedAt:        now,
+		RequestIP:          ip,
+		Reason:             truncate(reason, 255),
+		ExpiresAt:          now + approvalWindowSeconds(),
+	}
+	if err := t.DB.Create(&approval).Error; err != nil {
+		return approval, false, err
+	}
+	log.Printf("已提交轮换审批: 租户=%s, 表=%s, ID=%d, 申请人=%s, 审批ID=%d", t.Name, table, id, operator, approval.ID)
+	return approval, true, nil
+}
+
+// 确认或驳回审批；确认后立即执行轮换。申请人不能审批自己的申请：审批人身份须已知且与申请人身份不同，
+// 旧记录未保存申请人身份时按操作员名称判断
+func decideRotationApproval(t *Tenant, approvalID int, approve bool, operator, principal, ip string) (RotationApproval, error) {
+	now := time.Now().Unix()
+	expireRotationApprovals(t.DB, now)
+	var approval RotationApproval
+	if err := t.DB.First(&approval, approvalID).Error; err != nil {
+		return approval, errors.New("审批记录不存在")
+	}
+	if approval.Status != approvalPending {
+		return approval, errors.New("审批已处理，当前状态: " + approval.Status)
+	}
+	if principal == "" {
+		return approval, errors.New("无法确定审批人身份")
+	}
+	requester := approval.RequestedPrincipal
+	if requester == "" {
+		requester = approval.RequestedBy
+	}
+	if requester == principal || approval.RequestedBy == operator {
+		return approval, errors.New("不能审批自己提交的轮换申请，需由另一位操作员确认")
+	}
+	status := approvalRejected
+	if approve {
+		status = approvalExecuted
+	}
+	// 条件更新防止并发重复审批
+	result := t.DB.Model(&RotationApproval{}).Where("id = ? AND status = ?", approval.ID, approvalPending).
+		Updates(map[string]interface{}{"status": status, "decided_by": operator, "decided_principal": principal, "decided_at": now, "decide_ip": ip})
+	if result.Error != nil {
+		return approval, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return approval, errors.New("审批已被其他操作员处理")
+	}
+	approval.Status, approval.DecidedBy, approval.DecidedPrincipal, approval.DecidedAt, approval.DecideIP = status, operator, principal, now, ip
+	if !approve {
+		log.Printf("轮换审批已驳回: 审批ID=%d, 表=%s, ID=%d, 审批人=%s", approval.ID, approval.ServerTable, approval.ServerID, operator)
+		return approval, nil
+	}
+	log.Printf("轮换审批已确认，开始轮换: 审批ID=%d, 表=%s, ID=%d, 申请人=%s, 审批人=%s", approval.ID, approval.ServerTable, approval.ServerID, approval.RequestedBy, operator)
+	if err := rotateServerNow(t, approval.ServerTable, approval.ServerID, RotationCause{Trigger: triggerApproval, Actor: operator}); err != nil {
+		approval.Status, approval.Error = approvalFailed, truncate(err.Error(), 1024)
+		t.DB.Model(&RotationApproval{}).Where("id = ?", approval.ID).Updates(map[string]interface{}{"status": approval.Status, "error": approval.Error})
+		return approval, err
+	}
+	return approval, nil
+}
+
+// 注册轮换审批路由
+func registerApprovalRoutes(r *gin.Engine) {
+	// 列出轮换审批记录，可按 status、table、id 过滤
+	r.GET("/rotation-approvals", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		expireRotationApprovals(tdb, time.Now().Unix())
+		q := tdb.Scopes(serverAccessScope(c)).Order("id DESC").Limit(200)
+		if status := c.Query("status"); status != "" {
+			q = q.Where("status = ?", status)
+		}
+		if table := c.Query("table"); table != "" {
+			q = q.Where("server_table = ?", table)
+		}
+		if id, err := strconv.Atoi(c.Query("id")); err == nil {
+			q = q.Where("server_id = ?", id)
+		}
+		var approvals []RotationApproval
+		if err := q.Find(&approvals).Error; err != nil {
+			log.Printf("获取轮换审批失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取轮换审批失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"approvals": approvals, "operator": operatorName(c), "principal": requestPrincipal(c)})
+	})
+
+	// 确认（approve=1）或驳回（approve=0）轮换审批
+	r.POST("/rotation-approvals/decide", authMiddleware, func(c *gin.Context) {
+		id, err := strconv.Atoi(serverParam(c, "id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的审批ID")
+			return
+		}
+		approve := c.PostForm("approve") == "1"
+		approval, err := decideRotationApproval(currentTenant(c), id, approve, operatorName(c), requestPrincipal(c), c.ClientIP())
+		if err != nil {
+			if approval.Status == approvalFailed {
+				respondError(c, http.StatusInternalServerError, rotationErrorCode(err), "轮换失败："+err.Error(), approval)
+				return
+			}
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+			return
+		}
+		message := "已驳回轮换申请"
+		if approve {
+			message = "已确认，服务器已轮换"
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message, "approval": approval})
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDecideRotationApprovalRequiresDistinctPrincipal(t *testing.T) {
+	tn := &Tenant{Name: "test", DB: newTestDB(t, &RotationApproval{})}
+
+	// alice 用自己创建的令牌提交申请，令牌名称伪装成 bob
+	approval, created, err := requestRotationApproval(tn, "v2_server_vless", 1, "token:bob", "user:alice", "", "")
+	if err != nil || !created {
+		t.Fatalf("提交审批失败: created=%v, err=%v", created, err)
+	}
+	if _, err := decideRotationApproval(tn, int(approval.ID), false, "user:alice", "user:alice", ""); err == nil {
+		t.Fatal("令牌创建者不应能审批自己通过令牌提交的申请")
+	}
+	if _, err := decideRotationApproval(tn, int(approval.ID), false, "token:other", "", ""); err == nil {
+		t.Fatal("身份未知的审批人不应能审批")
+	}
+	decided, err := decideRotationApproval(tn, int(approval.ID), false, "user:bob", "user:bob", "")
+	if err != nil {
+		t.Fatalf("另一位用户应能审批: %v", err)
+	}
+	if decided.Status != approvalRejected || decided.DecidedPrincipal != "user:bob" {
+		t.Fatalf("审批结果错误: 状态=%s, 审批人=%s", decided.Status, decided.DecidedPrincipal)
+	}
+
+	// 未保存申请人身份的旧记录按操作员名称判断
+	legacy := RotationApproval{ServerTable: "v2_server_vless", ServerID: 2, Status: approvalPending, RequestedBy: "user:alice", ExpiresAt: 1 << 40}
+	tn.DB.Create(&legacy)
+	if _, err := decideRotationApproval(tn, int(legacy.ID), false, "user:alice", "user:alice", ""); err == nil {
+		t.Fatal("旧记录的申请人不应能审批自己的申请")
+	}
+}
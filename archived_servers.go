@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 已下线服务器的档案：面板行被隐藏或删除后，其域名及轮换历史仍按档案查询，
+// 并可将剩余域名重新分配给在用的服务器，而不是留下无主的记录
+
+// 重新分配时指定的域名不属于该服务器
+var errDomainNotOwned = errors.New("部分域名不属于该服务器")
+
+// ArchivedServer 服务器下线档案，每台服务器一条
+type ArchivedServer struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ServerTable string `gorm:"column:server_table;type:varchar(255);uniqueIndex:idx_archived_server;not null" json:"server_table"`
+	ServerID    int    `gorm:"column:server_id;uniqueIndex:idx_archived_server;not null" json:"server_id"`
+	Host        string `gorm:"column:host;type:varchar(255);default:''" json:"host"` // 下线时的主机
+	Port        int    `gorm:"column:port;default:0" json:"port"`
+	Mode        string `gorm:"column:mode;type:varchar(16);default:''" json:"mode"` // hide 或 delete，见 archiveMode* 常量
+	Operator    string `gorm:"column:operator;type:varchar(255);default:''" json:"operator"`
+	ArchivedAt  int64  `gorm:"column:archived_at;index" json:"archived_at"`
+}
+
+// ArchivedServerView 档案列表项，附带仍归属该服务器的域名及轮换历史统计
+type ArchivedServerView struct {
+	ArchivedServer
+	DomainTotal   int64 `json:"domain_total"`
+	DomainRetired int64 `json:"domain_retired"`
+	HistoryCount  int64 `json:"history_count"`
+}
+
+// 保存下线档案，同一服务器再次下线时覆盖旧档案
+func saveArchivedServer(tx *gorm.DB, record ArchivedServer) error {
+	if err := tx.Where("server_table = ? AND server_id = ?", record.ServerTable, record.ServerID).Delete(&ArchivedServer{}).Error; err != nil {
+		return err
+	}
+	return tx.Create(&record).Error
+}
+
+// 由轮换历史中的归档记录补全缺失的档案（本功能上线前下线的服务器），面板行已不存在的记为 delete
+func backfillArchivedServers(t *Tenant) {
+	var histories []RotationHistory
+	if err := t.DB.Where("status = ?", rotationArchived).Order("created_at DESC").Find(&histories).Error; err != nil {
+		log.Printf("补全下线档案失败: 租户=%s, 错误=%v", t.Name, err)
+		return
+	}
+	created := 0
+	for _, h := range histories {
+		var count int64
+		t.DB.Model(&ArchivedServer{}).Where("server_table = ? AND server_id = ? AND archived_at >= ?", h.ServerTable, h.ServerID, h.CreatedAt).Count(&count)
+		if count > 0 {
+			continue
+		}
+		mode := archiveModeHide
+		if !isValidServerTable(h.ServerTable) {
+			mode = archiveModeDelete
+		} else if exists, err := serverExists(t, h.ServerTable, h.ServerID); err != nil || !exists {
+			mode = archiveModeDelete
+		}
+		record := ArchivedServer{ServerTable: h.ServerTable, ServerID: h.ServerID, Host: h.OldHost, Port: h.OldPort, Mode: mode, Operator: h.Actor, ArchivedAt: h.CreatedAt}
+		if err := saveArchivedServer(t.DB, record); err != nil {
+			log.Printf("补全下线档案失败: 租户=%s, 表=%s, ID=%d, 错误=%v", t.Name, h.ServerTable, h.ServerID, err)
+			continue
+		}
+		created++
+	}
+	if created > 0 {
+		log.Printf("已由轮换历史补全 %d 条下线档案: 租户=%s", created, t.Name)
+	}
+}
+
+// 有下线档案的服务器，键为 表名:ID（包含面板行已删除的服务器）
+func archivedServerRecords(tdb *gorm.DB) map[string]bool {
+	var records []ArchivedServer
+	if err := tdb.Select("server_table, server_id").Find(&records).Error; err != nil {
+		log.Printf("获取下线档案失败: %v", err)
+	}
+	archived := make(map[string]bool, len(records))
+	for _, r := range records {
+		archived[r.ServerTable+":"+strconv.Itoa(r.ServerID)] = true
+	}
+	return archived
+}
+
+// 读取服务器的下线档案，不存在时返回 gorm.ErrRecordNotFound
+func loadArchivedServer(tdb *gorm.DB, table string, id int) (ArchivedServer, error) {
+	var record ArchivedServer
+	err := tdb.Where("server_table = ? AND server_id = ?", table, id).First(&record).Error
+	return record, err
+}
+
+// 将域名移交给目标服务器，排在目标现有域名之后；updates 为额外更新的字段（如恢复退役）
+func moveDomainToServer(tx *gorm.DB, d ServerDomain, targetTable string, targetID int, updates map[string]interface{}) error {
+	var maxOrder int
+	tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", targetTable, targetID).Select("MAX(`order`)").Scan(&maxOrder)
+	fields := map[string]interface{}{
+		"server_table":     targetTable,
+		"server_id":        targetID,
+		"in_use":           0,
+		"order":            maxOrder + 1,
+		"staged_until":     0,
+		"dns_status":       "",
+		"dns_detail":       "",
+		"dns_checked_time": 0,
+	}
+	for k, v := range updates {
+		fields[k] = v
+	}
+	return tx.Model(&ServerDomain{}).Where("id = ?", d.ID).Updates(fields).Error
+}
+
+// ReassignResult 档案域名重新分配结果
+type ReassignResult struct {
+	Moved    int      `json:"moved"`
+	Restored int      `json:"restored"`          // 因服务器下线而退役、随移交恢复的域名数
+	Skipped  []string `json:"skipped,omitempty"` // 目标服务器已有而未移交的域名
+}
+
+// 将已下线服务器的域名重新分配给在用的服务器：domainIDs 为空时移交全部域名，
+// restore 为 true 时恢复因服务器下线而退役的域名，其他原因退役的域名保持退役；目标已有的域名跳过
+func reassignArchivedDomains(t *Tenant, table string, id int, domainIDs []int, targetTable string, targetID int, restore bool) (ReassignResult, error) {
+	result := ReassignResult{}
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		q := tx.Where("server_table = ? AND server_id = ?", table, id).Order("`order`")
+		if len(domainIDs) > 0 {
+			q = q.Where("id IN ?", domainIDs)
+		}
+		var domains []ServerDomain
+		if err := q.Find(&domains).Error; err != nil {
+			return err
+		}
+		if len(domainIDs) > 0 && len(domains) != len(domainIDs) {
+			return errDomainNotOwned
+		}
+		for _, d := range domains {
+			var count int64
+			tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND domain = ?", targetTable, targetID, d.Domain).Count(&count)
+			if count > 0 {
+				result.Skipped = append(result.Skipped, d.Domain)
+				continue
+			}
+			var updates map[string]interface{}
+			if restore && d.Retired == 1 && d.RetiredReason == archiveRetiredReason {
+				updates = map[string]interface{}{"retired": 0, "retired_time": 0, "retired_reason": ""}
+				result.Restored++
+			}
+			if err := moveDomainToServer(tx, d, targetTable, targetID, updates); err != nil {
+				return err
+			}
+			result.Moved++
+		}
+		return nil
+	})
+	return result, err
+}
+
+// 解析逗号分隔的 ID 列表
+func parseIDList(raw string) ([]int, error) {
+	var ids []int
+	for _, f := range strings.Split(raw, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		id, err := strconv.Atoi(f)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("无效的ID：%s", f)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// 由路径参数读取已下线服务器的档案，失败时写入错误响应并返回 false
+func archivedServerParam(c *gin.Context) (ArchivedServer, bool) {
+	table := serverParam(c, "table")
+	if !isValidServerTable(table) {
+		respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+		return ArchivedServer{}, false
+	}
+	id, err := strconv.Atoi(serverParam(c, "id"))
+	if err != nil || id <= 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "无效的服务器ID")
+		return ArchivedServer{}, false
+	}
+	record, err := loadArchivedServer(currentTenant(c).DB, table, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, codeNotFound, "服务器未下线归档")
+			return ArchivedServer{}, false
+		}
+		log.Printf("获取下线档案失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "获取下线档案失败："+err.Error())
+		return ArchivedServer{}, false
+	}
+	return record, true
+}
+
+// 注册已下线服务器档案路由
+func registerArchivedServerRoutes(r *gin.Engine) {
+	// 列出已下线的服务器及仍归属其的域名、轮换历史数量，可按 table 过滤
+	r.GET("/api/v1/archived-servers", authMiddleware, httpCacheMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		q := readDB(t).Scopes(serverAccessScope(c)).Order("archived_at DESC, id DESC")
+		if table := c.Query("table"); table != "" {
+			if !isValidServerTable(table) {
+				respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+				return
+			}
+			q = q.Where("server_table = ?", table)
+		}
+		var records []ArchivedServer
+		if err := q.Find(&records).Error; err != nil {
+			log.Printf("获取下线档案失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取下线档案失败："+err.Error())
+			return
+		}
+		views := make([]ArchivedServerView, 0, len(records))
+		for _, record := range records {
+			view := ArchivedServerView{ArchivedServer: record}
+			owned := readDB(t).Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", record.ServerTable, record.ServerID)
+			owned.Session(&gorm.Session{}).Count(&view.DomainTotal)
+			owned.Session(&gorm.Session{}).Where("retired = ?", 1).Count(&view.DomainRetired)
+			readDB(t).Model(&RotationHistory{}).Where("server_table = ? AND server_id = ?", record.ServerTable, record.ServerID).Count(&view.HistoryCount)
+			views = append(views, view)
+		}
+		c.JSON(http.StatusOK, gin.H{"servers": views, "total": len(views)})
+	})
+
+	// 已下线服务器的详情：档案、仍归属其的域名及最近的轮换历史（limit 默认 100，最多 1000）
+	r.GET("/api/v1/archived-servers/:table/:id", authMiddleware, httpCacheMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		record, ok := archivedServerParam(c)
+		if !ok {
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 limit（1-1000）")
+			return
+		}
+		var domains []ServerDomain
+		if err := t.DB.Where("server_table = ? AND server_id = ?", record.ServerTable, record.ServerID).Order("`order`").Find(&domains).Error; err != nil {
+			log.Printf("获取已下线服务器的域名失败: 表=%s, ID=%d, 错误=%v", record.ServerTable, record.ServerID, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取域名失败："+err.Error())
+			return
+		}
+		var history []RotationHistory
+		if err := t.DB.Where("server_table = ? AND server_id = ?", record.ServerTable, record.ServerID).Order("created_at DESC, id DESC").Limit(limit).Find(&history).Error; err != nil {
+			log.Printf("获取已下线服务器的轮换历史失败: 表=%s, ID=%d, 错误=%v", record.ServerTable, record.ServerID, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取轮换历史失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"server": record, "domains": domains, "history": history})
+	})
+
+	// 将已下线服务器的域名重新分配给 target_table/target_id 指定的在用服务器：
+	// domain_ids 为逗号分隔的域名 ID，为空时移交全部；restore_retired=0 时不恢复因服务器下线而退役的域名
+	r.POST("/api/v1/archived-servers/:table/:id/reassign", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		record, ok := archivedServerParam(c)
+		if !ok {
+			return
+		}
+		targetTable := serverParam(c, "target_table")
+		if !isValidServerTable(targetTable) {
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的目标表名")
+			return
+		}
+		targetID, err := strconv.Atoi(serverParam(c, "target_id"))
+		if err != nil || targetID <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的目标服务器ID")
+			return
+		}
+		if exists, err := serverExists(t, targetTable, targetID); err != nil || !exists {
+			respondError(c, http.StatusNotFound, codeNotFound, "目标服务器不存在")
+			return
+		}
+		if archivedServers(t.DB)[targetTable+":"+strconv.Itoa(targetID)] {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "目标服务器已下线归档")
+			return
+		}
+		domainIDs, err := parseIDList(c.PostForm("domain_ids"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的域名ID列表："+err.Error())
+			return
+		}
+		restore := c.DefaultPostForm("restore_retired", "1") != "0"
+
+		result, err := reassignArchivedDomains(t, record.ServerTable, record.ServerID, domainIDs, targetTable, targetID, restore)
+		if err != nil {
+			if errors.Is(err, errDomainNotOwned) {
+				respondError(c, http.StatusBadRequest, codeDomainNotFound, err.Error())
+				return
+			}
+			log.Printf("重新分配域名失败: 租户=%s, 表=%s, ID=%d, 错误=%v", t.Name, record.ServerTable, record.ServerID, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "重新分配域名失败："+err.Error())
+			return
+		}
+		detail := fmt.Sprintf("目标=%s:%d, 移交=%d, 恢复=%d, 跳过=%d", targetTable, targetID, result.Moved, result.Restored, len(result.Skipped))
+		recordAudit(t.DB, "reassign_archived_domains", fmt.Sprintf("%s:%d", record.ServerTable, record.ServerID), operatorName(c), c.ClientIP(), detail)
+		log.Printf("已下线服务器的域名已重新分配: 租户=%s, 表=%s, ID=%d, %s", t.Name, record.ServerTable, record.ServerID, detail)
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("已移交 %d 个域名", result.Moved), "result": result})
+	})
+}
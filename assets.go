@@ -0,0 +1,72 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// 页面模板及静态文件编入二进制，单文件部署时无需随附 templates、static 目录；
+// 配置 server.assetsDir 后改为从该目录读取（修改模板无需重新编译）
+
+//go:embed templates static
+var embeddedAssets embed.FS
+
+// 资源文件系统：server.assetsDir 下需包含 templates/ 及 static/，未配置时使用编入的资源
+func assetsFS() fs.FS {
+	if dir := viper.GetString("server.assetsDir"); dir != "" {
+		return os.DirFS(dir)
+	}
+	return embeddedAssets
+}
+
+// 校验资源目录，缺少 templates 或 static 时退出，避免启动后页面才报错
+func checkAssetsDir() {
+	dir := viper.GetString("server.assetsDir")
+	if dir == "" {
+		log.Println("使用编入二进制的模板及静态文件")
+		return
+	}
+	for _, sub := range []string{"templates", "static"} {
+		if info, err := fs.Stat(assetsFS(), sub); err != nil || !info.IsDir() {
+			log.Fatalf("资源目录 %s 下缺少 %s 目录（server.assetsDir）", dir, sub)
+		}
+	}
+	log.Printf("从资源目录 %s 读取模板及静态文件", dir)
+}
+
+// 解析 templates 下的页面模板
+func parseTemplates(funcMap template.FuncMap) (*template.Template, error) {
+	return template.New("").Funcs(funcMap).ParseFS(assetsFS(), "templates/*")
+}
+
+// 静态文件目录，不列出目录内容（与 gin.Static 一致）
+func staticFS() http.FileSystem {
+	sub, err := fs.Sub(assetsFS(), "static")
+	if err != nil {
+		log.Fatalf("读取静态文件目录失败: %v", err)
+	}
+	return noListingFS{http.FS(sub)}
+}
+
+// 访问目录时返回不存在
+type noListingFS struct {
+	http.FileSystem
+}
+
+func (f noListingFS) Open(name string) (http.File, error) {
+	file, err := f.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
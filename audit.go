@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AuditLog 结构体，手动干预类操作（如强制释放域名）的审计记录
+type AuditLog struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	Action    string `gorm:"column:action;type:varchar(64);index;not null" json:"action"`
+	Target    string `gorm:"column:target;type:varchar(255);default:''" json:"target"`
+	Operator  string `gorm:"column:operator;type:varchar(255);not null" json:"operator"`
+	IP        string `gorm:"column:ip;type:varchar(64);default:''" json:"ip"`
+	Detail    string `gorm:"column:detail;type:varchar(1024);default:''" json:"detail"`
+	CreatedAt int64  `gorm:"column:created_at;index;not null" json:"created_at"`
+}
+
+// 写入审计记录，失败只记日志
+func recordAudit(tdb *gorm.DB, action, target, operator, ip, detail string) {
+	entry := AuditLog{Action: action, Target: target, Operator: operator, IP: ip, Detail: truncate(detail, 1024), CreatedAt: time.Now().Unix()}
+	if err := tdb.Create(&entry).Error; err != nil {
+		log.Printf("写入审计记录失败: 操作=%s, 对象=%s, 错误=%v", action, target, err)
+	}
+}
+
+// 注册审计记录路由
+func registerAuditRoutes(r *gin.Engine) {
+	// 列出最近的审计记录，可按 action 过滤
+	r.GET("/audit-logs", authMiddleware, func(c *gin.Context) {
+		q := currentTenant(c).DB.Order("id DESC").Limit(200)
+		if action := c.Query("action"); action != "" {
+			q = q.Where("action = ?", action)
+		}
+		var logs []AuditLog
+		if err := q.Find(&logs).Error; err != nil {
+			log.Printf("获取审计记录失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取审计记录失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"logs": logs})
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ser_manger/internal/handlers"
+)
+
+// sessionAuthenticator 按用户表校验密码，登录状态保存在会话及记住登录令牌中
+type sessionAuthenticator struct{}
+
+func (sessionAuthenticator) CheckPassword(username, password string) bool {
+	_, ok := checkUserPassword(username, password)
+	return ok
+}
+
+func (sessionAuthenticator) StartSession(c *gin.Context, username string) error {
+	return startSession(c, username)
+}
+
+func (sessionAuthenticator) Remember(c *gin.Context, username string) error {
+	return issueRememberToken(c, username)
+}
+
+func (sessionAuthenticator) EndSession(c *gin.Context) {
+	revokeRememberToken(c)
+	endSession(c)
+}
+
+// 注册登录、登出路由
+func registerAuthRoutes(r *gin.Engine) {
+	h := handlers.NewAuthHandler(sessionAuthenticator{}, redirectTo, handlers.AuthSettings{
+		LoginTemplate: "login.html",
+		LoginPath:     "/login",
+		HomePath:      "/servers",
+	})
+	r.GET("/", h.Root)
+	r.GET("/login", h.LoginPage)
+	r.POST("/login", h.Login)
+	r.GET("/logout", h.Logout)
+}
+
+// 认证中间件，支持会话登录或 Authorization: Bearer API 令牌；认证通过后处理 Idempotency-Key。
+// 会话登录时读取用户（已停用或删除的用户会话立即失效），操作员不能访问仅管理员可用的路由。
+// 各认证方式把服务器组限制（令牌的 servers、用户的 servers、OIDC 服务器组声明）写入 server_access，统一在此校验
+func authMiddleware(c *gin.Context) {
+	if token := bearerToken(c); token != "" {
+		// 开启 OIDC 时 JWT 格式的令牌按 IdP 签发的访问令牌校验，其余按静态 API 令牌校验
+		authenticate := authenticateToken
+		if oidcEnabled() && isJWT(token) {
+			authenticate = authenticateOIDCToken
+		}
+		if authenticate(c, token) && checkServerAccess(c, requestServerAccess(c), operatorName(c)) {
+			idempotentNext(c)
+		}
+		return
+	}
+	username := sessionUser(c)
+	if username == "" {
+		username = resumeFromRememberToken(c)
+	}
+	user, err := loadUser(username)
+	if username == "" || err != nil {
+		if username != "" {
+			endSession(c)
+		}
+		redirectTo(c, "/login")
+		c.Abort()
+		return
+	}
+	if user.Role != roleAdmin && adminOnlyRoute(c) {
+		log.Printf("操作员访问仅管理员可用的路由: 用户=%s, 路径=%s %s", user.Username, c.Request.Method, c.FullPath())
+		respondError(c, http.StatusForbidden, codeForbidden, "仅管理员可执行该操作")
+		return
+	}
+	c.Set("user", user)
+	c.Set("principal", "user:"+user.Username)
+	if access := newServerAccess(user.Servers); access != nil {
+		c.Set("server_access", access)
+	}
+	if !checkServerAccess(c, requestServerAccess(c), "user:"+user.Username) {
+		return
+	}
+	idempotentNext(c)
+}
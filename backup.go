@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 备份文件名：backup-<租户>-<时间>.json.gz，时间按 UTC
+var backupNamePattern = regexp.MustCompile(`^backup-[A-Za-z0-9_-]+-\d{8}-\d{6}\.json\.gz$`)
+
+const backupTimeLayout = "20060102-150405"
+
+// BackupObject 已保存的备份
+type BackupObject struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// BackupStore 备份存储，新增存储类型只需实现此接口并在 newBackupStore 中注册
+type BackupStore interface {
+	Name() string
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	List(ctx context.Context, prefix string) ([]BackupObject, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// 根据 backup.storage 创建备份存储：local（默认，保存到 backup.dir）或 s3（[backup.s3]，兼容 S3 的对象存储）
+func newBackupStore() (BackupStore, error) {
+	switch storage := viper.GetString("backup.storage"); storage {
+	case "", "local":
+		dir := viper.GetString("backup.dir")
+		if dir == "" {
+			dir = "backups"
+		}
+		return &localBackupStore{dir: dir}, nil
+	case "s3":
+		cfg := viper.Sub("backup.s3")
+		if cfg == nil {
+			return nil, errors.New("未配置 [backup.s3]")
+		}
+		store := &s3BackupStore{
+			endpoint:  strings.TrimRight(cfg.GetString("endpoint"), "/"),
+			region:    cfg.GetString("region"),
+			bucket:    cfg.GetString("bucket"),
+			prefix:    strings.Trim(cfg.GetString("prefix"), "/"),
+			accessKey: cfg.GetString("accessKey"),
+			secretKey: cfg.GetString("secretKey"),
+			pathStyle: cfg.GetBool("pathStyle"),
+			client:    &http.Client{Timeout: 60 * time.Second},
+		}
+		if store.endpoint == "" || store.bucket == "" || store.accessKey == "" || store.secretKey == "" {
+			return nil, errors.New("[backup.s3] 缺少 endpoint、bucket、accessKey 或 secretKey")
+		}
+		if store.region == "" {
+			store.region = "us-east-1"
+		}
+		if store.prefix != "" {
+			store.prefix += "/"
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("不支持的备份存储类型: %s", storage)
+	}
+}
+
+// 本地目录存储
+type localBackupStore struct {
+	dir string
+}
+
+func (s *localBackupStore) Name() string { return "local:" + s.dir }
+
+func (s *localBackupStore) Put(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	// 先写临时文件再改名，避免中断时留下不完整的备份
+	tmp := filepath.Join(s.dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, name))
+}
+
+func (s *localBackupStore) Get(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, name))
+}
+
+func (s *localBackupStore) List(ctx context.Context, prefix string) ([]BackupObject, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var objects []BackupObject
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), prefix) || !backupNamePattern.MatchString(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, BackupObject{Name: e.Name(), Size: info.Size(), CreatedAt: backupCreatedAt(e.Name(), info.ModTime())})
+	}
+	return objects, nil
+}
+
+func (s *localBackupStore) Delete(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+// 兼容 S3 的对象存储（AWS S3、MinIO、R2、OSS 等），使用 AWS Signature V4 签名
+type s3BackupStore struct {
+	endpoint  string
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	pathStyle bool // MinIO 等不支持虚拟主机风格时开启
+	client    *http.Client
+}
+
+func (s *s3BackupStore) Name() string { return "s3:" + s.bucket + "/" + s.prefix }
+
+// 对象 URL：路径风格为 endpoint/bucket/key，否则为 bucket.endpoint/key
+func (s *s3BackupStore) objectURL(key string, query url.Values) (*url.URL, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	return u, nil
+}
+
+// S3 路径编码：各段按 URI 规则转义，/ 保留
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(seg), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// 使用 AWS Signature V4 为请求签名（签名头为 host、x-amz-content-sha256、x-amz-date）
+func (s *s3BackupStore) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := now.UTC().Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+	signingKey := hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256([]byte("AWS4"+s.secretKey), date), s.region), "s3"), "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// 发送签名请求，返回响应体；非 2xx 时返回错误
+func (s *s3BackupStore) call(ctx context.Context, method, key string, query url.Values, body []byte) ([]byte, error) {
+	u, err := s.objectURL(key, query)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/gzip")
+	}
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("对象存储返回错误（状态码 %d）: %s", resp.StatusCode, truncate(string(data), 200))
+	}
+	return data, nil
+}
+
+func (s *s3BackupStore) Put(ctx context.Context, name string, data []byte) error {
+	_, err := s.call(ctx, http.MethodPut, s.prefix+name, nil, data)
+	return err
+}
+
+func (s *s3BackupStore) Get(ctx context.Context, name string) ([]byte, error) {
+	return s.call(ctx, http.MethodGet, s.prefix+name, nil, nil)
+}
+
+func (s *s3BackupStore) List(ctx context.Context, prefix string) ([]BackupObject, error) {
+	var objects []BackupObject
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		data, err := s.call(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("解析对象列表失败: %v", err)
+		}
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, s.prefix)
+			if backupNamePattern.MatchString(name) {
+				objects = append(objects, BackupObject{Name: name, Size: c.Size, CreatedAt: backupCreatedAt(name, c.LastModified)})
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *s3BackupStore) Delete(ctx context.Context, name string) error {
+	_, err := s.call(ctx, http.MethodDelete, s.prefix+name, nil, nil)
+	return err
+}
+
+// 租户备份文件名前缀
+func backupPrefix(t *Tenant) string {
+	return "backup-" + t.Name + "-"
+}
+
+// 是否为租户的备份；租户名可含 -，需排除前缀相同的其他租户（如 a 与 a-b）
+func isTenantBackup(t *Tenant, name string) bool {
+	return backupNamePattern.MatchString(name) && strings.HasPrefix(name, backupPrefix(t)) &&
+		len(name) == len(backupPrefix(t))+len(backupTimeLayout)+len(".json.gz")
+}
+
+// 从文件名解析备份时间，解析失败时使用存储的修改时间
+func backupCreatedAt(name string, modTime time.Time) int64 {
+	if len(name) > len(backupTimeLayout)+len(".json.gz") {
+		stamp := strings.TrimSuffix(name, ".json.gz")
+		if ts, err := time.Parse(backupTimeLayout, stamp[len(stamp)-len(backupTimeLayout):]); err == nil {
+			return ts.Unix()
+		}
+	}
+	return modTime.Unix()
+}
+
+// 列出租户的备份，最新的在前
+func listTenantBackups(ctx context.Context, store BackupStore, t *Tenant) ([]BackupObject, error) {
+	objects, err := store.List(ctx, backupPrefix(t))
+	if err != nil {
+		return nil, err
+	}
+	backups := []BackupObject{}
+	for _, obj := range objects {
+		if isTenantBackup(t, obj.Name) {
+			backups = append(backups, obj)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt > backups[j].CreatedAt })
+	return backups, nil
+}
+
+// 导出租户管理表并以 gzip 压缩的 JSON 保存到备份存储，返回备份文件名
+func writeBackup(ctx context.Context, store BackupStore, t *Tenant, now time.Time) (string, error) {
+	backup, err := buildBackup(t)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(backup); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	name := backupPrefix(t) + now.UTC().Format(backupTimeLayout) + ".json.gz"
+	if err := store.Put(ctx, name, buf.Bytes()); err != nil {
+		return "", fmt.Errorf("保存备份 %s 失败: %v", name, err)
+	}
+	log.Printf("备份已保存: 租户=%s, 存储=%s, 文件=%s, 大小=%s", t.Name, store.Name(), name, formatBytes(int64(buf.Len())))
+	return name, nil
+}
+
+// 按保留策略清理租户的旧备份：保留最近 backup.keep 份（0 表示不限），并删除超过 backup.retentionDays 天的备份，
+// 最新的一份始终保留；返回删除的数量
+func pruneBackups(ctx context.Context, store BackupStore, t *Tenant, now time.Time) (int, error) {
+	keep := viper.GetInt("backup.keep")
+	days := viper.GetInt("backup.retentionDays")
+	if keep <= 0 && days <= 0 {
+		return 0, nil
+	}
+	objects, err := listTenantBackups(ctx, store, t)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for i, obj := range objects {
+		if i == 0 {
+			continue
+		}
+		expired := days > 0 && obj.CreatedAt < now.Unix()-int64(days)*86400
+		if (keep > 0 && i >= keep) || expired {
+			if err := store.Delete(ctx, obj.Name); err != nil {
+				log.Printf("删除过期备份失败: 存储=%s, 文件=%s, 错误=%v", store.Name(), obj.Name, err)
+				continue
+			}
+			log.Printf("已删除过期备份: 租户=%s, 存储=%s, 文件=%s", t.Name, store.Name(), obj.Name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// 备份单个租户并清理旧备份
+func backupTenant(ctx context.Context, store BackupStore, t *Tenant) (string, error) {
+	now := time.Now()
+	name, err := writeBackup(ctx, store, t, now)
+	if err != nil {
+		return "", err
+	}
+	if _, err := pruneBackups(ctx, store, t, now); err != nil {
+		log.Printf("清理旧备份失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+	return name, nil
+}
+
+// 定时备份任务（backup.cron）：依次备份所有租户
+func runScheduledBackups() {
+	store, err := newBackupStore()
+	if err != nil {
+		log.Printf("定时备份失败: %v", err)
+		return
+	}
+	for _, t := range tenantList() {
+		if _, err := backupTenant(context.Background(), store, t); err != nil {
+			log.Printf("定时备份失败: 租户=%s, 错误=%v", t.Name, err)
+		}
+	}
+}
+
+// 注册备份路由
+func registerBackupRoutes(r *gin.Engine) {
+	// 立即导出当前租户的备份（JSON 下载，与 backup 子命令输出相同）
+	r.GET("/backup", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		backup, err := buildBackup(t)
+		if err != nil {
+			log.Printf("导出备份失败: 租户=%s, 错误=%v", t.Name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "导出备份失败："+err.Error())
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="backup-%s-%s.json"`, t.Name, time.Now().UTC().Format(backupTimeLayout)))
+		c.JSON(http.StatusOK, backup)
+	})
+
+	// 列出备份存储中当前租户的备份
+	r.GET("/backups", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		store, err := newBackupStore()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "备份存储配置无效："+err.Error())
+			return
+		}
+		objects, err := listTenantBackups(c.Request.Context(), store, t)
+		if err != nil {
+			log.Printf("获取备份列表失败: 存储=%s, 错误=%v", store.Name(), err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取备份列表失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"storage": store.Name(), "backups": objects, "total": len(objects)})
+	})
+
+	// 立即备份当前租户到备份存储，并按保留策略清理旧备份
+	r.POST("/backups", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		store, err := newBackupStore()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "备份存储配置无效："+err.Error())
+			return
+		}
+		name, err := backupTenant(c.Request.Context(), store, t)
+		if err != nil {
+			log.Printf("备份失败: 租户=%s, 错误=%v", t.Name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "备份失败："+err.Error())
+			return
+		}
+		recordAudit(t.DB, "backup", name, operatorName(c), c.ClientIP(), "存储="+store.Name())
+		c.JSON(http.StatusOK, gin.H{"message": "备份已保存", "name": name, "storage": store.Name()})
+	})
+
+	// 下载已保存的备份（gzip 压缩的 JSON）
+	r.GET("/backups/:name", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		name := c.Param("name")
+		if !isTenantBackup(t, name) {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的备份文件名")
+			return
+		}
+		store, err := newBackupStore()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "备份存储配置无效："+err.Error())
+			return
+		}
+		data, err := store.Get(c.Request.Context(), name)
+		if err != nil {
+			log.Printf("读取备份失败: 存储=%s, 文件=%s, 错误=%v", store.Name(), name, err)
+			respondError(c, http.StatusNotFound, codeNotFound, "读取备份失败："+err.Error())
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+		c.Data(http.StatusOK, "application/gzip", data)
+	})
+}
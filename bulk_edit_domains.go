@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 单次批量编辑最多涉及的域名数
+const maxBulkEditDomains = 5000
+
+// DomainBulkEdit 批量编辑请求：ids 与 filter 至少指定一个（同时指定时取交集），
+// 其余字段只更新请求中出现的；tags 整体替换标签，add_tags、remove_tags 在此基础上增删
+type DomainBulkEdit struct {
+	IDs        []uint  `json:"ids"`
+	Filter     string  `json:"filter"`
+	Tags       *string `json:"tags"`
+	AddTags    *string `json:"add_tags"`
+	RemoveTags *string `json:"remove_tags"`
+	Note       *string `json:"note"`
+	CDN        *int8   `json:"cdn"`
+	Protected  *int8   `json:"protected"`
+	Cooldown   *int    `json:"cooldown_minutes"`
+}
+
+// BulkEditItem 单个域名的批量编辑结果
+type BulkEditItem struct {
+	ID          uint              `json:"id"`
+	Domain      string            `json:"domain,omitempty"`
+	ServerTable string            `json:"server_table,omitempty"`
+	ServerID    int               `json:"server_id,omitempty"`
+	Status      string            `json:"status"` // updated、unchanged、invalid 或 not_found
+	Changes     []string          `json:"changes,omitempty"`
+	Errors      map[string]string `json:"errors,omitempty"`
+}
+
+// 批量编辑结果状态
+const (
+	bulkItemUpdated   = "updated"
+	bulkItemUnchanged = "unchanged"
+	bulkItemInvalid   = "invalid"
+	bulkItemNotFound  = "not_found"
+)
+
+// domainFilter 解析后的域名筛选条件
+type domainFilter struct {
+	scopes []func(*gorm.DB) *gorm.DB
+	tags   []string
+	states []string
+}
+
+// 解析筛选表达式：空格分隔的 key:value 条件，全部满足才匹配。支持
+// table:<表名>、server:<表名>:<ID>、domain:<子串>、tag:<标签>、state:<available|in_use|retired|staged|alias>、
+// cdn:<0|1>、protected:<0|1>、registrar:<注册商>
+func parseDomainFilter(expr string) (domainFilter, error) {
+	var f domainFilter
+	for _, term := range strings.Fields(expr) {
+		key, value, ok := strings.Cut(term, ":")
+		if !ok || value == "" {
+			return f, fmt.Errorf("无效的条件：%s，应为 key:value", term)
+		}
+		switch key {
+		case "table":
+			if !isValidServerTable(value) {
+				return f, fmt.Errorf("无效的表名：%s", value)
+			}
+			f.scopes = append(f.scopes, func(q *gorm.DB) *gorm.DB { return q.Where("server_table = ?", value) })
+		case "server":
+			table, idStr, _ := strings.Cut(value, ":")
+			id, err := strconv.Atoi(idStr)
+			if !isValidServerTable(table) || err != nil || id <= 0 {
+				return f, fmt.Errorf("无效的服务器：%s，应为 <表名>:<ID>", value)
+			}
+			f.scopes = append(f.scopes, serverDomainScope(table, id))
+		case "domain":
+			pattern := "%" + escapeLike(strings.ToLower(value)) + "%"
+			f.scopes = append(f.scopes, func(q *gorm.DB) *gorm.DB { return q.Where("LOWER(domain) LIKE ? ESCAPE '!'", pattern) })
+		case "tag":
+			f.tags = append(f.tags, strings.ToLower(value))
+		case "state":
+			switch value {
+			case domainStateAvailable, domainStateInUse, domainStateRetired, domainStateStaged, domainStateAlias:
+				f.states = append(f.states, value)
+			default:
+				return f, fmt.Errorf("无效的状态：%s", value)
+			}
+		case "cdn", "protected":
+			if value != "0" && value != "1" {
+				return f, fmt.Errorf("%s 的可选值: 0, 1", key)
+			}
+			column := key
+			f.scopes = append(f.scopes, func(q *gorm.DB) *gorm.DB { return q.Where(column+" = ?", value) })
+		case "registrar":
+			f.scopes = append(f.scopes, func(q *gorm.DB) *gorm.DB { return q.Where("registrar = ?", value) })
+		default:
+			return f, fmt.Errorf("未知的条件：%s", key)
+		}
+	}
+	return f, nil
+}
+
+// 标签及状态条件在查询后按记录判断
+func (f domainFilter) matches(d ServerDomain, now int64) bool {
+	for _, tag := range f.tags {
+		if !domainHasTag(d, tag) {
+			return false
+		}
+	}
+	for _, state := range f.states {
+		if domainState(d, now) != state {
+			return false
+		}
+	}
+	return true
+}
+
+// 按批量编辑请求计算单个域名的部分更新：标签先整体替换再增删，结果与原标签相同时不更新
+func (b DomainBulkEdit) patchFor(d ServerDomain) DomainPatch {
+	patch := DomainPatch{Note: b.Note, CDN: b.CDN, Protected: b.Protected, Cooldown: b.Cooldown}
+	if b.Tags == nil && b.AddTags == nil && b.RemoveTags == nil {
+		return patch
+	}
+	tags := d.Tags
+	if b.Tags != nil {
+		tags = *b.Tags
+	}
+	if b.AddTags != nil {
+		tags += "," + *b.AddTags
+	}
+	tags = normalizeTags(tags)
+	if b.RemoveTags != nil {
+		remove := map[string]bool{}
+		for _, tag := range strings.Split(normalizeTags(*b.RemoveTags), ",") {
+			remove[tag] = true
+		}
+		var kept []string
+		for _, tag := range strings.Split(tags, ",") {
+			if tag != "" && !remove[tag] {
+				kept = append(kept, tag)
+			}
+		}
+		tags = strings.Join(kept, ",")
+	}
+	if tags != d.Tags {
+		patch.Tags = &tags
+	}
+	return patch
+}
+
+// 与原值不同的字段
+func changedFields(d ServerDomain, updates map[string]interface{}) []string {
+	current := map[string]interface{}{
+		"tags":             d.Tags,
+		"note":             d.Note,
+		"cdn":              d.CDN,
+		"protected":        d.Protected,
+		"cooldown_minutes": d.Cooldown,
+	}
+	var changed []string
+	for field, value := range updates {
+		if fmt.Sprint(current[field]) != fmt.Sprint(value) {
+			changed = append(changed, field)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// 注册域名批量编辑路由
+func registerBulkEditDomainRoutes(r *gin.Engine) {
+	// 批量设置域名的标签、备注、CDN 标记、删除保护及冷却时间：请求体为 JSON，在同一事务中更新，
+	// 任一域名不存在或校验失败时不做任何修改；results 中返回每个域名的结果。需确认令牌 bulk-edit-domains（请求头提交）
+	r.POST("/bulk-edit-domains", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		body, err := c.GetRawData()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "读取请求失败")
+			return
+		}
+		var req DomainBulkEdit
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的请求体："+err.Error())
+			return
+		}
+		if len(req.IDs) == 0 && strings.TrimSpace(req.Filter) == "" {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "ids 与 filter 至少指定一个")
+			return
+		}
+		if len(req.IDs) > maxBulkEditDomains {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, fmt.Sprintf("一次最多编辑 %d 个域名", maxBulkEditDomains))
+			return
+		}
+		filter, err := parseDomainFilter(req.Filter)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的筛选条件："+err.Error())
+			return
+		}
+
+		now := time.Now().Unix()
+		q := t.DB.Scopes(serverAccessScope(c)).Scopes(filter.scopes...)
+		if len(req.IDs) > 0 {
+			q = q.Where("id IN ?", req.IDs)
+		}
+		var found []ServerDomain
+		if err := q.Order("id").Limit(maxBulkEditDomains + 1).Find(&found).Error; err != nil {
+			log.Printf("批量编辑查询域名失败: 租户=%s, 错误=%v", t.Name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "查询域名失败："+err.Error())
+			return
+		}
+		if len(found) > maxBulkEditDomains {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, fmt.Sprintf("匹配的域名超过 %d 个，请缩小筛选范围", maxBulkEditDomains))
+			return
+		}
+		var domains []ServerDomain
+		for _, d := range found {
+			if filter.matches(d, now) {
+				domains = append(domains, d)
+			}
+		}
+
+		results := make([]BulkEditItem, 0, len(domains))
+		updates := make([]map[string]interface{}, len(domains))
+		invalid := 0
+		if len(req.IDs) > 0 {
+			// ids 中未匹配的域名（不存在、不在令牌允许的服务器组或不满足筛选条件）
+			matched := make(map[uint]bool, len(domains))
+			for _, d := range domains {
+				matched[d.ID] = true
+			}
+			for _, id := range req.IDs {
+				if !matched[id] {
+					results = append(results, BulkEditItem{ID: id, Status: bulkItemNotFound})
+					invalid++
+				}
+			}
+		}
+		for i, d := range domains {
+			item := BulkEditItem{ID: d.ID, Domain: d.Domain, ServerTable: d.ServerTable, ServerID: d.ServerID}
+			fields, errs := req.patchFor(d).updates(d, "", now)
+			switch changed := changedFields(d, fields); {
+			case len(errs) > 0:
+				item.Status, item.Errors = bulkItemInvalid, errs
+				invalid++
+			case len(changed) == 0:
+				item.Status = bulkItemUnchanged
+			default:
+				item.Status, item.Changes = bulkItemUpdated, changed
+				updates[i] = fields
+			}
+			results = append(results, item)
+		}
+		if invalid > 0 {
+			respondError(c, http.StatusBadRequest, codeValidationFailed, fmt.Sprintf("%d 个域名不存在或校验失败，未做任何修改", invalid), gin.H{"results": results})
+			return
+		}
+		if !consumeConfirmToken(c, confirmBulkEditDomains) {
+			return
+		}
+
+		updated := 0
+		if err := t.DB.Transaction(func(tx *gorm.DB) error {
+			for i, d := range domains {
+				if updates[i] == nil {
+					continue
+				}
+				if err := tx.Model(&ServerDomain{}).Where("id = ?", d.ID).Updates(updates[i]).Error; err != nil {
+					return fmt.Errorf("更新域名 %s 失败: %v", d.Domain, err)
+				}
+				updated++
+			}
+			return nil
+		}); err != nil {
+			log.Printf("批量编辑域名失败: 租户=%s, 错误=%v", t.Name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "批量编辑域名失败："+err.Error())
+			return
+		}
+		for i, d := range domains {
+			if p, ok := updates[i]["protected"].(int8); ok {
+				recordProtectionChange(c, d, p)
+			}
+		}
+		if updated > 0 {
+			detail := fmt.Sprintf("更新=%d, 匹配=%d, 筛选=%q", updated, len(domains), req.Filter)
+			recordAudit(t.DB, "bulk_edit_domains", t.Name, operatorName(c), c.ClientIP(), detail)
+			log.Printf("批量编辑域名成功: 租户=%s, %s", t.Name, detail)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("已更新 %d 个域名", updated), "updated": updated, "matched": len(domains), "results": results})
+	})
+}
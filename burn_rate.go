@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// DomainBlock 结构体，健康检查发现域名在中国无法访问（被封锁）的记录，每次分配最多记录一次
+type DomainBlock struct {
+	ID              uint    `gorm:"primaryKey" json:"id"`
+	ServerTable     string  `gorm:"column:server_table;type:varchar(255);uniqueIndex:unique_domain_block;not null" json:"server_table"`
+	ServerID        int     `gorm:"column:server_id;uniqueIndex:unique_domain_block;not null" json:"server_id"`
+	Domain          string  `gorm:"column:domain;type:varchar(255);uniqueIndex:unique_domain_block;not null" json:"domain"`
+	AssignedAt      int64   `gorm:"column:assigned_at;uniqueIndex:unique_domain_block;not null" json:"assigned_at"` // 本次分配时间
+	Registrar       string  `gorm:"column:registrar;type:varchar(255);default:''" json:"registrar"`
+	Cost            float64 `gorm:"column:cost;type:decimal(10,2);default:0" json:"cost"`
+	PurchaseDate    int64   `gorm:"column:purchase_date;default:0" json:"purchase_date"`
+	SurvivalSeconds int64   `gorm:"column:survival_seconds;default:0" json:"survival_seconds"` // 被封锁前累计使用时长
+	Reason          string  `gorm:"column:reason;type:varchar(255);default:''" json:"reason"`
+	DetectedAt      int64   `gorm:"column:detected_at;index;not null" json:"detected_at"`
+}
+
+// 通过探测节点（health.probeEndpoints，协议同 probe.remoteURL）检查是否可从中国访问；
+// 超过半数节点不可达时判定为封锁，返回是否可访问及说明
+func checkProbeEndpoints(host, port string) (bool, string) {
+	endpoints := viper.GetStringSlice("health.probeEndpoints")
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 {
+		return true, ""
+	}
+	timeout := time.Duration(viper.GetInt("probe.timeoutSeconds")) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	failed := 0
+	var lastErr error
+	for _, endpoint := range endpoints {
+		if err := probeRemote(endpoint, host, p, timeout); err != nil {
+			failed++
+			lastErr = err
+		}
+	}
+	if failed*2 > len(endpoints) {
+		return false, fmt.Sprintf("%d/%d 个探测节点无法访问: %v", failed, len(endpoints), lastErr)
+	}
+	return true, ""
+}
+
+// 记录域名被封锁，同一次分配只记录一次
+func recordDomainBlock(t *Tenant, table string, id int, host, reason string, now int64) {
+	var domain ServerDomain
+	if err := t.DB.Where("server_table = ? AND server_id = ? AND domain = ?", table, id, host).First(&domain).Error; err != nil {
+		log.Printf("记录域名封锁失败，域名不在域名池中: 表=%s, ID=%d, 域名=%s", table, id, host)
+		return
+	}
+	block := DomainBlock{
+		ServerTable:     table,
+		ServerID:        id,
+		Domain:          host,
+		AssignedAt:      domain.LastUsedTime,
+		Registrar:       domain.Registrar,
+		Cost:            domain.Cost,
+		PurchaseDate:    domain.PurchaseDate,
+		SurvivalSeconds: domain.InUseSeconds,
+		Reason:          truncate(reason, 255),
+		DetectedAt:      now,
+	}
+	if domain.InUse == 1 && domain.LastUsedTime > 0 && now > domain.LastUsedTime {
+		block.SurvivalSeconds += now - domain.LastUsedTime
+	}
+	var count int64
+	t.DB.Model(&DomainBlock{}).Where("server_table = ? AND server_id = ? AND domain = ? AND assigned_at = ?", table, id, host, block.AssignedAt).Count(&count)
+	if count > 0 {
+		return
+	}
+	if err := t.DB.Create(&block).Error; err != nil {
+		log.Printf("记录域名封锁失败: 表=%s, ID=%d, 域名=%s, 错误=%v", table, id, host, err)
+		return
+	}
+	log.Printf("域名被封锁: 租户=%s, 表=%s, ID=%d, 域名=%s, 存活 %.1f 小时", t.Name, table, id, host, float64(block.SurvivalSeconds)/3600)
+	publishEvent(Event{Type: eventDomainBlocked, Tenant: t.Name, ServerTable: table, ServerID: id, Domain: host, Error: block.Reason, Time: now})
+}
+
+// BurnRateStats 按注册商汇总的封锁统计
+type BurnRateStats struct {
+	Registrar           string  `json:"registrar"`
+	Domains             int64   `json:"domains"`               // 域名池中的域名数
+	Blocked             int64   `json:"blocked"`               // 被封锁的次数
+	BlockRate           float64 `json:"block_rate"`            // 被封锁次数 / 域名数
+	AvgSurvivalHours    float64 `json:"avg_survival_hours"`    // 被封锁前平均存活时长
+	MedianSurvivalHours float64 `json:"median_survival_hours"` // 被封锁前存活时长中位数
+	CostPerSurvivalDay  float64 `json:"cost_per_survival_day"` // 被封锁域名的费用 / 存活天数，0 表示无费用数据
+}
+
+// 统计 since 之后的封锁记录，按注册商汇总
+func burnRateStats(tdb *gorm.DB, since int64) ([]BurnRateStats, []DomainBlock, error) {
+	var blocks []DomainBlock
+	if err := tdb.Where("detected_at >= ?", since).Order("detected_at DESC").Find(&blocks).Error; err != nil {
+		return nil, nil, err
+	}
+	var pool []struct {
+		Registrar string
+		Count     int64
+	}
+	if err := tdb.Model(&ServerDomain{}).Select("registrar, COUNT(DISTINCT domain) AS count").Group("registrar").Scan(&pool).Error; err != nil {
+		return nil, nil, err
+	}
+	byRegistrar := map[string]*BurnRateStats{}
+	get := func(registrar string) *BurnRateStats {
+		if byRegistrar[registrar] == nil {
+			byRegistrar[registrar] = &BurnRateStats{Registrar: registrar}
+		}
+		return byRegistrar[registrar]
+	}
+	for _, p := range pool {
+		get(p.Registrar).Domains = p.Count
+	}
+	survivals := map[string][]float64{}
+	costs := map[string]float64{}
+	for _, b := range blocks {
+		s := get(b.Registrar)
+		s.Blocked++
+		hours := float64(b.SurvivalSeconds) / 3600
+		survivals[b.Registrar] = append(survivals[b.Registrar], hours)
+		costs[b.Registrar] += b.Cost
+	}
+	stats := make([]BurnRateStats, 0, len(byRegistrar))
+	for registrar, s := range byRegistrar {
+		if s.Domains > 0 {
+			s.BlockRate = float64(s.Blocked) / float64(s.Domains)
+		}
+		if hours := survivals[registrar]; len(hours) > 0 {
+			sort.Float64s(hours)
+			total := 0.0
+			for _, h := range hours {
+				total += h
+			}
+			s.AvgSurvivalHours = total / float64(len(hours))
+			if len(hours)%2 == 1 {
+				s.MedianSurvivalHours = hours[len(hours)/2]
+			} else {
+				s.MedianSurvivalHours = (hours[len(hours)/2-1] + hours[len(hours)/2]) / 2
+			}
+			if costs[registrar] > 0 && total > 0 {
+				s.CostPerSurvivalDay = costs[registrar] / (total / 24)
+			}
+		}
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Registrar < stats[j].Registrar })
+	return stats, blocks, nil
+}
+
+// 注册封锁统计路由
+func registerBurnRateRoutes(r *gin.Engine) {
+	// 域名封锁统计：按注册商汇总及逐条封锁记录，days 为统计天数（默认 90）
+	r.GET("/stats/burn-rate", authMiddleware, httpCacheMiddleware, func(c *gin.Context) {
+		days := 90
+		if d, err := strconv.Atoi(c.Query("days")); err == nil && d > 0 {
+			days = d
+		}
+		stats, blocks, err := burnRateStats(readDB(currentTenant(c)), time.Now().Unix()-int64(days)*86400)
+		if err != nil {
+			log.Printf("获取封锁统计失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取封锁统计失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"days": days, "registrars": stats, "blocks": blocks})
+	})
+}
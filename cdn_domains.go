@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// CDN 域名（解析到 Cloudflare 等 CDN 的 IP，不直接暴露节点）被封锁的风险较低：
+// 分配后可使用更久、冷却更短，且不受“避免复用最近 N 次域名”限制
+
+// 是否为 CDN 域名
+func isCDNDomain(d ServerDomain) bool {
+	return d.CDN == 1
+}
+
+// CDN 域名使用后的冷却时间（domain.cdnCooldownMinutes），未配置时为 60 分钟
+func cdnCooldownSeconds() int64 {
+	if !viper.IsSet("domain.cdnCooldownMinutes") {
+		return 3600
+	}
+	if minutes := viper.GetInt64("domain.cdnCooldownMinutes"); minutes > 0 {
+		return minutes * 60
+	}
+	return 0
+}
+
+// 冷却期开始时间的 SQL 表达式：last_used_time 大于该值的域名仍在冷却期内；返回表达式及参数。
+// 单独设置了冷却时间（cooldown_minutes）的域名优先按该时间计算
+func cooldownStartExpr(now int64) (string, []interface{}) {
+	return cooldownStartExprFor(now, cdnCooldownSeconds())
+}
+
+// 按指定的 CDN 域名冷却时间构造冷却期开始时间的 SQL 表达式
+func cooldownStartExprFor(now, cdnCooldown int64) (string, []interface{}) {
+	return "CASE WHEN cooldown_minutes > 0 THEN ? - cooldown_minutes * 60 WHEN cdn = 1 THEN ? ELSE ? END", []interface{}{now, now - cdnCooldown, now - domainCooldownSeconds}
+}
+
+// 冷却期长度的 SQL 表达式，用于计算冷却结束时间
+func cooldownLengthExpr() (string, []interface{}) {
+	return "CASE WHEN cooldown_minutes > 0 THEN cooldown_minutes * 60 WHEN cdn = 1 THEN ? ELSE ? END", []interface{}{cdnCooldownSeconds(), domainCooldownSeconds}
+}
+
+// CDN 域名轮换间隔倍数（domain.cdnIntervalMultiplier），未配置时为 2，即分配 CDN 域名后保留两倍的轮换间隔
+func cdnIntervalMultiplier() float64 {
+	if !viper.IsSet("domain.cdnIntervalMultiplier") {
+		return 2
+	}
+	if m := viper.GetFloat64("domain.cdnIntervalMultiplier"); m > 0 {
+		return m
+	}
+	return 1
+}
+
+// 分配域名后到下次轮换的秒数：CDN 域名按倍数延长服务器的轮换间隔
+func rotationIntervalSeconds(tx *gorm.DB, table string, id int, d ServerDomain) int64 {
+	interval := int64(serverIntervalHours(tx, table, id) * 3600)
+	if isCDNDomain(d) {
+		return int64(float64(interval) * cdnIntervalMultiplier())
+	}
+	return interval
+}
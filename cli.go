@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// 创建命令行入口：不带子命令时运行 Web 服务，子命令直接操作数据库用于脚本化维护
+func newRootCmd() *cobra.Command {
+	root := &cobra.Command{
+		Use:           "server-manager",
+		Short:         "服务器端口与域名轮换管理",
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		Run: func(cmd *cobra.Command, args []string) {
+			runServer()
+		},
+	}
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "serve",
+			Short: "运行 Web 服务及定时任务",
+			Run: func(cmd *cobra.Command, args []string) {
+				runServer()
+			},
+		},
+		newAddDomainCmd(),
+		newImportDomainsCmd(),
+		newRotateCmd(),
+		newListServersCmd(),
+		newBackupCmd(),
+		newEncryptSecretCmd(),
+		newApplyCmd(),
+		newResetPasswordCmd(),
+	)
+	root.PersistentFlags().StringVar(&cliTenantName, "tenant", "", "租户名称，默认为 default")
+	return root
+}
+
+// 命令行指定的租户
+var cliTenantName string
+
+// 命令行子命令的初始化：加载配置、连接数据库并返回 --tenant 指定的租户
+func initCLI() (*Tenant, error) {
+	loadConfig()
+	connectDatabase()
+	t, ok := lookupTenant(cliTenantName)
+	if !ok {
+		return nil, fmt.Errorf("未知的租户: %s", cliTenantName)
+	}
+	return t, nil
+}
+
+// 校验 --table/--id 参数
+func validateServerFlags(table string, id int) error {
+	if !isValidServerTable(table) {
+		return fmt.Errorf("无效的表名: %s", table)
+	}
+	if id <= 0 {
+		return fmt.Errorf("无效的ID: %d", id)
+	}
+	return nil
+}
+
+// add-domain 子命令
+func newAddDomainCmd() *cobra.Command {
+	var table, domain string
+	var id int
+	cmd := &cobra.Command{
+		Use:   "add-domain",
+		Short: "为服务器添加域名",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateServerFlags(table, id); err != nil {
+				return err
+			}
+			if domain == "" {
+				return errors.New("域名不能为空")
+			}
+			t, err := initCLI()
+			if err != nil {
+				return err
+			}
+			if err := requireNoMaintenance(); err != nil {
+				return err
+			}
+			if err := addServerDomain(t, table, id, domain); err != nil {
+				return err
+			}
+			fmt.Printf("域名 %s 添加成功\n", domain)
+			if normalized, err := normalizeDomain(domain); err == nil {
+				if conflicts, _ := findDomainConflicts(t.DB, table, id, normalized); len(conflicts) > 0 {
+					fmt.Fprintf(os.Stderr, "警告：该域名同时存在于其他 %d 台服务器的域名池中\n", len(conflicts))
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&table, "table", "", "服务器表名")
+	cmd.Flags().IntVar(&id, "id", 0, "服务器ID")
+	cmd.Flags().StringVar(&domain, "domain", "", "域名")
+	return cmd
+}
+
+// import-domains 子命令：从文件（或标准输入 "-"）按行导入域名，# 开头为注释
+func newImportDomainsCmd() *cobra.Command {
+	var table, file string
+	var id int
+	cmd := &cobra.Command{
+		Use:   "import-domains",
+		Short: "从文件批量导入域名（每行一个）",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateServerFlags(table, id); err != nil {
+				return err
+			}
+			var in io.Reader = os.Stdin
+			if file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			t, err := initCLI()
+			if err != nil {
+				return err
+			}
+			if err := requireNoMaintenance(); err != nil {
+				return err
+			}
+			added, skipped, failed := 0, 0, 0
+			scanner := bufio.NewScanner(in)
+			for scanner.Scan() {
+				domain := strings.TrimSpace(scanner.Text())
+				if domain == "" || strings.HasPrefix(domain, "#") {
+					continue
+				}
+				err := addServerDomain(t, table, id, domain)
+				switch {
+				case err == nil:
+					added++
+				case errors.Is(err, errDomainExists):
+					skipped++
+				default:
+					failed++
+					fmt.Fprintf(os.Stderr, "添加域名 %s 失败: %v\n", domain, err)
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			fmt.Printf("导入完成：新增 %d，已存在 %d，失败 %d\n", added, skipped, failed)
+			if failed > 0 {
+				return fmt.Errorf("%d 个域名导入失败", failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&table, "table", "", "服务器表名")
+	cmd.Flags().IntVar(&id, "id", 0, "服务器ID")
+	cmd.Flags().StringVar(&file, "file", "-", "域名文件路径，- 表示标准输入")
+	return cmd
+}
+
+// rotate 子命令：立即轮换服务器端口和域名，需要审批的服务器只提交申请
+func newRotateCmd() *cobra.Command {
+	var table, reason string
+	var id int
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "立即轮换服务器端口和域名",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateServerFlags(table, id); err != nil {
+				return err
+			}
+			t, err := initCLI()
+			if err != nil {
+				return err
+			}
+			if err := requireNoMaintenance(); err != nil {
+				return err
+			}
+			if approvalRequired(t.DB, table, id) {
+				approval, created, err := requestRotationApproval(t, table, id, cliOperatorName(), cliOperatorName(), "", reason)
+				if err != nil {
+					return err
+				}
+				if !created {
+					fmt.Printf("该服务器已有待确认的轮换申请（审批ID=%d）\n", approval.ID)
+					return nil
+				}
+				fmt.Printf("该服务器的手动轮换需要审批，已提交申请（审批ID=%d），请由另一位操作员确认\n", approval.ID)
+				return nil
+			}
+			if err := rotateServerNow(t, table, id, RotationCause{Trigger: triggerCLI, Actor: cliOperatorName()}); err != nil {
+				return err
+			}
+			var server struct {
+				Port string
+				Host string
+			}
+			if err := t.DB.Table(table).Select(serverSelect(table, "port", "host")).Where("id = ?", id).First(&server).Error; err != nil {
+				return err
+			}
+			fmt.Printf("服务器已更新：主机=%s，端口=%s\n", server.Host, server.Port)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&table, "table", "", "服务器表名")
+	cmd.Flags().IntVar(&id, "id", 0, "服务器ID")
+	cmd.Flags().StringVar(&reason, "reason", "", "轮换原因（需要审批时记录在申请中）")
+	return cmd
+}
+
+// list-servers 子命令
+func newListServersCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "list-servers",
+		Short: "列出所有服务器",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := initCLI()
+			if err != nil {
+				return err
+			}
+			var servers []Server
+			now := time.Now().Unix()
+			for _, table := range serverTables(t) {
+				var records []Server
+				if err := t.DB.Table(table).Select(serverSelect(table, "id", "name", "port", "server_port", "host", "show", "next_update_time", "last_update_status")).Find(&records).Error; err != nil {
+					return fmt.Errorf("从表 %s 获取记录失败: %v", table, err)
+				}
+				for _, s := range records {
+					counts, err := t.Domains.Count(table, s.ID, now)
+					if err != nil {
+						return err
+					}
+					s.TableName = table
+					s.DomainTotal = int(counts.Total)
+					s.DomainAvailable = int(counts.Available)
+					servers = append(servers, s)
+				}
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(servers)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "TABLE\tID\tNAME\tPORT\tHOST\tDOMAINS\tNEXT UPDATE\tSTATUS")
+			for _, s := range servers {
+				next := "立即更新"
+				if s.NextUpdateTime != 0 {
+					next = formatTimeIn(s.NextUpdateTime, "")
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%d/%d\t%s\t%s\n", s.TableName, s.ID, s.Name, s.Port, s.Host, s.DomainTotal, s.DomainAvailable, next, s.LastUpdateStatus)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "以 JSON 格式输出")
+	return cmd
+}
+
+// backup 子命令：将服务器行及管理表导出为 JSON
+func newBackupCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "导出服务器及域名数据为 JSON 备份",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := initCLI()
+			if err != nil {
+				return err
+			}
+			backup, err := buildBackup(t)
+			if err != nil {
+				return err
+			}
+			var out io.Writer = os.Stdout
+			if output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(backup); err != nil {
+				return err
+			}
+			if output != "-" {
+				fmt.Printf("备份已写入 %s\n", output)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "-", "备份文件路径，- 表示标准输出")
+	return cmd
+}
+
+// 收集备份数据
+func buildBackup(t *Tenant) (map[string]interface{}, error) {
+	servers := map[string][]map[string]interface{}{}
+	for _, table := range serverTables(t) {
+		var rows []map[string]interface{}
+		if err := t.DB.Table(table).Select(serverSelect(table, "id", "name", "port", "server_port", "host", "show", "next_update_time", "last_update_status")).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("导出表 %s 失败: %v", table, err)
+		}
+		servers[table] = rows
+	}
+	var domains []ServerDomain
+	var settings []ServerSetting
+	var presets []PortPreset
+	var bindings []PortPresetBinding
+	var nodes []ServerNode
+	var deleted []DeletedDomain
+	var policies []RotationPolicy
+	var approvals []RotationApproval
+	var templates []ServerTemplate
+	for _, q := range []struct {
+		name string
+		dest interface{}
+	}{
+		{"server_domains", &domains},
+		{"server_settings", &settings},
+		{"port_presets", &presets},
+		{"port_preset_bindings", &bindings},
+		{"server_nodes", &nodes},
+		{"deleted_domains", &deleted},
+		{"rotation_policies", &policies},
+		{"rotation_approvals", &approvals},
+		{"server_templates", &templates},
+	} {
+		if err := t.DB.Find(q.dest).Error; err != nil {
+			return nil, fmt.Errorf("导出 %s 失败: %v", q.name, err)
+		}
+	}
+	return map[string]interface{}{
+		"tenant":               t.Name,
+		"created_at":           time.Now().Unix(),
+		"servers":              servers,
+		"server_domains":       domains,
+		"server_settings":      settings,
+		"port_presets":         presets,
+		"port_preset_bindings": bindings,
+		"server_nodes":         nodes,
+		"deleted_domains":      deleted,
+		"rotation_policies":    policies,
+		"rotation_approvals":   approvals,
+		"server_templates":     templates,
+	}, nil
+}
+
+// encrypt-secret：用主密钥加密配置值，输出可直接填入 config.toml 的 enc: 字符串
+func newEncryptSecretCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "encrypt-secret [值]",
+		Short: "加密配置值（主密钥取自环境变量 " + masterKeyEnv + "），未提供值时从标准输入读取",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var value string
+			if len(args) == 1 {
+				value = args[0]
+			} else {
+				line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+				if err != nil && err != io.EOF {
+					return err
+				}
+				value = strings.TrimRight(line, "\r\n")
+			}
+			if value == "" {
+				return errors.New("待加密的值不能为空")
+			}
+			encrypted, err := encryptConfigValue(value)
+			if err != nil {
+				return err
+			}
+			fmt.Println(encrypted)
+			return nil
+		},
+	}
+}
+
+// reset-password 子命令：在服务器上直接重置用户密码（新密码从标准输入读取），用于管理员忘记密码时恢复登录
+func newResetPasswordCmd() *cobra.Command {
+	var username string
+	cmd := &cobra.Command{
+		Use:   "reset-password",
+		Short: "重置用户密码（新密码从标准输入读取），重置后该用户的登录全部失效",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if username == "" {
+				return errors.New("用户名不能为空")
+			}
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			password := strings.TrimRight(line, "\r\n")
+			if _, err := initCLI(); err != nil {
+				return err
+			}
+			var user User
+			if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+				return fmt.Errorf("用户不存在: %s", username)
+			}
+			if err := setUserPassword(&user, password); err != nil {
+				return fmt.Errorf("新密码不符合要求: %v", err)
+			}
+			revoked := revokeUserLogins(user.Username, "")
+			recordAudit(db, "reset_user_password", user.Username, cliOperatorName(), "", fmt.Sprintf("吊销会话 %d 个", revoked))
+			fmt.Printf("用户 %s 的密码已重置，吊销会话 %d 个\n", user.Username, revoked)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&username, "username", "", "用户名")
+	return cmd
+}
+
+// apply 子命令：按声明式清单调整服务器、域名池、标签及轮换策略
+func newApplyCmd() *cobra.Command {
+	var file string
+	var dryRun, asJSON bool
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "按 YAML 清单调整服务器、域名池、标签及轮换策略",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data []byte
+			var err error
+			if file == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(file)
+			}
+			if err != nil {
+				return err
+			}
+			m, err := parseManifest(data)
+			if err != nil {
+				return err
+			}
+			if errs := validateManifest(&m); len(errs) > 0 {
+				return fmt.Errorf("清单校验失败: %v", joinFieldErrors(errs))
+			}
+			t, err := initCLI()
+			if err != nil {
+				return err
+			}
+			if !dryRun {
+				if err := requireNoMaintenance(); err != nil {
+					return err
+				}
+			}
+			result := applyManifest(t, m, dryRun, RotationCause{Trigger: triggerCLI, Actor: cliOperatorName()}, "")
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(result); err != nil {
+					return err
+				}
+			} else {
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "SERVER\tKIND\tTARGET\tACTION\tDETAIL\tERROR")
+				for _, c := range result.Changes {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Server, c.Kind, c.Target, c.Action, c.Detail, c.Error)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				switch {
+				case len(result.Changes) == 0:
+					fmt.Println("数据库已与清单一致，无需修改")
+				case dryRun:
+					fmt.Printf("演练：共 %d 项修改，未写入数据库\n", len(result.Changes))
+				default:
+					fmt.Printf("已应用 %d 项修改，失败 %d 项\n", len(result.Changes)-result.Failed, result.Failed)
+				}
+			}
+			if result.Failed > 0 {
+				return fmt.Errorf("%d 项修改失败", result.Failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "清单文件路径，- 表示标准输入")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "只列出将要执行的修改，不写入数据库")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "以 JSON 格式输出")
+	cmd.MarkFlagRequired("file")
+	return cmd
+}
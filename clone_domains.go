@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 旧版本 server_domains 的唯一索引只包含 domain 列，同一域名无法出现在多台服务器的域名池中；
+// 迁移前删除旧索引，由 AutoMigrate 按 (server_table, server_id, domain) 重建
+func upgradeDomainUniqueIndex(tdb *gorm.DB) {
+	m := tdb.Migrator()
+	if !m.HasTable(&ServerDomain{}) || !m.HasIndex(&ServerDomain{}, "unique_domain_per_server") {
+		return
+	}
+	indexes, err := m.GetIndexes(&ServerDomain{})
+	if err != nil {
+		log.Printf("读取 server_domains 索引失败: %v", err)
+		return
+	}
+	for _, idx := range indexes {
+		if idx.Name() == "unique_domain_per_server" && len(idx.Columns()) == 1 {
+			if err := m.DropIndex(&ServerDomain{}, "unique_domain_per_server"); err != nil {
+				log.Printf("删除旧的 server_domains 唯一索引失败: %v", err)
+				return
+			}
+			log.Println("已删除旧的 server_domains 唯一索引，将按服务器重建")
+		}
+	}
+}
+
+// 将源服务器的域名池复制到目标服务器：跳过目标已有及已退役的域名，复制的域名不处于使用中且使用统计清零，
+// 解析校验结果因节点不同一并清空；禁止跨服务器共用域名时拒绝复制；返回复制及跳过的数量
+func cloneServerDomains(t *Tenant, fromTable string, fromID int, toTable string, toID int) (int, int, error) {
+	if domainConflictBlocks() {
+		return 0, 0, fmt.Errorf("%w，已禁止跨服务器共用域名（domain.conflictMode = block）", errDomainConflict)
+	}
+	cloned, skipped := 0, 0
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Table(toTable).Where("id = ?", toID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("目标服务器不存在")
+		}
+		var source []ServerDomain
+		if err := tx.Where("server_table = ? AND server_id = ?", fromTable, fromID).Order("`order` ASC, id ASC").Find(&source).Error; err != nil {
+			return err
+		}
+		if len(source) == 0 {
+			return errors.New("源服务器没有域名")
+		}
+		var existing []string
+		if err := tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", toTable, toID).Pluck("domain", &existing).Error; err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, d := range existing {
+			seen[d] = true
+		}
+		var maxOrder int
+		tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", toTable, toID).Select("MAX(`order`)").Scan(&maxOrder)
+		for _, d := range source {
+			if seen[d.Domain] || d.Retired == 1 {
+				skipped++
+				continue
+			}
+			maxOrder++
+			copied := ServerDomain{
+				ServerTable:   toTable,
+				ServerID:      toID,
+				Domain:        d.Domain,
+				Order:         maxOrder,
+				Registrar:     d.Registrar,
+				PurchaseDate:  d.PurchaseDate,
+				Cost:          d.Cost,
+				Note:          d.Note,
+				MaxUses:       d.MaxUses,
+				MaxInUseHours: d.MaxInUseHours,
+				DNSProvider:   d.DNSProvider,
+				Tags:          d.Tags,
+				Sharing:       d.Sharing,
+				CDN:           d.CDN,
+				Protected:     d.Protected,
+			}
+			if err := tx.Create(&copied).Error; err != nil {
+				return fmt.Errorf("复制域名 %s 失败: %v", d.Domain, err)
+			}
+			seen[d.Domain] = true
+			cloned++
+		}
+		return nil
+	})
+	return cloned, skipped, err
+}
+
+// 注册域名池复制路由
+func registerCloneDomainRoutes(r *gin.Engine) {
+	// 复制域名池：表单参数 from_table、from_id、to_table、to_id
+	r.POST("/clone-domains", authMiddleware, func(c *gin.Context) {
+		param := func(key string) string {
+			return serverParam(c, key)
+		}
+		fromTable, toTable := param("from_table"), param("to_table")
+		if !isValidServerTable(fromTable) || !isValidServerTable(toTable) {
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		fromID, err := strconv.Atoi(param("from_id"))
+		if err != nil || fromID <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的源服务器ID")
+			return
+		}
+		toID, err := strconv.Atoi(param("to_id"))
+		if err != nil || toID <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的目标服务器ID")
+			return
+		}
+		if fromTable == toTable && fromID == toID {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "源服务器和目标服务器相同")
+			return
+		}
+		cloned, skipped, err := cloneServerDomains(currentTenant(c), fromTable, fromID, toTable, toID)
+		if err != nil {
+			log.Printf("复制域名池失败: %s:%d -> %s:%d, 错误=%v", fromTable, fromID, toTable, toID, err)
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "复制域名池失败："+err.Error())
+			return
+		}
+		log.Printf("复制域名池成功: %s:%d -> %s:%d, 复制=%d, 跳过=%d", fromTable, fromID, toTable, toID, cloned, skipped)
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("已复制 %d 个域名，跳过 %d 个", cloned, skipped),
+			"cloned":  cloned,
+			"skipped": skipped,
+		})
+	})
+}
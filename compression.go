@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 响应压缩：客户端接受 gzip 时压缩 JSON、HTML、YAML 等文本响应（如导出上万个域名的域名列表），
+// 响应体先缓冲到 server.gzipMinBytes（默认 1024）字节再决定是否压缩，过小的响应原样返回。
+// server.gzip = false 时关闭
+
+// 可压缩的响应类型
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/javascript": true,
+	"application/x-yaml":     true,
+	"application/yaml":       true,
+	"text/css":               true,
+	"text/html":              true,
+	"text/javascript":        true,
+	"text/plain":             true,
+}
+
+// 复用 gzip 压缩器
+var gzipWriterPool = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+
+// 是否开启响应压缩（server.gzip），未配置时开启
+func gzipEnabled() bool {
+	return !viper.IsSet("server.gzip") || viper.GetBool("server.gzip")
+}
+
+// 压缩的最小响应字节数（server.gzipMinBytes），默认 1024
+func gzipMinBytes() int {
+	if n := viper.GetInt("server.gzipMinBytes"); n > 0 {
+		return n
+	}
+	return 1024
+}
+
+// 客户端是否接受 gzip 编码
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// gzip;q=0 表示明确拒绝
+		q := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// gzipResponseWriter 缓冲响应体开头部分，达到阈值后按状态码及类型决定是否压缩
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	minBytes int
+	buf      bytes.Buffer
+	decided  bool
+	gz       *gzip.Writer
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buf.Write(data)
+		if w.buf.Len() < w.minBytes {
+			return len(data), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// 决定是否压缩并写出已缓冲的内容
+func (w *gzipResponseWriter) decide() error {
+	w.decided = true
+	header := w.Header()
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if w.buf.Len() >= w.minBytes && w.Status() == http.StatusOK && compressibleTypes[mediaType] && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", "gzip")
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		// 压缩后字节不同，强 ETag 降为弱 ETag
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.gz = gzipWriterPool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+		_, err := w.gz.Write(w.buf.Bytes())
+		w.buf.Reset()
+		return err
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// 处理结束：写出缓冲内容并关闭压缩器
+func (w *gzipResponseWriter) finish() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriterPool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// 响应压缩中间件
+func compressionMiddleware(c *gin.Context) {
+	if !gzipEnabled() || c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Next()
+		return
+	}
+	original := c.Writer
+	w := &gzipResponseWriter{ResponseWriter: original, minBytes: gzipMinBytes()}
+	c.Writer = w
+	defer func() {
+		w.finish()
+		c.Writer = original
+	}()
+	c.Next()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// 加密配置值的前缀，格式为 enc:<base64(nonce + 密文)>
+const encryptedValuePrefix = "enc:"
+
+// 主密钥所在的环境变量，任意长度的口令，经 SHA-256 派生为 AES-256 密钥
+const masterKeyEnv = "SERVER_MANAGER_MASTER_KEY"
+
+// 启动时解密过的配置项：键 -> 原密文，写回配置文件时据此重新加密
+var configSecrets = struct {
+	sync.Mutex
+	cipherText map[string]string
+	plainText  map[string]string
+}{cipherText: map[string]string{}, plainText: map[string]string{}}
+
+// 由环境变量派生 AES-GCM
+func masterCipher() (cipher.AEAD, error) {
+	key := os.Getenv(masterKeyEnv)
+	if key == "" {
+		return nil, fmt.Errorf("未设置环境变量 %s", masterKeyEnv)
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 加密配置值
+func encryptConfigValue(plain string) (string, error) {
+	gcm, err := masterCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// 解密配置值
+func decryptConfigValue(value string) (string, error) {
+	gcm, err := masterCipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedValuePrefix))
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("密文格式无效")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("解密失败，主密钥不正确或密文已损坏")
+	}
+	return string(plain), nil
+}
+
+// 解密配置中所有 enc: 开头的值（数据库密码、DNS 服务商令牌、SMTP 密码等），解密结果写回配置层，
+// 使 viper.Sub 等读取方式也能取到明文；任一值无法解密时终止启动
+func decryptConfigSecrets() {
+	settings := viper.AllSettings()
+	var failed []string
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			switch val := v.(type) {
+			case map[string]interface{}:
+				walk(prefix+k+".", val)
+			case string:
+				if !strings.HasPrefix(val, encryptedValuePrefix) {
+					continue
+				}
+				plain, err := decryptConfigValue(val)
+				if err != nil {
+					failed = append(failed, fmt.Sprintf("%s（%v）", prefix+k, err))
+					continue
+				}
+				m[k] = plain
+				configSecrets.cipherText[prefix+k] = val
+				configSecrets.plainText[prefix+k] = plain
+			}
+		}
+	}
+	configSecrets.Lock()
+	walk("", settings)
+	configSecrets.Unlock()
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		log.Fatalf("解密配置项失败: %s", strings.Join(failed, ", "))
+	}
+	if len(configSecrets.cipherText) == 0 {
+		return
+	}
+	if err := viper.MergeConfigMap(settings); err != nil {
+		log.Fatalf("加载解密后的配置失败: %v", err)
+	}
+	log.Printf("已解密 %d 个加密配置项", len(configSecrets.cipherText))
+}
+
+// 配置项是否在配置文件中加密保存
+func configValueEncrypted(key string) bool {
+	configSecrets.Lock()
+	defer configSecrets.Unlock()
+	_, ok := configSecrets.cipherText[key]
+	return ok
+}
+
+// 写回配置文件：启动时加密的配置项保持加密（值未变时沿用原密文，修改过则用主密钥重新加密），
+// 所有写配置文件的地方都应使用本函数代替 viper.WriteConfig
+func writeConfig() error {
+	configSecrets.Lock()
+	defer configSecrets.Unlock()
+	if len(configSecrets.cipherText) == 0 {
+		return viper.WriteConfig()
+	}
+	settings := viper.AllSettings()
+	for key := range configSecrets.cipherText {
+		parts := strings.Split(key, ".")
+		m := settings
+		for _, p := range parts[:len(parts)-1] {
+			next, ok := m[p].(map[string]interface{})
+			if !ok {
+				m = nil
+				break
+			}
+			m = next
+		}
+		if m == nil {
+			continue
+		}
+		last := parts[len(parts)-1]
+		current, ok := m[last].(string)
+		if !ok {
+			continue
+		}
+		if current != configSecrets.plainText[key] {
+			encrypted, err := encryptConfigValue(current)
+			if err != nil {
+				return fmt.Errorf("重新加密配置项 %s 失败: %v", key, err)
+			}
+			configSecrets.cipherText[key] = encrypted
+			configSecrets.plainText[key] = current
+		}
+		m[last] = configSecrets.cipherText[key]
+	}
+	out := viper.New()
+	out.SetConfigType("toml")
+	if err := out.MergeConfigMap(settings); err != nil {
+		return err
+	}
+	return out.WriteConfigAs(viper.ConfigFileUsed())
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 破坏性操作的确认令牌：执行前须先 GET /confirm-token?action=<操作> 领取短时有效的令牌，
+// 随请求以 X-Confirm-Token 请求头或 confirm_token 参数提交。令牌只能使用一次且与操作、操作者及租户绑定，
+// 重复提交表单或重放请求会因令牌已用而被拒绝
+
+// 需要确认的操作
+const (
+	confirmSetInterval      = "set-interval"      // 设置全局更新间隔并刷新所有服务器的下次更新时间
+	confirmPurgeDomain      = "purge-domain"      // 从回收站永久删除域名
+	confirmLogoutAll        = "logout-all"        // 吊销全部会话
+	confirmDeleteServer     = "delete-server"     // 下线服务器并删除面板行
+	confirmDeleteDomain     = "delete-domain"     // 删除域名（移入回收站）
+	confirmReleaseDomain    = "release-domain"    // 手动释放使用中的域名
+	confirmBulkEditDomains  = "bulk-edit-domains" // 批量编辑域名
+	confirmReconcileDomains = "reconcile-domains" // 校对并修正域名占用状态
+	confirmAuditFix         = "audit-consistency" // 一致性检查并修正不一致
+	confirmApplyManifest    = "apply-manifest"    // 应用包含归档、删除或退役的清单
+	confirmResetPassword    = "reset-password"    // 重置其他用户的密码
+)
+
+// 可领取令牌的操作及说明
+var confirmActions = map[string]string{
+	confirmSetInterval:      "设置全局更新间隔并刷新所有服务器的下次更新时间",
+	confirmPurgeDomain:      "从回收站永久删除域名",
+	confirmLogoutAll:        "在所有设备上登出",
+	confirmDeleteServer:     "下线服务器并删除面板行",
+	confirmDeleteDomain:     "删除域名（移入回收站）",
+	confirmReleaseDomain:    "手动释放使用中的域名",
+	confirmBulkEditDomains:  "批量编辑域名",
+	confirmReconcileDomains: "校对并修正所有服务器的域名占用状态",
+	confirmAuditFix:         "检查域名与服务器主机的一致性并修正",
+	confirmApplyManifest:    "应用清单（包含归档服务器、删除节点 IP 或策略、退役域名）",
+	confirmResetPassword:    "重置其他用户的密码并使其登录全部失效",
+}
+
+// 确认令牌请求头
+const confirmTokenHeader = "X-Confirm-Token"
+
+// ConfirmationToken 已签发的确认令牌（仅默认租户使用），使用后即删除
+type ConfirmationToken struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	TokenHash string `gorm:"column:token_hash;type:char(64);uniqueIndex;not null" json:"-"`
+	Action    string `gorm:"column:action;type:varchar(64);not null" json:"action"`
+	Operator  string `gorm:"column:operator;type:varchar(255);not null" json:"operator"`
+	Tenant    string `gorm:"column:tenant;type:varchar(64);not null" json:"tenant"`
+	ExpiresAt int64  `gorm:"column:expires_at;index" json:"expires_at"`
+}
+
+// 确认令牌有效期（confirmation.ttlSeconds），默认 120 秒
+func confirmTokenTTL() int64 {
+	if s := viper.GetInt64("confirmation.ttlSeconds"); s > 0 {
+		return s
+	}
+	return 120
+}
+
+// 签发确认令牌，同时清理已过期的令牌
+func issueConfirmToken(action, operator, tenant string) (string, int64, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", 0, err
+	}
+	token := hex.EncodeToString(buf)
+	now := time.Now().Unix()
+	expiresAt := now + confirmTokenTTL()
+	if err := db.Where("expires_at < ?", now).Delete(&ConfirmationToken{}).Error; err != nil {
+		log.Printf("清理过期确认令牌失败: %v", err)
+	}
+	err := db.Create(&ConfirmationToken{
+		TokenHash: hashToken(token),
+		Action:    action,
+		Operator:  operator,
+		Tenant:    tenant,
+		ExpiresAt: expiresAt,
+	}).Error
+	return token, expiresAt, err
+}
+
+// 校验并使用请求携带的确认令牌，失败时写入 428 响应并返回 false；
+// 令牌以单条删除语句使用，并发的重复请求只有一个能成功
+func consumeConfirmToken(c *gin.Context, action string) bool {
+	token := c.GetHeader(confirmTokenHeader)
+	if token == "" {
+		token = requestParam(c, "confirm_token")
+	}
+	if token == "" {
+		respondError(c, http.StatusPreconditionRequired, codeConfirmationRequired, "该操作需要确认，请先获取确认令牌", gin.H{"action": action})
+		return false
+	}
+	result := db.Where("token_hash = ? AND action = ? AND operator = ? AND tenant = ? AND expires_at >= ?",
+		hashToken(token), action, operatorName(c), currentTenant(c).Name, time.Now().Unix()).Delete(&ConfirmationToken{})
+	if result.Error != nil {
+		log.Printf("校验确认令牌失败: 操作=%s, 错误=%v", action, result.Error)
+		respondError(c, http.StatusInternalServerError, codeInternal, "校验确认令牌失败："+result.Error.Error())
+		return false
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("确认令牌无效、已使用或已过期: 操作=%s, 操作者=%s", action, operatorName(c))
+		respondError(c, http.StatusPreconditionRequired, codeConfirmationRequired, "确认令牌无效、已使用或已过期，请重新确认", gin.H{"action": action})
+		return false
+	}
+	return true
+}
+
+// 注册确认令牌路由
+func registerConfirmationRoutes(r *gin.Engine) {
+	// 领取确认令牌：action 为需要确认的操作
+	r.GET("/confirm-token", authMiddleware, func(c *gin.Context) {
+		action := c.Query("action")
+		description, ok := confirmActions[action]
+		if !ok {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的操作："+action)
+			return
+		}
+		token, expiresAt, err := issueConfirmToken(action, operatorName(c), currentTenant(c).Name)
+		if err != nil {
+			log.Printf("签发确认令牌失败: 操作=%s, 错误=%v", action, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "签发确认令牌失败："+err.Error())
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"token": token, "action": action, "description": description, "expires_at": expiresAt})
+	})
+}
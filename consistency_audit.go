@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 域名状态与服务器主机不一致的类型
+const (
+	issueOrphanInUse   = "orphan_in_use"    // 标记为使用中，但不是所属服务器的当前主机（轮换宽限期内的旧域名除外）
+	issueMissingInUse  = "missing_in_use"   // 是服务器的当前主机，但未标记为使用中
+	issueHostNotInPool = "host_not_in_pool" // 服务器当前主机不在其域名池中（仅报告）
+	issueServerMissing = "server_missing"   // 域名所属的服务器已不存在且没有下线档案（仅报告）
+)
+
+// ConsistencyIssue 一处域名状态与服务器主机不一致；Fixed 表示已修正
+type ConsistencyIssue struct {
+	Type        string `json:"type"`
+	ServerTable string `json:"server_table"`
+	ServerID    int    `json:"server_id"`
+	Host        string `json:"host"`
+	DomainID    uint   `json:"domain_id,omitempty"`
+	Domain      string `json:"domain,omitempty"`
+	Fixed       bool   `json:"fixed"`
+}
+
+// 比较各服务器的当前主机与 server_domains 的 in_use 标记，返回不一致之处；fix 为 true 时修正 in_use 标记
+// （只修改不一致的行，保留已有的 last_used_time，从未使用过的域名标记为使用中时记为当前时间），
+// 主机不在域名池中及服务器已删除只报告。
+// 某个表读取失败时跳过该表继续检查，返回第一个错误
+func auditDomainConsistency(t *Tenant, fix bool) ([]ConsistencyIssue, error) {
+	issues := []ConsistencyIssue{}
+	now := time.Now().Unix()
+	var firstErr error
+	archived := archivedServerRecords(t.DB)
+	grace := graceDomainIDs(t.DB)
+	for _, table := range serverTables(t) {
+		var records []struct {
+			ID   int
+			Host string
+		}
+		if err := t.DB.Table(table).Select(serverSelect(table, "id", "host")).Find(&records).Error; err != nil {
+			log.Printf("校对: 从表 %s 获取服务器失败: %v", table, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("从表 %s 获取服务器失败: %v", table, err)
+			}
+			continue
+		}
+		hosts := make(map[int]string, len(records))
+		for _, r := range records {
+			hosts[r.ID] = r.Host
+		}
+		var domains []ServerDomain
+		if err := t.DB.Select("id, server_id, domain, in_use").Where("server_table = ?", table).Find(&domains).Error; err != nil {
+			log.Printf("校对: 获取表 %s 的域名失败: %v", table, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("获取表 %s 的域名失败: %v", table, err)
+			}
+			continue
+		}
+		inPool := map[string]bool{}
+		missingServers := map[int]bool{}
+		for _, d := range domains {
+			host, exists := hosts[d.ServerID]
+			inPool[strconv.Itoa(d.ServerID)+":"+d.Domain] = true
+			if !exists && !missingServers[d.ServerID] && !archived[table+":"+strconv.Itoa(d.ServerID)] {
+				missingServers[d.ServerID] = true
+				issues = append(issues, ConsistencyIssue{Type: issueServerMissing, ServerTable: table, ServerID: d.ServerID})
+			}
+			current := exists && host != "" && host == d.Domain
+			issue := ConsistencyIssue{ServerTable: table, ServerID: d.ServerID, Host: host, DomainID: d.ID, Domain: d.Domain}
+			switch {
+			case d.InUse == 1 && !current && !grace[d.ID]:
+				issue.Type = issueOrphanInUse
+			case d.InUse == 0 && current:
+				issue.Type = issueMissingInUse
+			default:
+				continue
+			}
+			if fix {
+				fixed, err := fixDomainUsage(t, table, d, now)
+				switch {
+				case err != nil:
+					log.Printf("校对: 修正域名 %s 的使用中标记失败: 表=%s, 服务器ID=%d, 错误=%v", d.Domain, table, d.ServerID, err)
+				case !fixed:
+					log.Printf("校对: 域名 %s 重新读取后已一致（期间可能发生轮换），不修改: 表=%s, 服务器ID=%d", d.Domain, table, d.ServerID)
+				case issue.Type == issueOrphanInUse:
+					issue.Fixed = true
+					log.Printf("校对: 域名 %s 标记为使用中但服务器未引用（当前主机=%q），已释放: 表=%s, 服务器ID=%d", d.Domain, host, table, d.ServerID)
+				default:
+					issue.Fixed = true
+					log.Printf("校对: 域名 %s 为服务器当前主机但未标记使用中，已标记: 表=%s, 服务器ID=%d", d.Domain, table, d.ServerID)
+				}
+			}
+			issues = append(issues, issue)
+		}
+		for _, r := range records {
+			if r.Host != "" && !inPool[strconv.Itoa(r.ID)+":"+r.Host] {
+				issues = append(issues, ConsistencyIssue{Type: issueHostNotInPool, ServerTable: table, ServerID: r.ID, Host: r.Host})
+			}
+		}
+	}
+	return issues, firstErr
+}
+
+// 修正单个域名的 in_use 标记：在事务中锁定所属服务器行（SELECT ... FOR UPDATE），重新读取当前主机、
+// 域名状态及宽限记录后再判断，避免轮换在比较期间提交时按旧主机释放刚分配的新域名；
+// 重新读取后已一致时不修改并返回 false。服务器已删除时按没有当前主机处理
+func fixDomainUsage(t *Tenant, table string, d ServerDomain, now int64) (bool, error) {
+	fixed := false
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		var server struct {
+			Host string
+		}
+		if err := tx.Table(table).Clauses(clause.Locking{Strength: "UPDATE"}).Select(serverSelect(table, "host")).
+			Where("id = ?", d.ServerID).First(&server).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var current ServerDomain
+		if err := tx.Select("id, domain, in_use").Where("id = ?", d.ID).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		isHost := server.Host != "" && server.Host == current.Domain
+		var result *gorm.DB
+		switch {
+		case current.InUse == 1 && !isHost && !graceDomainIDs(tx)[d.ID]:
+			result = tx.Model(&ServerDomain{}).Where("id = ? AND in_use = ?", d.ID, 1).Update("in_use", 0)
+		case current.InUse == 0 && isHost:
+			result = tx.Model(&ServerDomain{}).Where("id = ? AND in_use = ?", d.ID, 0).Updates(map[string]interface{}{
+				"in_use":         1,
+				"last_used_time": gorm.Expr("CASE WHEN last_used_time = 0 THEN ? ELSE last_used_time END", now),
+			})
+		default:
+			return nil
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		fixed = result.RowsAffected > 0
+		return nil
+	})
+	return fixed, err
+}
+
+// 按类型统计不一致数量
+func countIssues(issues []ConsistencyIssue) (map[string]int, int) {
+	counts := map[string]int{}
+	fixed := 0
+	for _, issue := range issues {
+		counts[issue.Type]++
+		if issue.Fixed {
+			fixed++
+		}
+	}
+	return counts, fixed
+}
+
+// 启动时校对域名状态与服务器主机并记录日志，只修正不一致的记录
+func startupConsistencyAudit(t *Tenant) {
+	issues, err := auditDomainConsistency(t, true)
+	if err != nil {
+		log.Printf("启动一致性检查未完成: 租户=%s, 错误=%v", t.Name, err)
+	}
+	if len(issues) == 0 && err == nil {
+		log.Printf("启动一致性检查通过: 租户=%s", t.Name)
+		return
+	}
+	counts, fixed := countIssues(issues)
+	log.Printf("启动一致性检查发现 %d 处不一致，修正 %d 处: 租户=%s, 分类=%v", len(issues), fixed, t.Name, counts)
+	for _, issue := range issues {
+		log.Printf("  不一致: 类型=%s, 表=%s, 服务器ID=%d, 主机=%q, 域名=%q, 已修正=%t", issue.Type, issue.ServerTable, issue.ServerID, issue.Host, issue.Domain, issue.Fixed)
+	}
+}
+
+// 注册一致性检查路由
+func registerConsistencyAuditRoutes(r *gin.Engine) {
+	// 检查域名 in_use 标记与服务器当前主机是否一致，默认只报告；dry_run=0 时修正，需确认令牌 audit-consistency
+	r.POST("/audit-consistency", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		fix := c.PostForm("dry_run") == "0"
+		if fix && !consumeConfirmToken(c, confirmAuditFix) {
+			return
+		}
+		start := time.Now()
+		issues, err := auditDomainConsistency(t, fix)
+		if err != nil {
+			log.Printf("一致性检查失败: 租户=%s, 错误=%v", t.Name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "一致性检查失败："+err.Error())
+			return
+		}
+		counts, fixed := countIssues(issues)
+		log.Printf("一致性检查完成: 租户=%s, 不一致=%d, 已修正=%d, 耗时=%s", t.Name, len(issues), fixed, time.Since(start))
+		if fixed > 0 {
+			recordAudit(t.DB, "audit_consistency", t.Name, operatorName(c), c.ClientIP(), fmt.Sprintf("不一致 %d 处，修正 %d 处", len(issues), fixed))
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("一致性检查完成：发现 %d 处不一致，修正 %d 处", len(issues), fixed),
+			"issues":  issues,
+			"counts":  counts,
+			"fixed":   fixed,
+			"dry_run": !fix,
+		})
+	})
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 连接所有租户数据库，迁移管理表并补齐服务器表所需的列
+func connectDatabase() {
+	names := append([]string{defaultTenantName}, configuredTenantNames()...)
+	for _, name := range names {
+		var tdb *gorm.DB
+		var err error
+		key := "tenants." + name
+		if name == defaultTenantName {
+			key = "database"
+		}
+		if devMode {
+			tdb, err = openDevDatabase(name)
+		} else {
+			tdb, err = openMySQL(key)
+		}
+		if err != nil {
+			log.Fatalf("数据库连接失败: 租户=%s, 错误=%v", name, err)
+		}
+
+		// 配置数据库连接池
+		sqlDB, err := tdb.DB()
+		if err != nil {
+			log.Fatalf("获取 sql.DB 失败: 租户=%s, 错误=%v", name, err)
+		}
+		sqlDB.SetMaxIdleConns(10)
+		sqlDB.SetMaxOpenConns(100)
+		sqlDB.SetConnMaxLifetime(time.Hour)
+
+		// 数据库查询追踪
+		setupDBTracing(tdb, name)
+
+		t := addTenant(name, tdb)
+		migrateTenantDatabase(t)
+		if devMode {
+			seedDevDomains(t)
+		} else {
+			setupReadReplica(t, key)
+		}
+		log.Printf("租户数据库已连接: %s", name)
+	}
+	db = defaultTenant().DB
+}
+
+// 迁移租户数据库的管理表并补齐服务器表所需的列
+func migrateTenantDatabase(t *Tenant) {
+	tdb := t.DB
+
+	// 自动迁移 server_domains 表
+	upgradeDomainUniqueIndex(tdb)
+	if err := tdb.AutoMigrate(&ServerDomain{}); err != nil {
+		log.Fatalf("自动迁移 server_domains 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移 users、api_tokens、remember_tokens 及确认令牌表（仅默认租户使用），用户表为空时创建管理员
+	if t.Name == defaultTenantName {
+		if err := tdb.AutoMigrate(&User{}, &ApiToken{}, &RememberToken{}, &UserSession{}, &ConfirmationToken{}); err != nil {
+			log.Fatal("自动迁移令牌表失败: ", err)
+		}
+		bootstrapAdminUser(tdb)
+	}
+
+	// 自动迁移 server_nodes 表
+	if err := tdb.AutoMigrate(&ServerNode{}); err != nil {
+		log.Fatalf("自动迁移 server_nodes 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移轮换历史及服务器设置表
+	if err := tdb.AutoMigrate(&RotationHistory{}, &ServerSetting{}); err != nil {
+		log.Fatalf("自动迁移轮换历史及服务器设置表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移节点流量表
+	if err := tdb.AutoMigrate(&NodeMetric{}); err != nil {
+		log.Fatalf("自动迁移 node_metrics 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移端口预设相关表
+	if err := tdb.AutoMigrate(&PortPreset{}, &PortPresetBinding{}); err != nil {
+		log.Fatalf("自动迁移端口预设表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移域名回收站表
+	if err := tdb.AutoMigrate(&DeletedDomain{}); err != nil {
+		log.Fatalf("自动迁移 deleted_domains 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移轮换策略表
+	if err := tdb.AutoMigrate(&RotationPolicy{}); err != nil {
+		log.Fatalf("自动迁移 rotation_policies 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移域名封锁记录表
+	if err := tdb.AutoMigrate(&DomainBlock{}); err != nil {
+		log.Fatalf("自动迁移 domain_blocks 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移轮换审批表
+	if err := tdb.AutoMigrate(&RotationApproval{}); err != nil {
+		log.Fatalf("自动迁移 rotation_approvals 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移服务器模板表
+	if err := tdb.AutoMigrate(&ServerTemplate{}); err != nil {
+		log.Fatalf("自动迁移 server_templates 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移服务器快照及异常变更表
+	if err := tdb.AutoMigrate(&ServerSnapshot{}, &ServerAnomaly{}); err != nil {
+		log.Fatalf("自动迁移服务器快照及异常变更表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移审计记录表
+	if err := tdb.AutoMigrate(&AuditLog{}); err != nil {
+		log.Fatalf("自动迁移 audit_logs 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移健康检查结果表
+	if err := tdb.AutoMigrate(&ServerHealth{}); err != nil {
+		log.Fatalf("自动迁移 server_healths 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移域名购买记录表
+	if err := tdb.AutoMigrate(&DomainPurchase{}); err != nil {
+		log.Fatalf("自动迁移 domain_purchases 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移域名汇总表，并注册域名写入时重算汇总的回调
+	if err := tdb.AutoMigrate(&DomainSummary{}); err != nil {
+		log.Fatalf("自动迁移 domain_summaries 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+	registerDomainSummaryHooks(tdb)
+
+	// 注册写入时递增数据版本的回调，用于只读接口的 ETag
+	registerDataVersionHooks(t)
+
+	// 写入服务器表时清空服务器元数据缓存
+	registerServerMetaInvalidation(t)
+
+	// 自动迁移节点 SSH 凭据表
+	if err := tdb.AutoMigrate(&NodeCredential{}); err != nil {
+		log.Fatalf("自动迁移 node_credentials 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移轮换宽限记录表
+	if err := tdb.AutoMigrate(&DomainTransition{}); err != nil {
+		log.Fatalf("自动迁移 domain_transitions 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移幂等键表
+	if err := tdb.AutoMigrate(&IdempotencyKey{}); err != nil {
+		log.Fatalf("自动迁移 idempotency_keys 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+
+	// 自动迁移服务器下线档案表，并由轮换历史补全已下线服务器的档案
+	if err := tdb.AutoMigrate(&ArchivedServer{}); err != nil {
+		log.Fatalf("自动迁移 archived_servers 表失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+	backfillArchivedServers(t)
+
+	// 为性能添加索引
+	if err := tdb.Exec("CREATE INDEX idx_server_domains_all ON server_domains (server_table, server_id, last_used_time)").Error; err != nil {
+		log.Printf("创建 server_domains 索引失败: 租户=%s, 错误=%v", t.Name, err)
+	} else {
+		log.Println("索引 idx_server_domains_all 已创建或已存在")
+	}
+
+	// 验证表创建
+	if !tdb.Migrator().HasTable("server_domains") {
+		log.Fatalf("server_domains 表未创建: 租户=%s", t.Name)
+	} else {
+		log.Println("server_domains 表验证或创建成功")
+	}
+
+	// 准备托管端点表
+	migrateManagedEndpoints(t)
+
+	// 检查并添加列到服务器表
+	for _, table := range serverTables(t) {
+		addColumnIfNotExists(tdb, table, serverColumn(table, "next_update_time"), "BIGINT DEFAULT 0")
+		addColumnIfNotExists(tdb, table, serverColumn(table, "last_update_status"), "VARCHAR(255) DEFAULT ''")
+		addColumnIfNotExists(tdb, table, serverColumn(table, "last_update_status_code"), "VARCHAR(32) DEFAULT ''")
+		if heartbeatEnabled() {
+			addColumnIfNotExists(tdb, table, serverColumn(table, "last_check_at"), "BIGINT DEFAULT 0")
+		}
+	}
+}
+
+// 检查并添加列
+func addColumnIfNotExists(tdb *gorm.DB, table, column, columnType string) {
+	if !tdb.Migrator().HasColumn(table, column) {
+		if err := tdb.Exec("ALTER TABLE " + table + " ADD " + column + " " + columnType).Error; err != nil {
+			log.Printf("向表 %s 添加列 %s 失败: %v", table, column, err)
+		} else {
+			log.Printf("向表 %s 添加列 %s 成功", table, column)
+		}
+	}
+}
+
+// 初始化示例数据
+func initSampleData(t *Tenant) {
+	var domainCount int64
+	t.DB.Model(&ServerDomain{}).Count(&domainCount)
+	if domainCount > 0 {
+		log.Println("server_domains 表已有数据，跳过示例数据初始化")
+		return
+	}
+	tables := panelServerTables
+	domains := []string{"domain1.com", "domain2.com", "domain3.com", "domain4.com", "321sds.com"}
+	for _, table := range tables {
+		var serverCount int64
+		t.DB.Table(table).Count(&serverCount)
+		if serverCount == 0 {
+			log.Printf("表 %s 无数据，插入示例服务器", table)
+			t.DB.Exec(fmt.Sprintf("INSERT INTO %s (id, name, port, server_port, host, `show`) VALUES (4, '%sServer4', '8080', 8080, '', 1)", table, table))
+		}
+		var serverIDs []int
+		t.DB.Table(table).Select("id").Find(&serverIDs)
+		for _, serverID := range serverIDs {
+			for i, d := range domains {
+				var existingDomain ServerDomain
+				if err := t.DB.Where("server_table = ? AND server_id = ? AND domain = ?", table, serverID, d).First(&existingDomain).Error; err == nil {
+					continue
+				}
+				if err := t.DB.Create(&ServerDomain{
+					ServerTable:  table,
+					ServerID:     serverID,
+					Domain:       d,
+					InUse:        0,
+					Order:        i + 1,
+					LastUsedTime: 0,
+				}).Error; err != nil {
+					log.Printf("插入示例域名 %s 失败: 表=%s, 服务器ID=%d, 错误=%v", d, table, serverID, err)
+				}
+			}
+		}
+	}
+	log.Println("server_domains 示例数据初始化完成")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/glebarez/sqlite"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 开发模式：使用内存 SQLite 并填充示例数据，关闭所有外部集成（DNS 校验、V2Board、中国访问检查）
+var devMode bool
+
+// 开发模式下模拟的面板服务器表结构，列名按 [columns.<表名>] 映射
+func devServerTableSchema(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id INTEGER PRIMARY KEY,
+	%s VARCHAR(255) NOT NULL DEFAULT '',
+	%s VARCHAR(16) NOT NULL DEFAULT '',
+	%s INTEGER NOT NULL DEFAULT 0,
+	%s VARCHAR(255) NOT NULL DEFAULT '',
+	%s TINYINT NOT NULL DEFAULT 0,
+	%s BIGINT NOT NULL DEFAULT 0
+)`, table, quotedServerColumn(table, "name"), quotedServerColumn(table, "port"), quotedServerColumn(table, "server_port"),
+		quotedServerColumn(table, "host"), quotedServerColumn(table, "show"), quotedServerColumn(table, "updated_at"))
+}
+
+// 打开开发模式数据库（每个租户一个）并创建、填充面板服务器表
+func openDevDatabase(tenant string) (*gorm.DB, error) {
+	// 共享缓存保证连接池中的所有连接访问同一个内存数据库
+	devDB, err := gorm.Open(sqlite.Open("file:server_manager_dev_"+tenant+"?mode=memory&cache=shared&_pragma=busy_timeout(5000)"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range panelServerTables {
+		if err := devDB.Exec(devServerTableSchema(table)).Error; err != nil {
+			return nil, fmt.Errorf("创建表 %s 失败: %v", table, err)
+		}
+		var count int64
+		devDB.Table(table).Count(&count)
+		if count > 0 {
+			continue
+		}
+		for i := 1; i <= 2; i++ {
+			if err := devDB.Exec("INSERT INTO "+table+" (id, "+quotedServerColumn(table, "name")+", "+quotedServerColumn(table, "port")+", "+
+				quotedServerColumn(table, "server_port")+", "+quotedServerColumn(table, "host")+", "+quotedServerColumn(table, "show")+") VALUES (?, ?, ?, ?, '', 1)",
+				i, fmt.Sprintf("%s-dev-%d", table, i), "8080", 8080).Error; err != nil {
+				return nil, fmt.Errorf("填充表 %s 失败: %v", table, err)
+			}
+		}
+		// VLESS 节点带有 TLS 及传输设置 JSON，用于调试 SNI/伪装域名改写
+		if table == "v2_server_vless" {
+			for _, column := range []string{"tls_settings", "network_settings"} {
+				if err := devDB.Exec("ALTER TABLE " + table + " ADD COLUMN " + quotedServerColumn(table, column) + " TEXT").Error; err != nil {
+					return nil, fmt.Errorf("添加列 %s.%s 失败: %v", table, column, err)
+				}
+			}
+			if err := devDB.Table(table).Where("1 = 1").Updates(serverFields(table, map[string]interface{}{
+				"tls_settings":     `{"server_name":"","allow_insecure":0}`,
+				"network_settings": `{"path":"/ws","headers":{"Host":""}}`,
+			})).Error; err != nil {
+				return nil, fmt.Errorf("填充表 %s 失败: %v", table, err)
+			}
+		}
+	}
+	log.Printf("开发模式：已为租户 %s 创建内存 SQLite 数据库并填充示例服务器，外部集成已禁用", tenant)
+	return devDB, nil
+}
+
+// 为开发模式的示例服务器填充互不重复的示例域名（域名在租户内唯一）
+func seedDevDomains(t *Tenant) {
+	var count int64
+	t.DB.Model(&ServerDomain{}).Count(&count)
+	if count > 0 {
+		return
+	}
+	suffix := "dev.test"
+	if t.Name != defaultTenantName {
+		suffix = t.Name + "." + suffix
+	}
+	for _, table := range panelServerTables {
+		var serverIDs []int
+		t.DB.Table(table).Pluck("id", &serverIDs)
+		for _, id := range serverIDs {
+			for i := 1; i <= 5; i++ {
+				domain := fmt.Sprintf("d%d.%s-%d.%s", i, table[len("v2_server_"):], id, suffix)
+				if err := addServerDomain(t, table, id, domain); err != nil {
+					log.Printf("填充示例域名 %s 失败: %v", domain, err)
+				}
+			}
+		}
+	}
+}
+
+// 读取开发模式开关
+func loadDevMode() {
+	devMode = viper.GetBool("dev.enabled")
+}
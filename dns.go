@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// ServerNode 结构体，记录服务器对应节点的 IP，用于域名解析校验
+type ServerNode struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ServerTable string `gorm:"column:server_table;type:varchar(255);uniqueIndex:unique_server_node;not null" json:"server_table"`
+	ServerID    int    `gorm:"column:server_id;uniqueIndex:unique_server_node;not null" json:"server_id"`
+	IP          string `gorm:"column:ip;type:varchar(64);not null" json:"ip"`
+}
+
+// 域名解析校验状态
+const (
+	dnsStatusOK       = "ok"
+	dnsStatusMismatch = "mismatch"
+	dnsStatusError    = "error"
+	dnsStatusPending  = "pending" // 新购域名，等待解析生效
+)
+
+// 获取服务器节点 IP：优先 server_nodes 表，其次配置 dns.nodeIPs（键为 "表名:ID"）
+func lookupNodeIP(tx *gorm.DB, table string, id int) string {
+	var node ServerNode
+	if err := tx.Where("server_table = ? AND server_id = ?", table, id).First(&node).Error; err == nil && node.IP != "" {
+		return node.IP
+	}
+	return viper.GetStringMapString("dns.nodeIPs")[strings.ToLower(fmt.Sprintf("%s:%d", table, id))]
+}
+
+// 解析域名并判断是否指向节点 IP，返回状态及解析结果说明
+func verifyDomainDNS(domain, nodeIP string) (string, string) {
+	timeout := viper.GetInt("dns.timeoutSeconds")
+	if timeout <= 0 {
+		timeout = 5
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, domain)
+	if err != nil {
+		return dnsStatusError, err.Error()
+	}
+	for _, addr := range addrs {
+		if addr == nodeIP {
+			return dnsStatusOK, strings.Join(addrs, ",")
+		}
+	}
+	return dnsStatusMismatch, strings.Join(addrs, ",")
+}
+
+// 是否在分配前校验域名解析（dns.verify），开发模式下关闭
+func dnsVerifyEnabled() bool {
+	return !devMode && viper.GetBool("dns.verify")
+}
+
+// 按顺序校验候选域名的解析，返回第一个解析到节点 IP 的域名的ID；节点 IP 未知时返回 nil（不限制）。
+// 需要网络查询，在轮换事务开始前调用，避免持有行锁等待解析；校验结果直接写入 tdb
+func verifyCandidateDNS(tdb *gorm.DB, table string, id int, candidates []ServerDomain, now int64) (map[uint]bool, error) {
+	nodeIP := lookupNodeIP(tdb, table, id)
+	if nodeIP == "" {
+		log.Printf("未配置节点 IP，跳过域名解析校验: 表=%s, ID=%d", table, id)
+		return nil, nil
+	}
+	for _, d := range candidates {
+		status, detail := verifyDomainDNS(d.Domain, nodeIP)
+		// 校验结果在事务外写入，即使本次更新回滚也保留标记
+		if err := tdb.Model(&ServerDomain{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+			"dns_status":       status,
+			"dns_detail":       truncate(detail, 255),
+			"dns_checked_time": now,
+		}).Error; err != nil {
+			log.Printf("记录域名 %s 解析校验结果失败: 表=%s, ID=%d, 错误=%v", d.Domain, table, id, err)
+		}
+		if status == dnsStatusOK {
+			log.Printf("域名 %s 解析校验通过: 节点IP=%s, 表=%s, ID=%d", d.Domain, nodeIP, table, id)
+			return map[uint]bool{d.ID: true}, nil
+		}
+		log.Printf("域名 %s 解析校验未通过，跳过: 状态=%s, 结果=%s, 节点IP=%s, 表=%s, ID=%d", d.Domain, status, detail, nodeIP, table, id)
+	}
+	return nil, fmt.Errorf("%w（%d 个候选域名均未解析到节点 IP %s）", errNoAvailableDomain, len(candidates), nodeIP)
+}
+
+// 截断字符串到指定字节数
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// 注册节点 IP 管理路由
+func registerServerNodeRoutes(r *gin.Engine) {
+	// 设置服务器节点 IP，ip 为空表示删除
+	r.POST("/server-node-ip", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		if !isValidServerTable(table) {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		ip := strings.TrimSpace(c.PostForm("ip"))
+		if ip == "" {
+			if err := tdb.Where("server_table = ? AND server_id = ?", table, id).Delete(&ServerNode{}).Error; err != nil {
+				log.Printf("删除节点 IP 失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+				respondError(c, http.StatusInternalServerError, codeInternal, "删除节点 IP 失败："+err.Error())
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "节点 IP 已删除"})
+			return
+		}
+		if net.ParseIP(ip) == nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 IP 地址")
+			return
+		}
+		node := ServerNode{ServerTable: table, ServerID: id, IP: ip}
+		var existing ServerNode
+		if err := tdb.Where("server_table = ? AND server_id = ?", table, id).First(&existing).Error; err == nil {
+			node.ID = existing.ID
+		}
+		if err := tdb.Save(&node).Error; err != nil {
+			log.Printf("保存节点 IP 失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存节点 IP 失败："+err.Error())
+			return
+		}
+		log.Printf("保存节点 IP 成功: 表=%s, ID=%d, IP=%s", table, id, ip)
+		c.JSON(http.StatusOK, gin.H{"message": "节点 IP 已设置为 " + ip})
+	})
+}
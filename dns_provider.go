@@ -0,0 +1,610 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"golang.org/x/net/publicsuffix"
+	"gorm.io/gorm"
+)
+
+// DNSProvider DNS 服务商，轮换时将新域名解析到节点 IP；新增服务商只需实现此接口并在 newDNSProvider 中注册
+type DNSProvider interface {
+	Name() string
+	// 将 zone 下的 fqdn 记录设置为 value，记录不存在时创建
+	UpsertRecord(ctx context.Context, zone, fqdn, recordType, value string) error
+}
+
+// 已配置的 DNS 服务商（[dnsproviders.<名称>]，type 为 cloudflare、dnspod、aliyun、namecheap 或 rfc2136），首次使用时加载
+var (
+	dnsProvidersOnce sync.Once
+	dnsProviders     map[string]DNSProvider
+	dnsProviderTypes map[string]string
+)
+
+func loadDNSProviders() {
+	dnsProviders = map[string]DNSProvider{}
+	dnsProviderTypes = map[string]string{}
+	for name := range viper.GetStringMap("dnsproviders") {
+		cfg := viper.Sub("dnsproviders." + name)
+		if cfg == nil {
+			continue
+		}
+		provider, err := newDNSProvider(name, cfg)
+		if err != nil {
+			log.Printf("DNS 服务商 %s 配置无效: %v", name, err)
+			continue
+		}
+		dnsProviders[name] = provider
+		dnsProviderTypes[name] = cfg.GetString("type")
+	}
+}
+
+func newDNSProvider(name string, cfg *viper.Viper) (DNSProvider, error) {
+	ttl := cfg.GetInt("ttl")
+	if ttl <= 0 {
+		ttl = 600
+	}
+	client := &http.Client{}
+	switch cfg.GetString("type") {
+	case "cloudflare":
+		if cfg.GetString("token") == "" {
+			return nil, errors.New("缺少 token")
+		}
+		return &cloudflareProvider{name: name, token: cfg.GetString("token"), ttl: ttl, client: client}, nil
+	case "dnspod":
+		if cfg.GetString("id") == "" || cfg.GetString("token") == "" {
+			return nil, errors.New("缺少 id 或 token")
+		}
+		return &dnspodProvider{name: name, loginToken: cfg.GetString("id") + "," + cfg.GetString("token"), ttl: ttl, client: client}, nil
+	case "aliyun":
+		if cfg.GetString("accessKeyID") == "" || cfg.GetString("accessKeySecret") == "" {
+			return nil, errors.New("缺少 accessKeyID 或 accessKeySecret")
+		}
+		return &aliyunProvider{name: name, keyID: cfg.GetString("accessKeyID"), keySecret: cfg.GetString("accessKeySecret"), ttl: ttl, client: client}, nil
+	case "namecheap":
+		if cfg.GetString("apiUser") == "" || cfg.GetString("apiKey") == "" || cfg.GetString("clientIP") == "" {
+			return nil, errors.New("缺少 apiUser、apiKey 或 clientIP")
+		}
+		return &namecheapProvider{name: name, apiUser: cfg.GetString("apiUser"), apiKey: cfg.GetString("apiKey"), clientIP: cfg.GetString("clientIP"), ttl: ttl, client: client}, nil
+	case "rfc2136":
+		if cfg.GetString("server") == "" {
+			return nil, errors.New("缺少 server")
+		}
+		return &rfc2136Provider{
+			name:    name,
+			server:  cfg.GetString("server"),
+			keyFile: cfg.GetString("keyFile"),
+			key:     cfg.GetString("key"),
+			ttl:     ttl,
+		}, nil
+	}
+	return nil, fmt.Errorf("不支持的类型: %q", cfg.GetString("type"))
+}
+
+// 域名所属区域与服务商的映射，dns.zones 每项格式为 "区域=服务商"
+func dnsZoneMappings() map[string]string {
+	zones := map[string]string{}
+	for _, item := range viper.GetStringSlice("dns.zones") {
+		zone, provider, ok := strings.Cut(item, "=")
+		if !ok {
+			log.Printf("dns.zones 配置项无效: %s", item)
+			continue
+		}
+		zones[strings.ToLower(strings.TrimSpace(zone))] = strings.TrimSpace(provider)
+	}
+	return zones
+}
+
+// 确定域名使用的服务商及所属区域：优先域名单独指定的服务商，其次 dns.zones 中最长匹配的区域，最后 dns.defaultProvider；
+// 区域未在 dns.zones 中配置时取注册域名（eTLD+1）。未配置服务商时返回 nil
+func dnsProviderFor(domain ServerDomain) (DNSProvider, string, error) {
+	dnsProvidersOnce.Do(loadDNSProviders)
+	name := domain.DNSProvider
+	zone := ""
+	for z, provider := range dnsZoneMappings() {
+		if (domain.Domain == z || strings.HasSuffix(domain.Domain, "."+z)) && len(z) > len(zone) {
+			zone = z
+			if domain.DNSProvider == "" {
+				name = provider
+			}
+		}
+	}
+	if name == "" {
+		name = viper.GetString("dns.defaultProvider")
+	}
+	if name == "" {
+		return nil, "", nil
+	}
+	provider, ok := dnsProviders[name]
+	if !ok {
+		return nil, "", fmt.Errorf("未配置 DNS 服务商 %s", name)
+	}
+	if zone == "" {
+		var err error
+		if zone, err = publicsuffix.EffectiveTLDPlusOne(domain.Domain); err != nil {
+			return nil, "", fmt.Errorf("无法确定域名 %s 所属区域: %v", domain.Domain, err)
+		}
+	}
+	return provider, zone, nil
+}
+
+// 轮换时将新域名解析到节点 IP（dns.autoUpdate 开启时），未配置节点 IP 或服务商时跳过
+func syncDomainRecord(tx *gorm.DB, table string, id int, domain ServerDomain) error {
+	if devMode || !viper.GetBool("dns.autoUpdate") {
+		return nil
+	}
+	nodeIP := lookupNodeIP(tx, table, id)
+	if nodeIP == "" {
+		log.Printf("未配置节点 IP，跳过域名解析更新: 表=%s, ID=%d", table, id)
+		return nil
+	}
+	provider, zone, err := dnsProviderFor(domain)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		log.Printf("域名 %s 未配置 DNS 服务商，跳过解析更新: 表=%s, ID=%d", domain.Domain, table, id)
+		return nil
+	}
+	recordType := "A"
+	if ip := net.ParseIP(nodeIP); ip != nil && ip.To4() == nil {
+		recordType = "AAAA"
+	}
+	timeout := viper.GetInt("dns.providerTimeoutSeconds")
+	if timeout <= 0 {
+		timeout = 20
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	if err := provider.UpsertRecord(ctx, zone, domain.Domain, recordType, nodeIP); err != nil {
+		return fmt.Errorf("%s: %v", provider.Name(), err)
+	}
+	log.Printf("域名解析已更新: 服务商=%s, 区域=%s, 域名=%s, %s=%s, 表=%s, ID=%d", provider.Name(), zone, domain.Domain, recordType, nodeIP, table, id)
+	return nil
+}
+
+// 记录在区域内的主机名，根域名为 "@"
+func relativeRecordName(zone, fqdn string) string {
+	if fqdn == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(fqdn, "."+zone)
+}
+
+// 发送请求并按 JSON 解析响应
+func doJSONRequest(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("响应无效（状态码 %d）: %s", resp.StatusCode, truncate(string(body), 200))
+	}
+	return nil
+}
+
+// Cloudflare：使用 API Token（需 Zone.DNS 编辑权限）
+type cloudflareProvider struct {
+	name   string
+	token  string
+	ttl    int
+	client *http.Client
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (p *cloudflareProvider) Name() string { return p.name }
+
+func (p *cloudflareProvider) call(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "https://api.cloudflare.com/client/v4"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+	var resp cloudflareResponse
+	if err := doJSONRequest(p.client, req, &resp); err != nil {
+		return err
+	}
+	if !resp.Success {
+		var msgs []string
+		for _, e := range resp.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("Cloudflare 返回错误: %s", strings.Join(msgs, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(resp.Result, out)
+	}
+	return nil
+}
+
+func (p *cloudflareProvider) UpsertRecord(ctx context.Context, zone, fqdn, recordType, value string) error {
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(zone), nil, &zones); err != nil {
+		return err
+	}
+	if len(zones) == 0 {
+		return fmt.Errorf("Cloudflare 中不存在区域 %s", zone)
+	}
+	zoneID := zones[0].ID
+	var records []struct {
+		ID      string `json:"id"`
+		Content string `json:"content"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/zones/"+zoneID+"/dns_records?type="+recordType+"&name="+url.QueryEscape(fqdn), nil, &records); err != nil {
+		return err
+	}
+	record := map[string]interface{}{"type": recordType, "name": fqdn, "content": value, "ttl": p.ttl, "proxied": false}
+	if len(records) == 0 {
+		return p.call(ctx, http.MethodPost, "/zones/"+zoneID+"/dns_records", record, nil)
+	}
+	if records[0].Content == value {
+		return nil
+	}
+	return p.call(ctx, http.MethodPut, "/zones/"+zoneID+"/dns_records/"+records[0].ID, record, nil)
+}
+
+// DNSPod：使用 API Token（id + token）
+type dnspodProvider struct {
+	name       string
+	loginToken string
+	ttl        int
+	client     *http.Client
+}
+
+type dnspodResponse struct {
+	Status struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+	Records []struct {
+		ID    string `json:"id"`
+		Value string `json:"value"`
+	} `json:"records"`
+}
+
+func (p *dnspodProvider) Name() string { return p.name }
+
+func (p *dnspodProvider) call(ctx context.Context, action string, form url.Values) (*dnspodResponse, error) {
+	form.Set("login_token", p.loginToken)
+	form.Set("format", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://dnsapi.cn/"+action, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var resp dnspodResponse
+	if err := doJSONRequest(p.client, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (p *dnspodProvider) UpsertRecord(ctx context.Context, zone, fqdn, recordType, value string) error {
+	sub := relativeRecordName(zone, fqdn)
+	resp, err := p.call(ctx, "Record.List", url.Values{"domain": {zone}, "sub_domain": {sub}, "record_type": {recordType}})
+	if err != nil {
+		return err
+	}
+	// 10 表示记录列表为空
+	if resp.Status.Code != "1" && resp.Status.Code != "10" {
+		return fmt.Errorf("DNSPod 返回错误: %s", resp.Status.Message)
+	}
+	form := url.Values{
+		"domain":      {zone},
+		"sub_domain":  {sub},
+		"record_type": {recordType},
+		"record_line": {"默认"},
+		"value":       {value},
+		"ttl":         {strconv.Itoa(p.ttl)},
+	}
+	action := "Record.Create"
+	if len(resp.Records) > 0 {
+		if resp.Records[0].Value == value {
+			return nil
+		}
+		action = "Record.Modify"
+		form.Set("record_id", resp.Records[0].ID)
+	}
+	if resp, err = p.call(ctx, action, form); err != nil {
+		return err
+	}
+	if resp.Status.Code != "1" {
+		return fmt.Errorf("DNSPod 返回错误: %s", resp.Status.Message)
+	}
+	return nil
+}
+
+// 阿里云云解析：使用 AccessKey，按 RPC 签名方式调用
+type aliyunProvider struct {
+	name      string
+	keyID     string
+	keySecret string
+	ttl       int
+	client    *http.Client
+}
+
+func (p *aliyunProvider) Name() string { return p.name }
+
+// 阿里云要求的 URL 编码
+func aliyunEscape(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
+
+func (p *aliyunProvider) call(ctx context.Context, params map[string]string, out interface{}) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	params["Format"] = "JSON"
+	params["Version"] = "2015-01-09"
+	params["AccessKeyId"] = p.keyID
+	params["SignatureMethod"] = "HMAC-SHA1"
+	params["SignatureVersion"] = "1.0"
+	params["SignatureNonce"] = hex.EncodeToString(nonce)
+	params["Timestamp"] = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, aliyunEscape(k)+"="+aliyunEscape(params[k]))
+	}
+	query := strings.Join(pairs, "&")
+	mac := hmac.New(sha1.New, []byte(p.keySecret+"&"))
+	mac.Write([]byte("GET&" + aliyunEscape("/") + "&" + aliyunEscape(query)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://alidns.aliyuncs.com/?"+query+"&Signature="+aliyunEscape(signature), nil)
+	if err != nil {
+		return err
+	}
+	var raw json.RawMessage
+	if err := doJSONRequest(p.client, req, &raw); err != nil {
+		return err
+	}
+	var apiErr struct {
+		Code    string `json:"Code"`
+		Message string `json:"Message"`
+	}
+	if err := json.Unmarshal(raw, &apiErr); err == nil && apiErr.Code != "" {
+		return fmt.Errorf("阿里云返回错误: %s %s", apiErr.Code, apiErr.Message)
+	}
+	if out != nil {
+		return json.Unmarshal(raw, out)
+	}
+	return nil
+}
+
+func (p *aliyunProvider) UpsertRecord(ctx context.Context, zone, fqdn, recordType, value string) error {
+	var list struct {
+		DomainRecords struct {
+			Record []struct {
+				RecordID string `json:"RecordId"`
+				Value    string `json:"Value"`
+			} `json:"Record"`
+		} `json:"DomainRecords"`
+	}
+	if err := p.call(ctx, map[string]string{"Action": "DescribeSubDomainRecords", "SubDomain": fqdn, "Type": recordType, "DomainName": zone}, &list); err != nil {
+		return err
+	}
+	params := map[string]string{"RR": relativeRecordName(zone, fqdn), "Type": recordType, "Value": value, "TTL": strconv.Itoa(p.ttl)}
+	if records := list.DomainRecords.Record; len(records) > 0 {
+		if records[0].Value == value {
+			return nil
+		}
+		params["Action"] = "UpdateDomainRecord"
+		params["RecordId"] = records[0].RecordID
+	} else {
+		params["Action"] = "AddDomainRecord"
+		params["DomainName"] = zone
+	}
+	return p.call(ctx, params, nil)
+}
+
+// Namecheap：setHosts 会覆盖区域内全部记录，因此先读取现有记录再整体写回
+type namecheapProvider struct {
+	name     string
+	apiUser  string
+	apiKey   string
+	clientIP string
+	ttl      int
+	client   *http.Client
+}
+
+type namecheapHost struct {
+	Name    string `xml:"Name,attr"`
+	Type    string `xml:"Type,attr"`
+	Address string `xml:"Address,attr"`
+	MXPref  string `xml:"MXPref,attr"`
+	TTL     string `xml:"TTL,attr"`
+}
+
+type namecheapResponse struct {
+	Status string `xml:"Status,attr"`
+	Errors []struct {
+		Message string `xml:",chardata"`
+	} `xml:"Errors>Error"`
+	Hosts  []namecheapHost `xml:"CommandResponse>DomainDNSGetHostsResult>host"`
+	Checks []struct {
+		Domain       string `xml:"Domain,attr"`
+		Available    bool   `xml:"Available,attr"`
+		IsPremium    bool   `xml:"IsPremiumName,attr"`
+		PremiumPrice string `xml:"PremiumRegistrationPrice,attr"`
+	} `xml:"CommandResponse>DomainCheckResult"`
+	Created struct {
+		Registered bool `xml:"Registered,attr"`
+	} `xml:"CommandResponse>DomainCreateResult"`
+}
+
+func (p *namecheapProvider) Name() string { return p.name }
+
+func (p *namecheapProvider) call(ctx context.Context, form url.Values) (*namecheapResponse, error) {
+	form.Set("ApiUser", p.apiUser)
+	form.Set("ApiKey", p.apiKey)
+	form.Set("UserName", p.apiUser)
+	form.Set("ClientIp", p.clientIP)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.namecheap.com/xml.response", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result namecheapResponse
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("响应无效（状态码 %d）: %v", resp.StatusCode, err)
+	}
+	if result.Status != "OK" {
+		var msgs []string
+		for _, e := range result.Errors {
+			msgs = append(msgs, strings.TrimSpace(e.Message))
+		}
+		return nil, fmt.Errorf("Namecheap 返回错误: %s", strings.Join(msgs, "; "))
+	}
+	return &result, nil
+}
+
+func (p *namecheapProvider) UpsertRecord(ctx context.Context, zone, fqdn, recordType, value string) error {
+	sld, tld, ok := strings.Cut(zone, ".")
+	if !ok {
+		return fmt.Errorf("无效的区域: %s", zone)
+	}
+	current, err := p.call(ctx, url.Values{"Command": {"namecheap.domains.dns.getHosts"}, "SLD": {sld}, "TLD": {tld}})
+	if err != nil {
+		return err
+	}
+	name := relativeRecordName(zone, fqdn)
+	hosts := current.Hosts
+	found := false
+	for i, h := range hosts {
+		if strings.EqualFold(h.Name, name) && h.Type == recordType {
+			if h.Address == value {
+				return nil
+			}
+			hosts[i].Address = value
+			found = true
+		}
+	}
+	if !found {
+		hosts = append(hosts, namecheapHost{Name: name, Type: recordType, Address: value, TTL: strconv.Itoa(p.ttl)})
+	}
+	form := url.Values{"Command": {"namecheap.domains.dns.setHosts"}, "SLD": {sld}, "TLD": {tld}}
+	for i, h := range hosts {
+		n := strconv.Itoa(i + 1)
+		form.Set("HostName"+n, h.Name)
+		form.Set("RecordType"+n, h.Type)
+		form.Set("Address"+n, h.Address)
+		if h.TTL != "" {
+			form.Set("TTL"+n, h.TTL)
+		}
+		if h.MXPref != "" {
+			form.Set("MXPref"+n, h.MXPref)
+		}
+	}
+	_, err = p.call(ctx, form)
+	return err
+}
+
+// RFC2136 动态更新：调用 nsupdate 命令，TSIG 密钥通过 keyFile（-k）或 key（-y，格式 算法:名称:密钥）指定
+type rfc2136Provider struct {
+	name    string
+	server  string
+	keyFile string
+	key     string
+	ttl     int
+}
+
+func (p *rfc2136Provider) Name() string { return p.name }
+
+func (p *rfc2136Provider) UpsertRecord(ctx context.Context, zone, fqdn, recordType, value string) error {
+	var args []string
+	if p.keyFile != "" {
+		args = append(args, "-k", p.keyFile)
+	} else if p.key != "" {
+		args = append(args, "-y", p.key)
+	}
+	host, port, err := net.SplitHostPort(p.server)
+	if err != nil {
+		host, port = p.server, "53"
+	}
+	script := fmt.Sprintf("server %s %s\nzone %s\nupdate delete %s. %s\nupdate add %s. %d %s %s\nsend\n",
+		host, port, zone, fqdn, recordType, fqdn, p.ttl, recordType, value)
+	cmd := exec.CommandContext(ctx, "nsupdate", args...)
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nsupdate 失败: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// 注册 DNS 服务商路由
+func registerDNSProviderRoutes(r *gin.Engine) {
+	// 列出已配置的 DNS 服务商
+	r.GET("/dns-providers", authMiddleware, func(c *gin.Context) {
+		dnsProvidersOnce.Do(loadDNSProviders)
+		providers := make([]gin.H, 0, len(dnsProviders))
+		for name := range dnsProviders {
+			providers = append(providers, gin.H{"name": name, "type": dnsProviderTypes[name]})
+		}
+		sort.Slice(providers, func(i, j int) bool { return providers[i]["name"].(string) < providers[j]["name"].(string) })
+		c.JSON(http.StatusOK, gin.H{
+			"providers":        providers,
+			"default_provider": viper.GetString("dns.defaultProvider"),
+			"zones":            dnsZoneMappings(),
+			"auto_update":      viper.GetBool("dns.autoUpdate"),
+		})
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 上下文标记：正在写入别名关联，写入触发的回调不再重复关联
+type domainAliasLinkingKey struct{}
+
+// 域名的别名键：大小写、末尾的点及 www. 前缀不同的域名视为同一域名
+func domainAliasKey(domain string) string {
+	d := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if strings.HasPrefix(d, "www.") && strings.Count(d, ".") >= 2 {
+		d = d[len("www."):]
+	}
+	return d
+}
+
+// 重新关联服务器域名池中的别名：同一别名键的域名中，与别名键完全相同的（裸域名、小写）或 ID 最小的为主域名，
+// 其余记录 alias_of 指向主域名。别名不计入可用数，也不参与轮换
+func linkDomainAliases(tx *gorm.DB, table string, id int) error {
+	ctx := tx.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if ctx.Value(domainAliasLinkingKey{}) != nil {
+		return nil
+	}
+	var domains []ServerDomain
+	if err := tx.Select("id", "domain", "alias_of").Scopes(serverDomainScope(table, id)).Order("id").Find(&domains).Error; err != nil {
+		return err
+	}
+	groups := map[string][]ServerDomain{}
+	var keys []string
+	for _, d := range domains {
+		key := domainAliasKey(d.Domain)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], d)
+	}
+	changes := map[uint][]uint{} // alias_of -> 域名 ID
+	for _, key := range keys {
+		group := groups[key]
+		primary := group[0]
+		for _, d := range group {
+			if d.Domain == key {
+				primary = d
+				break
+			}
+		}
+		for _, d := range group {
+			want := primary.ID
+			if d.ID == primary.ID {
+				want = 0
+			}
+			if d.AliasOf != want {
+				changes[want] = append(changes[want], d.ID)
+				if want != 0 {
+					log.Printf("检测到域名别名: %s 为 %s 的别名, 表=%s, ID=%d", d.Domain, primary.Domain, table, id)
+				}
+			}
+		}
+	}
+	linking := tx.Session(&gorm.Session{NewDB: true, Context: context.WithValue(ctx, domainAliasLinkingKey{}, true)})
+	for aliasOf, ids := range changes {
+		if err := linking.Model(&ServerDomain{}).Where("id IN ?", ids).Update("alias_of", aliasOf).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 关联租户全部服务器的域名别名（启动时处理已有数据）
+func linkAllDomainAliases(t *Tenant) {
+	var servers []DomainSummary
+	if err := t.DB.Model(&ServerDomain{}).Distinct("server_table", "server_id").Find(&servers).Error; err != nil {
+		log.Printf("获取域名所属服务器失败: 租户=%s, 错误=%v", t.Name, err)
+		return
+	}
+	for _, s := range servers {
+		if err := linkDomainAliases(t.DB, s.ServerTable, s.ServerID); err != nil {
+			log.Printf("关联域名别名失败: 表=%s, ID=%d, 错误=%v", s.ServerTable, s.ServerID, err)
+		}
+	}
+}
+
+// DomainAlias 别名及其主域名
+type DomainAlias struct {
+	ServerTable string `json:"server_table"`
+	ServerID    int    `json:"server_id"`
+	DomainID    uint   `json:"domain_id"`
+	Domain      string `json:"domain"`
+	PrimaryID   uint   `json:"primary_id"`
+	Primary     string `json:"primary"`
+}
+
+// 注册域名别名路由
+func registerDomainAliasRoutes(r *gin.Engine) {
+	// 列出域名池中的别名（www./裸域名、大小写不同的重复条目），可按服务器过滤
+	r.GET("/domain-aliases", authMiddleware, httpCacheMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		q := tdb.Scopes(serverAccessScope(c)).Where("alias_of > ?", 0)
+		if table := c.Query("table"); table != "" {
+			if !isValidServerTable(table) {
+				respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+				return
+			}
+			q = q.Where("server_table = ?", table)
+		}
+		if id := c.Query("id"); id != "" {
+			q = q.Where("server_id = ?", id)
+		}
+		var aliases []ServerDomain
+		if err := q.Order("server_table ASC, server_id ASC, id ASC").Find(&aliases).Error; err != nil {
+			log.Printf("获取域名别名失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取域名别名失败："+err.Error())
+			return
+		}
+		primaryIDs := make([]uint, 0, len(aliases))
+		for _, a := range aliases {
+			primaryIDs = append(primaryIDs, a.AliasOf)
+		}
+		primaries := map[uint]string{}
+		if len(primaryIDs) > 0 {
+			var rows []ServerDomain
+			if err := tdb.Select("id", "domain").Where("id IN ?", primaryIDs).Find(&rows).Error; err != nil {
+				log.Printf("获取主域名失败: %v", err)
+				respondError(c, http.StatusInternalServerError, codeInternal, "获取域名别名失败："+err.Error())
+				return
+			}
+			for _, p := range rows {
+				primaries[p.ID] = p.Domain
+			}
+		}
+		result := make([]DomainAlias, 0, len(aliases))
+		for _, a := range aliases {
+			result = append(result, DomainAlias{ServerTable: a.ServerTable, ServerID: a.ServerID, DomainID: a.ID, Domain: a.Domain, PrimaryID: a.AliasOf, Primary: primaries[a.AliasOf]})
+		}
+		c.JSON(http.StatusOK, gin.H{"aliases": result, "total": len(result)})
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 域名已在其他服务器的域名池中（domain.conflictMode = "block" 时拒绝添加）
+var errDomainConflict = errors.New("域名已被其他服务器使用")
+
+// DomainConflict 同一域名所在的一台服务器
+type DomainConflict struct {
+	ServerTable string `json:"server_table"`
+	ServerID    int    `json:"server_id"`
+	DomainID    uint   `json:"domain_id"`
+	InUse       int8   `json:"in_use"`
+	Retired     int8   `json:"retired"`
+	Sharing     string `json:"sharing"`
+}
+
+// DuplicateDomain 出现在多台服务器域名池中的域名；Active 表示同时被多台服务器使用，
+// Violation 表示独占域名被多台服务器同时使用
+type DuplicateDomain struct {
+	Domain    string           `json:"domain"`
+	Servers   []DomainConflict `json:"servers"`
+	Active    bool             `json:"active"`
+	Violation bool             `json:"violation"`
+}
+
+// 域名共用方式
+const (
+	domainExclusive = "exclusive" // 同一时间只能被一台服务器使用
+	domainShared    = "shared"    // 可同时被多台服务器使用（泛解析或位于 CDN 之后）
+)
+
+// 域名未设置共用方式时的默认值（domain.defaultSharing），默认 shared 以保持原有行为
+func defaultDomainSharing() string {
+	if strings.EqualFold(viper.GetString("domain.defaultSharing"), domainExclusive) {
+		return domainExclusive
+	}
+	return domainShared
+}
+
+// 域名的共用方式
+func domainSharing(d ServerDomain) string {
+	if d.Sharing == domainExclusive || d.Sharing == domainShared {
+		return d.Sharing
+	}
+	return defaultDomainSharing()
+}
+
+// 从候选域名中排除与其他服务器冲突的域名：候选为独占且其他服务器正在使用，
+// 或其他服务器以独占方式使用该域名
+func excludeExclusiveConflicts(tx *gorm.DB, table string, id int, candidates []ServerDomain) ([]ServerDomain, error) {
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+	names := make([]string, 0, len(candidates))
+	for _, d := range candidates {
+		names = append(names, d.Domain)
+	}
+	var active []ServerDomain
+	if err := tx.Where("domain IN ? AND in_use = 1 AND NOT (server_table = ? AND server_id = ?)", names, table, id).
+		Find(&active).Error; err != nil {
+		return nil, err
+	}
+	if len(active) == 0 {
+		return candidates, nil
+	}
+	inUse := make(map[string]bool, len(active))
+	exclusiveInUse := make(map[string]bool, len(active))
+	for _, d := range active {
+		inUse[d.Domain] = true
+		if domainSharing(d) == domainExclusive {
+			exclusiveInUse[d.Domain] = true
+		}
+	}
+	filtered := make([]ServerDomain, 0, len(candidates))
+	for _, d := range candidates {
+		if exclusiveInUse[d.Domain] || (inUse[d.Domain] && domainSharing(d) == domainExclusive) {
+			log.Printf("跳过其他服务器正在使用的独占域名: %s, 表=%s, ID=%d", d.Domain, table, id)
+			continue
+		}
+		filtered = append(filtered, d)
+	}
+	return filtered, nil
+}
+
+// 跨服务器同名域名的处理方式：warn（默认，记录警告）或 block（拒绝添加）
+func domainConflictBlocks() bool {
+	return strings.EqualFold(viper.GetString("domain.conflictMode"), "block")
+}
+
+// 查找其他服务器（含其他协议表）域名池中的同名域名
+func findDomainConflicts(tdb *gorm.DB, table string, id int, domain string) ([]DomainConflict, error) {
+	var domains []ServerDomain
+	if err := tdb.Where("domain = ? AND NOT (server_table = ? AND server_id = ?)", domain, table, id).
+		Order("server_table ASC, server_id ASC").Find(&domains).Error; err != nil {
+		return nil, err
+	}
+	conflicts := make([]DomainConflict, 0, len(domains))
+	for _, d := range domains {
+		conflicts = append(conflicts, DomainConflict{ServerTable: d.ServerTable, ServerID: d.ServerID, DomainID: d.ID, InUse: d.InUse, Retired: d.Retired, Sharing: domainSharing(d)})
+	}
+	return conflicts, nil
+}
+
+// 列出所有出现在多台服务器域名池中的域名
+func listDuplicateDomains(tdb *gorm.DB) ([]DuplicateDomain, error) {
+	var names []string
+	if err := tdb.Model(&ServerDomain{}).Group("domain").Having("COUNT(*) > 1").Order("domain ASC").Pluck("domain", &names).Error; err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return []DuplicateDomain{}, nil
+	}
+	var domains []ServerDomain
+	if err := tdb.Where("domain IN ?", names).Order("domain ASC, server_table ASC, server_id ASC").Find(&domains).Error; err != nil {
+		return nil, err
+	}
+	duplicates := make([]DuplicateDomain, 0, len(names))
+	index := make(map[string]int, len(names))
+	for _, d := range domains {
+		i, ok := index[d.Domain]
+		if !ok {
+			i = len(duplicates)
+			index[d.Domain] = i
+			duplicates = append(duplicates, DuplicateDomain{Domain: d.Domain})
+		}
+		duplicates[i].Servers = append(duplicates[i].Servers, DomainConflict{ServerTable: d.ServerTable, ServerID: d.ServerID, DomainID: d.ID, InUse: d.InUse, Retired: d.Retired, Sharing: domainSharing(d)})
+	}
+	for i := range duplicates {
+		inUse, exclusive := 0, false
+		for _, s := range duplicates[i].Servers {
+			inUse += int(s.InUse)
+			if s.InUse == 1 && s.Sharing == domainExclusive {
+				exclusive = true
+			}
+		}
+		duplicates[i].Active = inUse > 1
+		duplicates[i].Violation = duplicates[i].Active && exclusive
+	}
+	return duplicates, nil
+}
+
+// 注册域名冲突路由
+func registerDomainConflictRoutes(r *gin.Engine) {
+	// 列出跨服务器重复的域名，同一主机名被多个节点共用会导致 SNI 路由混乱；
+	// violations 为独占域名被多台服务器同时使用的数量，?violations=1 时只返回这些域名
+	r.GET("/duplicate-domains", authMiddleware, func(c *gin.Context) {
+		duplicates, err := listDuplicateDomains(currentTenant(c).DB)
+		if err != nil {
+			log.Printf("获取重复域名失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取重复域名失败："+err.Error())
+			return
+		}
+		var violations []DuplicateDomain
+		for _, d := range duplicates {
+			if d.Violation {
+				violations = append(violations, d)
+			}
+		}
+		if c.Query("violations") == "1" {
+			duplicates = append([]DuplicateDomain{}, violations...)
+		}
+		c.JSON(http.StatusOK, gin.H{"duplicates": duplicates, "total": len(duplicates), "violations": len(violations)})
+	})
+}
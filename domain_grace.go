@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 轮换宽限期：配置 rotation.graceMinutes 后，轮换时旧域名在该时长内仍保持使用中（记录在 domain_transitions），
+// 缓存了旧配置的客户端不会在主机变更的瞬间断开；到期后由定时任务释放旧域名并累计使用时长
+
+// DomainTransition 轮换时旧域名的宽限记录，ReleasedAt 为 0 表示旧域名仍在宽限期内
+type DomainTransition struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ServerTable string `gorm:"column:server_table;type:varchar(255);index:idx_transition_server;not null" json:"server_table"`
+	ServerID    int    `gorm:"column:server_id;index:idx_transition_server;not null" json:"server_id"`
+	DomainID    uint   `gorm:"column:domain_id;index;not null" json:"domain_id"`
+	OldDomain   string `gorm:"column:old_domain;type:varchar(255);not null" json:"old_domain"`
+	NewDomain   string `gorm:"column:new_domain;type:varchar(255);default:''" json:"new_domain"`
+	StartedAt   int64  `gorm:"column:started_at" json:"started_at"`
+	ExpiresAt   int64  `gorm:"column:expires_at;index" json:"expires_at"`
+	ReleasedAt  int64  `gorm:"column:released_at;default:0" json:"released_at"`
+}
+
+// 轮换宽限秒数（rotation.graceMinutes），未配置或为 0 时轮换立即释放旧域名
+func rotationGraceSeconds() int64 {
+	if minutes := viper.GetInt64("rotation.graceMinutes"); minutes > 0 {
+		return minutes * 60
+	}
+	return 0
+}
+
+// 轮换时开始旧域名的宽限期：旧域名保持使用中，记录宽限到期时间
+func beginDomainGrace(tx *gorm.DB, table string, id int, oldHost, newHost string, now, graceSeconds int64) error {
+	var domain ServerDomain
+	if err := tx.Select("id").Where("server_table = ? AND server_id = ? AND domain = ?", table, id, oldHost).First(&domain).Error; err != nil {
+		return err
+	}
+	return tx.Create(&DomainTransition{
+		ServerTable: table,
+		ServerID:    id,
+		DomainID:    domain.ID,
+		OldDomain:   oldHost,
+		NewDomain:   newHost,
+		StartedAt:   now,
+		ExpiresAt:   now + graceSeconds,
+	}).Error
+}
+
+// 仍在宽限期内的域名 ID
+func graceDomainIDs(tdb *gorm.DB) map[uint]bool {
+	var ids []uint
+	if err := tdb.Model(&DomainTransition{}).Where("released_at = ?", 0).Pluck("domain_id", &ids).Error; err != nil {
+		log.Printf("获取宽限期内的域名失败: %v", err)
+	}
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// 释放宽限期已到的旧域名；旧域名已被释放或又成为服务器当前主机时只结束宽限记录
+func releaseExpiredGraceDomains(t *Tenant, now int64) {
+	var transitions []DomainTransition
+	if err := t.DB.Where("released_at = ? AND expires_at <= ?", 0, now).Order("expires_at").Find(&transitions).Error; err != nil {
+		log.Printf("获取到期的宽限记录失败: 租户=%s, 错误=%v", t.Name, err)
+		return
+	}
+	for _, tr := range transitions {
+		err := t.DB.Transaction(func(tx *gorm.DB) error {
+			var domain ServerDomain
+			err := tx.Where("id = ? AND server_table = ? AND server_id = ?", tr.DomainID, tr.ServerTable, tr.ServerID).First(&domain).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				log.Printf("宽限期结束，域名已不在原服务器: 域名=%s, 表=%s, ID=%d", tr.OldDomain, tr.ServerTable, tr.ServerID)
+			case err != nil:
+				return err
+			case domain.InUse == 1:
+				var host string
+				if err := tx.Table(tr.ServerTable).Select(serverSelect(tr.ServerTable, "host")).Where("id = ?", tr.ServerID).Scan(&host).Error; err != nil {
+					return err
+				}
+				if host == domain.Domain {
+					log.Printf("宽限期结束，域名已重新成为服务器当前主机，不释放: 域名=%s, 表=%s, ID=%d", domain.Domain, tr.ServerTable, tr.ServerID)
+					break
+				}
+				if err := releaseDomain(tx, tr.ServerTable, tr.ServerID, domain.Domain, now); err != nil {
+					return err
+				}
+				log.Printf("宽限期结束，已释放旧域名: 域名=%s, 表=%s, ID=%d", domain.Domain, tr.ServerTable, tr.ServerID)
+			}
+			return tx.Model(&DomainTransition{}).Where("id = ?", tr.ID).Update("released_at", now).Error
+		})
+		if err != nil {
+			log.Printf("释放宽限期到期的域名失败: 租户=%s, 域名=%s, 表=%s, ID=%d, 错误=%v", t.Name, tr.OldDomain, tr.ServerTable, tr.ServerID, err)
+		}
+	}
+}
+
+// 定时任务：释放所有租户宽限期已到的旧域名
+func releaseGraceDomains() {
+	now := time.Now().Unix()
+	for _, t := range tenantList() {
+		releaseExpiredGraceDomains(t, now)
+	}
+}
+
+// 注册轮换宽限路由
+func registerDomainGraceRoutes(r *gin.Engine) {
+	// 列出轮换宽限记录，可按 table、id 过滤；active=1 时只列出仍在宽限期内的旧域名
+	r.GET("/domain-transitions", authMiddleware, func(c *gin.Context) {
+		q := currentTenant(c).DB.Scopes(serverAccessScope(c)).Order("started_at DESC, id DESC").Limit(500)
+		if table := c.Query("table"); table != "" {
+			if !isValidServerTable(table) {
+				respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+				return
+			}
+			q = q.Where("server_table = ?", table)
+		}
+		if idStr := c.Query("id"); idStr != "" {
+			id, err := strconv.Atoi(idStr)
+			if err != nil || id <= 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+				return
+			}
+			q = q.Where("server_id = ?", id)
+		}
+		if c.Query("active") == "1" {
+			q = q.Where("released_at = ?", 0)
+		}
+		var transitions []DomainTransition
+		if err := q.Find(&transitions).Error; err != nil {
+			log.Printf("获取轮换宽限记录失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取宽限记录失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"transitions": transitions, "grace_minutes": rotationGraceSeconds() / 60})
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DomainPatch 域名部分更新请求，只更新请求中出现的字段
+type DomainPatch struct {
+	Order         *int    `json:"order"`
+	Tags          *string `json:"tags"`
+	Note          *string `json:"note"`
+	InUse         *int8   `json:"in_use"`
+	Retired       *int8   `json:"retired"`
+	RetiredReason *string `json:"retired_reason"`
+	CDN           *int8   `json:"cdn"`
+	Protected     *int8   `json:"protected"`
+	Cooldown      *int    `json:"cooldown_minutes"`
+}
+
+// 单个域名可设置的最长冷却时间（分钟），30 天
+const maxDomainCooldownMinutes = 30 * 24 * 60
+
+// 校验部分更新请求并生成待更新字段；errs 为字段级错误（字段名 -> 原因）。
+// in_use 只能修正为与服务器当前主机一致的值，切换域名需通过轮换完成；使用中的域名不能退役，
+// 受保护的域名需在同一请求或之前取消保护才能退役
+func (p DomainPatch) updates(domain ServerDomain, host string, now int64) (map[string]interface{}, map[string]string) {
+	updates := map[string]interface{}{}
+	errs := map[string]string{}
+	current := host != "" && host == domain.Domain
+	if p.Order != nil {
+		if *p.Order < 0 {
+			errs["order"] = "不能为负数"
+		} else {
+			updates["order"] = *p.Order
+		}
+	}
+	if p.Tags != nil {
+		tags := normalizeTags(*p.Tags)
+		if len(tags) > 255 {
+			errs["tags"] = "标签过长（最多 255 字节）"
+		} else {
+			updates["tags"] = tags
+		}
+	}
+	if p.Note != nil {
+		if len(*p.Note) > 1024 {
+			errs["note"] = "备注过长（最多 1024 字节）"
+		} else {
+			updates["note"] = *p.Note
+		}
+	}
+	if p.InUse != nil {
+		switch {
+		case *p.InUse != 0 && *p.InUse != 1:
+			errs["in_use"] = "可选值: 0, 1"
+		case *p.InUse == 1 && !current:
+			errs["in_use"] = "域名不是服务器当前主机，不能标记为使用中，请通过轮换切换域名"
+		case *p.InUse == 0 && current:
+			errs["in_use"] = "域名为服务器当前主机，不能释放，请先轮换到其他域名"
+		case *p.InUse != domain.InUse:
+			updates["in_use"] = *p.InUse
+		}
+	}
+	if p.CDN != nil {
+		if *p.CDN != 0 && *p.CDN != 1 {
+			errs["cdn"] = "可选值: 0, 1"
+		} else {
+			updates["cdn"] = *p.CDN
+		}
+	}
+	if p.Cooldown != nil {
+		if *p.Cooldown < 0 || *p.Cooldown > maxDomainCooldownMinutes {
+			errs["cooldown_minutes"] = "可选范围: 0-" + strconv.Itoa(maxDomainCooldownMinutes) + "（0 表示按默认冷却时间）"
+		} else {
+			updates["cooldown_minutes"] = *p.Cooldown
+		}
+	}
+	protected := domain.Protected
+	if p.Protected != nil {
+		if *p.Protected != 0 && *p.Protected != 1 {
+			errs["protected"] = "可选值: 0, 1"
+		} else {
+			protected = *p.Protected
+			updates["protected"] = *p.Protected
+		}
+	}
+	if p.RetiredReason != nil && len(*p.RetiredReason) > 255 {
+		errs["retired_reason"] = "退役原因过长（最多 255 字节）"
+	}
+	if p.Retired != nil {
+		switch {
+		case *p.Retired != 0 && *p.Retired != 1:
+			errs["retired"] = "可选值: 0, 1"
+		case *p.Retired == 1 && current:
+			errs["retired"] = "域名正在使用中，不能退役"
+		case *p.Retired == 1 && domain.Retired == 0 && protected == 1:
+			errs["retired"] = "域名已开启删除保护，不能退役，请先取消保护"
+		case *p.Retired == 1 && domain.Retired == 0:
+			reason := "手动退役"
+			if p.RetiredReason != nil && *p.RetiredReason != "" {
+				reason = *p.RetiredReason
+			}
+			updates["retired"] = 1
+			updates["retired_time"] = now
+			updates["retired_reason"] = reason
+		case *p.Retired == 0 && domain.Retired == 1:
+			updates["retired"] = 0
+			updates["retired_time"] = 0
+			updates["retired_reason"] = ""
+		}
+	} else if p.RetiredReason != nil && domain.Retired == 1 {
+		updates["retired_reason"] = *p.RetiredReason
+	}
+	return updates, errs
+}
+
+// 注册域名部分更新路由
+func registerDomainPatchRoutes(r *gin.Engine) {
+	// 部分更新域名：请求体为 JSON，可包含 order、tags、note、in_use、retired、retired_reason、cdn、protected、cooldown_minutes，
+	// 任一字段校验失败时不做任何修改，并在 fields 中返回各字段的错误
+	r.PATCH("/api/v1/domains/:id", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		id, err := strconv.Atoi(serverParam(c, "id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的域名ID")
+			return
+		}
+		body, err := c.GetRawData()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "读取请求失败")
+			return
+		}
+		var patch DomainPatch
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&patch); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的请求体："+err.Error())
+			return
+		}
+		var domain ServerDomain
+		if err := t.DB.First(&domain, id).Error; err != nil {
+			respondError(c, http.StatusNotFound, codeDomainNotFound, "域名不存在")
+			return
+		}
+		meta, err := loadServerMeta(t, domain.ServerTable, domain.ServerID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("获取服务器主机失败: 表=%s, ID=%d, 错误=%v", domain.ServerTable, domain.ServerID, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取服务器信息失败："+err.Error())
+			return
+		}
+		updates, errs := patch.updates(domain, meta.Host, time.Now().Unix())
+		if len(errs) > 0 {
+			respondError(c, http.StatusBadRequest, codeValidationFailed, "字段校验失败", errs)
+			return
+		}
+		if len(updates) > 0 {
+			if err := t.DB.Model(&ServerDomain{}).Where("id = ?", domain.ID).Updates(updates).Error; err != nil {
+				log.Printf("更新域名失败: ID=%d, 域名=%s, 错误=%v", domain.ID, domain.Domain, err)
+				respondError(c, http.StatusInternalServerError, codeInternal, "更新域名失败："+err.Error())
+				return
+			}
+			previous := domain
+			if err := t.DB.First(&domain, domain.ID).Error; err != nil {
+				log.Printf("获取更新后的域名失败: ID=%d, 错误=%v", domain.ID, err)
+			} else {
+				recordProtectionChange(c, previous, domain.Protected)
+			}
+			log.Printf("更新域名成功: ID=%d, 域名=%s, 字段=%v", domain.ID, domain.Domain, updates)
+		}
+		c.JSON(http.StatusOK, gin.H{"domain": domain, "updated": len(updates)})
+	})
+}
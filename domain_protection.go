@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 删除保护：关键域名（证书、客户端配置中写死的域名等）开启后，任何接口都不能删除或退役，
+// 配额超限及服务器归档也不会自动退役，需先显式取消保护
+
+// 域名已开启删除保护
+var errDomainProtected = errors.New("域名已开启删除保护，请先取消保护")
+
+// 是否开启了删除保护
+func isProtectedDomain(d ServerDomain) bool {
+	return d.Protected == 1
+}
+
+// 删除保护状态变化时记录审计日志
+func recordProtectionChange(c *gin.Context, d ServerDomain, protected int8) {
+	if d.Protected == protected {
+		return
+	}
+	action := "protect_domain"
+	if protected == 0 {
+		action = "unprotect_domain"
+	}
+	t := currentTenant(c)
+	log.Printf("域名删除保护已变更: 域名=%s, 保护=%d, 操作人=%s", d.Domain, protected, operatorName(c))
+	recordAudit(t.DB, action, d.Domain, operatorName(c), c.ClientIP(), "")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 注册域名释放路由
+func registerDomainReleaseRoutes(r *gin.Engine) {
+	// 手动释放卡在使用中的域名（如服务器已在面板外下线）：confirm 须与域名一致；
+	// reset_last_used=1 时同时清除最后使用时间，使域名跳过冷却期；服务器仍在使用该域名时须 force=1；需确认令牌 release-domain
+	r.POST("/release-domain", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		id, err := strconv.Atoi(serverParam(c, "domain_id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的域名ID")
+			return
+		}
+		var domain ServerDomain
+		if err := t.DB.First(&domain, id).Error; err != nil {
+			respondError(c, http.StatusNotFound, codeDomainNotFound, "域名不存在")
+			return
+		}
+		if c.PostForm("confirm") != domain.Domain {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "请在 confirm 中填写域名 "+domain.Domain+" 以确认释放")
+			return
+		}
+		resetLastUsed := c.PostForm("reset_last_used") == "1"
+		if domain.InUse == 0 && !resetLastUsed {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "域名未在使用中")
+			return
+		}
+
+		// 服务器仍存在且主机正是该域名时，释放后可能被再次分配给其他服务器
+		server, err := loadServerMeta(t, domain.ServerTable, domain.ServerID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("获取服务器主机失败: 表=%s, ID=%d, 错误=%v", domain.ServerTable, domain.ServerID, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取服务器信息失败："+err.Error())
+			return
+		}
+		serverExists := err == nil
+		if serverExists && server.Host == domain.Domain && c.PostForm("force") != "1" {
+			respondError(c, http.StatusConflict, codeConflict, "服务器仍在使用该域名，如确需释放请设置 force=1")
+			return
+		}
+		if !consumeConfirmToken(c, confirmReleaseDomain) {
+			return
+		}
+
+		updates := map[string]interface{}{"in_use": 0}
+		if resetLastUsed {
+			updates["last_used_time"] = 0
+		}
+		if err := t.DB.Model(&ServerDomain{}).Where("id = ?", domain.ID).Updates(updates).Error; err != nil {
+			log.Printf("释放域名失败: 域名=%s, 错误=%v", domain.Domain, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "释放域名失败："+err.Error())
+			return
+		}
+		operator := operatorName(c)
+		detail := fmt.Sprintf("表=%s, ID=%d, 原使用中=%d, 原最后使用时间=%d, 清除最后使用时间=%t, 服务器存在=%t",
+			domain.ServerTable, domain.ServerID, domain.InUse, domain.LastUsedTime, resetLastUsed, serverExists)
+		if reason := c.PostForm("reason"); reason != "" {
+			detail += ", 原因=" + reason
+		}
+		recordAudit(t.DB, "release_domain", domain.Domain, operator, c.ClientIP(), detail)
+		log.Printf("手动释放域名: 域名=%s, 操作员=%s, %s", domain.Domain, operator, detail)
+		c.JSON(http.StatusOK, gin.H{"message": "域名 " + domain.Domain + " 已释放"})
+	})
+}
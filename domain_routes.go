@@ -0,0 +1,377 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 注册域名池管理路由
+func registerDomainRoutes(r *gin.Engine) {
+	// 获取域名列表（包括已使用和未使用），支持 in_use、q（子串）过滤及 limit + offset/cursor 分页；不带 limit 时返回全部
+	r.GET("/available-domains", authMiddleware, httpCacheMiddleware, func(c *gin.Context) {
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		isValidTable := isValidServerTable(table)
+		if !isValidTable {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		query := DomainQuery{Search: strings.TrimSpace(c.Query("q")), Cursor: c.Query("cursor")}
+		if v := c.Query("in_use"); v != "" {
+			inUse, err := strconv.Atoi(v)
+			if err != nil || (inUse != 0 && inUse != 1) {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 in_use，可选值: 0, 1")
+				return
+			}
+			query.InUse = &inUse
+		}
+		if v := c.Query("limit"); v != "" {
+			if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit <= 0 || query.Limit > maxDomainPageSize {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, fmt.Sprintf("无效的 limit，范围 1-%d", maxDomainPageSize))
+				return
+			}
+		}
+		if v := c.Query("offset"); v != "" {
+			if query.Offset, err = strconv.Atoi(v); err != nil || query.Offset < 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 offset")
+				return
+			}
+		}
+		if query.Cursor != "" {
+			if _, _, err := decodeDomainCursor(query.Cursor); err != nil {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+				return
+			}
+		}
+		page, err := currentTenant(c).Domains.Page(table, id, query)
+		if err != nil {
+			log.Printf("获取表 %s, ID %d 的域名失败: %v", table, id, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "无法获取域名列表: "+err.Error())
+			return
+		}
+		log.Printf("为表 %s, ID %d 获取到 %d 个域名（共 %d 个）", table, id, len(page.Domains), page.Total)
+		c.JSON(http.StatusOK, page)
+	})
+
+	// 添加新域名
+	r.POST("/add-domain", authMiddleware, func(c *gin.Context) {
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		domain := c.PostForm("domain")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		isValidTable := isValidServerTable(table)
+		if !isValidTable {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		if domain == "" {
+			log.Printf("无效的域名: 为空")
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "域名不能为空")
+			return
+		}
+		t := currentTenant(c)
+		if err := addServerDomain(t, table, id, domain); err != nil {
+			if errors.Is(err, errDomainExists) {
+				respondError(c, http.StatusBadRequest, codeDomainExists, "域名已存在")
+				return
+			}
+			if errors.Is(err, errInvalidDomain) || errors.Is(err, errDomainConflict) {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+				return
+			}
+			respondError(c, http.StatusInternalServerError, codeInternal, "添加域名失败："+err.Error())
+			return
+		}
+		counts, err := t.Domains.Count(table, id, time.Now().Unix())
+		if err != nil {
+			log.Printf("统计域名失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		}
+		resp := gin.H{
+			"message":          "域名 " + domain + " 添加成功",
+			"domain_total":     counts.Total,
+			"domain_available": counts.Available,
+		}
+		if normalized, err := normalizeDomain(domain); err == nil {
+			if conflicts, _ := findDomainConflicts(t.DB, table, id, normalized); len(conflicts) > 0 {
+				resp["warning"] = fmt.Sprintf("该域名同时存在于其他 %d 台服务器的域名池中，共用主机名可能导致 SNI 路由混乱", len(conflicts))
+				resp["conflicts"] = conflicts
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// 删除域名，需确认令牌 delete-domain
+	r.POST("/delete-domain", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		domainIDStr := serverParam(c, "domain_id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的服务器ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的服务器ID")
+			return
+		}
+		domainID, err := strconv.Atoi(domainIDStr)
+		if err != nil || domainID <= 0 {
+			log.Printf("无效的域名ID: %s", domainIDStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的域名ID")
+			return
+		}
+		isValidTable := isValidServerTable(table)
+		if !isValidTable {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		var domain ServerDomain
+		if err := t.DB.Where("id = ? AND server_table = ? AND server_id = ?", domainID, table, id).First(&domain).Error; err != nil {
+			log.Printf("域名不存在: ID=%d, 表=%s, 服务器ID=%d, 错误=%v", domainID, table, id, err)
+			respondError(c, http.StatusBadRequest, codeDomainNotFound, "域名不存在")
+			return
+		}
+		if isProtectedDomain(domain) {
+			log.Printf("无法删除受保护的域名: ID=%d, 域名=%s, 表=%s, 服务器ID=%d", domainID, domain.Domain, table, id)
+			respondError(c, http.StatusConflict, codeDomainProtected, "域名 "+domain.Domain+" 已开启删除保护，请先取消保护")
+			return
+		}
+		if domain.InUse == 1 {
+			log.Printf("无法删除正在使用的域名: ID=%d, 域名=%s, 表=%s, 服务器ID=%d", domainID, domain.Domain, table, id)
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无法删除正在使用的域名")
+			return
+		}
+		if meta, err := loadServerMeta(t, table, id); err == nil && meta.Host == domain.Domain {
+			log.Printf("无法删除当前服务器使用的域名: 域名=%s, 表=%s, ID=%d", domain.Domain, table, id)
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无法删除当前服务器使用的域名")
+			return
+		}
+		if !consumeConfirmToken(c, confirmDeleteDomain) {
+			return
+		}
+		// 移入回收站，保留期内可恢复
+		if err := t.DB.Transaction(func(tx *gorm.DB) error {
+			return moveDomainToRecycleBin(tx, domain, time.Now().Unix())
+		}); err != nil {
+			log.Printf("删除域名失败: ID=%d, 表=%s, 服务器ID=%d, 错误=%v", domainID, table, id, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "删除域名失败："+err.Error())
+			return
+		}
+		counts, err := t.Domains.Count(table, id, time.Now().Unix())
+		if err != nil {
+			log.Printf("统计域名失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":          "域名 " + domain.Domain + " 已移入回收站",
+			"domain_total":     counts.Total,
+			"domain_available": counts.Available,
+		})
+	})
+
+	// 更新域名备注及元数据（注册商、购买日期、费用、备注、共用方式等），仅更新提交的字段
+	r.POST("/update-domain-meta", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		domainIDStr := serverParam(c, "domain_id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的服务器ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的服务器ID")
+			return
+		}
+		domainID, err := strconv.Atoi(domainIDStr)
+		if err != nil || domainID <= 0 {
+			log.Printf("无效的域名ID: %s", domainIDStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的域名ID")
+			return
+		}
+		if !isValidServerTable(table) {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		var domain ServerDomain
+		if err := t.DB.Where("id = ? AND server_table = ? AND server_id = ?", domainID, table, id).First(&domain).Error; err != nil {
+			log.Printf("域名不存在: ID=%d, 表=%s, 服务器ID=%d, 错误=%v", domainID, table, id, err)
+			respondError(c, http.StatusBadRequest, codeDomainNotFound, "域名不存在")
+			return
+		}
+		updates := map[string]interface{}{}
+		if registrar, ok := c.GetPostForm("registrar"); ok {
+			updates["registrar"] = strings.TrimSpace(registrar)
+		}
+		if purchaseDate, ok := c.GetPostForm("purchase_date"); ok {
+			purchaseDate = strings.TrimSpace(purchaseDate)
+			if purchaseDate == "" {
+				updates["purchase_date"] = 0
+			} else {
+				date, err := time.ParseInLocation("2006-01-02", purchaseDate, userLocation(c))
+				if err != nil {
+					respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的购买日期，格式应为 YYYY-MM-DD")
+					return
+				}
+				updates["purchase_date"] = date.Unix()
+			}
+		}
+		if costStr, ok := c.GetPostForm("cost"); ok {
+			costStr = strings.TrimSpace(costStr)
+			if costStr == "" {
+				updates["cost"] = 0
+			} else {
+				cost, err := strconv.ParseFloat(costStr, 64)
+				if err != nil || cost < 0 {
+					respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的费用")
+					return
+				}
+				updates["cost"] = cost
+			}
+		}
+		if note, ok := c.GetPostForm("note"); ok {
+			if len(note) > 1024 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "备注过长（最多 1024 字节）")
+				return
+			}
+			updates["note"] = note
+		}
+		if tags, ok := c.GetPostForm("tags"); ok {
+			tags = normalizeTags(tags)
+			if len(tags) > 255 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "标签过长（最多 255 字节）")
+				return
+			}
+			updates["tags"] = tags
+		}
+		if provider, ok := c.GetPostForm("dns_provider"); ok {
+			provider = strings.TrimSpace(provider)
+			if provider != "" {
+				dnsProvidersOnce.Do(loadDNSProviders)
+				if _, exists := dnsProviders[provider]; !exists {
+					respondError(c, http.StatusBadRequest, codeInvalidArgument, "未配置的 DNS 服务商："+provider)
+					return
+				}
+			}
+			updates["dns_provider"] = provider
+		}
+		if sharing, ok := c.GetPostForm("sharing"); ok {
+			sharing = strings.ToLower(strings.TrimSpace(sharing))
+			if sharing != "" && sharing != domainExclusive && sharing != domainShared {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的共用方式（可选 exclusive, shared，留空使用默认）")
+				return
+			}
+			updates["sharing"] = sharing
+		}
+		if v, ok := c.GetPostForm("cdn"); ok {
+			if v != "0" && v != "1" {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 cdn，可选值: 0, 1")
+				return
+			}
+			cdn, _ := strconv.Atoi(v)
+			updates["cdn"] = cdn
+		}
+		if v, ok := c.GetPostForm("protected"); ok {
+			if v != "0" && v != "1" {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 protected，可选值: 0, 1")
+				return
+			}
+			protected, _ := strconv.Atoi(v)
+			updates["protected"] = protected
+		}
+		if len(updates) == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "没有需要更新的字段")
+			return
+		}
+		if err := t.DB.Model(&ServerDomain{}).Where("id = ?", domain.ID).Updates(updates).Error; err != nil {
+			log.Printf("更新域名元数据失败: ID=%d, 域名=%s, 错误=%v", domain.ID, domain.Domain, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "更新域名信息失败："+err.Error())
+			return
+		}
+		previous := domain
+		if err := t.DB.First(&domain, domain.ID).Error; err != nil {
+			log.Printf("获取更新后的域名失败: ID=%d, 错误=%v", domain.ID, err)
+		} else {
+			recordProtectionChange(c, previous, domain.Protected)
+		}
+		log.Printf("更新域名元数据成功: ID=%d, 域名=%s, 字段=%v", domain.ID, domain.Domain, updates)
+		c.JSON(http.StatusOK, gin.H{"message": "域名 " + domain.Domain + " 信息已更新", "domain": domain})
+	})
+
+	// 调试：检查所有域名
+	r.GET("/debug-domains", authMiddleware, func(c *gin.Context) {
+		var domains []ServerDomain
+		currentTenant(c).DB.Find(&domains)
+		c.JSON(http.StatusOK, gin.H{"all_domains": domains})
+	})
+}
+
+// 域名已存在
+var errDomainExists = errors.New("域名已存在")
+
+// 为服务器添加域名（先规范化校验），排在现有域名之后
+func addServerDomain(t *Tenant, table string, id int, domain string) error {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		log.Printf("域名校验失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return err
+	}
+	var existingDomain ServerDomain
+	if err := t.DB.Where("server_table = ? AND server_id = ? AND domain = ?", table, id, domain).First(&existingDomain).Error; err == nil {
+		log.Printf("域名已存在: 表=%s, ID=%d, 域名=%s", table, id, domain)
+		return errDomainExists
+	}
+	conflicts, err := findDomainConflicts(t.DB, table, id, domain)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		if domainConflictBlocks() {
+			log.Printf("域名已在其他 %d 台服务器的域名池中，拒绝添加: 表=%s, ID=%d, 域名=%s", len(conflicts), table, id, domain)
+			return fmt.Errorf("%w（%s:%d 等 %d 台）", errDomainConflict, conflicts[0].ServerTable, conflicts[0].ServerID, len(conflicts))
+		}
+		log.Printf("警告: 域名已在其他 %d 台服务器的域名池中: 表=%s, ID=%d, 域名=%s", len(conflicts), table, id, domain)
+	}
+	var maxOrder int
+	t.DB.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", table, id).Select("MAX(`order`)").Scan(&maxOrder)
+	newDomain := ServerDomain{
+		ServerTable:  table,
+		ServerID:     id,
+		Domain:       domain,
+		InUse:        0,
+		Order:        maxOrder + 1,
+		LastUsedTime: 0,
+	}
+	// 预热：先创建解析记录，传播完成前不参与轮换
+	staging := canStageDomain(t, newDomain)
+	if staging {
+		newDomain.StagedUntil = time.Now().Unix() + domainStageSeconds()
+	}
+	if err := t.DB.Create(&newDomain).Error; err != nil {
+		log.Printf("添加域名 %s 失败: 表=%s, ID=%d, 错误=%v", domain, table, id, err)
+		return err
+	}
+	if staging {
+		go stageDomain(t, newDomain)
+	}
+	publishEvent(Event{Type: eventDomainAdded, Tenant: t.Name, ServerTable: table, ServerID: id, Domain: domain})
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 每个域名返回的最近轮换记录数
+const domainSearchHistoryLimit = 10
+
+// 域名状态
+const (
+	domainStateInUse     = "in_use"
+	domainStateAvailable = "available"
+	domainStateStaged    = "staged"
+	domainStateRetired   = "retired"
+	domainStateAlias     = "alias"
+)
+
+// DomainSearchResult 全局域名查找的一条结果：域名所在服务器、状态及使用历史
+type DomainSearchResult struct {
+	ServerDomain
+	ServerName string            `json:"server_name"`
+	State      string            `json:"state"`
+	Blocks     []DomainBlock     `json:"blocks"`
+	History    []RotationHistory `json:"history"`
+}
+
+// 域名池记录的状态
+func domainState(d ServerDomain, now int64) string {
+	switch {
+	case d.Retired == 1:
+		return domainStateRetired
+	case d.InUse == 1:
+		return domainStateInUse
+	case d.AliasOf > 0:
+		return domainStateAlias
+	case d.StagedUntil > now:
+		return domainStateStaged
+	}
+	return domainStateAvailable
+}
+
+// 服务器名称，查询失败时返回空字符串
+func lookupServerName(t *Tenant, table string, id int) string {
+	meta, err := loadServerMeta(t, table, id)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("获取服务器名称失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+	}
+	return meta.Name
+}
+
+// 按域名子串查找所有服务器域名池中的域名，附带所在服务器、状态、封锁记录及最近的轮换记录；scopes 用于限定服务器范围
+func searchDomains(t *Tenant, q string, limit int, now int64, scopes ...func(*gorm.DB) *gorm.DB) ([]DomainSearchResult, error) {
+	tdb := readDB(t)
+	pattern := "%" + escapeLike(strings.ToLower(q)) + "%"
+	var domains []ServerDomain
+	if err := tdb.Scopes(scopes...).Where("LOWER(domain) LIKE ? ESCAPE '!'", pattern).
+		Order("domain ASC, server_table ASC, server_id ASC").Limit(limit).Find(&domains).Error; err != nil {
+		return nil, err
+	}
+	results := make([]DomainSearchResult, 0, len(domains))
+	for _, d := range domains {
+		result := DomainSearchResult{ServerDomain: d, ServerName: lookupServerName(t, d.ServerTable, d.ServerID), State: domainState(d, now), Blocks: []DomainBlock{}, History: []RotationHistory{}}
+		if err := tdb.Where("server_table = ? AND server_id = ? AND domain = ?", d.ServerTable, d.ServerID, d.Domain).
+			Order("detected_at DESC").Find(&result.Blocks).Error; err != nil {
+			return nil, err
+		}
+		if err := tdb.Where("server_table = ? AND server_id = ? AND (new_host = ? OR old_host = ?)", d.ServerTable, d.ServerID, d.Domain, d.Domain).
+			Order("created_at DESC, id DESC").Limit(domainSearchHistoryLimit).Find(&result.History).Error; err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// 注册全局域名查找路由
+func registerDomainSearchRoutes(r *gin.Engine) {
+	// 按域名子串查找域名所在的服务器（跨所有服务器表），返回状态及使用历史；回收站中的匹配域名单独列出。
+	// 用户反馈某个主机名被封锁时可据此定位
+	r.GET("/search-domains", authMiddleware, func(c *gin.Context) {
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "缺少查询参数 q")
+			return
+		}
+		limit := 50
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 200 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 limit（1-200）")
+				return
+			}
+			limit = n
+		}
+		t := currentTenant(c)
+		tdb := readDB(t)
+		results, err := searchDomains(t, q, limit, time.Now().Unix(), serverAccessScope(c))
+		if err != nil {
+			log.Printf("查找域名失败: 关键字=%s, 错误=%v", q, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "查找域名失败："+err.Error())
+			return
+		}
+		var deleted []DeletedDomain
+		if err := tdb.Scopes(serverAccessScope(c)).Where("LOWER(domain) LIKE ? ESCAPE '!'", "%"+escapeLike(strings.ToLower(q))+"%").
+			Order("deleted_at DESC").Limit(limit).Find(&deleted).Error; err != nil {
+			log.Printf("查找回收站域名失败: 关键字=%s, 错误=%v", q, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "查找域名失败："+err.Error())
+			return
+		}
+		if deleted == nil {
+			deleted = []DeletedDomain{}
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results, "total": len(results), "deleted": deleted, "truncated": len(results) == limit})
+	})
+}
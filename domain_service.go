@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 域名使用后的冷却时间（秒），冷却期内不会再次分配
+const domainCooldownSeconds = 3 * 3600
+
+// 没有可分配的域名（域名池耗尽）
+var errNoAvailableDomain = errors.New("无可用域名")
+
+// DomainCounts 服务器域名计数
+type DomainCounts struct {
+	Total      int64
+	Available  int64
+	InCooldown int64 // 未使用、未退役但仍在冷却期内
+}
+
+// 域名列表单页最大条数
+const maxDomainPageSize = 500
+
+// DomainQuery 域名列表查询条件，Limit 为 0 表示不分页；Cursor 与 Offset 二选一，Cursor 优先
+type DomainQuery struct {
+	InUse  *int   // 按是否使用中过滤，nil 表示不过滤
+	Search string // 域名子串
+	Limit  int
+	Offset int
+	Cursor string // 上一页返回的 NextCursor
+}
+
+// DomainPage 域名列表分页结果
+type DomainPage struct {
+	Domains    []ServerDomain `json:"domains"`
+	Total      int64          `json:"total"`       // 满足过滤条件的总数
+	NextCursor string         `json:"next_cursor"` // 为空表示没有下一页
+}
+
+// DomainService 域名可用性查询，所有"可用域名"的判断规则（冷却、历史、解析校验等）集中在此实现
+type DomainService interface {
+	// Count 统计服务器的域名总数、当前可用数及冷却中的数量，读取 domain_summaries 中的汇总行
+	Count(table string, id int, now int64) (DomainCounts, error)
+	// CountAll 批量统计全部服务器的域名计数（键为 "表名:ID"），一次读取 domain_summaries，过期的汇总逐个重算；
+	// 还没有汇总行的服务器不在结果中，用 lookupDomainCounts 读取
+	CountAll(now int64) (map[string]DomainCounts, error)
+	// List 列出服务器的全部域名，按 last_used_time 升序
+	List(table string, id int) ([]ServerDomain, error)
+	// Page 按条件分页列出服务器的域名，按 last_used_time、id 升序
+	Page(table string, id int, query DomainQuery) (DomainPage, error)
+	// Available 在 tx 中查询可分配的域名（排除 excludeHost），按 last_used_time 升序
+	Available(tx *gorm.DB, table string, id int, excludeHost string, now int64) ([]ServerDomain, error)
+	// Candidates 在 tx 中按轮换策略筛选出可分配的候选域名，按 last_used_time 升序，不做解析校验
+	Candidates(tx *gorm.DB, table string, id int, excludeHost string, now int64) ([]ServerDomain, error)
+	// VerifyCandidates 在事务外校验候选域名的解析，返回通过校验的域名ID；未开启校验时返回 nil
+	VerifyCandidates(table string, id int, excludeHost string, now int64) (map[uint]bool, error)
+	// PickNext 在 tx 中按轮换策略选出下一个要分配的域名；verified 不为 nil 时只选择其中的域名
+	PickNext(tx *gorm.DB, table string, id int, excludeHost string, now int64, verified map[uint]bool) (ServerDomain, error)
+}
+
+// DomainSettings 域名服务用到的全局配置
+type DomainSettings struct {
+	DNSVerify          bool  // 分配前校验域名解析
+	AvoidRecentDomains int   // 不复用最近 N 个域名，服务器设置为 -1 时使用
+	CDNCooldownSeconds int64 // CDN 域名使用后的冷却时间
+}
+
+// 按服务器设置得到生效的"不复用最近 N 个域名"数量
+func (s DomainSettings) avoidRecentDomains(setting ServerSetting) int {
+	if setting.AvoidRecentDomains >= 0 {
+		return setting.AvoidRecentDomains
+	}
+	return s.AvoidRecentDomains
+}
+
+// 从配置读取域名服务设置，每次调用时读取，修改配置后立即生效
+func configDomainSettings() DomainSettings {
+	return DomainSettings{
+		DNSVerify:          dnsVerifyEnabled(),
+		AvoidRecentDomains: viper.GetInt("rotation.avoidRecentDomains"),
+		CDNCooldownSeconds: cdnCooldownSeconds(),
+	}
+}
+
+// gormDomainService 基于 GORM 的 DomainService 实现
+type gormDomainService struct {
+	db       *gorm.DB
+	settings func() DomainSettings
+}
+
+// 创建基于 GORM 的域名服务，settings 在每次查询时调用以取得当前配置
+func newDomainService(db *gorm.DB, settings func() DomainSettings) DomainService {
+	return &gormDomainService{db: db, settings: settings}
+}
+
+// 可用域名条件：未使用、未退役、不是别名、已过冷却期（CDN 域名冷却更短）且不在预热中
+func availableDomainScope(now int64) func(*gorm.DB) *gorm.DB {
+	return availableDomainScopeFor(now, cdnCooldownSeconds())
+}
+
+// 按指定的 CDN 域名冷却时间构造可用域名条件
+func availableDomainScopeFor(now, cdnCooldown int64) func(*gorm.DB) *gorm.DB {
+	cooldownStart, args := cooldownStartExprFor(now, cdnCooldown)
+	return func(q *gorm.DB) *gorm.DB {
+		return q.Where("in_use = ? AND retired = ? AND alias_of = ? AND staged_until <= ?", 0, 0, 0, now).
+			Where("(last_used_time = 0 OR last_used_time <= "+cooldownStart+")", args...)
+	}
+}
+
+// 服务器域名条件
+func serverDomainScope(table string, id int) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		return q.Where("server_table = ? AND server_id = ?", table, id)
+	}
+}
+
+func (s *gormDomainService) Count(table string, id int, now int64) (DomainCounts, error) {
+	summary, err := loadDomainSummary(s.db, table, id, now)
+	return DomainCounts{Total: summary.Total, Available: summary.Available, InCooldown: summary.InCooldown}, err
+}
+
+func (s *gormDomainService) CountAll(now int64) (map[string]DomainCounts, error) {
+	var summaries []DomainSummary
+	if err := s.db.Find(&summaries).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]DomainCounts, len(summaries))
+	for _, summary := range summaries {
+		if !summary.validAt(now) {
+			var err error
+			if summary, err = refreshDomainSummary(s.db, summary.ServerTable, summary.ServerID, now); err != nil {
+				log.Printf("重算域名汇总失败: 表=%s, ID=%d, 错误=%v", summary.ServerTable, summary.ServerID, err)
+				continue
+			}
+		}
+		counts[summary.ServerTable+":"+strconv.Itoa(summary.ServerID)] = DomainCounts{Total: summary.Total, Available: summary.Available, InCooldown: summary.InCooldown}
+	}
+	return counts, nil
+}
+
+// 从 CountAll 的结果中取服务器的域名计数，不在结果中时单独统计
+func lookupDomainCounts(svc DomainService, all map[string]DomainCounts, table string, id int, now int64) (DomainCounts, error) {
+	if counts, ok := all[table+":"+strconv.Itoa(id)]; ok {
+		return counts, nil
+	}
+	return svc.Count(table, id, now)
+}
+
+func (s *gormDomainService) List(table string, id int) ([]ServerDomain, error) {
+	var domains []ServerDomain
+	err := s.db.Scopes(serverDomainScope(table, id)).Order("last_used_time ASC").Find(&domains).Error
+	return domains, err
+}
+
+// 分页游标：最后一条记录的 last_used_time 与 id
+func encodeDomainCursor(d ServerDomain) string {
+	return fmt.Sprintf("%d-%d", d.LastUsedTime, d.ID)
+}
+
+func decodeDomainCursor(cursor string) (int64, uint, error) {
+	var lastUsed int64
+	var id uint
+	if _, err := fmt.Sscanf(cursor, "%d-%d", &lastUsed, &id); err != nil {
+		return 0, 0, fmt.Errorf("无效的分页游标: %s", cursor)
+	}
+	return lastUsed, id, nil
+}
+
+func (s *gormDomainService) Page(table string, id int, query DomainQuery) (DomainPage, error) {
+	var page DomainPage
+	filtered := func() *gorm.DB {
+		q := s.db.Model(&ServerDomain{}).Scopes(serverDomainScope(table, id))
+		if query.InUse != nil {
+			q = q.Where("in_use = ?", *query.InUse)
+		}
+		if query.Search != "" {
+			q = q.Where("domain LIKE ? ESCAPE '!'", "%"+escapeLike(query.Search)+"%")
+		}
+		return q
+	}
+	if err := filtered().Count(&page.Total).Error; err != nil {
+		return page, err
+	}
+	q := filtered().Order("last_used_time ASC, id ASC")
+	if query.Limit > 0 {
+		if query.Cursor != "" {
+			lastUsed, lastID, err := decodeDomainCursor(query.Cursor)
+			if err != nil {
+				return page, err
+			}
+			q = q.Where("(last_used_time > ? OR (last_used_time = ? AND id > ?))", lastUsed, lastUsed, lastID)
+		} else if query.Offset > 0 {
+			q = q.Offset(query.Offset)
+		}
+		// 多取一条用于判断是否还有下一页
+		q = q.Limit(query.Limit + 1)
+	}
+	if err := q.Find(&page.Domains).Error; err != nil {
+		return page, err
+	}
+	if query.Limit > 0 && len(page.Domains) > query.Limit {
+		page.Domains = page.Domains[:query.Limit]
+		page.NextCursor = encodeDomainCursor(page.Domains[query.Limit-1])
+	}
+	return page, nil
+}
+
+// 转义 LIKE 通配符（以 ! 为转义符，兼容 MySQL 与 SQLite）
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+func (s *gormDomainService) Available(tx *gorm.DB, table string, id int, excludeHost string, now int64) ([]ServerDomain, error) {
+	var domains []ServerDomain
+	q := tx.Scopes(serverDomainScope(table, id), availableDomainScopeFor(now, s.settings().CDNCooldownSeconds))
+	if excludeHost != "" {
+		q = q.Where("domain != ?", excludeHost)
+	}
+	if err := q.Order("last_used_time ASC").Find(&domains).Error; err != nil {
+		return nil, err
+	}
+	// 与当前主机互为别名的域名（如 www. 与裸域名）不紧接着分配
+	if excludeHost != "" {
+		key := domainAliasKey(excludeHost)
+		filtered := domains[:0]
+		for _, d := range domains {
+			if domainAliasKey(d.Domain) != key {
+				filtered = append(filtered, d)
+			}
+		}
+		domains = filtered
+	}
+	return domains, nil
+}
+
+func (s *gormDomainService) Candidates(tx *gorm.DB, table string, id int, excludeHost string, now int64) ([]ServerDomain, error) {
+	availableDomains, err := s.Available(tx, table, id, excludeHost, now)
+	if err != nil {
+		log.Printf("获取可用域名失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return nil, fmt.Errorf("获取可用域名失败: %v", err)
+	}
+	log.Printf("可用域名数: %v, 表=%s, ID=%d", len(availableDomains), table, id)
+	if len(availableDomains) == 0 {
+		log.Printf("无可用域名（排除当前主机）: 表=%s, ID=%d", table, id)
+		return nil, errNoAvailableDomain
+	}
+
+	// 排除最近 N 次分配过的域名（CDN 域名不受此限制）
+	if avoidN := s.settings().avoidRecentDomains(loadServerSetting(tx, table, id)); avoidN > 0 {
+		recent, err := recentAssignedDomains(tx, table, id, avoidN)
+		if err != nil {
+			log.Printf("获取轮换历史失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			return nil, fmt.Errorf("获取轮换历史失败: %v", err)
+		}
+		recentSet := make(map[string]bool, len(recent))
+		for _, h := range recent {
+			recentSet[h] = true
+		}
+		filtered := availableDomains[:0]
+		for _, d := range availableDomains {
+			if recentSet[d.Domain] && !isCDNDomain(d) {
+				log.Printf("跳过最近 %d 次使用过的域名: %s, 表=%s, ID=%d", avoidN, d.Domain, table, id)
+				continue
+			}
+			filtered = append(filtered, d)
+		}
+		availableDomains = filtered
+		if len(availableDomains) == 0 {
+			log.Printf("无可用域名（排除最近 %d 次使用过的域名）: 表=%s, ID=%d", avoidN, table, id)
+			return nil, fmt.Errorf("%w（最近 %d 次使用过的域名已排除）", errNoAvailableDomain, avoidN)
+		}
+	}
+
+	// 执行服务器轮换策略中的域名规则
+	if rules := loadPolicyRules(tx, table, id); len(rules) > 0 {
+		if availableDomains, err = applyDomainPolicy(tx, rules, availableDomains, now); err != nil {
+			log.Printf("无可用域名（轮换策略）: 表=%s, ID=%d, 错误=%v", table, id, err)
+			return nil, err
+		}
+	}
+
+	// 排除其他服务器正在使用的独占域名
+	if availableDomains, err = excludeExclusiveConflicts(tx, table, id, availableDomains); err != nil {
+		log.Printf("检查域名共用方式失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return nil, fmt.Errorf("检查域名共用方式失败: %v", err)
+	}
+	if len(availableDomains) == 0 {
+		log.Printf("无可用域名（独占域名正被其他服务器使用）: 表=%s, ID=%d", table, id)
+		return nil, fmt.Errorf("%w（独占域名正被其他服务器使用）", errNoAvailableDomain)
+	}
+
+	return availableDomains, nil
+}
+
+func (s *gormDomainService) VerifyCandidates(table string, id int, excludeHost string, now int64) (map[uint]bool, error) {
+	if !s.settings().DNSVerify {
+		return nil, nil
+	}
+	candidates, err := s.Candidates(s.db, table, id, excludeHost, now)
+	if err != nil {
+		return nil, err
+	}
+	return verifyCandidateDNS(s.db, table, id, candidates, now)
+}
+
+func (s *gormDomainService) PickNext(tx *gorm.DB, table string, id int, excludeHost string, now int64, verified map[uint]bool) (ServerDomain, error) {
+	candidates, err := s.Candidates(tx, table, id, excludeHost, now)
+	if err != nil {
+		return ServerDomain{}, err
+	}
+	// 选择第一个域名（last_used_time 最小），开启解析校验时选择第一个通过校验的域名
+	if verified == nil {
+		return candidates[0], nil
+	}
+	for _, d := range candidates {
+		if verified[d.ID] {
+			return d, nil
+		}
+	}
+	// 校验后域名被其他轮换占用或状态改变，重试时重新校验
+	return ServerDomain{}, fmt.Errorf("%w（通过解析校验的域名已不可分配）", errServerConflict)
+}
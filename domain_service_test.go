@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 测试用的内存数据库，每个测试独立
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	tdb, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := tdb.AutoMigrate(models...); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := tdb.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return tdb
+}
+
+// 测试用的域名服务，使用固定设置
+func newTestDomainService(t *testing.T, settings DomainSettings) (*gorm.DB, DomainService) {
+	tdb := newTestDB(t, &ServerDomain{}, &ServerSetting{}, &RotationHistory{}, &RotationPolicy{})
+	return tdb, newDomainService(tdb, func() DomainSettings { return settings })
+}
+
+func createTestDomains(t *testing.T, tdb *gorm.DB, domains []ServerDomain) {
+	t.Helper()
+	for i := range domains {
+		if domains[i].ServerTable == "" {
+			domains[i].ServerTable, domains[i].ServerID = "v2_server_vless", 1
+		}
+		if err := tdb.Create(&domains[i]).Error; err != nil {
+			t.Fatalf("创建域名失败: %v", err)
+		}
+	}
+}
+
+func domainNames(domains []ServerDomain) string {
+	names := make([]string, 0, len(domains))
+	for _, d := range domains {
+		names = append(names, d.Domain)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestDomainServicePage(t *testing.T) {
+	tdb, svc := newTestDomainService(t, DomainSettings{})
+	// last_used_time 相同的域名按 id 排序，游标需跨过相同的 last_used_time
+	createTestDomains(t, tdb, []ServerDomain{
+		{Domain: "a.example.com", LastUsedTime: 100},
+		{Domain: "b.example.com", LastUsedTime: 100},
+		{Domain: "c.example.com", LastUsedTime: 100, InUse: 1},
+		{Domain: "d.example.com", LastUsedTime: 50},
+		{Domain: "e.example.com", LastUsedTime: 200},
+		{Domain: "other.example.com", ServerTable: "v2_server_vless", ServerID: 2},
+	})
+	inUse := 0
+	tests := []struct {
+		name  string
+		query DomainQuery
+		pages []string
+		total int64
+	}{
+		{"不分页", DomainQuery{}, []string{"d.example.com,a.example.com,b.example.com,c.example.com,e.example.com"}, 5},
+		{"每页两条", DomainQuery{Limit: 2}, []string{"d.example.com,a.example.com", "b.example.com,c.example.com", "e.example.com"}, 5},
+		{"恰好整页", DomainQuery{Limit: 5}, []string{"d.example.com,a.example.com,b.example.com,c.example.com,e.example.com"}, 5},
+		{"按使用状态过滤", DomainQuery{Limit: 3, InUse: &inUse}, []string{"d.example.com,a.example.com,b.example.com", "e.example.com"}, 4},
+		{"按子串搜索", DomainQuery{Limit: 1, Search: "b.ex"}, []string{"b.example.com"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			var got []string
+			for i := 0; i <= len(tt.pages); i++ {
+				page, err := svc.Page("v2_server_vless", 1, query)
+				if err != nil {
+					t.Fatalf("Page 失败: %v", err)
+				}
+				if page.Total != tt.total {
+					t.Errorf("Total = %d，期望 %d", page.Total, tt.total)
+				}
+				got = append(got, domainNames(page.Domains))
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			if strings.Join(got, "|") != strings.Join(tt.pages, "|") {
+				t.Errorf("分页结果 = %q，期望 %q", got, tt.pages)
+			}
+		})
+	}
+
+	if _, err := svc.Page("v2_server_vless", 1, DomainQuery{Limit: 2, Cursor: "bad"}); err == nil {
+		t.Error("无效游标应返回错误")
+	}
+}
+
+func TestDomainServiceAvailable(t *testing.T) {
+	const now = int64(1_000_000)
+	tdb, svc := newTestDomainService(t, DomainSettings{CDNCooldownSeconds: 600})
+	createTestDomains(t, tdb, []ServerDomain{
+		{Domain: "example.com", LastUsedTime: 1},
+		{Domain: "www.example.com", LastUsedTime: 2},
+		{Domain: "Example.org", LastUsedTime: 3},
+		{Domain: "example.org", AliasOf: 3},
+		{Domain: "used.example.net", InUse: 1},
+		{Domain: "cooling.example.net", LastUsedTime: now - 60},
+		{Domain: "cdn.example.net", LastUsedTime: now - 900, CDN: 1},
+		{Domain: "retired.example.net", Retired: 1},
+	})
+	tests := []struct {
+		name        string
+		excludeHost string
+		want        string
+	}{
+		{"不排除主机", "", "example.com,www.example.com,Example.org,cdn.example.net"},
+		{"排除裸域名及其 www 别名", "example.com", "Example.org,cdn.example.net"},
+		{"排除 www 域名及其裸域名", "WWW.example.com.", "Example.org,cdn.example.net"},
+		{"别名记录本身不可分配", "example.org", "example.com,www.example.com,cdn.example.net"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domains, err := svc.Available(tdb, "v2_server_vless", 1, tt.excludeHost, now)
+			if err != nil {
+				t.Fatalf("Available 失败: %v", err)
+			}
+			if got := domainNames(domains); got != tt.want {
+				t.Errorf("Available = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainServicePickNext(t *testing.T) {
+	const now = int64(1_000_000)
+	tdb, svc := newTestDomainService(t, DomainSettings{})
+	createTestDomains(t, tdb, []ServerDomain{
+		{Domain: "current.example.com", InUse: 1},
+		{Domain: "first.example.com", LastUsedTime: 10},
+		{Domain: "second.example.com", LastUsedTime: 20},
+		{Domain: "third.example.com", LastUsedTime: 30},
+	})
+	ids := map[string]uint{}
+	var all []ServerDomain
+	tdb.Find(&all)
+	for _, d := range all {
+		ids[d.Domain] = d.ID
+	}
+	tests := []struct {
+		name     string
+		verified map[uint]bool
+		want     string
+		wantErr  error
+	}{
+		{"未开启校验时选最久未用的域名", nil, "first.example.com", nil},
+		{"只选通过校验的域名", map[uint]bool{ids["third.example.com"]: true, ids["second.example.com"]: true}, "second.example.com", nil},
+		{"通过校验的域名已不可分配", map[uint]bool{ids["current.example.com"]: true}, "", errServerConflict},
+		{"没有域名通过校验", map[uint]bool{}, "", errServerConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := svc.PickNext(tdb, "v2_server_vless", 1, "current.example.com", now, tt.verified)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("错误 = %v，期望 %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PickNext 失败: %v", err)
+			}
+			if d.Domain != tt.want {
+				t.Errorf("PickNext = %s，期望 %s", d.Domain, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainServicePickNextAvoidRecent(t *testing.T) {
+	const now = int64(1_000_000)
+	tests := []struct {
+		name    string
+		global  int
+		setting int
+		want    string
+	}{
+		{"不排除最近使用的域名", 0, -1, "first.example.com"},
+		{"使用全局设置", 1, -1, "second.example.com"},
+		{"服务器设置优先", 2, 0, "first.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tdb, svc := newTestDomainService(t, DomainSettings{AvoidRecentDomains: tt.global})
+			createTestDomains(t, tdb, []ServerDomain{
+				{Domain: "first.example.com", LastUsedTime: 10},
+				{Domain: "second.example.com", LastUsedTime: 20},
+			})
+			tdb.Create(&ServerSetting{ServerTable: "v2_server_vless", ServerID: 1, AvoidRecentDomains: tt.setting})
+			tdb.Create(&RotationHistory{ServerTable: "v2_server_vless", ServerID: 1, Status: rotationSuccess, NewHost: "first.example.com"})
+			d, err := svc.PickNext(tdb, "v2_server_vless", 1, "", now, nil)
+			if err != nil {
+				t.Fatalf("PickNext 失败: %v", err)
+			}
+			if d.Domain != tt.want {
+				t.Errorf("PickNext = %s，期望 %s", d.Domain, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainServiceCountAll(t *testing.T) {
+	const now = int64(1_000_000)
+	tdb, svc := newTestDomainService(t, DomainSettings{})
+	if err := tdb.AutoMigrate(&DomainSummary{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	createTestDomains(t, tdb, []ServerDomain{
+		{Domain: "a.example.com"},
+		{Domain: "b.example.com", LastUsedTime: now - 60},
+		{Domain: "c.example.com", ServerTable: "v2_server_vless", ServerID: 2},
+	})
+	for _, id := range []int{1, 2} {
+		if _, err := svc.Count("v2_server_vless", id, now); err != nil {
+			t.Fatalf("Count 失败: %v", err)
+		}
+	}
+	// 服务器 1 的冷却在 now+3h-60 结束，之后读取时汇总过期需重算
+	later := now + domainCooldownSeconds
+	all, err := svc.CountAll(later)
+	if err != nil {
+		t.Fatalf("CountAll 失败: %v", err)
+	}
+	want := map[string]DomainCounts{
+		"v2_server_vless:1": {Total: 2, Available: 2},
+		"v2_server_vless:2": {Total: 1, Available: 1},
+	}
+	if len(all) != len(want) {
+		t.Fatalf("CountAll = %v，期望 %v", all, want)
+	}
+	for key, w := range want {
+		if all[key] != w {
+			t.Errorf("%s = %+v，期望 %+v", key, all[key], w)
+		}
+	}
+	// 没有汇总行的服务器单独统计
+	createTestDomains(t, tdb, []ServerDomain{{Domain: "d.example.com", ServerTable: "v2_server_vless", ServerID: 3}})
+	counts, err := lookupDomainCounts(svc, all, "v2_server_vless", 3, later)
+	if err != nil || counts.Total != 1 {
+		t.Errorf("lookupDomainCounts = %+v, %v，期望 Total=1", counts, err)
+	}
+}
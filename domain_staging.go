@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 域名预热的传播等待时间（dns.stageSeconds），0 表示不预热
+func domainStageSeconds() int64 {
+	return viper.GetInt64("dns.stageSeconds")
+}
+
+// 是否可以预热域名：开启了自动解析与预热，且节点 IP、DNS 服务商均已配置
+func canStageDomain(t *Tenant, d ServerDomain) bool {
+	if devMode || !viper.GetBool("dns.autoUpdate") || domainStageSeconds() <= 0 {
+		return false
+	}
+	if lookupNodeIP(t.DB, d.ServerTable, d.ServerID) == "" {
+		return false
+	}
+	provider, _, err := dnsProviderFor(d)
+	return err == nil && provider != nil
+}
+
+// 预热域名：先创建解析记录，再等待 dns.stageSeconds 传播后才参与轮换；
+// 创建失败时取消预热（轮换时仍会按原流程更新解析）并记录失败原因
+func stageDomain(t *Tenant, d ServerDomain) (int64, error) {
+	if err := syncDomainRecord(t.DB, d.ServerTable, d.ServerID, d); err != nil {
+		log.Printf("域名预热失败: 域名=%s, 表=%s, ID=%d, 错误=%v", d.Domain, d.ServerTable, d.ServerID, err)
+		if dbErr := t.DB.Model(&ServerDomain{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+			"staged_until":     0,
+			"dns_status":       dnsStatusError,
+			"dns_detail":       truncate("预热失败："+err.Error(), 255),
+			"dns_checked_time": time.Now().Unix(),
+		}).Error; dbErr != nil {
+			log.Printf("记录域名预热结果失败: 域名=%s, 错误=%v", d.Domain, dbErr)
+		}
+		return 0, err
+	}
+	until := time.Now().Unix() + domainStageSeconds()
+	if err := t.DB.Model(&ServerDomain{}).Where("id = ?", d.ID).Update("staged_until", until).Error; err != nil {
+		return 0, err
+	}
+	log.Printf("域名已预热，%s 后可参与轮换: 域名=%s, 表=%s, ID=%d", time.Duration(domainStageSeconds())*time.Second, d.Domain, d.ServerTable, d.ServerID)
+	return until, nil
+}
+
+// 注册域名预热路由
+func registerDomainStagingRoutes(r *gin.Engine) {
+	// 手动预热未使用的域名（如节点 IP 变更后），成功后返回可参与轮换的时间
+	r.POST("/stage-domain", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		id, err := strconv.Atoi(serverParam(c, "domain_id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的域名ID")
+			return
+		}
+		var domain ServerDomain
+		if err := t.DB.First(&domain, id).Error; err != nil {
+			respondError(c, http.StatusNotFound, codeDomainNotFound, "域名不存在")
+			return
+		}
+		if domain.InUse == 1 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "域名正在使用中，无需预热")
+			return
+		}
+		if !canStageDomain(t, domain) {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "未开启预热（dns.autoUpdate、dns.stageSeconds）或未配置节点 IP、DNS 服务商")
+			return
+		}
+		until, err := stageDomain(t, domain)
+		if err != nil {
+			respondError(c, http.StatusBadGateway, codeUpstreamFailed, fmt.Sprintf("预热失败：%v", err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "域名已预热", "staged_until": until})
+	})
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DomainSummary 结构体，每台服务器的域名计数汇总，域名变更时在同一事务内重算，
+// 列表页及接口读取一行即可，无需每次重新统计 server_domains
+type DomainSummary struct {
+	ServerTable  string `gorm:"column:server_table;type:varchar(255);primaryKey" json:"server_table"`
+	ServerID     int    `gorm:"column:server_id;primaryKey;autoIncrement:false" json:"server_id"`
+	Total        int64  `gorm:"column:total;default:0" json:"total"`
+	Available    int64  `gorm:"column:available;default:0" json:"available"`
+	InCooldown   int64  `gorm:"column:in_cooldown;default:0" json:"in_cooldown"`
+	ComputedAt   int64  `gorm:"column:computed_at;default:0" json:"computed_at"`
+	NextChangeAt int64  `gorm:"column:next_change_at;default:0" json:"next_change_at"` // 最早有域名结束冷却或预热的时间，到期后重算；0 表示不随时间变化
+}
+
+// 汇总是否适用于时间 now：冷却、预热随时间结束，超出 [computed_at, next_change_at) 时需要重算
+func (s DomainSummary) validAt(now int64) bool {
+	return now >= s.ComputedAt && (s.NextChangeAt == 0 || now < s.NextChangeAt)
+}
+
+// 从 server_domains 统计服务器的域名汇总
+func computeDomainSummary(tx *gorm.DB, table string, id int, now int64) (DomainSummary, error) {
+	summary := DomainSummary{ServerTable: table, ServerID: id, ComputedAt: now}
+	// 冷却期按域名类型不同（CDN 域名冷却更短）
+	cooldownStart, startArgs := cooldownStartExpr(now)
+	cooldownLength, lengthArgs := cooldownLengthExpr()
+	var row struct {
+		Total         int64
+		Available     int64
+		InCooldown    int64
+		CooldownUntil int64
+		StagedUntil   int64
+	}
+	args := append([]interface{}{}, startArgs...)
+	args = append(args, now)
+	args = append(args, startArgs...)
+	args = append(args, startArgs...)
+	args = append(args, lengthArgs...)
+	args = append(args, now)
+	err := tx.Model(&ServerDomain{}).Scopes(serverDomainScope(table, id)).Select(
+		"COUNT(*) AS total, "+
+			"COALESCE(SUM(CASE WHEN in_use = 0 AND retired = 0 AND alias_of = 0 AND (last_used_time = 0 OR last_used_time <= "+cooldownStart+") AND staged_until <= ? THEN 1 ELSE 0 END), 0) AS available, "+
+			"COALESCE(SUM(CASE WHEN in_use = 0 AND retired = 0 AND alias_of = 0 AND last_used_time > "+cooldownStart+" THEN 1 ELSE 0 END), 0) AS in_cooldown, "+
+			"COALESCE(MIN(CASE WHEN in_use = 0 AND retired = 0 AND alias_of = 0 AND last_used_time > "+cooldownStart+" THEN last_used_time + "+cooldownLength+" END), 0) AS cooldown_until, "+
+			"COALESCE(MIN(CASE WHEN in_use = 0 AND retired = 0 AND alias_of = 0 AND staged_until > ? THEN staged_until END), 0) AS staged_until",
+		args...).Scan(&row).Error
+	if err != nil {
+		return summary, err
+	}
+	summary.Total, summary.Available, summary.InCooldown = row.Total, row.Available, row.InCooldown
+	if row.CooldownUntil > 0 {
+		summary.NextChangeAt = row.CooldownUntil
+	}
+	if row.StagedUntil > 0 && (summary.NextChangeAt == 0 || row.StagedUntil < summary.NextChangeAt) {
+		summary.NextChangeAt = row.StagedUntil
+	}
+	return summary, nil
+}
+
+// 重算并保存服务器的域名汇总
+func refreshDomainSummary(tx *gorm.DB, table string, id int, now int64) (DomainSummary, error) {
+	summary, err := computeDomainSummary(tx, table, id, now)
+	if err != nil {
+		return summary, err
+	}
+	err = tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&summary).Error
+	return summary, err
+}
+
+// 读取服务器的域名汇总，不存在或已过期时重算
+func loadDomainSummary(tdb *gorm.DB, table string, id int, now int64) (DomainSummary, error) {
+	var summary DomainSummary
+	err := tdb.Where("server_table = ? AND server_id = ?", table, id).Take(&summary).Error
+	if err == nil && summary.validAt(now) {
+		return summary, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("读取域名汇总失败，重新统计: 表=%s, ID=%d, 错误=%v", table, id, err)
+	}
+	return refreshDomainSummary(tdb, table, id, now)
+}
+
+// 受本次写入影响的服务器，键为 表名:ID
+type summaryTargets map[string]DomainSummary
+
+func (ts summaryTargets) add(table string, id int) {
+	if table != "" && id > 0 {
+		ts[table+":"+strconv.Itoa(id)] = DomainSummary{ServerTable: table, ServerID: id}
+	}
+}
+
+// 在租户数据库上注册回调：写入 server_domains 前找出受影响的服务器，写入后在同一事务内重新关联别名并重算汇总；
+// 无法确定受影响的服务器时（无条件的批量更新、原生 SQL）清空全部汇总，读取时按需重算
+func registerDomainSummaryHooks(tdb *gorm.DB) {
+	const key = "domain_summary:targets"
+	isDomainWrite := func(tx *gorm.DB) bool {
+		return tx.Statement.Table == "server_domains"
+	}
+	collect := func(tx *gorm.DB) {
+		if tx.Error != nil || !isDomainWrite(tx) {
+			return
+		}
+		targets := summaryTargets{}
+		collectModelTargets(tx.Statement.ReflectValue, targets)
+		if dest, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+			table, _ := dest["server_table"].(string)
+			id, _ := dest["server_id"].(int)
+			targets.add(table, id)
+		}
+		where, ok := tx.Statement.Clauses["WHERE"].Expression.(clause.Where)
+		if !ok || len(where.Exprs) == 0 {
+			if len(targets) == 0 {
+				tx.InstanceSet(key, summaryTargets(nil))
+				return
+			}
+		} else {
+			var pairs []DomainSummary
+			if err := tx.Session(&gorm.Session{NewDB: true}).Model(&ServerDomain{}).Clauses(where).
+				Distinct("server_table", "server_id").Find(&pairs).Error; err != nil {
+				log.Printf("查询受影响的服务器失败，清空域名汇总: %v", err)
+				tx.InstanceSet(key, summaryTargets(nil))
+				return
+			}
+			for _, p := range pairs {
+				targets.add(p.ServerTable, p.ServerID)
+			}
+		}
+		tx.InstanceSet(key, targets)
+	}
+	refresh := func(tx *gorm.DB) {
+		if tx.Error != nil || !isDomainWrite(tx) {
+			return
+		}
+		v, ok := tx.InstanceGet(key)
+		targets, _ := v.(summaryTargets)
+		if !ok {
+			// 创建：从写入的记录中取服务器
+			targets = summaryTargets{}
+			collectModelTargets(tx.Statement.ReflectValue, targets)
+		}
+		db := tx.Session(&gorm.Session{NewDB: true})
+		if targets == nil {
+			clearDomainSummaries(db)
+			return
+		}
+		now := time.Now().Unix()
+		for _, s := range targets {
+			if err := linkDomainAliases(db, s.ServerTable, s.ServerID); err != nil {
+				log.Printf("关联域名别名失败: 表=%s, ID=%d, 错误=%v", s.ServerTable, s.ServerID, err)
+				tx.AddError(err)
+				return
+			}
+			if _, err := refreshDomainSummary(db, s.ServerTable, s.ServerID, now); err != nil {
+				log.Printf("更新域名汇总失败: 表=%s, ID=%d, 错误=%v", s.ServerTable, s.ServerID, err)
+				tx.AddError(err)
+				return
+			}
+		}
+	}
+	raw := func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		sql := strings.ToUpper(strings.TrimSpace(tx.Statement.SQL.String()))
+		if strings.Contains(sql, "SERVER_DOMAINS") && (strings.HasPrefix(sql, "UPDATE") || strings.HasPrefix(sql, "DELETE") || strings.HasPrefix(sql, "INSERT")) {
+			clearDomainSummaries(tx.Session(&gorm.Session{NewDB: true}))
+		}
+	}
+	cb := tdb.Callback()
+	cb.Update().Before("gorm:update").Register("domain_summary:collect", collect)
+	cb.Delete().Before("gorm:delete").Register("domain_summary:collect", collect)
+	cb.Create().After("gorm:create").Register("domain_summary:refresh", refresh)
+	cb.Update().After("gorm:update").Register("domain_summary:refresh", refresh)
+	cb.Delete().After("gorm:delete").Register("domain_summary:refresh", refresh)
+	cb.Raw().After("gorm:raw").Register("domain_summary:refresh", raw)
+}
+
+// 从写入的 ServerDomain 记录（单条或切片）中取出服务器
+func collectModelTargets(v reflect.Value, targets summaryTargets) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectModelTargets(v.Elem(), targets)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectModelTargets(v.Index(i), targets)
+		}
+	case reflect.Struct:
+		if d, ok := v.Interface().(ServerDomain); ok {
+			targets.add(d.ServerTable, d.ServerID)
+		}
+	}
+}
+
+// 清空全部域名汇总
+func clearDomainSummaries(tx *gorm.DB) {
+	if err := tx.Where("1 = 1").Delete(&DomainSummary{}).Error; err != nil {
+		log.Printf("清空域名汇总失败: %v", err)
+	}
+}
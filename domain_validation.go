@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/idna"
+)
+
+// 域名格式无效
+var errInvalidDomain = errors.New("无效的域名")
+
+// 规范化并校验域名：去除空白和末尾的点、转小写、IDN 转为 punycode，
+// 按 RFC 1035/1123 校验长度及字符；通配符域名仅在 domain.allowWildcard 开启时允许
+func normalizeDomain(raw string) (string, error) {
+	domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(raw)), ".")
+	if domain == "" {
+		return "", fmt.Errorf("%w: 域名不能为空", errInvalidDomain)
+	}
+	wildcard := false
+	if strings.HasPrefix(domain, "*.") {
+		if !viper.GetBool("domain.allowWildcard") {
+			return "", fmt.Errorf("%w: 不允许使用通配符域名", errInvalidDomain)
+		}
+		wildcard = true
+		domain = domain[2:]
+	}
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidDomain, err)
+	}
+	if len(ascii) > 253 {
+		return "", fmt.Errorf("%w: 域名长度超过 253", errInvalidDomain)
+	}
+	labels := strings.Split(ascii, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("%w: 域名至少包含两级", errInvalidDomain)
+	}
+	for _, label := range labels {
+		if err := validateDomainLabel(label); err != nil {
+			return "", err
+		}
+	}
+	if isAllDigits(labels[len(labels)-1]) {
+		return "", fmt.Errorf("%w: 顶级域名不能为纯数字", errInvalidDomain)
+	}
+	if wildcard {
+		ascii = "*." + ascii
+	}
+	return ascii, nil
+}
+
+// 校验单个标签：1-63 个字符，仅字母、数字、连字符，且不以连字符开头或结尾
+func validateDomainLabel(label string) error {
+	if len(label) == 0 || len(label) > 63 {
+		return fmt.Errorf("%w: 标签 %q 长度应为 1-63", errInvalidDomain, label)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("%w: 标签 %q 不能以连字符开头或结尾", errInvalidDomain, label)
+	}
+	for _, r := range label {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return fmt.Errorf("%w: 标签 %q 包含非法字符", errInvalidDomain, label)
+		}
+	}
+	return nil
+}
+
+func isAllDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"ser_manger/internal/handlers"
+)
+
+// API 错误码，定义见 handlers 包
+const (
+	codeInvalidArgument      = handlers.CodeInvalidArgument
+	codeInvalidTable         = handlers.CodeInvalidTable
+	codeInvalidID            = handlers.CodeInvalidID
+	codeValidationFailed     = handlers.CodeValidationFailed
+	codeNotFound             = handlers.CodeNotFound
+	codeDomainNotFound       = handlers.CodeDomainNotFound
+	codeDomainExists         = handlers.CodeDomainExists
+	codeDomainExhausted      = handlers.CodeDomainExhausted
+	codeDomainProtected      = handlers.CodeDomainProtected
+	codeConflict             = handlers.CodeConflict
+	codeUnauthorized         = handlers.CodeUnauthorized
+	codeForbidden            = handlers.CodeForbidden
+	codeBodyTooLarge         = handlers.CodeBodyTooLarge
+	codeUnsupportedMediaType = handlers.CodeUnsupportedMediaType
+	codeMaintenance          = handlers.CodeMaintenance
+	codeStandby              = handlers.CodeStandby
+	codeUpstreamFailed       = handlers.CodeUpstreamFailed
+	codeRotationFailed       = handlers.CodeRotationFailed
+	codeIdempotencyKeyReused = handlers.CodeIdempotencyKeyReused
+	codeConfirmationRequired = handlers.CodeConfirmationRequired
+	codeInternal             = handlers.CodeInternal
+)
+
+// 错误响应，见 handlers.RespondError
+func respondError(c *gin.Context, status int, code, message string, details ...interface{}) {
+	handlers.RespondError(c, status, code, message, details...)
+}
+
+// 轮换失败的错误码：无可用域名时为 DOMAIN_EXHAUSTED，其余为 ROTATION_FAILED
+func rotationErrorCode(err error) string {
+	if errors.Is(err, errNoAvailableDomain) {
+		return codeDomainExhausted
+	}
+	return codeRotationFailed
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 事件类型
+const (
+	eventRotationStarted   = "rotation_started"
+	eventRotationSucceeded = "rotation_succeeded"
+	eventRotationFailed    = "rotation_failed"
+	eventDomainAdded       = "domain_added"
+	eventDomainExhausted   = "domain_exhausted"
+	eventPortUnreachable   = "port_unreachable"
+	eventDomainBlocked     = "domain_blocked"
+	eventServerModified    = "server_modified"
+	eventRotationReport    = "rotation_report"
+)
+
+// Event 轮换相关事件
+type Event struct {
+	Type          string          `json:"type"`
+	Tenant        string          `json:"tenant"`
+	ServerTable   string          `json:"server_table"`
+	ServerID      int             `json:"server_id"`
+	Domain        string          `json:"domain,omitempty"`
+	OldHost       string          `json:"old_host,omitempty"`
+	NewHost       string          `json:"new_host,omitempty"`
+	OldPort       int             `json:"old_port,omitempty"`
+	NewPort       int             `json:"new_port,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	Trigger       string          `json:"trigger,omitempty"`        // 轮换事件的触发来源
+	Actor         string          `json:"actor,omitempty"`          // 轮换事件的操作者
+	AffectedUsers *int            `json:"affected_users,omitempty"` // 轮换影响的在线用户数，无统计数据时为空
+	Report        *RotationReport `json:"report,omitempty"`         // 仅 rotation_report 事件
+	Time          int64           `json:"time"`
+}
+
+// 事件的单行文字描述，供日志和聊天类通知使用；非默认租户的事件带租户前缀
+func (e Event) String() string {
+	if e.Tenant != "" && e.Tenant != defaultTenantName {
+		return "[" + e.Tenant + "] " + e.describe()
+	}
+	return e.describe()
+}
+
+// 轮换事件的触发来源及操作者
+func (e Event) causeSuffix() string {
+	if e.Trigger == "" {
+		return ""
+	}
+	return fmt.Sprintf(", 触发=%s, 操作者=%s", e.Trigger, e.Actor)
+}
+
+// 轮换影响的在线用户数
+func (e Event) impactSuffix() string {
+	if e.AffectedUsers == nil {
+		return ""
+	}
+	return fmt.Sprintf(", 影响在线用户 %d 人", *e.AffectedUsers)
+}
+
+func (e Event) describe() string {
+	switch e.Type {
+	case eventRotationStarted:
+		return fmt.Sprintf("开始轮换: 表=%s, ID=%d", e.ServerTable, e.ServerID) + e.causeSuffix()
+	case eventRotationSucceeded:
+		return fmt.Sprintf("轮换成功: 表=%s, ID=%d, 主机 %s -> %s, 端口 %d -> %d", e.ServerTable, e.ServerID, e.OldHost, e.NewHost, e.OldPort, e.NewPort) + e.impactSuffix() + e.causeSuffix()
+	case eventRotationFailed:
+		return fmt.Sprintf("轮换失败: 表=%s, ID=%d, 错误=%s", e.ServerTable, e.ServerID, e.Error) + e.causeSuffix()
+	case eventDomainAdded:
+		return fmt.Sprintf("添加域名: 表=%s, ID=%d, 域名=%s", e.ServerTable, e.ServerID, e.Domain)
+	case eventDomainExhausted:
+		return fmt.Sprintf("域名池耗尽: 表=%s, ID=%d, 错误=%s", e.ServerTable, e.ServerID, e.Error)
+	case eventDomainBlocked:
+		return fmt.Sprintf("域名被封锁: 表=%s, ID=%d, 域名=%s, 原因=%s", e.ServerTable, e.ServerID, e.Domain, e.Error)
+	case eventServerModified:
+		return fmt.Sprintf("服务器被外部修改: 表=%s, ID=%d, 主机 %s -> %s, 端口 %d -> %d", e.ServerTable, e.ServerID, e.OldHost, e.NewHost, e.OldPort, e.NewPort)
+	case eventRotationReport:
+		if e.Report != nil {
+			return e.Report.summary()
+		}
+	case eventPortUnreachable:
+		return fmt.Sprintf("轮换后端口不可达: 表=%s, ID=%d, 目标=%s:%d, 错误=%s", e.ServerTable, e.ServerID, e.NewHost, e.NewPort, e.Error)
+	}
+	return fmt.Sprintf("%s: 表=%s, ID=%d", e.Type, e.ServerTable, e.ServerID)
+}
+
+// EventSink 事件接收端，新增通知渠道只需实现此接口并在 setupEventBus 中注册
+type EventSink interface {
+	Name() string
+	Handle(e Event) error
+}
+
+// 事件总线：事件经缓冲队列由单个 goroutine 按顺序分发，发布方不会被慢速接收端阻塞
+type eventBus struct {
+	queue chan Event
+	sinks []sinkEntry
+}
+
+type sinkEntry struct {
+	sink  EventSink
+	types map[string]bool // 为空表示接收全部事件
+}
+
+var bus *eventBus
+
+// 发布事件；事件总线未启动（如命令行模式）时忽略，队列已满时丢弃
+func publishEvent(e Event) {
+	if bus == nil {
+		return
+	}
+	if e.Time == 0 {
+		e.Time = time.Now().Unix()
+	}
+	select {
+	case bus.queue <- e:
+	default:
+		log.Printf("事件队列已满，丢弃事件: %s", e)
+	}
+}
+
+func (b *eventBus) run() {
+	for e := range b.queue {
+		for _, entry := range b.sinks {
+			if len(entry.types) > 0 && !entry.types[e.Type] {
+				continue
+			}
+			if err := entry.sink.Handle(e); err != nil {
+				log.Printf("事件接收端 %s 处理失败: 事件=%s, 错误=%v", entry.sink.Name(), e.Type, err)
+			}
+		}
+	}
+}
+
+// 按配置启动事件总线，events.<接收端>.types 可限定接收的事件类型
+func setupEventBus() {
+	b := &eventBus{queue: make(chan Event, 1000)}
+	templates := func(channel string) notificationTemplates {
+		ts, err := loadNotificationTemplates(channel)
+		if err != nil {
+			log.Fatalf("加载通知模板失败: %v", err)
+		}
+		return ts
+	}
+	add := func(key string, sink EventSink) {
+		entry := sinkEntry{sink: sink}
+		for _, t := range viper.GetStringSlice("events." + key + ".types") {
+			if entry.types == nil {
+				entry.types = map[string]bool{}
+			}
+			entry.types[strings.TrimSpace(t)] = true
+		}
+		b.sinks = append(b.sinks, entry)
+		log.Printf("已注册事件接收端: %s", sink.Name())
+	}
+	viper.SetDefault("events.log.enabled", true)
+	if viper.GetBool("events.log.enabled") {
+		add("log", logSink{templates: templates("log")})
+	}
+	add("metrics", eventCounter)
+	if u := viper.GetString("events.webhook.url"); u != "" {
+		add("webhook", &webhookSink{url: u, client: &http.Client{Timeout: 10 * time.Second}})
+	}
+	if token := viper.GetString("events.telegram.botToken"); token != "" {
+		add("telegram", &telegramSink{
+			token:     token,
+			chatID:    viper.GetString("events.telegram.chatID"),
+			client:    &http.Client{Timeout: 10 * time.Second},
+			templates: templates("telegram"),
+		})
+	}
+	if u := viper.GetString("events.slack.webhookURL"); u != "" {
+		add("slack", &chatWebhookSink{name: "slack", url: u, field: "text", limit: 3000, client: &http.Client{Timeout: 10 * time.Second}, templates: templates("slack")})
+	}
+	if u := viper.GetString("events.discord.webhookURL"); u != "" {
+		add("discord", &chatWebhookSink{name: "discord", url: u, field: "content", limit: 2000, client: &http.Client{Timeout: 10 * time.Second}, templates: templates("discord")})
+	}
+	if host := viper.GetString("events.email.host"); host != "" && len(viper.GetStringSlice("events.email.to")) > 0 {
+		port := viper.GetInt("events.email.port")
+		if port <= 0 {
+			port = 587
+		}
+		add("email", &emailSink{
+			host:      host,
+			addr:      net.JoinHostPort(host, strconv.Itoa(port)),
+			username:  viper.GetString("events.email.username"),
+			password:  viper.GetString("events.email.password"),
+			from:      viper.GetString("events.email.from"),
+			to:        viper.GetStringSlice("events.email.to"),
+			templates: templates("email"),
+		})
+	}
+	if viper.GetBool("acquire.enabled") {
+		add("acquire", acquireSink{})
+	}
+	bus = b
+	go b.run()
+}
+
+// 日志接收端
+type logSink struct {
+	templates notificationTemplates
+}
+
+func (logSink) Name() string { return "log" }
+
+func (s logSink) Handle(e Event) error {
+	log.Printf("[事件] %s", s.templates.render(e))
+	return nil
+}
+
+// Webhook 接收端：以 JSON 形式 POST 事件
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Name() string { return "webhook" }
+
+func (s *webhookSink) Handle(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Telegram 接收端：通过 Bot API 发送文字消息
+type telegramSink struct {
+	token     string
+	chatID    string
+	client    *http.Client
+	templates notificationTemplates
+}
+
+func (s *telegramSink) Name() string { return "telegram" }
+
+func (s *telegramSink) Handle(e Event) error {
+	resp, err := s.client.PostForm("https://api.telegram.org/bot"+s.token+"/sendMessage", url.Values{
+		"chat_id": {s.chatID},
+		"text":    {s.templates.render(e)},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Telegram 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Slack / Discord 接收端：通过 Incoming Webhook 发送文字消息，
+// 两者仅消息字段名（Slack 为 text，Discord 为 content）及长度上限不同
+type chatWebhookSink struct {
+	name      string
+	url       string
+	field     string
+	limit     int
+	client    *http.Client
+	templates notificationTemplates
+}
+
+func (s *chatWebhookSink) Name() string { return s.name }
+
+func (s *chatWebhookSink) Handle(e Event) error {
+	body, err := json.Marshal(map[string]string{s.field: truncate(s.templates.render(e), s.limit)})
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s 返回状态码 %d", s.name, resp.StatusCode)
+	}
+	return nil
+}
+
+// 邮件接收端：通过 SMTP 发送，轮换报告以 HTML 正文发送，其他事件为纯文本
+type emailSink struct {
+	host      string
+	addr      string
+	username  string
+	password  string
+	from      string
+	to        []string
+	templates notificationTemplates
+}
+
+func (s *emailSink) Name() string { return "email" }
+
+func (s *emailSink) Handle(e Event) error {
+	subject := "[server-manager] " + e.String()
+	contentType := "text/plain; charset=UTF-8"
+	body := s.templates.render(e)
+	if e.Report != nil && s.templates[eventRotationReport] == nil {
+		subject = "[server-manager] 轮换报告"
+		if e.Tenant != "" && e.Tenant != defaultTenantName {
+			subject += "（" + e.Tenant + "）"
+		}
+		html, err := renderRotationReport(*e.Report)
+		if err != nil {
+			log.Printf("渲染轮换报告失败，改为发送文字摘要: %v", err)
+		} else {
+			contentType = "text/html; charset=UTF-8"
+			body = html
+		}
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", truncate(subject, 200)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\nContent-Type: %s\r\nContent-Transfer-Encoding: base64\r\n\r\n", contentType)
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+	return smtp.SendMail(s.addr, auth, s.from, s.to, msg.Bytes())
+}
+
+// 计数接收端：按事件类型累计次数并保留最近一次事件
+type eventCounterSink struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	last   map[string]Event
+}
+
+var eventCounter = &eventCounterSink{counts: map[string]int64{}, last: map[string]Event{}}
+
+func (s *eventCounterSink) Name() string { return "metrics" }
+
+func (s *eventCounterSink) Handle(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[e.Type]++
+	s.last[e.Type] = e
+	return nil
+}
+
+func (s *eventCounterSink) snapshot() (map[string]int64, map[string]Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int64, len(s.counts))
+	for k, v := range s.counts {
+		counts[k] = v
+	}
+	last := make(map[string]Event, len(s.last))
+	for k, v := range s.last {
+		last[k] = v
+	}
+	return counts, last
+}
+
+// 注册事件统计路由
+func registerEventRoutes(r *gin.Engine) {
+	// 启动以来各类事件的次数及最近一次事件
+	r.GET("/events/stats", authMiddleware, func(c *gin.Context) {
+		counts, last := eventCounter.snapshot()
+		c.JSON(http.StatusOK, gin.H{"counts": counts, "last": last})
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// 轮换失败分类，写入面板服务器表的 last_update_status_code 列；成功或非失败状态为空
+const (
+	failureNoDomains   = "NO_DOMAINS"              // 无可分配的域名
+	failureDBError     = "DB_ERROR"                // 读写数据库失败
+	failureDNSProvider = "DNS_PROVIDER_ERROR"      // DNS 服务商更新解析失败
+	failurePortProbe   = "PORT_PROBE_FAILED"       // 轮换后新端口不可达
+	failureBlackout    = "POLICY_BLACKOUT"         // 处于策略禁止轮换时段
+	failureConflict    = "CONCURRENT_MODIFICATION" // 服务器行被面板或其他实例并发修改
+	failureUnknown     = "UNKNOWN"                 // 未归类的错误
+)
+
+// 各类失败的处理建议，界面及接口展示此文字，原始错误作为补充信息
+var failureRemediations = map[string]string{
+	failureNoDomains:   "域名池已耗尽：请添加或恢复域名，或检查冷却期、轮换策略及解析校验是否排除了全部域名",
+	failureDBError:     "数据库读写失败：请检查数据库连接及磁盘空间，恢复后手动重新轮换",
+	failureDNSProvider: "DNS 服务商更新解析失败：请检查服务商令牌、域名所在 Zone 配置及服务商状态",
+	failurePortProbe:   "新端口不可达：请检查节点防火墙及安全组是否放行端口范围，或节点进程是否已重载配置",
+	failureBlackout:    "处于轮换策略的禁止时段：时段结束后将自动轮换，如需立即轮换请调整策略",
+	failureConflict:    "服务器记录被面板或其他实例同时修改：通常重试即可，频繁出现时请检查是否有多个实例同时轮换",
+	failureUnknown:     "未归类的错误：请查看原始错误信息及服务日志",
+}
+
+// 带分类的错误，错误文字与原错误相同
+type classifiedError struct {
+	class string
+	err   error
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+func (e *classifiedError) Unwrap() error { return e.err }
+
+// 为错误标记失败分类
+func withFailureClass(class string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// 数据库错误
+func dbFailure(err error) error {
+	return withFailureClass(failureDBError, err)
+}
+
+// 轮换失败归类
+func classifyFailure(err error) string {
+	var classified *classifiedError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &classified):
+		return classified.class
+	case errors.Is(err, errNoAvailableDomain):
+		return failureNoDomains
+	case errors.Is(err, errPolicyBlackout):
+		return failureBlackout
+	case errors.Is(err, errServerConflict):
+		return failureConflict
+	}
+	return failureUnknown
+}
+
+// 失败分类对应的处理建议
+func failureRemediation(code string) string {
+	return failureRemediations[code]
+}
+
+// 写入服务器最后更新状态及失败分类
+func setServerStatus(tdb *gorm.DB, table string, id int, status, code string) error {
+	return newServerRepository(tdb).SetStatus(table, id, status, code)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 运行时全局设置（更新间隔、端口范围）由 HTTP 接口修改、定时任务并发读取，
+// 以不可变快照保存：读取无锁，修改时复制后整体替换，读取方不会看到修改了一半的设置
+
+// Settings 全局设置快照，取得后只读
+type Settings struct {
+	UpdateIntervalHours int // 全局更新间隔（小时）
+	MinPort             int // 全局端口范围
+	MaxPort             int
+}
+
+// 未加载配置时的默认设置
+var defaultSettings = Settings{UpdateIntervalHours: 24}
+
+var (
+	settingsMu       sync.Mutex // 串行化修改，避免并发修改互相覆盖
+	settingsSnapshot atomic.Pointer[Settings]
+)
+
+// 当前全局设置
+func currentSettings() Settings {
+	if s := settingsSnapshot.Load(); s != nil {
+		return *s
+	}
+	return defaultSettings
+}
+
+// 修改全局设置：在当前设置的副本上执行 update 后替换，返回修改后的设置
+func updateSettings(update func(s *Settings)) Settings {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	next := currentSettings()
+	update(&next)
+	settingsSnapshot.Store(&next)
+	return next
+}
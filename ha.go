@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 调度器租约名称
+const schedulerLeaseName = "scheduler"
+
+// LeaderLease 结构体，主备选举租约（默认租户数据库），持有未过期租约的实例为主节点
+type LeaderLease struct {
+	Name      string `gorm:"column:name;type:varchar(64);primaryKey" json:"name"`
+	Holder    string `gorm:"column:holder;type:varchar(255);not null" json:"holder"`
+	ExpiresAt int64  `gorm:"column:expires_at;not null" json:"expires_at"`
+	RenewedAt int64  `gorm:"column:renewed_at;not null" json:"renewed_at"`
+}
+
+// 主备状态：未开启 ha.enabled 时本实例始终为主节点
+var haState struct {
+	sync.RWMutex
+	instanceID string
+	leader     bool
+	holder     string
+	expiresAt  int64
+}
+
+// 本实例 ID：ha.instanceID，未配置时为主机名-进程号-随机后缀
+func haInstanceID() string {
+	if id := viper.GetString("ha.instanceID"); id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	buf := make([]byte, 3)
+	rand.Read(buf)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(buf))
+}
+
+// 租约时长（秒），默认 30 秒
+func haLeaseSeconds() int64 {
+	if s := viper.GetInt64("ha.leaseSeconds"); s > 0 {
+		return s
+	}
+	return 30
+}
+
+// 本实例是否为主节点
+func isLeader() bool {
+	haState.RLock()
+	defer haState.RUnlock()
+	return haState.leader
+}
+
+// 尝试获取或续期租约，返回是否为主节点；各实例时钟需同步
+func acquireLease(now int64) (bool, error) {
+	expires := now + haLeaseSeconds()
+	id := haState.instanceID
+	result := db.Model(&LeaderLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", schedulerLeaseName, id, now).
+		Updates(map[string]interface{}{"holder": id, "expires_at": expires, "renewed_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := db.Model(&LeaderLease{}).Where("name = ?", schedulerLeaseName).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return false, nil
+		}
+		// 首次运行：创建租约，并发创建时主键冲突的一方成为备用节点
+		if err := db.Create(&LeaderLease{Name: schedulerLeaseName, Holder: id, ExpiresAt: expires, RenewedAt: now}).Error; err != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// 执行一次选举并按结果启停调度器
+func runElection() {
+	now := time.Now().Unix()
+	leader, err := acquireLease(now)
+	if err != nil {
+		// 无法访问数据库时无法确认租约仍有效，主动降级避免双主
+		log.Printf("主备选举失败: %v", err)
+		leader = false
+	}
+	var lease LeaderLease
+	db.Where("name = ?", schedulerLeaseName).First(&lease)
+	haState.Lock()
+	changed := haState.leader != leader
+	haState.leader = leader
+	haState.holder = lease.Holder
+	haState.expiresAt = lease.ExpiresAt
+	haState.Unlock()
+	if changed {
+		if leader {
+			log.Printf("本实例成为主节点: %s", haState.instanceID)
+		} else {
+			log.Printf("本实例成为备用节点: %s, 当前主节点=%s", haState.instanceID, lease.Holder)
+		}
+		syncScheduler()
+	}
+}
+
+// 初始化主备选举：未开启时本实例即为主节点；开启时先同步选举一次，再定期续约
+func setupHA() {
+	haState.instanceID = haInstanceID()
+	if !viper.GetBool("ha.enabled") {
+		haState.leader = true
+		return
+	}
+	if err := db.AutoMigrate(&LeaderLease{}); err != nil {
+		log.Fatal("自动迁移 leader_leases 表失败: ", err)
+	}
+	runElection()
+	go func() {
+		ticker := time.NewTicker(time.Duration(haLeaseSeconds()) * time.Second / 3)
+		defer ticker.Stop()
+		for range ticker.C {
+			runElection()
+		}
+	}()
+}
+
+// 按主备状态及维护模式启停调度器：仅主节点且未处于维护模式时运行
+func syncScheduler() {
+	if appScheduler == nil {
+		return
+	}
+	want := isLeader() && !inMaintenance()
+	if want == appScheduler.Running() {
+		return
+	}
+	if !want {
+		log.Println("停止定时任务，等待正在执行的任务结束")
+	}
+	if !appScheduler.SetRunning(want) {
+		return
+	}
+	if want {
+		log.Println("定时任务已启动")
+	} else {
+		log.Println("定时任务已暂停")
+	}
+}
+
+// 备用节点中间件：备用节点只处理只读请求，写操作返回 503 并提示主节点
+func standbyMiddleware(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	if isLeader() || maintenanceExemptPaths[c.Request.URL.Path] {
+		c.Next()
+		return
+	}
+	haState.RLock()
+	holder := haState.holder
+	haState.RUnlock()
+	respondError(c, http.StatusServiceUnavailable, codeStandby, "当前实例为备用节点，请在主节点上操作", gin.H{"leader": holder})
+}
+
+// 注册主备状态路由
+func registerHARoutes(r *gin.Engine) {
+	// 查询主备状态
+	r.GET("/ha/status", authMiddleware, func(c *gin.Context) {
+		haState.RLock()
+		defer haState.RUnlock()
+		running := appScheduler != nil && appScheduler.Running()
+		c.JSON(http.StatusOK, gin.H{
+			"enabled":           viper.GetBool("ha.enabled"),
+			"instance":          haState.instanceID,
+			"leader":            haState.leader,
+			"current_leader":    haState.holder,
+			"lease_expires_at":  haState.expiresAt,
+			"scheduler_running": running,
+		})
+	})
+}
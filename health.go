@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 各服务器最近一次故障切换时间，用于限制切换频率
+var (
+	failoverMu   sync.Mutex
+	lastFailover = map[string]int64{}
+)
+
+// 检查服务器当前主机是否健康：域名可解析，且（开启时）可从中国访问；
+// 返回是否健康、原因及是否为中国无法访问（封锁）
+func checkServerHealth(host, port string) (bool, string, bool) {
+	timeout := viper.GetInt("dns.timeoutSeconds")
+	if timeout <= 0 {
+		timeout = 5
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		return false, "域名无法解析: " + err.Error(), false
+	}
+	if devMode {
+		return true, "", false
+	}
+	if len(viper.GetStringSlice("health.probeEndpoints")) > 0 {
+		if accessible, reason := checkProbeEndpoints(host, port); !accessible {
+			return false, "中国无法访问: " + reason, true
+		}
+	}
+	if viper.GetBool("health.chinaCheck") {
+		accessible, err := isAccessibleFromChina(host + ":" + port)
+		if err != nil && !accessible {
+			return false, "中国访问检查失败: " + err.Error(), false
+		}
+		if !accessible {
+			return false, "中国无法访问", true
+		}
+	}
+	return true, "", false
+}
+
+// 判断服务器是否允许故障切换（限流），允许时记录切换时间
+func allowFailover(t *Tenant, table string, id int, now int64) bool {
+	cooldown := viper.GetInt64("health.failoverCooldownMinutes")
+	if cooldown <= 0 {
+		cooldown = 30
+	}
+	key := fmt.Sprintf("%s:%s:%d", t.Name, table, id)
+	failoverMu.Lock()
+	defer failoverMu.Unlock()
+	if last, ok := lastFailover[key]; ok && now-last < cooldown*60 {
+		return false
+	}
+	lastFailover[key] = now
+	return true
+}
+
+// 健康检查结果状态
+const (
+	healthStatusHealthy   = "healthy"
+	healthStatusUnhealthy = "unhealthy"
+	healthStatusBlocked   = "blocked" // 中国无法访问
+	healthStatusTimeout   = "timeout" // 探测超时，不触发故障切换
+)
+
+// ServerHealth 结构体，服务器当前主机最近一次健康检查结果，每次探测完成即写入
+type ServerHealth struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ServerTable string `gorm:"column:server_table;type:varchar(255);uniqueIndex:unique_server_health;not null" json:"server_table"`
+	ServerID    int    `gorm:"column:server_id;uniqueIndex:unique_server_health;not null" json:"server_id"`
+	Host        string `gorm:"column:host;type:varchar(255);default:''" json:"host"`
+	Status      string `gorm:"column:status;type:varchar(32);index;not null" json:"status"`
+	Reason      string `gorm:"column:reason;type:varchar(255);default:''" json:"reason"`
+	DurationMs  int64  `gorm:"column:duration_ms;default:0" json:"duration_ms"`
+	CheckedAt   int64  `gorm:"column:checked_at;index;default:0" json:"checked_at"`
+}
+
+// HealthSweepStats 最近一轮健康检查的统计
+type HealthSweepStats struct {
+	StartedAt     int64 `json:"started_at"`
+	FinishedAt    int64 `json:"finished_at"`
+	Workers       int   `json:"workers"`
+	BudgetSeconds int64 `json:"budget_seconds"`
+	Total         int   `json:"total"`
+	Probed        int   `json:"probed"`
+	Unhealthy     int   `json:"unhealthy"`
+	TimedOut      int   `json:"timed_out"`
+	Skipped       int   `json:"skipped"` // 超出时间预算未探测，下一轮优先探测
+	FailedOver    int   `json:"failed_over"`
+}
+
+// 健康检查任务及结果
+type healthJob struct {
+	t     *Tenant
+	table string
+	id    int
+	host  string
+	port  string
+}
+
+type healthResult struct {
+	healthJob
+	status   string
+	reason   string
+	duration time.Duration
+}
+
+var (
+	// 同一时间只运行一轮健康检查，上一轮未结束时跳过本次调度
+	healthSweepMu sync.Mutex
+	// 最近一轮健康检查的统计
+	lastHealthSweep struct {
+		sync.Mutex
+		stats HealthSweepStats
+	}
+)
+
+// 健康检查任务的 cron 表达式（health.cron），默认每 10 分钟
+func healthCronSpec() string {
+	if spec := viper.GetString("health.cron"); spec != "" {
+		return spec
+	}
+	return "*/10 * * * *"
+}
+
+// 并发探测数（health.workers），默认 16
+func healthWorkers() int {
+	if n := viper.GetInt("health.workers"); n > 0 {
+		return n
+	}
+	return 16
+}
+
+// 单次探测超时（health.probeTimeoutSeconds），默认 15 秒，开启中国访问检查时为 75 秒
+func healthProbeTimeout() time.Duration {
+	if s := viper.GetInt("health.probeTimeoutSeconds"); s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if viper.GetBool("health.chinaCheck") {
+		return 75 * time.Second
+	}
+	return 15 * time.Second
+}
+
+// 一轮健康检查的时间预算（health.budgetSeconds），默认为调度间隔的 90%，保证在下一轮开始前结束
+func healthSweepBudget() time.Duration {
+	if s := viper.GetInt("health.budgetSeconds"); s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	schedule, err := cron.ParseStandard(healthCronSpec())
+	if err != nil {
+		return 10 * time.Minute
+	}
+	next := schedule.Next(time.Now())
+	return schedule.Next(next).Sub(next) * 9 / 10
+}
+
+// 带超时地探测单个服务器；超时的探测在后台自行结束，结果丢弃
+func probeServerHealth(job healthJob, timeout time.Duration) healthResult {
+	start := time.Now()
+	done := make(chan healthResult, 1)
+	go func() {
+		healthy, reason, blocked := checkServerHealth(job.host, job.port)
+		status := healthStatusHealthy
+		switch {
+		case blocked:
+			status = healthStatusBlocked
+		case !healthy:
+			status = healthStatusUnhealthy
+		}
+		done <- healthResult{healthJob: job, status: status, reason: reason}
+	}()
+	select {
+	case r := <-done:
+		r.duration = time.Since(start)
+		return r
+	case <-time.After(timeout):
+		return healthResult{healthJob: job, status: healthStatusTimeout, reason: fmt.Sprintf("探测超过 %s 未完成", timeout), duration: timeout}
+	}
+}
+
+// 收集所有租户待检查的服务器（跳过已归档），按上次检查时间升序，未检查过及上一轮被跳过的优先
+func collectHealthJobs() []healthJob {
+	type ordered struct {
+		job       healthJob
+		checkedAt int64
+	}
+	var list []ordered
+	for _, t := range tenantList() {
+		var records []ServerHealth
+		if err := t.DB.Select("server_table, server_id, checked_at").Find(&records).Error; err != nil {
+			log.Printf("健康检查: 获取上次检查结果失败: 租户=%s, 错误=%v", t.Name, err)
+		}
+		checked := make(map[string]int64, len(records))
+		for _, r := range records {
+			checked[r.ServerTable+":"+strconv.Itoa(r.ServerID)] = r.CheckedAt
+		}
+		archived := archivedServers(t.DB)
+		for _, table := range serverTables(t) {
+			var servers []struct {
+				ID   int
+				Port string
+				Host string
+			}
+			if err := t.DB.Table(table).Select(serverSelect(table, "id", "port", "host")).Where(quotedServerColumn(table, "host") + " != ''").Find(&servers).Error; err != nil {
+				log.Printf("健康检查: 从表 %s 获取服务器失败: 租户=%s, 错误=%v", table, t.Name, err)
+				continue
+			}
+			for _, s := range servers {
+				key := table + ":" + strconv.Itoa(s.ID)
+				if archived[key] {
+					continue
+				}
+				list = append(list, ordered{job: healthJob{t: t, table: table, id: s.ID, host: s.Host, port: s.Port}, checkedAt: checked[key]})
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].checkedAt < list[j].checkedAt })
+	jobs := make([]healthJob, len(list))
+	for i, o := range list {
+		jobs[i] = o.job
+	}
+	return jobs
+}
+
+// 保存单个探测结果
+func saveHealthResult(r healthResult, now int64) {
+	record := ServerHealth{ServerTable: r.table, ServerID: r.id}
+	if err := r.t.DB.Where("server_table = ? AND server_id = ?", r.table, r.id).First(&record).Error; err != nil && err != gorm.ErrRecordNotFound {
+		log.Printf("健康检查: 获取检查结果失败: 表=%s, ID=%d, 错误=%v", r.table, r.id, err)
+	}
+	record.Host, record.Status, record.Reason = r.host, r.status, truncate(r.reason, 255)
+	record.DurationMs, record.CheckedAt = r.duration.Milliseconds(), now
+	if err := r.t.DB.Save(&record).Error; err != nil {
+		log.Printf("健康检查: 保存检查结果失败: 表=%s, ID=%d, 错误=%v", r.table, r.id, err)
+	}
+}
+
+// 处理异常的探测结果：记录封锁，开启故障切换时执行计划外轮换；返回是否已切换
+func handleUnhealthy(r healthResult) bool {
+	t, table, id := r.t, r.table, r.id
+	log.Printf("健康检查: 服务器当前域名异常: 租户=%s, 表=%s, ID=%d, 主机=%s, 原因=%s", t.Name, table, id, r.host, r.reason)
+	now := time.Now().Unix()
+	if r.status == healthStatusBlocked {
+		recordDomainBlock(t, table, id, r.host, r.reason, now)
+	}
+	if !viper.GetBool("health.failover") {
+		return false
+	}
+	if !allowFailover(t, table, id, now) {
+		log.Printf("健康检查: 故障切换过于频繁，跳过: 租户=%s, 表=%s, ID=%d", t.Name, table, id)
+		return false
+	}
+	if err := updateServerWithRetry(t, table, id, now, false, systemCause(triggerFailover)); err != nil {
+		log.Printf("健康检查: 故障切换失败: 租户=%s, 表=%s, ID=%d, 错误=%v", t.Name, table, id, err)
+		recordRotationFailure(t, table, id, systemCause(triggerFailover), fmt.Errorf("故障切换失败（%s）: %w", r.reason, err))
+		return false
+	}
+	if err := setServerStatus(t.DB, table, id, "故障切换成功："+r.reason, ""); err != nil {
+		log.Printf("更新 last_update_status 失败: 租户=%s, 表=%s, ID=%d, 错误=%v", t.Name, table, id, err)
+	}
+	log.Printf("健康检查: 故障切换成功: 租户=%s, 表=%s, ID=%d, 原主机=%s", t.Name, table, id, r.host)
+	return true
+}
+
+// 对所有租户的服务器执行健康检查：有界并发探测，每个探测单独限时，结果逐个写入；
+// 超出本轮时间预算后停止派发，剩余服务器在下一轮优先探测。当前域名异常时触发计划外轮换
+func runHealthChecks() {
+	if !healthSweepMu.TryLock() {
+		log.Println("健康检查: 上一轮尚未结束，跳过本次调度")
+		return
+	}
+	defer healthSweepMu.Unlock()
+
+	start := time.Now()
+	budget := healthSweepBudget()
+	deadline := start.Add(budget)
+	timeout := healthProbeTimeout()
+	jobs := collectHealthJobs()
+	stats := HealthSweepStats{StartedAt: start.Unix(), Workers: healthWorkers(), BudgetSeconds: int64(budget / time.Second), Total: len(jobs)}
+	log.Printf("运行 runHealthChecks，时间: %s, 服务器数=%d, 并发=%d, 单次超时=%s, 时间预算=%s",
+		start.Format("2006-01-02 15:04:05"), len(jobs), stats.Workers, timeout, budget)
+
+	jobCh := make(chan healthJob)
+	results := make(chan healthResult, len(jobs))
+	var wg sync.WaitGroup
+	for i := 0; i < stats.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				results <- probeServerHealth(job, timeout)
+			}
+		}()
+	}
+	// 派发任务：预算耗尽或剩余时间不足一次探测时停止
+	go func() {
+		defer close(jobCh)
+		for i, job := range jobs {
+			if time.Now().Add(timeout).After(deadline) {
+				stats.Skipped = len(jobs) - i
+				return
+			}
+			jobCh <- job
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// 结果逐个写入；故障切换在此串行执行，避免同时发起大量轮换
+	for r := range results {
+		stats.Probed++
+		saveHealthResult(r, time.Now().Unix())
+		switch r.status {
+		case healthStatusHealthy:
+		case healthStatusTimeout:
+			stats.TimedOut++
+			log.Printf("健康检查: 探测超时: 租户=%s, 表=%s, ID=%d, 主机=%s", r.t.Name, r.table, r.id, r.host)
+		default:
+			stats.Unhealthy++
+			if handleUnhealthy(r) {
+				stats.FailedOver++
+			}
+		}
+	}
+	stats.FinishedAt = time.Now().Unix()
+	lastHealthSweep.Lock()
+	lastHealthSweep.stats = stats
+	lastHealthSweep.Unlock()
+	log.Printf("健康检查完成: 耗时=%s, 探测=%d, 异常=%d, 超时=%d, 未探测=%d, 故障切换=%d",
+		time.Since(start).Round(time.Second), stats.Probed, stats.Unhealthy, stats.TimedOut, stats.Skipped, stats.FailedOver)
+}
+
+// 注册健康检查路由
+func registerHealthRoutes(r *gin.Engine) {
+	// 最近一轮健康检查统计及各服务器的检查结果，可按 status 过滤
+	r.GET("/health-checks", authMiddleware, func(c *gin.Context) {
+		q := currentTenant(c).DB.Scopes(serverAccessScope(c)).Order("checked_at DESC")
+		if status := c.Query("status"); status != "" {
+			q = q.Where("status = ?", status)
+		}
+		var records []ServerHealth
+		if err := q.Find(&records).Error; err != nil {
+			log.Printf("获取健康检查结果失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取健康检查结果失败："+err.Error())
+			return
+		}
+		lastHealthSweep.Lock()
+		stats := lastHealthSweep.stats
+		lastHealthSweep.Unlock()
+		c.JSON(http.StatusOK, gin.H{"last_sweep": stats, "results": records})
+	})
+
+	// 立即运行一轮健康检查（后台执行）
+	r.POST("/health-checks/run", authMiddleware, func(c *gin.Context) {
+		go runHealthChecks()
+		c.JSON(http.StatusAccepted, gin.H{"message": "健康检查已开始"})
+	})
+}
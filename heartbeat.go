@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 节点心跳回写：面板按服务器行的 last_check_at（可在 [columns.<表名>] 中映射）显示节点是否在线，
+// 轮换后节点换到新端口，重新上报前面板可能显示离线。开启 heartbeat.enabled 后，
+// 端口探测通过（未开启探测时为轮换成功）即写入当前时间，使面板反映本程序确认的可达状态
+
+// 是否回写节点心跳（heartbeat.enabled）
+func heartbeatEnabled() bool {
+	return viper.GetBool("heartbeat.enabled")
+}
+
+// 写入服务器的 last_check_at，仅当服务器仍使用给定的主机和端口时写入，避免为之后的轮换结果误报在线
+func writeServerHeartbeat(t *Tenant, table string, id int, host string, port int) {
+	if !heartbeatEnabled() {
+		return
+	}
+	res := t.DB.Table(table).Where(serverCond(table, "id", "host", "server_port"), id, host, port).
+		Updates(serverFields(table, map[string]interface{}{"last_check_at": time.Now().Unix()}))
+	if res.Error != nil {
+		log.Printf("回写节点心跳失败: 租户=%s, 表=%s, ID=%d, 错误=%v", t.Name, table, id, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		log.Printf("服务器主机或端口已变更，未回写节点心跳: 租户=%s, 表=%s, ID=%d", t.Name, table, id)
+	}
+}
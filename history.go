@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 轮换结果
+const (
+	rotationSuccess  = "success"
+	rotationFailed   = "failed"
+	rotationArchived = "archived" // 服务器下线归档时写入的最后一条记录
+)
+
+// 轮换触发来源
+const (
+	triggerCron     = "cron"     // 定时轮换
+	triggerManual   = "manual"   // 面板登录用户手动轮换
+	triggerAPI      = "api"      // API 令牌调用
+	triggerFailover = "failover" // 健康检查故障切换
+	triggerApproval = "approval" // 审批通过后执行
+	triggerCLI      = "cli"      // 命令行
+)
+
+// RotationCause 轮换的触发来源及操作者，写入轮换历史及事件
+type RotationCause struct {
+	Trigger string
+	Actor   string
+	ctx     context.Context // 发起轮换的请求上下文，轮换的追踪片段归入该请求；系统发起时为空
+}
+
+// 系统自动发起的轮换
+func systemCause(trigger string) RotationCause {
+	return RotationCause{Trigger: trigger, Actor: "system"}
+}
+
+// HTTP 请求发起的轮换：API 令牌为 api，否则为 manual
+func requestCause(c *gin.Context) RotationCause {
+	if _, ok := c.Get("api_token"); ok {
+		return RotationCause{Trigger: triggerAPI, Actor: operatorName(c), ctx: c.Request.Context()}
+	}
+	return RotationCause{Trigger: triggerManual, Actor: operatorName(c), ctx: c.Request.Context()}
+}
+
+// RotationHistory 结构体，记录每次服务器轮换（端口/域名更换）的结果
+type RotationHistory struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	ServerTable   string `gorm:"column:server_table;type:varchar(255);index:idx_rotation_server;not null" json:"server_table"`
+	ServerID      int    `gorm:"column:server_id;index:idx_rotation_server;not null" json:"server_id"`
+	OldHost       string `gorm:"column:old_host;type:varchar(255);default:''" json:"old_host"`
+	NewHost       string `gorm:"column:new_host;type:varchar(255);default:''" json:"new_host"`
+	OldPort       int    `gorm:"column:old_port;default:0" json:"old_port"`
+	NewPort       int    `gorm:"column:new_port;default:0" json:"new_port"`
+	Status        string `gorm:"column:status;type:varchar(32);not null" json:"status"`
+	Error         string `gorm:"column:error;type:varchar(1024);default:''" json:"error"`
+	FailureCode   string `gorm:"column:failure_code;type:varchar(32);default:''" json:"failure_code"` // 失败分类，见 failure* 常量
+	ProbeStatus   string `gorm:"column:probe_status;type:varchar(32);default:''" json:"probe_status"` // 轮换后端口探测结果：open、closed，未探测为空
+	ProbeDetail   string `gorm:"column:probe_detail;type:varchar(255);default:''" json:"probe_detail"`
+	Trigger       string `gorm:"column:trigger_source;type:varchar(32);index;default:''" json:"trigger"` // 触发来源，见 trigger* 常量
+	Actor         string `gorm:"column:actor;type:varchar(255);default:''" json:"actor"`                 // 操作者：user:<用户>、token:<令牌>、cli:<系统用户> 或 system
+	AffectedUsers *int   `gorm:"column:affected_users" json:"affected_users"`                            // 轮换时的在线用户数，无统计数据时为空
+	CreatedAt     int64  `gorm:"column:created_at;index:idx_rotation_server" json:"created_at"`
+}
+
+// 获取服务器最近 n 次成功轮换分配的域名
+func recentAssignedDomains(tx *gorm.DB, table string, id int, n int) ([]string, error) {
+	var hosts []string
+	if n <= 0 {
+		return hosts, nil
+	}
+	err := tx.Model(&RotationHistory{}).
+		Where("server_table = ? AND server_id = ? AND status = ? AND new_host != ''", table, id, rotationSuccess).
+		Order("created_at DESC, id DESC").Limit(n).Pluck("new_host", &hosts).Error
+	return hosts, err
+}
+
+// 记录失败的轮换
+func recordRotationFailure(t *Tenant, table string, id int, cause RotationCause, err error) {
+	history := RotationHistory{
+		ServerTable: table,
+		ServerID:    id,
+		Status:      rotationFailed,
+		Error:       truncate(err.Error(), 1024),
+		FailureCode: classifyFailure(err),
+		Trigger:     cause.Trigger,
+		Actor:       cause.Actor,
+		CreatedAt:   time.Now().Unix(),
+	}
+	if createErr := t.DB.Create(&history).Error; createErr != nil {
+		log.Printf("记录轮换失败历史失败: 表=%s, ID=%d, 错误=%v", table, id, createErr)
+	}
+	publishEvent(Event{Type: eventRotationFailed, Tenant: t.Name, ServerTable: table, ServerID: id, Error: history.Error, Trigger: cause.Trigger, Actor: cause.Actor, Time: history.CreatedAt})
+}
+
+// 注册轮换历史路由
+func registerHistoryRoutes(r *gin.Engine) {
+	// 列出轮换历史，可按 table、id、trigger、actor、status 及时间范围 since/until（Unix 秒）过滤
+	r.GET("/rotation-history", authMiddleware, func(c *gin.Context) {
+		q := readDB(currentTenant(c)).Scopes(serverAccessScope(c)).Order("created_at DESC, id DESC")
+		if table := c.Query("table"); table != "" {
+			if !isValidServerTable(table) {
+				respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+				return
+			}
+			q = q.Where("server_table = ?", table)
+		}
+		for param, cond := range map[string]string{"id": "server_id = ?", "since": "created_at >= ?", "until": "created_at <= ?"} {
+			v := c.Query(param)
+			if v == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 "+param)
+				return
+			}
+			q = q.Where(cond, n)
+		}
+		if trigger := c.Query("trigger"); trigger != "" {
+			q = q.Where("trigger_source = ?", trigger)
+		}
+		if actor := c.Query("actor"); actor != "" {
+			q = q.Where("actor = ?", actor)
+		}
+		if status := c.Query("status"); status != "" {
+			q = q.Where("status = ?", status)
+		}
+		limit := 100
+		if v := c.Query("limit"); v != "" {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > 500 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 limit，范围 1-500")
+				return
+			}
+		}
+		var history []RotationHistory
+		if err := q.Limit(limit).Find(&history).Error; err != nil {
+			log.Printf("获取轮换历史失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取轮换历史失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"history": history})
+	})
+}
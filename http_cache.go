@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 只读接口的 HTTP 缓存：ETag 由租户数据版本（每次写入租户数据库时递增）、面板服务器行的摘要、
+// 下一个时间边界（冷却或预热结束、计划轮换时间）及请求参数计算，不执行处理函数即可判断 If-None-Match 是否命中，
+// 轮询的看板在数据未变化时只收到 304，与轮询间隔无关
+
+// 进程启动时间，重启后计数器归零，ETag 中带上启动时间避免与重启前的 ETag 相同
+var httpCacheEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// 各租户的数据版本（租户名 -> *atomic.Int64）
+var dataVersions sync.Map
+
+// 租户的数据版本计数器
+func tenantDataVersion(name string) *atomic.Int64 {
+	v, _ := dataVersions.LoadOrStore(name, new(atomic.Int64))
+	return v.(*atomic.Int64)
+}
+
+// 只保存认证、幂等及主节点选举等簿记信息的表，写入时不递增数据版本：
+// 令牌最后使用时间、会话续期等在 ETag 计算之前就会写入，否则每个请求都会使 ETag 失效
+var dataVersionExemptTables = map[string]bool{
+	"api_tokens":          true,
+	"user_sessions":       true,
+	"remember_tokens":     true,
+	"confirmation_tokens": true,
+	"idempotency_keys":    true,
+	"leader_leases":       true,
+}
+
+// 在租户数据库上注册回调：创建、更新、删除或执行原生 SQL 成功后递增数据版本
+func registerDataVersionHooks(t *Tenant) {
+	version := tenantDataVersion(t.Name)
+	bump := func(tx *gorm.DB) {
+		if tx.Error == nil && !dataVersionExemptTables[tx.Statement.Table] {
+			version.Add(1)
+		}
+	}
+	cb := t.DB.Callback()
+	cb.Create().After("gorm:create").Register("http_cache:bump", bump)
+	cb.Update().After("gorm:update").Register("http_cache:bump", bump)
+	cb.Delete().After("gorm:delete").Register("http_cache:bump", bump)
+	cb.Raw().After("gorm:raw").Register("http_cache:bump", bump)
+}
+
+// 租户域名汇总的下一个变化时间，按数据版本缓存
+type domainBoundary struct {
+	version int64
+	at      int64 // 0 表示没有冷却或预热中的域名
+}
+
+// 租户名 -> domainBoundary
+var domainBoundaries sync.Map
+
+// 最早结束冷却或预热的时间（domain_summaries.next_change_at 中晚于 now 的最小值），
+// 数据版本不变且尚未到达时沿用缓存，不必每个请求都查询
+func nextDomainBoundary(t *Tenant, version, now int64) int64 {
+	if v, ok := domainBoundaries.Load(t.Name); ok {
+		if b := v.(domainBoundary); b.version == version && (b.at == 0 || now < b.at) {
+			return b.at
+		}
+	}
+	var at int64
+	if err := readDB(t).Model(&DomainSummary{}).Where("next_change_at > ?", now).
+		Select("COALESCE(MIN(next_change_at), 0)").Scan(&at).Error; err != nil {
+		log.Printf("获取域名汇总变化时间失败: 租户=%s, 错误=%v", t.Name, err)
+		return now
+	}
+	domainBoundaries.Store(t.Name, domainBoundary{version: version, at: at})
+	return at
+}
+
+// 面板服务器行的摘要及最早的下一次计划轮换时间：面板外部的修改不经过数据版本回调，
+// 计划轮换时间到达时页面上的状态随之变化
+func panelFingerprint(t *Tenant, now int64) (string, int64) {
+	h := sha256.New()
+	var nextUpdate int64
+	for _, table := range serverTables(t) {
+		rows, err := listServerRows(t, table)
+		if err != nil {
+			log.Printf("获取服务器行失败: 表=%s, 租户=%s, 错误=%v", table, t.Name, err)
+			h.Write([]byte(table + ":error\n"))
+			continue
+		}
+		for _, s := range rows {
+			fmt.Fprintf(h, "%s:%d:%s:%s:%d:%s:%t:%d:%s:%s\n", table, s.ID, s.Name, s.Port, s.ServerPort, s.Host, s.Show, s.NextUpdateTime, s.LastUpdateStatus, s.LastUpdateStatusCode)
+			if s.NextUpdateTime > now && (nextUpdate == 0 || s.NextUpdateTime < nextUpdate) {
+				nextUpdate = s.NextUpdateTime
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:12]), nextUpdate
+}
+
+// 响应缓存秒数（server.httpCacheSeconds），未配置时为 10 秒，0 表示关闭
+func httpCacheSeconds() int64 {
+	if !viper.IsSet("server.httpCacheSeconds") {
+		return 10
+	}
+	if n := viper.GetInt64("server.httpCacheSeconds"); n > 0 {
+		return n
+	}
+	return 0
+}
+
+// 计算请求的 ETag：数据版本、面板服务器行及已到达的时间边界都不变时，相同用户的相同请求得到相同的 ETag
+func requestETag(c *gin.Context) string {
+	t := currentTenant(c)
+	now := time.Now().Unix()
+	version := tenantDataVersion(t.Name).Load()
+	panel, nextUpdate := panelFingerprint(t, now)
+	h := sha256.New()
+	for _, part := range []string{
+		httpCacheEpoch,
+		t.Name,
+		strconv.FormatInt(version, 10),
+		strconv.FormatInt(nextDomainBoundary(t, version, now), 10),
+		panel,
+		strconv.FormatInt(nextUpdate, 10),
+		c.Request.URL.RequestURI(),
+		c.GetHeader("Accept"),
+		operatorName(c),
+		locationName(userLocation(c)),
+		strconv.FormatBool(inMaintenance()),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// If-None-Match 是否包含 etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// 非 200 响应去掉缓存相关响应头，避免客户端缓存错误结果
+type cacheHeaderWriter struct {
+	gin.ResponseWriter
+}
+
+func (w cacheHeaderWriter) WriteHeader(code int) {
+	if code != http.StatusOK {
+		w.Header().Del("ETag")
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// HTTP 缓存中间件（放在 authMiddleware 之后）：设置 ETag 及短时 Cache-Control，
+// If-None-Match 命中时直接返回 304，不再执行处理函数
+func httpCacheMiddleware(c *gin.Context) {
+	seconds := httpCacheSeconds()
+	if seconds <= 0 || c.Request.Method != http.MethodGet {
+		c.Next()
+		return
+	}
+	etag := requestETag(c)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, max-age="+strconv.FormatInt(seconds, 10))
+	c.Header("Vary", "Accept, Cookie, Authorization, X-Tenant")
+	if match := c.GetHeader("If-None-Match"); match != "" && etagMatches(match, etag) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+	c.Writer = cacheHeaderWriter{c.Writer}
+	c.Next()
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestDataVersionHooks(t *testing.T) {
+	tdb := newTestDB(t, &ApiToken{}, &ServerDomain{}, &DomainSummary{})
+	tenant := &Tenant{Name: t.Name(), DB: tdb}
+	registerDataVersionHooks(tenant)
+	version := tenantDataVersion(tenant.Name)
+
+	tdb.Create(&ApiToken{Name: "poller", TokenHash: "hash", Scopes: "read"})
+	before := version.Load()
+	// 令牌的最后使用时间在每个请求的认证阶段写入，不能使 ETag 失效
+	tdb.Model(&ApiToken{}).Where("name = ?", "poller").Update("last_used_time", 100)
+	if got := version.Load(); got != before {
+		t.Errorf("更新簿记表后数据版本 = %d，期望不变（%d）", got, before)
+	}
+	tdb.Create(&ServerDomain{ServerTable: "v2_server_vless", ServerID: 1, Domain: "a.example.com"})
+	if got := version.Load(); got == before {
+		t.Error("写入域名后数据版本应递增")
+	}
+
+	const now = int64(1_000_000)
+	tdb.Create(&[]DomainSummary{
+		{ServerTable: "v2_server_vless", ServerID: 1, NextChangeAt: now + 600},
+		{ServerTable: "v2_server_vless", ServerID: 2, NextChangeAt: now + 60},
+		{ServerTable: "v2_server_vless", ServerID: 3},
+	})
+	v := version.Load()
+	if got := nextDomainBoundary(tenant, v, now); got != now+60 {
+		t.Errorf("nextDomainBoundary = %d，期望 %d", got, now+60)
+	}
+	// 到达边界后重新计算，取下一个边界
+	if got := nextDomainBoundary(tenant, v, now+60); got != now+600 {
+		t.Errorf("到达边界后 nextDomainBoundary = %d，期望 %d", got, now+600)
+	}
+	if got := nextDomainBoundary(tenant, v, now+600); got != 0 {
+		t.Errorf("没有后续边界时 nextDomainBoundary = %d，期望 0", got)
+	}
+}
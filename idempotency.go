@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 支持 Idempotency-Key 的写接口（轮换及域名变更），自动化脚本超时重试时不会重复轮换或重复添加域名
+var idempotentPaths = map[string]bool{
+	"/update-now":                true,
+	"/rotation-approvals/decide": true,
+	"/api/v1/servers":            true,
+	"/api/v1/servers/:table/:id": true,
+	"/add-domain":                true,
+	"/delete-domain":             true,
+	"/update-domain-meta":        true,
+	"/clone-domains":             true,
+	"/api/v1/domains/:id":        true,
+	"/deleted-domains/restore":   true,
+	"/deleted-domains/purge":     true,
+	"/domain-restore-retired":    true,
+	"/rebalance-domains":         true,
+	"/stage-domain":              true,
+	"/release-domain":            true,
+	"/acquire-domains":           true,
+	"/api/v1/domains/unused":     true,
+	"/bulk-edit-domains":         true,
+}
+
+// 处理中的记录超过此时间视为请求已中断（如进程退出），允许使用同一键重新执行
+const idempotencyLockSeconds = 300
+
+// 保存的响应体上限，超出时不保存（重试会重新执行）
+const idempotencyMaxResponseBytes = 60000
+
+// IdempotencyKey 结构体，记录带 Idempotency-Key 的写请求及其响应，键按操作者隔离
+type IdempotencyKey struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Key         string `gorm:"column:idempotency_key;type:varchar(255);uniqueIndex:unique_idempotency_key;not null" json:"key"`
+	Operator    string `gorm:"column:operator;type:varchar(255);uniqueIndex:unique_idempotency_key;not null" json:"operator"`
+	Method      string `gorm:"column:method;type:varchar(16)" json:"method"`
+	Path        string `gorm:"column:path;type:varchar(255)" json:"path"`
+	RequestHash string `gorm:"column:request_hash;type:char(64)" json:"request_hash"`
+	Status      int    `gorm:"column:status;default:0" json:"status"` // 0 表示处理中
+	ContentType string `gorm:"column:content_type;type:varchar(255);default:''" json:"content_type"`
+	Response    string `gorm:"column:response;type:text" json:"response"`
+	CreatedAt   int64  `gorm:"column:created_at;index" json:"created_at"`
+}
+
+// 幂等键保留时间（idempotency.ttlHours），默认 24 小时
+func idempotencyTTL() int64 {
+	if hours := viper.GetInt64("idempotency.ttlHours"); hours > 0 {
+		return hours * 3600
+	}
+	return 24 * 3600
+}
+
+// 记录响应体的 ResponseWriter
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// 请求摘要：方法、路径、查询参数、租户、表单字段及请求体（表单已由 requestGuardMiddleware 解析，请求体为空），
+// 同一键用于不同请求时拒绝
+func idempotencyRequestHash(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	for _, part := range []string{c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery, currentTenant(c).Name} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(c.Request.PostForm.Encode()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 认证通过后执行后续处理：带 Idempotency-Key 的写请求首次执行并保存响应，
+// 相同请求重试时直接返回保存的响应（带 Idempotent-Replayed: true 头）
+func idempotentNext(c *gin.Context) {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" || c.Request.Method == http.MethodGet || !idempotentPaths[c.FullPath()] {
+		c.Next()
+		return
+	}
+	if len(key) > 255 {
+		respondError(c, http.StatusBadRequest, codeInvalidArgument, "Idempotency-Key 过长（最多 255 字节）")
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidArgument, "读取请求体失败")
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	tdb := currentTenant(c).DB
+	now := time.Now().Unix()
+	operator := operatorName(c)
+	record := IdempotencyKey{Key: key, Operator: operator, Method: c.Request.Method, Path: c.Request.URL.Path, RequestHash: idempotencyRequestHash(c, body), CreatedAt: now}
+	for attempt := 0; ; attempt++ {
+		err := tdb.Create(&record).Error
+		if err == nil {
+			break
+		}
+		var existing IdempotencyKey
+		if findErr := tdb.Where("idempotency_key = ? AND operator = ?", key, operator).Take(&existing).Error; findErr != nil {
+			log.Printf("保存幂等键失败: 键=%s, 错误=%v", key, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存幂等键失败")
+			return
+		}
+		switch {
+		case existing.CreatedAt < now-idempotencyTTL() || (existing.Status == 0 && existing.CreatedAt < now-idempotencyLockSeconds):
+			// 已过期或中断的记录，删除后重新执行
+			tdb.Where("id = ?", existing.ID).Delete(&IdempotencyKey{})
+			if attempt > 0 {
+				respondError(c, http.StatusConflict, codeConflict, "幂等键正被其他请求使用")
+				return
+			}
+			continue
+		case existing.RequestHash != record.RequestHash:
+			respondError(c, http.StatusUnprocessableEntity, codeIdempotencyKeyReused, "Idempotency-Key 已用于不同的请求")
+			return
+		case existing.Status == 0:
+			respondError(c, http.StatusConflict, codeConflict, "相同 Idempotency-Key 的请求正在处理中，请稍后重试")
+			return
+		}
+		log.Printf("重放幂等请求: 键=%s, 操作者=%s, 路径=%s, 状态=%d", key, operator, existing.Path, existing.Status)
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(existing.Status, existing.ContentType, []byte(existing.Response))
+		c.Abort()
+		return
+	}
+
+	// 顺带清理过期的幂等键
+	tdb.Where("created_at < ?", now-idempotencyTTL()).Delete(&IdempotencyKey{})
+
+	writer := &capturingWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+
+	status := writer.Status()
+	// 服务端错误及过大的响应不保存，重试时重新执行
+	if status >= http.StatusInternalServerError || writer.body.Len() > idempotencyMaxResponseBytes {
+		if err := tdb.Where("id = ?", record.ID).Delete(&IdempotencyKey{}).Error; err != nil {
+			log.Printf("删除幂等键失败: 键=%s, 错误=%v", key, err)
+		}
+		return
+	}
+	if err := tdb.Model(&IdempotencyKey{}).Where("id = ?", record.ID).Updates(map[string]interface{}{
+		"status":       status,
+		"content_type": writer.Header().Get("Content-Type"),
+		"response":     writer.body.String(),
+	}).Error; err != nil {
+		log.Printf("保存幂等响应失败: 键=%s, 错误=%v", key, err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 首次接管时是否错开 next_update_time 为 0 的服务器（rotation.spreadInitial），默认开启
+func spreadInitialEnabled() bool {
+	if !viper.IsSet("rotation.spreadInitial") {
+		return true
+	}
+	return viper.GetBool("rotation.spreadInitial")
+}
+
+// 错开首次轮换的时间窗口（rotation.spreadWindowHours），0 表示使用各服务器的更新间隔
+func spreadWindowSeconds(serverIntervalHours int) int64 {
+	if hours := viper.GetInt("rotation.spreadWindowHours"); hours > 0 {
+		return int64(hours) * 3600
+	}
+	return int64(serverIntervalHours) * 3600
+}
+
+// 首次接管的服务器（next_update_time 为 0）原本会在第一次检查时全部立即轮换，
+// 改为在时间窗口内均匀错开首次轮换时间，返回调整的服务器数
+func spreadInitialSchedules(t *Tenant, now int64) int {
+	if !spreadInitialEnabled() {
+		return 0
+	}
+	type pending struct {
+		Table string
+		ID    int
+	}
+	var servers []pending
+	archived := archivedServers(t.DB)
+	for _, table := range serverTables(t) {
+		var ids []int
+		if err := t.DB.Table(table).Where(serverCond(table, "next_update_time"), 0).Order("id").Pluck("id", &ids).Error; err != nil {
+			log.Printf("获取未排期的服务器失败: 表=%s, 错误=%v", table, err)
+			continue
+		}
+		for _, id := range ids {
+			if !archived[table+":"+strconv.Itoa(id)] {
+				servers = append(servers, pending{Table: table, ID: id})
+			}
+		}
+	}
+	spread := 0
+	for i, s := range servers {
+		window := spreadWindowSeconds(serverIntervalHours(t.DB, s.Table, s.ID))
+		next := now + window*int64(i+1)/int64(len(servers)+1)
+		// 仅在仍未排期时写入，避免覆盖期间被手动设置的时间
+		result := t.DB.Table(s.Table).Where(serverCond(s.Table, "id", "next_update_time"), s.ID, 0).
+			Updates(serverFields(s.Table, map[string]interface{}{"next_update_time": next}))
+		if result.Error != nil {
+			log.Printf("错开首次轮换时间失败: 表=%s, ID=%d, 错误=%v", s.Table, s.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected > 0 {
+			spread++
+			log.Printf("首次轮换时间已错开: 表=%s, ID=%d, 下次更新时间=%s", s.Table, s.ID, time.Unix(next, 0).In(appLocation()).Format("2006-01-02 15:04:05"))
+		}
+	}
+	if spread > 0 {
+		log.Printf("已错开 %d 台首次接管服务器的轮换时间: 租户=%s", spread, t.Name)
+	}
+	return spread
+}
@@ -182,22 +182,21 @@ init_database() {
 # 下载并安装项目
 install_project() {
     log_info "下载项目文件..."
-    mkdir -p "$INSTALL_DIR/templates"
-    curl -Ls "$RAW_URL/main.go" -o "$INSTALL_DIR/main.go"
-    if [ $? -ne 0 ]; then
-        log_error "下载 main.go 失败，请检查 $RAW_URL/main.go"
-        exit 1
-    fi
-    curl -Ls "$RAW_URL/templates/servers.html" -o "$INSTALL_DIR/templates/servers.html"
-    if [ $? -ne 0 ]; then
-        log_error "下载 servers.html 失败，请检查 $RAW_URL/templates/servers.html"
+    mkdir -p "$INSTALL_DIR"
+    # 项目由多个源文件组成，直接下载仓库归档，保留已生成的配置文件；
+    # 先下载到临时文件，HTTP 错误（如 404 页面）视为下载失败
+    if ! curl -fLs "$REPO_URL/archive/refs/heads/main.tar.gz" -o /tmp/server-manager.tar.gz; then
+        rm -f /tmp/server-manager.tar.gz
+        log_error "下载项目归档失败，请检查 $REPO_URL"
         exit 1
     fi
-    curl -Ls "$RAW_URL/templates/login.html" -o "$INSTALL_DIR/templates/login.html"
+    tar -xzf /tmp/server-manager.tar.gz -C "$INSTALL_DIR" --strip-components=1 --exclude='*/config.toml'
     if [ $? -ne 0 ]; then
-        log_error "下载 login.html 失败，请检查 $RAW_URL/templates/login.html"
+        rm -f /tmp/server-manager.tar.gz
+        log_error "解压项目归档失败"
         exit 1
     fi
+    rm -f /tmp/server-manager.tar.gz
 
     # 静态资源通过 CDN 加载
     log_info "静态资源（Bootstrap、jQuery）将通过 CDN 加载，无需本地下载"
@@ -205,9 +204,8 @@ install_project() {
     # 编译 Go 程序
     log_info "编译项目..."
     cd "$INSTALL_DIR"
-    go mod init server-manager
-    go mod tidy
-    go build -o server-manager main.go
+    go mod download
+    go build -o server-manager .
     if [ $? -ne 0 ]; then
         log_error "编译失败，请检查 Go 环境和代码"
         exit 1
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authenticator 登录校验及会话管理
+type Authenticator interface {
+	// CheckPassword 校验用户名及密码，已停用的用户不能登录
+	CheckPassword(username, password string) bool
+	// StartSession 为用户创建登录会话
+	StartSession(c *gin.Context, username string) error
+	// Remember 签发"记住我"长期登录令牌
+	Remember(c *gin.Context, username string) error
+	// EndSession 吊销记住登录令牌并结束当前会话
+	EndSession(c *gin.Context)
+}
+
+// Redirector 重定向到应用内路径（处理基础路径及反向代理）
+type Redirector func(c *gin.Context, path string)
+
+// AuthSettings 登录页面设置
+type AuthSettings struct {
+	LoginTemplate string // 登录页模板名
+	LoginPath     string // 登录页路径
+	HomePath      string // 登录成功后跳转的路径
+}
+
+// AuthHandler 登录、登出处理
+type AuthHandler struct {
+	auth     Authenticator
+	redirect Redirector
+	settings AuthSettings
+}
+
+// NewAuthHandler 创建登录、登出处理
+func NewAuthHandler(auth Authenticator, redirect Redirector, settings AuthSettings) *AuthHandler {
+	return &AuthHandler{auth: auth, redirect: redirect, settings: settings}
+}
+
+// Root 根路径重定向到登录页
+func (h *AuthHandler) Root(c *gin.Context) {
+	h.redirect(c, h.settings.LoginPath)
+}
+
+// LoginPage 登录页面
+func (h *AuthHandler) LoginPage(c *gin.Context) {
+	c.HTML(http.StatusOK, h.settings.LoginTemplate, nil)
+}
+
+// Login 登录处理
+func (h *AuthHandler) Login(c *gin.Context) {
+	username := c.PostForm("username")
+	if !h.auth.CheckPassword(username, c.PostForm("password")) {
+		c.HTML(http.StatusUnauthorized, h.settings.LoginTemplate, gin.H{"error": "无效的用户名或密码"})
+		return
+	}
+	if err := h.auth.StartSession(c, username); err != nil {
+		log.Printf("保存会话失败: %v", err)
+		RespondError(c, http.StatusInternalServerError, CodeInternal, "保存会话失败")
+		return
+	}
+	if c.PostForm("remember") != "" {
+		if err := h.auth.Remember(c, username); err != nil {
+			log.Printf("签发记住登录令牌失败: %v", err)
+		}
+	}
+	h.redirect(c, h.settings.HomePath)
+}
+
+// Logout 登出
+func (h *AuthHandler) Logout(c *gin.Context) {
+	h.auth.EndSession(c)
+	h.redirect(c, h.settings.LoginPath)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+)
+
+// CheckSchedule 定时检查任务的调度
+type CheckSchedule interface {
+	// Current 当前的表达式及下次执行时间，调度器未运行时下次执行时间为零值
+	Current() (string, time.Time)
+	// Reschedule 按新的表达式重新调度检查任务
+	Reschedule(spec string) error
+	// Save 将表达式写入配置文件
+	Save(spec string) error
+}
+
+// CheckCronHandler 查看及修改检查频率
+type CheckCronHandler struct {
+	schedule CheckSchedule
+}
+
+// NewCheckCronHandler 创建检查频率处理
+func NewCheckCronHandler(schedule CheckSchedule) *CheckCronHandler {
+	return &CheckCronHandler{schedule: schedule}
+}
+
+// Get 查看检查频率
+func (h *CheckCronHandler) Get(c *gin.Context) {
+	spec, next := h.schedule.Current()
+	var nextRun int64
+	if !next.IsZero() {
+		nextRun = next.Unix()
+	}
+	c.JSON(http.StatusOK, gin.H{"cron": spec, "next_run_time": nextRun})
+}
+
+// Set 修改检查频率，立即生效并写入配置文件
+func (h *CheckCronHandler) Set(c *gin.Context) {
+	spec := strings.TrimSpace(c.PostForm("cron"))
+	if _, err := cron.ParseStandard(spec); err != nil {
+		log.Printf("无效的检查频率表达式: %s, 错误=%v", spec, err)
+		RespondError(c, http.StatusBadRequest, CodeInvalidArgument, "无效的检查频率表达式："+err.Error())
+		return
+	}
+	if err := h.schedule.Reschedule(spec); err != nil {
+		log.Printf("重新调度检查任务失败: %v", err)
+		RespondError(c, http.StatusInternalServerError, CodeInternal, "修改检查频率失败："+err.Error())
+		return
+	}
+	if err := h.schedule.Save(spec); err != nil {
+		log.Printf("写入配置文件失败: %v", err)
+		RespondError(c, http.StatusInternalServerError, CodeInternal, "保存检查频率失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "检查频率已设置为 " + spec})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 测试用的检查任务调度
+type fakeSchedule struct {
+	spec      string
+	saved     string
+	rescheErr error
+}
+
+func (s *fakeSchedule) Current() (string, time.Time) { return s.spec, time.Time{} }
+func (s *fakeSchedule) Reschedule(spec string) error {
+	if s.rescheErr != nil {
+		return s.rescheErr
+	}
+	s.spec = spec
+	return nil
+}
+func (s *fakeSchedule) Save(spec string) error {
+	s.saved = spec
+	return nil
+}
+
+func TestCheckCronHandlerSet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name      string
+		cron      string
+		rescheErr error
+		status    int
+		saved     string
+	}{
+		{"有效表达式", " */10 * * * * ", nil, http.StatusOK, "*/10 * * * *"},
+		{"无效表达式", "every minute", nil, http.StatusBadRequest, ""},
+		{"调度失败", "*/5 * * * *", errors.New("调度器未初始化"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := &fakeSchedule{spec: "*/5 * * * *", rescheErr: tt.rescheErr}
+			h := NewCheckCronHandler(schedule)
+			r := gin.New()
+			r.POST("/check-cron", h.Set)
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/check-cron", strings.NewReader(url.Values{"cron": {tt.cron}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("状态码应为 %d，实际为 %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if schedule.saved != tt.saved {
+				t.Errorf("写入配置的表达式应为 %q，实际为 %q", tt.saved, schedule.saved)
+			}
+		})
+	}
+}
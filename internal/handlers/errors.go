@@ -0,0 +1,87 @@
+// Package handlers HTTP 处理函数及统一的错误响应。处理函数的依赖（认证、调度等）通过构造函数注入，
+// 包内不持有数据库连接或全局配置
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API 错误码，调用方应按 code 而非中文提示分支处理
+const (
+	CodeInvalidArgument      = "INVALID_ARGUMENT"       // 参数缺失或格式错误
+	CodeInvalidTable         = "INVALID_TABLE"          // 不支持的服务器表名
+	CodeInvalidID            = "INVALID_ID"             // ID 参数无效
+	CodeValidationFailed     = "VALIDATION_FAILED"      // 字段校验失败，details 中列出各项问题
+	CodeNotFound             = "NOT_FOUND"              // 记录不存在
+	CodeDomainNotFound       = "DOMAIN_NOT_FOUND"       // 域名不存在
+	CodeDomainExists         = "DOMAIN_EXISTS"          // 域名已存在
+	CodeDomainExhausted      = "DOMAIN_EXHAUSTED"       // 服务器没有可分配的域名
+	CodeDomainProtected      = "DOMAIN_PROTECTED"       // 域名已开启删除保护
+	CodeConflict             = "CONFLICT"               // 与当前状态冲突
+	CodeUnauthorized         = "UNAUTHORIZED"           // 未登录或令牌无效
+	CodeForbidden            = "FORBIDDEN"              // 权限不足
+	CodeBodyTooLarge         = "BODY_TOO_LARGE"         // 请求体超出限制
+	CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE" // 不支持的请求体类型
+	CodeMaintenance          = "MAINTENANCE"            // 维护模式中拒绝写操作
+	CodeStandby              = "STANDBY"                // 备用节点拒绝写操作
+	CodeUpstreamFailed       = "UPSTREAM_FAILED"        // DNS 服务商等外部服务调用失败
+	CodeRotationFailed       = "ROTATION_FAILED"        // 轮换失败
+	CodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED" // Idempotency-Key 已用于不同的请求
+	CodeConfirmationRequired = "CONFIRMATION_REQUIRED"  // 破坏性操作缺少有效的确认令牌
+	CodeInternal             = "INTERNAL_ERROR"         // 服务端错误
+)
+
+// 各 HTTP 状态码的默认错误码
+var defaultErrorCodes = map[int]string{
+	http.StatusBadRequest:            CodeInvalidArgument,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodeBodyTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMediaType,
+	http.StatusPreconditionRequired:  CodeConfirmationRequired,
+	http.StatusBadGateway:            CodeUpstreamFailed,
+}
+
+// RespondError 错误响应：{"code", "message", "details", "request_id"}，并保留 "error"（同 message）兼容旧调用方；
+// code 为空时按状态码取默认值，details 可选
+func RespondError(c *gin.Context, status int, code, message string, details ...interface{}) {
+	if code == "" {
+		code = defaultErrorCodes[status]
+		if code == "" {
+			code = CodeInternal
+		}
+	}
+	body := gin.H{"code": code, "message": message, "error": message, "request_id": RequestID(c)}
+	if len(details) > 0 && details[0] != nil {
+		body["details"] = details[0]
+	}
+	c.AbortWithStatusJSON(status, body)
+}
+
+// 客户端传入的请求 ID 只接受常见字符，避免写入日志及响应头时被注入
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestIDMiddleware 请求 ID 中间件：沿用代理或客户端传入的 X-Request-ID，否则生成新的 ID，并写回响应头
+func RequestIDMiddleware(c *gin.Context) {
+	id := c.GetHeader("X-Request-ID")
+	if !validRequestID.MatchString(id) {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	c.Set("request_id", id)
+	c.Header("X-Request-ID", id)
+	c.Next()
+}
+
+// RequestID 当前请求的 ID
+func RequestID(c *gin.Context) string {
+	return c.GetString("request_id")
+}
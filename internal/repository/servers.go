@@ -0,0 +1,101 @@
+// Package repository 面板服务器表的数据访问。面板按协议分表（如 v2_server_vless），列名可按面板版本映射，
+// 数据库连接及列映射通过构造函数注入
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ColumnMapper 将服务器表的逻辑列名（如 next_update_time）映射为实际列名
+type ColumnMapper interface {
+	Column(table, column string) string
+}
+
+// Settings 服务器表数据访问的设置
+type Settings struct {
+	Columns ColumnMapper // 列映射，为空时实际列名与逻辑列名相同
+}
+
+// DueServer 到期待轮换的服务器
+type DueServer struct {
+	Table          string
+	ID             int
+	NextUpdateTime int64
+}
+
+// ServerRepository 面板服务器表的数据访问
+type ServerRepository struct {
+	db       *gorm.DB
+	settings Settings
+}
+
+// NewServerRepository 创建服务器表的数据访问
+func NewServerRepository(db *gorm.DB, settings Settings) *ServerRepository {
+	return &ServerRepository{db: db, settings: settings}
+}
+
+// 实际列名
+func (r *ServerRepository) column(table, column string) string {
+	if column == "id" || r.settings.Columns == nil {
+		return column
+	}
+	return r.settings.Columns.Column(table, column)
+}
+
+// 带反引号的实际列名，用于拼接 SQL
+func (r *ServerRepository) quoted(table, column string) string {
+	return "`" + r.column(table, column) + "`"
+}
+
+// 查询列表达式：实际列名以逻辑名作为别名返回
+func (r *ServerRepository) selectColumns(table string, columns ...string) string {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		if column == "id" {
+			parts[i] = "id"
+			continue
+		}
+		parts[i] = fmt.Sprintf("%s AS `%s`", r.quoted(table, column), column)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// 将以逻辑列名为键的更新字段转换为实际列名
+func (r *ServerRepository) fields(table string, fields map[string]interface{}) map[string]interface{} {
+	mapped := make(map[string]interface{}, len(fields))
+	for column, value := range fields {
+		mapped[r.column(table, column)] = value
+	}
+	return mapped
+}
+
+// Due 表中下次更新时间不晚于 now 的服务器
+func (r *ServerRepository) Due(table string, now int64) ([]DueServer, error) {
+	var servers []DueServer
+	err := r.db.Table(table).Select(r.selectColumns(table, "id", "next_update_time")).
+		Where(r.quoted(table, "next_update_time")+" <= ?", now).Find(&servers).Error
+	for i := range servers {
+		servers[i].Table = table
+	}
+	return servers, err
+}
+
+// SetStatus 更新服务器的最近更新状态及失败分类（成功时分类为空）
+func (r *ServerRepository) SetStatus(table string, id int, status, code string) error {
+	return r.db.Table(table).Where("id = ?", id).Updates(r.fields(table, map[string]interface{}{
+		"last_update_status":      status,
+		"last_update_status_code": code,
+	})).Error
+}
+
+// MarkFailed 记录更新失败的状态，并把下次更新时间推迟到 nextUpdateTime
+func (r *ServerRepository) MarkFailed(table string, id int, status, code string, nextUpdateTime int64) error {
+	return r.db.Table(table).Where("id = ?", id).Updates(r.fields(table, map[string]interface{}{
+		"last_update_status":      status,
+		"last_update_status_code": code,
+		"next_update_time":        nextUpdateTime,
+	})).Error
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 测试用的列映射：next_update_time 映射为 next_at
+type testColumns struct{}
+
+func (testColumns) Column(table, column string) string {
+	if column == "next_update_time" {
+		return "next_at"
+	}
+	return column
+}
+
+func TestServerRepositoryColumnMapping(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.Exec("CREATE TABLE v2_server_vless (id INTEGER PRIMARY KEY, next_at INTEGER, last_update_status TEXT, last_update_status_code TEXT)").Error; err != nil {
+		t.Fatalf("创建服务器表失败: %v", err)
+	}
+	db.Exec("INSERT INTO v2_server_vless (id, next_at) VALUES (1, 100), (2, 500)")
+
+	repo := NewServerRepository(db, Settings{Columns: testColumns{}})
+	due, err := repo.Due("v2_server_vless", 200)
+	if err != nil {
+		t.Fatalf("查询到期服务器失败: %v", err)
+	}
+	if len(due) != 1 || due[0].ID != 1 || due[0].NextUpdateTime != 100 || due[0].Table != "v2_server_vless" {
+		t.Fatalf("到期服务器错误: %+v", due)
+	}
+
+	if err := repo.MarkFailed("v2_server_vless", 1, "更新失败", "unknown", 900); err != nil {
+		t.Fatalf("记录失败状态失败: %v", err)
+	}
+	var next int64
+	db.Raw("SELECT next_at FROM v2_server_vless WHERE id = 1").Scan(&next)
+	if next != 900 {
+		t.Errorf("下次更新时间应写入映射后的列，实际为 %d", next)
+	}
+}
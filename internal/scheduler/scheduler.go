@@ -0,0 +1,102 @@
+// Package scheduler 定时任务调度：在 cron 之上提供可替换表达式的具名任务及启停控制，
+// 任务函数及时区由调用方注入，包内不持有数据库或配置
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Settings 调度器设置
+type Settings struct {
+	Location *time.Location // 解析 Cron 表达式使用的时区，为空时使用本地时区
+}
+
+// 具名任务：表达式可在运行中替换
+type namedJob struct {
+	id   cron.EntryID
+	spec string
+}
+
+// Scheduler 定时任务调度器，创建后处于停止状态，由 SetRunning 启停
+type Scheduler struct {
+	mu      sync.Mutex
+	cron    *cron.Cron
+	named   map[string]namedJob
+	running bool
+}
+
+// New 创建调度器
+func New(settings Settings) *Scheduler {
+	loc := settings.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	return &Scheduler{cron: cron.New(cron.WithLocation(loc)), named: map[string]namedJob{}}
+}
+
+// Add 添加固定表达式的任务
+func (s *Scheduler) Add(spec string, job func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.cron.AddFunc(spec, job)
+	return err
+}
+
+// Schedule 按给定表达式（重新）调度具名任务，先添加新任务再移除旧任务，避免出现空档
+func (s *Scheduler) Schedule(name, spec string, job func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := s.cron.AddFunc(spec, job)
+	if err != nil {
+		return err
+	}
+	if old, ok := s.named[name]; ok {
+		s.cron.Remove(old.id)
+	}
+	s.named[name] = namedJob{id: id, spec: spec}
+	return nil
+}
+
+// Spec 具名任务当前的表达式，未调度时为空
+func (s *Scheduler) Spec(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.named[name].spec
+}
+
+// Next 具名任务的下次执行时间，未调度或调度器未运行时为零值
+func (s *Scheduler) Next(name string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.named[name]
+	if !ok {
+		return time.Time{}
+	}
+	return s.cron.Entry(job.id).Next
+}
+
+// SetRunning 启动或停止调度器，停止时等待正在执行的任务结束；状态改变时返回 true
+func (s *Scheduler) SetRunning(run bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case run && !s.running:
+		s.cron.Start()
+	case !run && s.running:
+		<-s.cron.Stop().Done()
+	default:
+		return false
+	}
+	s.running = run
+	return true
+}
+
+// Running 调度器是否正在运行
+func (s *Scheduler) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
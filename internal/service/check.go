@@ -0,0 +1,125 @@
+// Package service 服务器轮换的业务流程。数据访问及轮换动作通过接口注入，设置在每次执行时读取，
+// 包内不持有数据库连接或全局配置
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"ser_manger/internal/repository"
+)
+
+// ServerStore 定时检查用到的服务器表数据访问
+type ServerStore interface {
+	Due(table string, now int64) ([]repository.DueServer, error)
+	SetStatus(table string, id int, status, code string) error
+	MarkFailed(table string, id int, status, code string, nextUpdateTime int64) error
+}
+
+// Rotator 定时检查用到的轮换动作，由调用方按租户实现
+type Rotator interface {
+	// Tables 参与轮换的服务器表
+	Tables() []string
+	// Archived 已下线归档的服务器，键为 "表名:ID"
+	Archived() map[string]bool
+	// Defer 本次是否跳过该服务器（不在允许轮换时段、节点繁忙或处于禁止轮换时段），跳过时已记录原因
+	Defer(table string, id int, now int64) bool
+	// Rotate 轮换服务器端口及域名
+	Rotate(table string, id int, now int64) error
+	// RecordFailure 记录最终失败，连续失败达到上限并隐藏节点时返回 true
+	RecordFailure(table string, id int, err error) bool
+	// IntervalHours 服务器的轮换间隔（小时）
+	IntervalHours(table string, id int) int
+	// Classify 失败分类
+	Classify(err error) string
+}
+
+// CheckSettings 定时检查的设置
+type CheckSettings struct {
+	RetryAttempts       int // 每台服务器的尝试次数，小于 1 时按 1 次
+	RetryBackoffSeconds int // 第 N 次重试前等待 N × RetryBackoffSeconds 秒
+	HideAfterFailures   int // 连续失败多少次后隐藏节点，用于失败提示
+}
+
+// CheckService 检查一个租户中到期的服务器并轮换
+type CheckService struct {
+	store    ServerStore
+	rotator  Rotator
+	settings func() CheckSettings
+	sleep    func(time.Duration)
+}
+
+// NewCheckService 创建定时检查服务，settings 在每次检查时调用以取得当前配置
+func NewCheckService(store ServerStore, rotator Rotator, settings func() CheckSettings) *CheckService {
+	return &CheckService{store: store, rotator: rotator, settings: settings, sleep: time.Sleep}
+}
+
+// Run 轮换到期的服务器，最早到期的先轮换；budget 为剩余可轮换数（小于 0 表示不限），
+// 返回因达到上限而推迟的服务器数
+func (s *CheckService) Run(now int64, budget *int) int {
+	var due []repository.DueServer
+	archived := s.rotator.Archived()
+	for _, table := range s.rotator.Tables() {
+		servers, err := s.store.Due(table, now)
+		if err != nil {
+			log.Printf("从表 %s 获取服务器失败: %v", table, err)
+			continue
+		}
+		for _, server := range servers {
+			// 已下线归档的服务器不再轮换
+			if archived[table+":"+strconv.Itoa(server.ID)] {
+				continue
+			}
+			due = append(due, server)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextUpdateTime < due[j].NextUpdateTime })
+	settings := s.settings()
+	attempts := settings.RetryAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	for i, server := range due {
+		if *budget == 0 {
+			return len(due) - i
+		}
+		if s.rotator.Defer(server.Table, server.ID, now) {
+			continue
+		}
+		if *budget > 0 {
+			*budget--
+		}
+		s.rotate(server, now, attempts, settings)
+	}
+	return 0
+}
+
+// 轮换一台服务器，失败时按设置重试，最终失败时记录失败并推迟到下一个间隔
+func (s *CheckService) rotate(server repository.DueServer, now int64, attempts int, settings CheckSettings) {
+	table, id := server.Table, server.ID
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			s.sleep(time.Duration(settings.RetryBackoffSeconds*attempt) * time.Second)
+		}
+		if err = s.rotator.Rotate(table, id, now); err == nil {
+			if updateErr := s.store.SetStatus(table, id, "更新成功", ""); updateErr != nil {
+				log.Printf("更新表 %s, ID=%d 的 last_update_status 失败: %v", table, id, updateErr)
+			}
+			return
+		}
+		log.Printf("尝试 %d 更新服务器失败: 表=%s, ID=%d, 错误=%v", attempt+1, table, id, err)
+	}
+	log.Printf("%d 次尝试后更新服务器失败: 表=%s, ID=%d, 错误=%v", attempts, table, id, err)
+	status := "更新失败：" + err.Error()
+	if s.rotator.RecordFailure(table, id, err) {
+		status = fmt.Sprintf("连续 %d 次更新失败，节点已自动隐藏：%s", settings.HideAfterFailures, err.Error())
+	}
+	next := now + int64(s.rotator.IntervalHours(table, id)*3600)
+	if updateErr := s.store.MarkFailed(table, id, status, s.rotator.Classify(err), next); updateErr != nil {
+		log.Printf("更新表 %s, ID=%d 的 last_update_status 失败: %v", table, id, updateErr)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"ser_manger/internal/repository"
+)
+
+// 测试用的服务器表：记录状态更新
+type fakeStore struct {
+	due    map[string][]repository.DueServer
+	status map[string]string
+	next   map[string]int64
+}
+
+func (s *fakeStore) Due(table string, now int64) ([]repository.DueServer, error) {
+	return s.due[table], nil
+}
+
+func (s *fakeStore) SetStatus(table string, id int, status, code string) error {
+	s.status[key(table, id)] = status
+	return nil
+}
+
+func (s *fakeStore) MarkFailed(table string, id int, status, code string, next int64) error {
+	s.status[key(table, id)] = code + ":" + status
+	s.next[key(table, id)] = next
+	return nil
+}
+
+// 测试用的轮换动作：按服务器返回预设的错误，记录轮换顺序
+type fakeRotator struct {
+	archived map[string]bool
+	deferred map[string]bool
+	errs     map[string]error
+	rotated  []string
+	failures int
+}
+
+func key(table string, id int) string { return table + ":" + strconv.Itoa(id) }
+
+func (r *fakeRotator) Tables() []string          { return []string{"a", "b"} }
+func (r *fakeRotator) Archived() map[string]bool { return r.archived }
+func (r *fakeRotator) Defer(table string, id int, now int64) bool {
+	return r.deferred[key(table, id)]
+}
+func (r *fakeRotator) Rotate(table string, id int, now int64) error {
+	r.rotated = append(r.rotated, key(table, id))
+	return r.errs[key(table, id)]
+}
+func (r *fakeRotator) RecordFailure(table string, id int, err error) bool {
+	r.failures++
+	return false
+}
+func (r *fakeRotator) IntervalHours(table string, id int) int { return 2 }
+func (r *fakeRotator) Classify(err error) string              { return "unknown" }
+
+func TestCheckServiceRun(t *testing.T) {
+	store := &fakeStore{
+		due: map[string][]repository.DueServer{
+			"a": {{Table: "a", ID: 1, NextUpdateTime: 300}, {Table: "a", ID: 2, NextUpdateTime: 100}, {Table: "a", ID: 3, NextUpdateTime: 50}},
+			"b": {{Table: "b", ID: 1, NextUpdateTime: 200}, {Table: "b", ID: 2, NextUpdateTime: 10}},
+		},
+		status: map[string]string{},
+		next:   map[string]int64{},
+	}
+	rotator := &fakeRotator{
+		archived: map[string]bool{"b:2": true},
+		deferred: map[string]bool{"a:3": true},
+		errs:     map[string]error{"b:1": errors.New("无可用域名")},
+	}
+	svc := NewCheckService(store, rotator, func() CheckSettings { return CheckSettings{RetryAttempts: 2} })
+	svc.sleep = func(time.Duration) {}
+
+	// 最多轮换 2 台：跳过已归档的 b:2 及推迟的 a:3，按到期时间先轮换 a:2、b:1（重试 2 次），a:1 留到下次
+	budget := 2
+	if deferred := svc.Run(1000, &budget); deferred != 1 {
+		t.Fatalf("推迟数应为 1，实际为 %d", deferred)
+	}
+	want := []string{"a:2", "b:1", "b:1"}
+	if len(rotator.rotated) != len(want) {
+		t.Fatalf("轮换顺序错误: %v", rotator.rotated)
+	}
+	for i := range want {
+		if rotator.rotated[i] != want[i] {
+			t.Fatalf("轮换顺序错误: %v", rotator.rotated)
+		}
+	}
+	if store.status["a:2"] != "更新成功" {
+		t.Errorf("成功的轮换应更新状态: %q", store.status["a:2"])
+	}
+	if store.status["b:1"] != "unknown:更新失败：无可用域名" || store.next["b:1"] != 1000+2*3600 || rotator.failures != 1 {
+		t.Errorf("失败的轮换应记录失败并推迟一个间隔: 状态=%q, 下次=%d, 失败记录=%d", store.status["b:1"], store.next["b:1"], rotator.failures)
+	}
+}
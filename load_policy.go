@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 节点上报超过该时长视为数据过期，不作为负载判断依据
+const metricsStaleSeconds = 600
+
+// 判断节点是否繁忙，返回原因；不繁忙或无近期数据时返回空字符串
+func nodeBusyReason(tdb *gorm.DB, table string, id int, now int64) string {
+	summary := trafficSummary(tdb, table, id, now)
+	if summary.ReportedAt == 0 || now-summary.ReportedAt > metricsStaleSeconds {
+		return ""
+	}
+	if maxConn := viper.GetInt("load.maxConnections"); maxConn > 0 && summary.Connections > maxConn {
+		return fmt.Sprintf("当前连接数 %d 超过 %d", summary.Connections, maxConn)
+	}
+	if maxTraffic := viper.GetInt64("load.maxTrafficBytesPerHour"); maxTraffic > 0 && summary.LastHour > maxTraffic {
+		return fmt.Sprintf("最近一小时流量 %s 超过 %s", formatBytes(summary.LastHour), formatBytes(maxTraffic))
+	}
+	return ""
+}
+
+// 推算空闲时段时参考的历史天数
+const quietWindowHistoryDays = 7
+
+// 某个整点至少有这么多天的上报数据才可能被视为空闲，避免偶尔一次的稀疏上报被当作规律
+const quietWindowMinDays = 3
+
+// 按节点最近 quietWindowHistoryDays 天的上报数据推算下一个空闲时段的开始时间：按部署时区的整点小时统计
+// 平均连接数、每小时流量及在线用户数，返回 now 之后第一个有 quietWindowMinDays 天以上数据且各项均不超过阈值的整点
+// （最多向后查找 24 小时）；没有足够的历史数据或找不到空闲时段时返回 0
+func nextQuietWindow(tdb *gorm.DB, table string, id int, setting ServerSetting, now int64) int64 {
+	var metrics []NodeMetric
+	if err := tdb.Select("reported_at", "connections", "online_users", "upload_delta", "download_delta").
+		Where("server_table = ? AND server_id = ? AND reported_at > ?", table, id, now-quietWindowHistoryDays*86400).
+		Find(&metrics).Error; err != nil {
+		log.Printf("获取节点历史负载失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return 0
+	}
+	type hourLoad struct {
+		reports, connections  int64
+		onlineReports, online int64
+		traffic               int64
+		days                  map[string]bool
+	}
+	var hours [24]hourLoad
+	for _, m := range metrics {
+		at := time.Unix(m.ReportedAt, 0).In(appLocation())
+		h := &hours[at.Hour()]
+		if h.days == nil {
+			h.days = map[string]bool{}
+		}
+		h.days[at.Format("2006-01-02")] = true
+		h.reports++
+		h.connections += int64(m.Connections)
+		h.traffic += m.UploadDelta + m.DownloadDelta
+		if m.OnlineUsers != nil {
+			h.onlineReports++
+			h.online += int64(*m.OnlineUsers)
+		}
+	}
+	loadEnabled := viper.GetBool("load.enabled")
+	maxConn := viper.GetInt64("load.maxConnections")
+	maxTraffic := viper.GetInt64("load.maxTrafficBytesPerHour")
+	quiet := func(h hourLoad) bool {
+		if len(h.days) < quietWindowMinDays {
+			return false
+		}
+		if loadEnabled && maxConn > 0 && h.connections/h.reports > maxConn {
+			return false
+		}
+		if loadEnabled && maxTraffic > 0 && h.traffic/int64(len(h.days)) > maxTraffic {
+			return false
+		}
+		if setting.MaxOnlineUsers > 0 && h.onlineReports > 0 && h.online/h.onlineReports > int64(setting.MaxOnlineUsers) {
+			return false
+		}
+		return true
+	}
+	current := time.Unix(now, 0).In(appLocation())
+	start := time.Date(current.Year(), current.Month(), current.Day(), current.Hour(), 0, 0, 0, current.Location())
+	for i := 1; i <= 24; i++ {
+		slot := start.Add(time.Duration(i) * time.Hour)
+		if quiet(hours[slot.Hour()]) {
+			return slot.Unix()
+		}
+	}
+	return 0
+}
+
+// 负载感知调度：节点繁忙（load.enabled 开启时）或在线用户数超过服务器的 max_online_users 设置时
+// 推迟轮换到下一个空闲时段（按历史负载推算，见 nextQuietWindow），返回 true 表示本次已推迟；
+// 无法推算空闲时段时推迟 load.deferMinutes 分钟。
+// 连续推迟超过 load.maxDeferHours 后不再推迟，避免域名长期不轮换；推迟时间也不超过该期限。
+func deferRotationIfBusy(t *Tenant, table string, id int, now int64) bool {
+	tdb := t.DB
+	setting := loadServerSetting(tdb, table, id)
+	if !viper.GetBool("load.enabled") && setting.MaxOnlineUsers <= 0 && setting.DeferredSince == 0 {
+		return false
+	}
+	reason := ""
+	if viper.GetBool("load.enabled") {
+		reason = nodeBusyReason(tdb, table, id, now)
+	}
+	if reason == "" {
+		reason = onlineUsersGuardReason(setting, estimateUserImpact(t, table, id, now))
+	}
+	if reason == "" {
+		if setting.DeferredSince != 0 {
+			setting.DeferredSince = 0
+			if err := tdb.Save(&setting).Error; err != nil {
+				log.Printf("清除推迟标记失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			}
+		}
+		return false
+	}
+	maxDefer := viper.GetInt64("load.maxDeferHours")
+	if maxDefer <= 0 {
+		maxDefer = 6
+	}
+	if setting.DeferredSince != 0 && now-setting.DeferredSince >= maxDefer*3600 {
+		log.Printf("节点繁忙但已连续推迟 %d 小时，强制轮换: 表=%s, ID=%d, 原因=%s", maxDefer, table, id, reason)
+		setting.DeferredSince = 0
+		if err := tdb.Save(&setting).Error; err != nil {
+			log.Printf("清除推迟标记失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		}
+		return false
+	}
+	if setting.DeferredSince == 0 {
+		setting.DeferredSince = now
+		if err := tdb.Save(&setting).Error; err != nil {
+			log.Printf("记录推迟标记失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		}
+	}
+	next := nextQuietWindow(tdb, table, id, setting, now)
+	if next == 0 {
+		deferMinutes := viper.GetInt64("load.deferMinutes")
+		if deferMinutes <= 0 {
+			deferMinutes = 30
+		}
+		next = now + deferMinutes*60
+	}
+	if deadline := setting.DeferredSince + maxDefer*3600; next > deadline {
+		next = deadline
+	}
+	if err := tdb.Table(table).Where("id = ?", id).Updates(serverFields(table, map[string]interface{}{
+		"next_update_time":        next,
+		"last_update_status":      "节点繁忙，推迟轮换：" + reason,
+		"last_update_status_code": "",
+	})).Error; err != nil {
+		log.Printf("推迟轮换失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return false
+	}
+	log.Printf("节点繁忙，推迟轮换到 %s: 表=%s, ID=%d, 原因=%s", time.Unix(next, 0).Format("2006-01-02 15:04:05"), table, id, reason)
+	return true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestNextQuietWindow(t *testing.T) {
+	// 非整点时差的时区：按 UTC 整点统计会把同一本地小时拆到两个小时里
+	loc := time.FixedZone("UTC+5:30", 5*3600+1800)
+	prevLoc := deployLocation
+	deployLocation = loc
+	t.Cleanup(func() { deployLocation = prevLoc })
+	for key, value := range map[string]interface{}{"load.enabled": true, "load.maxConnections": 50, "load.maxTrafficBytesPerHour": 0} {
+		prev := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, prev) })
+	}
+
+	now := time.Date(2026, 10, 15, 23, 15, 0, 0, loc)
+	nextDay := func(hour int) int64 {
+		return time.Date(2026, 10, 16, hour, 0, 0, 0, loc).Unix()
+	}
+	// days 天前的本地 hour 点，每小时上报两次（:10 与 :50）
+	reports := func(connections, hour int, days ...int) []NodeMetric {
+		var metrics []NodeMetric
+		for _, d := range days {
+			for _, minute := range []int{10, 50} {
+				at := time.Date(now.Year(), now.Month(), now.Day()-d, hour, minute, 0, 0, loc)
+				metrics = append(metrics, NodeMetric{ServerTable: "v2_server_vless", ServerID: 1, Connections: connections, ReportedAt: at.Unix()})
+			}
+		}
+		return metrics
+	}
+	busyAllDay := func(days ...int) []NodeMetric {
+		var metrics []NodeMetric
+		for hour := 0; hour < 24; hour++ {
+			metrics = append(metrics, reports(100, hour, days...)...)
+		}
+		return metrics
+	}
+	join := func(groups ...[]NodeMetric) []NodeMetric {
+		var metrics []NodeMetric
+		for _, g := range groups {
+			metrics = append(metrics, g...)
+		}
+		return metrics
+	}
+
+	tests := []struct {
+		name    string
+		metrics []NodeMetric
+		want    int64
+	}{
+		{"没有历史数据", nil, 0},
+		{"跨过本地午夜的空闲时段", join(reports(5, 0, 1, 2, 3), reports(100, 1, 1, 2, 3)), nextDay(0)},
+		{"上报天数不足的小时不算空闲", join(reports(5, 0, 1, 2), reports(100, 1, 1, 2, 3), reports(5, 3, 1, 2, 3)), nextDay(3)},
+		{"只有一天繁忙数据的小时不算空闲", join(reports(5, 0, 1), reports(100, 2, 4)), 0},
+		{"繁忙与空闲的天数混合时按平均连接数判断", join(reports(5, 1, 1, 2, 3, 4), reports(80, 1, 5), reports(100, 2, 1, 2, 3)), nextDay(1)},
+		{"整天繁忙", busyAllDay(1, 2, 3, 4, 5, 6), 0},
+		{"超出历史范围的数据不参考", reports(5, 4, 8, 9, 10), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tdb := newTestDB(t, &NodeMetric{})
+			if len(tt.metrics) > 0 {
+				if err := tdb.Create(&tt.metrics).Error; err != nil {
+					t.Fatalf("写入上报数据失败: %v", err)
+				}
+			}
+			got := nextQuietWindow(tdb, "v2_server_vless", 1, ServerSetting{}, now.Unix())
+			if got != tt.want {
+				t.Errorf("nextQuietWindow = %s，期望 %s", time.Unix(got, 0).In(loc), time.Unix(tt.want, 0).In(loc))
+			}
+		})
+	}
+}
@@ -1,902 +1,403 @@
 package main
 
 import (
-	"context"
-	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
-	"strconv"
-	"strings"
+	"os"
 	"time"
 
-	"github.com/chromedp/chromedp"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
 	"github.com/spf13/viper"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"html/template"
+
+	"ser_manger/internal/handlers"
 )
 
-// 数据库连接
+// 默认租户的数据库连接，用于 API 令牌等全局数据
 var db *gorm.DB
 
 // Server 结构体，用于存储表中的数据
 type Server struct {
-	TableName        string
-	ID               int
-	Name             string
-	Port             string
-	ServerPort       int
-	Host             string
-	Show             bool
-	NextUpdateTime   int64  `gorm:"column:next_update_time"`
-	LastUpdateStatus string `gorm:"column:last_update_status"`
-	DomainTotal      int
-	DomainAvailable  int
+	TableName        string `json:"table_name"`
+	ID               int    `json:"id"`
+	Name             string `json:"name"`
+	Port             string `json:"port"`
+	ServerPort       int    `json:"server_port"`
+	Host             string `json:"host"`
+	Show             bool   `json:"show"`
+	NextUpdateTime   int64  `gorm:"column:next_update_time" json:"next_update_time"`
+	LastUpdateStatus string `gorm:"column:last_update_status" json:"last_update_status"`
+	// 失败分类及对应的处理建议，成功时为空
+	LastUpdateStatusCode string         `gorm:"column:last_update_status_code" json:"last_update_status_code"`
+	Remediation          string         `json:"remediation"`
+	DomainTotal          int            `json:"domain_total"`
+	DomainAvailable      int            `json:"domain_available"`
+	Traffic              TrafficSummary `json:"traffic"`
+	Impact               UserImpact     `json:"impact"`
 }
 
 // ServerDomain 结构体，用于存储每个服务器的域名
 type ServerDomain struct {
-	ID           uint   `gorm:"primaryKey" json:"id"`
-	ServerTable  string `gorm:"column:server_table;type:varchar(255);not null" json:"server_table"`
-	ServerID     int    `gorm:"column:server_id;not null" json:"server_id"`
-	Domain       string `gorm:"column:domain;type:varchar(255);uniqueIndex:unique_domain_per_server;not null" json:"domain"`
-	InUse        int8   `gorm:"type:tinyint;default:0" json:"in_use"`
-	Order        int    `gorm:"not null" json:"order"`
-	LastUsedTime int64  `gorm:"column:last_used_time;default:0" json:"last_used_time"`
+	ID             uint    `gorm:"primaryKey" json:"id"`
+	ServerTable    string  `gorm:"column:server_table;type:varchar(255);uniqueIndex:unique_domain_per_server;not null" json:"server_table"`
+	ServerID       int     `gorm:"column:server_id;uniqueIndex:unique_domain_per_server;not null" json:"server_id"`
+	Domain         string  `gorm:"column:domain;type:varchar(255);uniqueIndex:unique_domain_per_server;not null" json:"domain"`
+	InUse          int8    `gorm:"type:tinyint;default:0" json:"in_use"`
+	Order          int     `gorm:"not null" json:"order"`
+	LastUsedTime   int64   `gorm:"column:last_used_time;default:0" json:"last_used_time"`
+	Registrar      string  `gorm:"column:registrar;type:varchar(255);default:''" json:"registrar"`
+	PurchaseDate   int64   `gorm:"column:purchase_date;default:0" json:"purchase_date"`
+	Cost           float64 `gorm:"column:cost;type:decimal(10,2);default:0" json:"cost"`
+	Note           string  `gorm:"column:note;type:varchar(1024);default:''" json:"note"`
+	DNSStatus      string  `gorm:"column:dns_status;type:varchar(32);default:''" json:"dns_status"`
+	DNSDetail      string  `gorm:"column:dns_detail;type:varchar(255);default:''" json:"dns_detail"`
+	DNSCheckedTime int64   `gorm:"column:dns_checked_time;default:0" json:"dns_checked_time"`
+	MaxUses        int     `gorm:"column:max_uses;default:0" json:"max_uses"`
+	MaxInUseHours  int     `gorm:"column:max_in_use_hours;default:0" json:"max_in_use_hours"`
+	UseCount       int     `gorm:"column:use_count;default:0" json:"use_count"`
+	InUseSeconds   int64   `gorm:"column:in_use_seconds;default:0" json:"in_use_seconds"`
+	Retired        int8    `gorm:"column:retired;type:tinyint;default:0" json:"retired"`
+	RetiredTime    int64   `gorm:"column:retired_time;default:0" json:"retired_time"`
+	RetiredReason  string  `gorm:"column:retired_reason;type:varchar(255);default:''" json:"retired_reason"`
+	DNSProvider    string  `gorm:"column:dns_provider;type:varchar(64);default:''" json:"dns_provider"` // 为空时按 dns.zones 或 dns.defaultProvider 确定
+	Tags           string  `gorm:"column:tags;type:varchar(255);default:''" json:"tags"`                // 逗号分隔，供轮换策略使用
+	StagedUntil    int64   `gorm:"column:staged_until;default:0" json:"staged_until"`                   // 预热中：解析已创建，此时间前不参与轮换
+	Sharing        string  `gorm:"column:sharing;type:varchar(16);default:''" json:"sharing"`           // exclusive 或 shared，为空时按 domain.defaultSharing 确定
+	AliasOf        uint    `gorm:"column:alias_of;default:0" json:"alias_of"`                           // 别名（www./裸域名、大小写不同）指向的主域名 ID，0 表示不是别名
+	CDN            int8    `gorm:"column:cdn;type:tinyint;default:0" json:"cdn"`                        // 1 表示 CDN 域名（位于 CDN 之后），冷却更短、保留更久
+	Protected      int8    `gorm:"column:protected;type:tinyint;default:0" json:"protected"`            // 1 表示删除保护，取消保护前不能删除或退役
+	CreatedAt      int64   `gorm:"column:created_at;autoCreateTime" json:"created_at"`                  // 加入域名池的时间，0 表示早于记录该字段的版本
+	Cooldown       int     `gorm:"column:cooldown_minutes;default:0" json:"cooldown_minutes"`           // 使用后的冷却时间（分钟），0 表示按默认或 CDN 冷却时间
 }
 
-// 全局变量
-var updateIntervalHours = 24 // 默认更新间隔 24 小时
-var minPort int
-var maxPort int
-
 func main() {
-	// 加载配置文件
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// 加载配置文件并读取全局设置
+func loadConfig() {
 	viper.SetConfigName("config")
 	viper.SetConfigType("toml")
 	viper.AddConfigPath(".")
 	if err := viper.ReadInConfig(); err != nil {
 		log.Fatal("读取配置文件失败: ", err)
 	}
-
-	// 读取配置值
-	dbUser := viper.GetString("database.user")
-	dbPass := viper.GetString("database.password")
-	dbHost := viper.GetString("database.host")
-	dbPort := viper.GetString("database.port")
-	dbName := viper.GetString("database.name")
-	authUsername := viper.GetString("auth.username")
-	authPassword := viper.GetString("auth.password")
-	minPort = viper.GetInt("port.min")
-	maxPort = viper.GetInt("port.max")
-	updateIntervalHours = viper.GetInt("server.updateIntervalHours")
+	decryptConfigSecrets()
+	settings := updateSettings(func(s *Settings) {
+		s.MinPort = viper.GetInt("port.min")
+		s.MaxPort = viper.GetInt("port.max")
+		s.UpdateIntervalHours = viper.GetInt("server.updateIntervalHours")
+	})
+	loadDevMode()
+	loadTimeZone()
 	// 验证端口范围
-	if minPort >= maxPort {
+	if settings.MinPort >= settings.MaxPort {
 		log.Fatal("端口范围无效：最小端口必须小于最大端口")
 	}
+}
 
-	// 初始化数据库连接
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", dbUser, dbPass, dbHost, dbPort, dbName)
-	var err error
-	db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	if err != nil {
-		log.Fatal("数据库连接失败: ", err)
-	}
+// 运行 Web 服务及定时任务
+func runServer() {
+	// 加载配置文件
+	loadConfig()
 
-	// 配置数据库连接池
-	sqlDB, err := db.DB()
-	if err != nil {
-		log.Fatal("获取 sql.DB 失败: ", err)
-	}
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
+	// 配置日志输出及 Gin 模式
+	setupLogging()
+	setupEventBus()
+	setupTracing()
+	loadMaintenanceState()
 
-	// 自动迁移 server_domains 表
-	if err := db.AutoMigrate(&ServerDomain{}); err != nil {
-		log.Fatal("自动迁移 server_domains 表失败: ", err)
+	// 读取配置值
+	checkCron := viper.GetString("server.checkCron")
+	if checkCron == "" {
+		checkCron = defaultCheckCron
 	}
-
-	// 为性能添加索引
-	if err := db.Exec("CREATE INDEX idx_server_domains_all ON server_domains (server_table, server_id, last_used_time)").Error; err != nil {
-		log.Printf("创建 server_domains 索引失败: %v", err)
-	} else {
-		log.Println("索引 idx_server_domains_all 已创建或已存在")
+	// 验证检查频率表达式
+	if _, err := cron.ParseStandard(checkCron); err != nil {
+		log.Fatal("检查频率表达式无效: ", err)
 	}
-
-	// 验证表创建
-	var tableCount int64
-	db.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?", dbName, "server_domains").Scan(&tableCount)
-	if tableCount == 0 {
-		log.Fatal("server_domains 表未创建")
-	} else {
-		log.Println("server_domains 表验证或创建成功")
+	reconcileCron := viper.GetString("server.reconcileCron")
+	if reconcileCron == "" {
+		reconcileCron = defaultReconcileCron
+	}
+	if _, err := cron.ParseStandard(reconcileCron); err != nil {
+		log.Fatal("校对频率表达式无效: ", err)
 	}
 
-	// 检查并添加列到服务器表
-	addColumnIfNotExists("v2_server_vless", "next_update_time", "BIGINT DEFAULT 0")
-	addColumnIfNotExists("v2_server_shadowsocks", "next_update_time", "BIGINT DEFAULT 0")
-	addColumnIfNotExists("v2_server_vmess", "next_update_time", "BIGINT DEFAULT 0")
-	addColumnIfNotExists("v2_server_vless", "last_update_status", "VARCHAR(255) DEFAULT ''")
-	addColumnIfNotExists("v2_server_shadowsocks", "last_update_status", "VARCHAR(255) DEFAULT ''")
-	addColumnIfNotExists("v2_server_vmess", "last_update_status", "VARCHAR(255) DEFAULT ''")
+	// 初始化数据库连接
+	connectDatabase()
+
+	// 启动自检
+	startupSelfCheck()
+
+	// 主备选举
+	setupHA()
 
-	// 初始化示例数据
-	initSampleData()
+	// 面板服务器本地缓存
+	setupServerCache()
 
-	// 初始化已使用资源
-	initUsedResources()
+	// 指标定时推送
+	setupMetricsPush()
+
+	for _, t := range tenantList() {
+		if inMaintenance() || !isLeader() {
+			break
+		}
+		// 初始化示例数据
+		initSampleData(t)
+
+		// 校对域名状态与服务器主机，只修正不一致的记录，保留 last_used_time 以延续冷却期
+		startupConsistencyAudit(t)
+
+		// 错开首次接管服务器的轮换时间，避免启动后第一次检查时全部立即轮换
+		spreadInitialSchedules(t, time.Now().Unix())
+
+		// 关联已有数据中的域名别名
+		linkAllDomainAliases(t)
+	}
 
 	// 设置 Gin 路由
-	r := gin.Default()
+	r := gin.New()
+	r.Use(handlers.RequestIDMiddleware)
+	// OpenTelemetry 请求追踪
+	if tracing := tracingMiddleware(); tracing != nil {
+		r.Use(tracing)
+	}
+	if accessLogger := newAccessLogger(); accessLogger != nil {
+		r.Use(accessLogger)
+	}
+	r.Use(gin.Recovery())
+
+	// 响应压缩（gzip）
+	r.Use(compressionMiddleware)
+
+	// 请求体大小、类型及参数字符校验
+	r.Use(requestGuardMiddleware)
+
+	// 自定义响应头
+	r.Use(customHeadersMiddleware)
 
 	// 设置信任的代理（修复警告）
-	r.SetTrustedProxies([]string{"127.0.0.1"}) // 根据需要调整
+	// 设置信任的代理（server.trustedProxies），来自这些地址的 X-Forwarded-* 头才会被采用
+	r.SetTrustedProxies(trustedProxies())
 
 	// 设置会话中间件
 	store := cookie.NewStore([]byte("secret123"))
-	store.Options(sessions.Options{
-		Path:     "/",
-		MaxAge:   86400,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	store.Options(sessionOptions())
 	r.Use(sessions.Sessions("mysession", store))
 
-	// 提供静态文件
-	r.Static("/static", "./static")
+	// 解析请求所选租户
+	r.Use(tenantMiddleware)
+
+	// 维护模式及备用节点拒绝写操作
+	r.Use(maintenanceMiddleware)
+	r.Use(standbyMiddleware)
+
+	// 提供静态文件（编入二进制或 server.assetsDir 目录）
+	checkAssetsDir()
+	r.StaticFS("/static", staticFS())
 
 	// 定义自定义模板函数
 	funcMap := template.FuncMap{
-		"formatUnixTime": func(timestamp int64) string {
+		// 可选第二个参数为显示时区（页面数据中的 TimeZone）
+		"formatUnixTime": func(timestamp int64, tz ...string) string {
 			if timestamp == 0 {
 				return "立即更新"
 			}
-			return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+			if len(tz) > 0 {
+				return formatTimeIn(timestamp, tz[0])
+			}
+			return formatTimeIn(timestamp, "")
 		},
 		"formatDomainCount": func(total, available int) string {
 			return fmt.Sprintf("%d/%d", total, available)
 		},
+		"formatBytes":  formatBytes,
+		"trafficTrend": trafficTrend,
+		"basePath":     basePath,
 	}
 
 	// 加载 HTML 模板并应用自定义函数
 	r.SetFuncMap(funcMap)
-	r.LoadHTMLGlob("templates/*")
+	templates, err := parseTemplates(funcMap)
+	if err != nil {
+		log.Fatalf("加载页面模板失败: %v", err)
+	}
+	r.SetHTMLTemplate(templates)
 
-	// 根路径重定向到 /login
-	r.GET("/", func(c *gin.Context) {
-		c.Redirect(http.StatusFound, "/login")
-	})
+	// 登录及登出
+	registerAuthRoutes(r)
 
-	// 登录页面
-	r.GET("/login", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "login.html", nil)
-	})
+	// 服务器列表、轮换设置及检查任务
+	registerServerRoutes(r)
 
-	// 登录处理
-	r.POST("/login", func(c *gin.Context) {
-		username := c.PostForm("username")
-		password := c.PostForm("password")
-		if username == authUsername && password == authPassword {
-			session := sessions.Default(c)
-			session.Set("user", username)
-			if err := session.Save(); err != nil {
-				log.Printf("保存会话失败: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "保存会话失败"})
-				return
-			}
-			c.Redirect(http.StatusFound, "/servers")
-			return
-		}
-		c.HTML(http.StatusUnauthorized, "login.html", gin.H{"error": "无效的用户名或密码"})
-	})
+	// 域名池管理
+	registerDomainRoutes(r)
 
-	// 登出
-	r.GET("/logout", func(c *gin.Context) {
-		session := sessions.Default(c)
-		session.Clear()
-		session.Save()
-		c.Redirect(http.StatusFound, "/login")
-	})
+	// API 令牌管理
+	registerTokenRoutes(r)
 
-	// 服务器列表
-	r.GET("/servers", authMiddleware, func(c *gin.Context) {
-		var servers []Server
-		tables := []string{"v2_server_vless", "v2_server_shadowsocks", "v2_server_vmess"}
-		for _, table := range tables {
-			var records []struct {
-				ID               int
-				Name             string
-				Port             string
-				ServerPort       int
-				Host             string
-				Show             bool
-				NextUpdateTime   int64
-				LastUpdateStatus string
-			}
-			if err := db.Table(table).Select("id, name, port, server_port, host, `show`, next_update_time, last_update_status").Find(&records).Error; err != nil {
-				log.Printf("从表 %s 获取记录失败: %v", table, err)
-				continue
-			}
-			for _, s := range records {
-				var total int64
-				db.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", table, s.ID).Count(&total)
-				var available int64
-				db.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND in_use = ? AND (last_used_time = 0 OR last_used_time <= ?)", table, s.ID, 0, time.Now().Unix()-3*3600).Count(&available)
-				servers = append(servers, Server{
-					TableName:        table,
-					ID:               s.ID,
-					Name:             s.Name,
-					Port:             s.Port,
-					ServerPort:       s.ServerPort,
-					Host:             s.Host,
-					Show:             s.Show,
-					NextUpdateTime:   s.NextUpdateTime,
-					LastUpdateStatus: s.LastUpdateStatus,
-					DomainTotal:      int(total),
-					DomainAvailable:  int(available),
-				})
-			}
-		}
-		c.HTML(http.StatusOK, "servers.html", gin.H{"Servers": servers, "Interval": updateIntervalHours, "MinPort": minPort, "MaxPort": maxPort})
-	})
+	// 端口预设管理
+	registerPortPresetRoutes(r)
 
-	// 获取所有域名（包括已使用和未使用）
-	r.GET("/available-domains", authMiddleware, func(c *gin.Context) {
-		table := c.Query("table")
-		idStr := c.Query("id")
-		id, err := strconv.Atoi(idStr)
-		if err != nil || id <= 0 {
-			log.Printf("无效的ID: %s", idStr)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
-			return
-		}
-		validTables := []string{"v2_server_vless", "v2_server_shadowsocks", "v2_server_vmess"}
-		isValidTable := false
-		for _, t := range validTables {
-			if t == table {
-				isValidTable = true
-				break
-			}
-		}
-		if !isValidTable {
-			log.Printf("无效的表名: %s", table)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的表名"})
-			return
-		}
-		var domains []ServerDomain
-		err = db.Select("id, server_table, server_id, domain, in_use, `order`, last_used_time").
-			Where("server_table = ? AND server_id = ?", table, id).
-			Order("last_used_time ASC").Find(&domains).Error
-		if err != nil {
-			log.Printf("获取表 %s, ID %d 的域名失败: %v", table, id, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "无法获取域名列表: " + err.Error()})
-			return
-		}
-		log.Printf("为表 %s, ID %d 获取到 %d 个域名", table, id, len(domains))
-		for _, d := range domains {
-			log.Printf("域名: %s, in_use=%d, last_used_time=%d", d.Domain, d.InUse, d.LastUsedTime)
-		}
-		c.JSON(http.StatusOK, gin.H{"domains": domains})
-	})
+	// 节点 IP 管理（域名解析校验）
+	registerServerNodeRoutes(r)
 
-	// 添加新域名
-	r.POST("/add-domain", authMiddleware, func(c *gin.Context) {
-		table := c.PostForm("table")
-		idStr := c.PostForm("id")
-		domain := c.PostForm("domain")
-		id, err := strconv.Atoi(idStr)
-		if err != nil || id <= 0 {
-			log.Printf("无效的ID: %s", idStr)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
-			return
-		}
-		validTables := []string{"v2_server_vless", "v2_server_shadowsocks", "v2_server_vmess"}
-		isValidTable := false
-		for _, t := range validTables {
-			if t == table {
-				isValidTable = true
-				break
-			}
-		}
-		if !isValidTable {
-			log.Printf("无效的表名: %s", table)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的表名"})
-			return
-		}
-		if domain == "" {
-			log.Printf("无效的域名: 为空")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "域名不能为空"})
-			return
-		}
-		var existingDomain ServerDomain
-		if err := db.Where("server_table = ? AND server_id = ? AND domain = ?", table, id, domain).First(&existingDomain).Error; err == nil {
-			log.Printf("域名已存在: 表=%s, ID=%d, 域名=%s", table, id, domain)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "域名已存在"})
-			return
-		}
-		var maxOrder int
-		db.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", table, id).Select("MAX(`order`)").Scan(&maxOrder)
-		newDomain := ServerDomain{
-			ServerTable:  table,
-			ServerID:     id,
-			Domain:       domain,
-			InUse:        0,
-			Order:        maxOrder + 1,
-			LastUsedTime: 0,
-		}
-		if err := db.Create(&newDomain).Error; err != nil {
-			log.Printf("添加域名 %s 失败: 表=%s, ID=%d, 错误=%v", domain, table, id, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "添加域名失败：" + err.Error()})
-			return
-		}
-		var total int64
-		db.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", table, id).Count(&total)
-		var available int64
-		db.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND in_use = ? AND (last_used_time = 0 OR last_used_time <= ?)", table, id, 0, time.Now().Unix()-3*3600).Count(&available)
-		c.JSON(http.StatusOK, gin.H{
-			"message":          "域名 " + domain + " 添加成功",
-			"domain_total":     total,
-			"domain_available": available,
-		})
-	})
+	// 服务器轮换策略设置
+	registerServerSettingRoutes(r)
 
-	// 删除域名
-	r.POST("/delete-domain", authMiddleware, func(c *gin.Context) {
-		table := c.PostForm("table")
-		idStr := c.PostForm("id")
-		domainIDStr := c.PostForm("domain_id")
-		id, err := strconv.Atoi(idStr)
-		if err != nil || id <= 0 {
-			log.Printf("无效的服务器ID: %s", idStr)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的服务器ID"})
-			return
-		}
-		domainID, err := strconv.Atoi(domainIDStr)
-		if err != nil || domainID <= 0 {
-			log.Printf("无效的域名ID: %s", domainIDStr)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的域名ID"})
-			return
-		}
-		validTables := []string{"v2_server_vless", "v2_server_shadowsocks", "v2_server_vmess"}
-		isValidTable := false
-		for _, t := range validTables {
-			if t == table {
-				isValidTable = true
-				break
-			}
-		}
-		if !isValidTable {
-			log.Printf("无效的表名: %s", table)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的表名"})
-			return
-		}
-		var domain ServerDomain
-		if err := db.Where("id = ? AND server_table = ? AND server_id = ?", domainID, table, id).First(&domain).Error; err != nil {
-			log.Printf("域名不存在: ID=%d, 表=%s, 服务器ID=%d, 错误=%v", domainID, table, id, err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "域名不存在"})
-			return
-		}
-		if domain.InUse == 1 {
-			log.Printf("无法删除正在使用的域名: ID=%d, 域名=%s, 表=%s, 服务器ID=%d", domainID, domain.Domain, table, id)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无法删除正在使用的域名"})
-			return
-		}
-		var currentServer struct {
-			Host string
-		}
-		if err := db.Table(table).Select("host").Where("id = ?", id).First(&currentServer).Error; err == nil && currentServer.Host == domain.Domain {
-			log.Printf("无法删除当前服务器使用的域名: 域名=%s, 表=%s, ID=%d", domain.Domain, table, id)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无法删除当前服务器使用的域名"})
-			return
-		}
-		if err := db.Delete(&ServerDomain{}, "id = ? AND server_table = ? AND server_id = ?", domainID, table, id).Error; err != nil {
-			log.Printf("删除域名失败: ID=%d, 表=%s, 服务器ID=%d, 错误=%v", domainID, table, id, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除域名失败：" + err.Error()})
-			return
-		}
-		var total int64
-		db.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", table, id).Count(&total)
-		var available int64
-		db.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND in_use = ? AND (last_used_time = 0 OR last_used_time <= ?)", table, id, 0, time.Now().Unix()-3*3600).Count(&available)
-		c.JSON(http.StatusOK, gin.H{
-			"message":          "域名 " + domain.Domain + " 删除成功",
-			"domain_total":     total,
-			"domain_available": available,
-		})
-	})
+	// 服务器详情
+	registerServerDetailRoutes(r)
+	// 轮换日历
+	registerRotationCalendarRoutes(r)
 
-	// 设置更新间隔
-	r.POST("/set-interval", authMiddleware, func(c *gin.Context) {
-		intervalStr := c.PostForm("interval")
-		interval, err := strconv.Atoi(intervalStr)
-		if err != nil || interval <= 0 {
-			log.Printf("无效的间隔: %s", intervalStr)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的间隔"})
-			return
-		}
-		viper.Set("server.updateIntervalHours", interval)
-		updateIntervalHours = interval
-		now := time.Now().Unix()
-		newNextUpdateTime := now + int64(interval*3600)
-		tables := []string{"v2_server_vless", "v2_server_shadowsocks", "v2_server_vmess"}
-		for _, table := range tables {
-			if err := db.Table(table).Where("1 = 1").Update("next_update_time", newNextUpdateTime).Error; err != nil {
-				log.Printf("更新表 %s 的 next_update_time 失败: %v", table, err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "更新间隔失败：" + err.Error()})
-				return
-			}
-		}
-		c.JSON(http.StatusOK, gin.H{"message": "更新间隔已设置为 " + intervalStr + " 小时，所有服务器下次更新时间已刷新"})
-	})
+	// V2Board 面板集成
+	registerV2boardRoutes(r)
 
-	// 立即更新服务器
-	r.POST("/update-now", authMiddleware, func(c *gin.Context) {
-		table := c.PostForm("table")
-		idStr := c.PostForm("id")
-		id, err := strconv.Atoi(idStr)
-		if err != nil || id <= 0 {
-			log.Printf("无效的ID: %s", idStr)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
-			return
-		}
-		validTables := []string{"v2_server_vless", "v2_server_shadowsocks", "v2_server_vmess"}
-		isValidTable := false
-		for _, t := range validTables {
-			if t == table {
-				isValidTable = true
-				break
-			}
-		}
-		if !isValidTable {
-			log.Printf("无效的表名: %s", table)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的表名"})
-			return
-		}
-		now := time.Now().Unix()
-		if err := updateServer(table, id, now, false); err != nil {
-			log.Printf("更新服务器失败: 表=%s, ID=%d, 错误=%v", table, id, err)
-			if updateErr := db.Table(table).Where("id = ?", id).Update("last_update_status", "更新失败："+err.Error()).Error; updateErr != nil {
-				log.Printf("更新 last_update_status 失败: 表=%s, ID=%d, 错误=%v", table, id, updateErr)
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败：" + err.Error()})
-			return
-		}
-		if err := db.Table(table).Where("id = ?", id).Update("last_update_status", "更新成功").Error; err != nil {
-			log.Printf("更新 last_update_status 失败: 表=%s, ID=%d, 错误=%v", table, id, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败：" + err.Error()})
-			return
-		}
-		var server struct {
-			Port             string
-			Host             string
-			NextUpdateTime   int64
-			LastUpdateStatus string
-		}
-		if err := db.Table(table).Select("port, host, next_update_time, last_update_status").Where("id = ?", id).First(&server).Error; err != nil {
-			log.Printf("获取更新后的服务器失败: 表=%s, ID=%d, 错误=%v", table, id, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "无法获取更新后的服务器数据"})
-			return
-		}
-		var total int64
-		db.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", table, id).Count(&total)
-		var available int64
-		db.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND in_use = ? AND (last_used_time = 0 OR last_used_time <= ?)", table, id, 0, time.Now().Unix()-3*3600).Count(&available)
-		log.Printf("更新服务器成功: 表=%s, ID=%d, 端口=%s, 主机=%s, 域名总数=%d, 可用域名=%d", table, id, server.Port, server.Host, total, available)
-		c.JSON(http.StatusOK, gin.H{
-			"message":            "服务器已立即更新",
-			"port":               server.Port,
-			"host":               server.Host,
-			"next_update_time":   server.NextUpdateTime,
-			"last_update_status": server.LastUpdateStatus,
-			"domain_total":       total,
-			"domain_available":   available,
-		})
-	})
+	// 轮换影响的在线用户估算
+	registerUserImpactRoutes(r)
 
-	// 设置端口范围
-	r.POST("/set-port-range", authMiddleware, func(c *gin.Context) {
-		minStr := c.PostForm("min_port")
-		maxStr := c.PostForm("max_port")
-		min, err := strconv.Atoi(minStr)
-		if err != nil || min <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的最小端口"})
-			return
-		}
-		max, err := strconv.Atoi(maxStr)
-		if err != nil || max <= 0 || max <= min {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的最大端口"})
-			return
-		}
-		minPort = min
-		maxPort = max
-		viper.Set("port.min", min)
-		viper.Set("port.max", max)
-		if err := viper.WriteConfig(); err != nil {
-			log.Printf("写入配置文件失败: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存端口范围失败"})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"message": "端口范围已更新"})
-	})
+	// 备份
+	registerBackupRoutes(r)
 
-	// 调试：检查所有域名
-	r.GET("/debug-domains", authMiddleware, func(c *gin.Context) {
-		var domains []ServerDomain
-		db.Find(&domains)
-		c.JSON(http.StatusOK, gin.H{"all_domains": domains})
-	})
+	// 全局域名查找
+	registerDomainSearchRoutes(r)
 
-	// 添加结构体
-	type ChinaAccessRequest struct {
-		Host string `json:"host" binding:"required"`
-		Port string `json:"port" binding:"required"`
-	}
+	// 域名状态一致性检查
+	registerConsistencyAuditRoutes(r)
 
-	// 添加路由
-	r.POST("/check-china-access", func(c *gin.Context) {
-		var req ChinaAccessRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效参数"})
-			return
-		}
+	// 域名使用配额
+	registerDomainQuotaRoutes(r)
 
-		hostPort := req.Host + ":" + req.Port
-		accessible, err := isAccessibleFromChina(hostPort)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("检查失败: %v", err)})
-			return
-		}
+	// 系统自检
+	registerSelfCheckRoutes(r)
 
-		c.JSON(http.StatusOK, gin.H{"accessible": accessible})
-	})
+	// 节点流量
+	registerNodeMetricRoutes(r)
 
-	// 启动 cron 任务
-	c := cron.New()
-	c.AddFunc("*/5 * * * *", checkAndUpdateServers)
-	c.Start()
+	// 事件统计
+	registerEventRoutes(r)
 
-	// 启动服务
-	serAddr := viper.GetString("Server.Addr")
-	log.Printf("启动服务于 %s", serAddr)
-	if err := r.Run(serAddr); err != nil {
-		log.Fatal("服务启动失败:", err)
-	}
-}
+	// 通知模板预览
+	registerNotificationTemplateRoutes(r)
 
-// 检查并添加列
-func addColumnIfNotExists(table, column, columnType string) {
-	var count int64
-	db.Raw("SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = ? AND table_name = ? AND column_name = ?", "vpn", table, column).Scan(&count)
-	if count == 0 {
-		if err := db.Exec("ALTER TABLE " + table + " ADD " + column + " " + columnType).Error; err != nil {
-			log.Printf("向表 %s 添加列 %s 失败: %v", table, column, err)
-		} else {
-			log.Printf("向表 %s 添加列 %s 成功", table, column)
-		}
-	}
-}
+	// 租户切换
+	registerTenantRoutes(r)
 
-// 初始化示例数据
-func initSampleData() {
-	var domainCount int64
-	db.Model(&ServerDomain{}).Count(&domainCount)
-	if domainCount > 0 {
-		log.Println("server_domains 表已有数据，跳过示例数据初始化")
-		return
-	}
-	tables := []string{"v2_server_vless", "v2_server_shadowsocks", "v2_server_vmess"}
-	domains := []string{"domain1.com", "domain2.com", "domain3.com", "domain4.com", "321sds.com"}
-	for _, table := range tables {
-		var serverCount int64
-		db.Table(table).Count(&serverCount)
-		if serverCount == 0 {
-			log.Printf("表 %s 无数据，插入示例服务器", table)
-			db.Exec(fmt.Sprintf("INSERT INTO %s (id, name, port, server_port, host, `show`) VALUES (4, '%sServer4', '8080', 8080, '', 1)", table, table))
-		}
-		var serverIDs []int
-		db.Table(table).Select("id").Find(&serverIDs)
-		for _, serverID := range serverIDs {
-			for i, d := range domains {
-				var existingDomain ServerDomain
-				if err := db.Where("server_table = ? AND server_id = ? AND domain = ?", table, serverID, d).First(&existingDomain).Error; err == nil {
-					continue
-				}
-				if err := db.Create(&ServerDomain{
-					ServerTable:  table,
-					ServerID:     serverID,
-					Domain:       d,
-					InUse:        0,
-					Order:        i + 1,
-					LastUsedTime: 0,
-				}).Error; err != nil {
-					log.Printf("插入示例域名 %s 失败: 表=%s, 服务器ID=%d, 错误=%v", d, table, serverID, err)
-				}
-			}
-		}
-	}
-	log.Println("server_domains 示例数据初始化完成")
-}
+	// 域名回收站
+	registerRecycleBinRoutes(r)
+	registerCloneDomainRoutes(r)
 
-// 初始化已使用资源
-func initUsedResources() {
-	if err := db.Model(&ServerDomain{}).Updates(map[string]interface{}{"in_use": 0, "last_used_time": 0}).Error; err != nil {
-		log.Printf("重置 server_domains 失败: %v", err)
-	}
-	tables := []string{"v2_server_vless", "v2_server_shadowsocks", "v2_server_vmess"}
-	for _, table := range tables {
-		var records []struct {
-			ID   int
-			Host string
-		}
-		db.Table(table).Select("id, host").Find(&records)
-		for _, r := range records {
-			if r.Host != "" {
-				if err := db.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND domain = ?", table, r.ID, r.Host).Updates(map[string]interface{}{
-					"in_use":         1,
-					"last_used_time": time.Now().Unix(),
-				}).Error; err != nil {
-					log.Printf("标记域名 %s 为已使用失败: 表=%s, ID=%d, 错误=%v", r.Host, table, r.ID, err)
-				}
-			}
-		}
-	}
-	log.Println("已使用资源初始化完成")
-}
+	// 维护模式开关
+	registerMaintenanceRoutes(r)
 
-// 检查并更新服务器
-func checkAndUpdateServers() {
-	log.Println("运行 checkAndUpdateServers，时间:", time.Now().Format("2006-01-02 15:04:05"))
-	now := time.Now().Unix()
-	tables := []string{"v2_server_vless", "v2_server_shadowsocks", "v2_server_vmess"}
-	for _, table := range tables {
-		var servers []struct {
-			ID             int
-			NextUpdateTime int64
-		}
-		if err := db.Table(table).Where("next_update_time <= ?", now).Find(&servers).Error; err != nil {
-			log.Printf("从表 %s 获取服务器失败: %v", table, err)
-			continue
-		}
-		for _, s := range servers {
-			var err error
-			for attempt := 0; attempt < 3; attempt++ {
-				err = updateServer(table, s.ID, now, true)
-				if err == nil {
-					if updateErr := db.Table(table).Where("id = ?", s.ID).Update("last_update_status", "更新成功").Error; updateErr != nil {
-						log.Printf("更新表 %s, ID=%d 的 last_update_status 失败: %v", table, s.ID, updateErr)
-					}
-					break
-				}
-				log.Printf("尝试 %d 更新服务器失败: 表=%s, ID=%d, 错误=%v", attempt+1, table, s.ID, err)
-			}
-			if err != nil {
-				log.Printf("三次尝试后更新服务器失败: 表=%s, ID=%d, 错误=%v", table, s.ID, err)
-				if updateErr := db.Table(table).Where("id = ?", s.ID).Updates(map[string]interface{}{
-					"last_update_status": "更新失败：" + err.Error(),
-					"next_update_time":   now + int64(updateIntervalHours*3600),
-				}).Error; updateErr != nil {
-					log.Printf("更新表 %s, ID=%d 的 last_update_status 失败: %v", table, s.ID, updateErr)
-				}
-			}
-		}
-	}
-}
+	// DNS 服务商
+	registerDNSProviderRoutes(r)
 
-// 更新单个服务器
-func updateServer(table string, id int, now int64, useOrder bool) error {
-	log.Printf("开始 updateServer: 表=%s, ID=%d, 当前时间=%d, 使用顺序=%v", table, id, now, useOrder)
+	// 会话管理及修改密码
+	registerSessionRoutes(r)
 
-	tx := db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			log.Printf("updateServer 发生恐慌: 表=%s, ID=%d, 错误=%v", table, id, r)
-		}
-	}()
+	// 登录用户管理（仅管理员）
+	registerUserRoutes(r)
 
-	// 获取当前服务器信息
-	var currentServer struct {
-		Port       string
-		ServerPort int
-		Host       string
-	}
-	if err := tx.Table(table).Select("port, server_port, host").Where("id = ?", id).First(&currentServer).Error; err != nil {
-		tx.Rollback()
-		log.Printf("获取当前服务器失败: 表=%s, ID=%d, 错误=%v", table, id, err)
-		return fmt.Errorf("获取服务器数据失败: %v", err)
-	}
-	log.Printf("当前服务器: 表=%s, ID=%d, 端口=%s, 服务器端口=%d, 主机=%s",
-		table, id, currentServer.Port, currentServer.ServerPort, currentServer.Host)
-
-	// 释放当前域名（如果存在），仅设置 in_use=0，不重置 last_used_time
-	if currentServer.Host != "" {
-		var domainCount int64
-		tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND domain = ?", table, id, currentServer.Host).Count(&domainCount)
-		if domainCount == 0 {
-			log.Printf("警告: 当前主机 %s 在 server_domains 中未找到: 表=%s, ID=%d", currentServer.Host, table, id)
-		} else {
-			if err := tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND domain = ?", table, id, currentServer.Host).Update("in_use", 0).Error; err != nil {
-				tx.Rollback()
-				log.Printf("释放域名 %s 失败: 表=%s, ID=%d, 错误=%v", currentServer.Host, table, id, err)
-				return fmt.Errorf("释放域名失败: %v", err)
-			}
-			log.Printf("释放域名 %s 成功: 表=%s, ID=%d", currentServer.Host, table, id)
-		}
-	}
+	// 轮换策略
+	registerPolicyRoutes(r)
 
-	// 获取新的随机端口
-	currentPort := currentServer.ServerPort
-	var nextPort int
-	for i := 0; i < 100; i++ {
-		nextPort = rand.Intn(maxPort-minPort+1) + minPort
-		if nextPort != currentPort {
-			break
-		}
-		if i == 99 {
-			tx.Rollback()
-			log.Printf("无法找到不同的端口: 表=%s, ID=%d", table, id)
-			return errors.New("无法找到不同的端口")
-		}
-	}
-	log.Printf("选择新端口: %d, 表=%s, ID=%d", nextPort, table, id)
-
-	// 获取可用域名，按 last_used_time 升序排序
-	var availableDomains []ServerDomain
-	domainQuery := tx.Select("id, server_table, server_id, domain, in_use, `order`, last_used_time").
-		Where("server_table = ? AND server_id = ? AND in_use = ? AND (last_used_time = 0 OR last_used_time <= ?)",
-			table, id, 0, now-3*3600)
-	if currentServer.Host != "" {
-		domainQuery = domainQuery.Where("domain != ?", currentServer.Host)
-	}
-	domainQuery = domainQuery.Order("last_used_time ASC")
-	if err := domainQuery.Find(&availableDomains).Error; err != nil {
-		tx.Rollback()
-		log.Printf("获取可用域名失败: 表=%s, ID=%d, 错误=%v", table, id, err)
-		return fmt.Errorf("获取可用域名失败: %v", err)
-	}
-	log.Printf("可用域名数: %v, 表=%s, ID=%d", len(availableDomains), table, id)
-	for _, d := range availableDomains {
-		log.Printf("可用域名: %s, in_use=%d, last_used_time=%d", d.Domain, d.InUse, d.LastUsedTime)
-	}
-	if len(availableDomains) == 0 {
-		tx.Rollback()
-		log.Printf("无可用域名（排除当前主机）: 表=%s, ID=%d", table, id)
-		return errors.New("无可用域名")
-	}
+	// 域名封锁统计
+	registerBurnRateRoutes(r)
 
-	// 选择第一个域名（last_used_time 最小）
-	nextDomain := availableDomains[0]
-	log.Printf("选择新域名: %s, 表=%s, ID=%d, last_used_time=%d", nextDomain.Domain, table, id, nextDomain.LastUsedTime)
+	// 主备状态
+	registerHARoutes(r)
 
-	// 更新服务器记录
-	updateFields := map[string]interface{}{
-		"port":             strconv.Itoa(nextPort),
-		"server_port":      nextPort,
-		"host":             nextDomain.Domain,
-		"next_update_time": now + int64(updateIntervalHours*3600),
-	}
-	if err := tx.Table(table).Where("id = ?", id).Updates(updateFields).Error; err != nil {
-		tx.Rollback()
-		log.Printf("更新服务器记录失败: 表=%s, ID=%d, 错误=%v", table, id, err)
-		return fmt.Errorf("更新服务器记录失败: %v", err)
-	}
-	log.Printf("更新服务器记录成功: 表=%s, ID=%d, 端口=%s, 主机=%s, 下次更新时间=%d", table, id, updateFields["port"], nextDomain.Domain, now+int64(updateIntervalHours*3600))
-
-	// 标记新域名为已使用，并更新 last_used_time
-	if err := tx.Model(&ServerDomain{}).Where("id = ?", nextDomain.ID).Updates(map[string]interface{}{
-		"in_use":         1,
-		"last_used_time": now,
-	}).Error; err != nil {
-		tx.Rollback()
-		log.Printf("标记域名 %s 为已使用失败: 表=%s, ID=%d, 错误=%v", nextDomain.Domain, table, id, err)
-		return fmt.Errorf("标记域名失败: %v", err)
-	}
-	log.Printf("标记域名 %s 为已使用成功: 表=%s, ID=%d, last_used_time=%d", nextDomain.Domain, table, id, now)
-
-	// 如果是 cron 任务，更新域名顺序
-	if useOrder {
-		var maxDomainOrder int
-		tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", table, id).Select("MAX(`order`)").Scan(&maxDomainOrder)
-		if err := tx.Model(&ServerDomain{}).Where("id = ?", nextDomain.ID).Update("order", maxDomainOrder+1).Error; err != nil {
-			tx.Rollback()
-			log.Printf("更新域名顺序失败: 表=%s, ID=%d, 错误=%v", table, id, err)
-			return fmt.Errorf("更新域名顺序失败: %v", err)
-		}
-		log.Printf("更新域名顺序到 %d: 域名=%s, 表=%s, ID=%d", maxDomainOrder+1, nextDomain.Domain, table, id)
-	}
+	// 域名部分更新及批量编辑
+	registerDomainPatchRoutes(r)
+	registerBulkEditDomainRoutes(r)
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		log.Printf("提交事务失败: 表=%s, ID=%d, 错误=%v", table, id, err)
-		return fmt.Errorf("事务提交失败: %v", err)
-	}
-	log.Printf("事务提交成功: 表=%s, ID=%d", table, id)
-
-	// 调试：查询更新后的域名状态
-	var updatedDomain ServerDomain
-	if err := db.Where("server_table = ? AND server_id = ? AND domain = ?", table, id, nextDomain.Domain).First(&updatedDomain).Error; err != nil {
-		log.Printf("查询更新后的域名失败: 表=%s, ID=%d, 域名=%s, 错误=%v", table, id, nextDomain.Domain, err)
-	} else {
-		log.Printf("更新后域名状态: 表=%s, ID=%d, 域名=%s, in_use=%d, last_used_time=%d", table, id, updatedDomain.Domain, updatedDomain.InUse, updatedDomain.LastUsedTime)
-	}
+	// 跨服务器重复域名
+	registerDomainConflictRoutes(r)
 
-	return nil
-}
+	// 域名别名
+	registerDomainAliasRoutes(r)
 
-// 认证中间件
-func authMiddleware(c *gin.Context) {
-	session := sessions.Default(c)
-	user := session.Get("user")
-	if user == nil {
-		c.Redirect(http.StatusFound, "/login")
-		c.Abort()
-		return
-	}
-	c.Next()
-}
+	// Prometheus 指标
+	registerPromMetricsRoutes(r)
 
-// 执行单次检查
-func isAccessibleFromChina(host string) (bool, error) {
-	// 创建 Chrome 实例
-	ctx, cancel := chromedp.NewContext(context.Background())
-	defer cancel()
-
-	// 设置超时
-	ctx, cancel = context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-
-	// 存储表格 HTML
-	var tableHTML string
-
-	// 执行浏览器操作
-	err := chromedp.Run(ctx,
-		// 访问页面
-		chromedp.Navigate("https://tcp.ping.pe/"),
-		// 等待页面主体加载
-		chromedp.WaitVisible(`body`, chromedp.ByQuery),
-		// 等待输入框出现
-		chromedp.WaitVisible(`input[name="query"]`, chromedp.ByQuery, chromedp.NodeVisible),
-		// 输入域名和端口
-		chromedp.SetValue(`input[name="query"]`, host, chromedp.ByQuery),
-		// 调试：确认输入框值
-		chromedp.Evaluate(`document.querySelector('input[name="query"]').value`, &host),
-		// 点击提交按钮
-		chromedp.Click(`input#goButton`, chromedp.NodeVisible, chromedp.ByQuery),
-		// 等待结果表格加载
-		chromedp.WaitVisible(`table#megatable`, chromedp.ByQuery, chromedp.NodeVisible),
-		// 等待 AJAX 更新（最多10秒）
-		chromedp.Sleep(10*time.Second),
-		// 提取表格 HTML
-		chromedp.OuterHTML(`table#megatable`, &tableHTML, chromedp.ByQuery),
-	)
-	if err != nil {
-		return false, fmt.Errorf("浏览器操作失败: %v", err)
-	}
+	// 轮换审批
+	registerApprovalRoutes(r)
 
-	// 解析表格
-	lines := strings.Split(tableHTML, "\n")
-	for i, line := range lines {
-		if strings.Contains(strings.ToLower(line), "china") {
-			// 查找状态列（在同一行或下一行的 <span>）
-			for j := i; j < len(lines); j++ {
-				nextLine := strings.ToLower(lines[j])
-				if strings.Contains(nextLine, "tcp-") && strings.Contains(nextLine, "-result") {
-					log.Printf("中国行内容: %s, 状态行: %s", line, nextLine)
-					if strings.Contains(nextLine, "successful") {
-						return true, nil
-					}
-					break
-				}
-			}
-		}
-	}
+	// 服务器模板
+	registerServerTemplateRoutes(r)
+
+	// 时区偏好
+	registerTimeZoneRoutes(r)
+
+	// 服务器异常变更
+	registerAnomalyRoutes(r)
 
-	return false, fmt.Errorf("未找到中国的结果或状态不可访问")
+	// 域名池再平衡
+	registerRebalanceRoutes(r)
+
+	// 轮换重试设置
+	registerRetrySettingRoutes(r)
+
+	// 总览
+	registerSummaryRoutes(r)
+
+	// 域名预热
+	registerDomainStagingRoutes(r)
+
+	// 轮换报告
+	registerReportRoutes(r)
+
+	// 手动释放域名及审计记录
+	registerDomainReleaseRoutes(r)
+	registerAuditRoutes(r)
+
+	// 服务器下线归档及已下线服务器档案
+	registerServerArchiveRoutes(r)
+	registerArchivedServerRoutes(r)
+
+	// 轮换宽限记录
+	registerDomainGraceRoutes(r)
+
+	// 节点 SSH 凭据
+	registerNodeSSHRoutes(r)
+
+	// 轮换耗时分析
+	registerRotationProfileRoutes(r)
+
+	// 声明式清单
+	registerManifestRoutes(r)
+
+	// 破坏性操作的确认令牌
+	registerConfirmationRoutes(r)
+
+	// 从未使用的域名
+	registerUnusedDomainRoutes(r)
+
+	// 健康检查结果
+	registerHealthRoutes(r)
+
+	// 自动购买域名
+	registerRegistrarRoutes(r)
+
+	// 轮换历史（含触发来源及操作者）
+	registerHistoryRoutes(r)
+
+	// 启动定时任务
+	startScheduler(checkCron, reconcileCron)
+
+	// 启动服务
+	serAddr := viper.GetString("Server.Addr")
+	log.Printf("启动服务于 %s", serAddr)
+	if err := http.ListenAndServe(serAddr, basePathHandler(tenantPathHandler(r))); err != nil {
+		log.Fatal("服务启动失败:", err)
+	}
 }
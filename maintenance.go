@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 维护模式状态：开启时暂停定时任务并拒绝所有写操作，保证数据库维护期间面板表不被修改；
+// 状态写入配置文件 maintenance.enabled，重启后保持
+var maintenanceState struct {
+	sync.RWMutex
+	enabled bool
+	reason  string
+	since   int64
+}
+
+// 维护模式下仍允许的非只读请求
+var maintenanceExemptPaths = map[string]bool{
+	"/login":              true,
+	"/logout-all":         true,
+	"/maintenance":        true,
+	"/check-china-access": true,
+}
+
+// 是否处于维护模式
+func inMaintenance() bool {
+	maintenanceState.RLock()
+	defer maintenanceState.RUnlock()
+	return maintenanceState.enabled
+}
+
+// 启动时从配置恢复维护模式状态
+func loadMaintenanceState() {
+	maintenanceState.Lock()
+	defer maintenanceState.Unlock()
+	maintenanceState.enabled = viper.GetBool("maintenance.enabled")
+	maintenanceState.reason = viper.GetString("maintenance.reason")
+	maintenanceState.since = viper.GetInt64("maintenance.since")
+	if maintenanceState.enabled {
+		log.Printf("维护模式已开启（自 %s），定时任务不会运行: %s", time.Unix(maintenanceState.since, 0).Format("2006-01-02 15:04:05"), maintenanceState.reason)
+	}
+}
+
+// 开启或关闭维护模式：开启时停止调度器并等待正在执行的任务结束，关闭时（主节点）恢复调度
+func setMaintenance(enabled bool, reason string) error {
+	maintenanceState.Lock()
+	if maintenanceState.enabled == enabled {
+		maintenanceState.Unlock()
+		return nil
+	}
+	since := int64(0)
+	if enabled {
+		since = time.Now().Unix()
+	} else {
+		reason = ""
+	}
+	viper.Set("maintenance.enabled", enabled)
+	viper.Set("maintenance.reason", reason)
+	viper.Set("maintenance.since", since)
+	if err := writeConfig(); err != nil {
+		maintenanceState.Unlock()
+		return err
+	}
+	maintenanceState.enabled, maintenanceState.reason, maintenanceState.since = enabled, reason, since
+	maintenanceState.Unlock()
+
+	// 释放状态锁后再等待任务结束，正在执行的任务可能需要读取维护状态
+	if enabled {
+		log.Printf("开启维护模式: %s", reason)
+	} else {
+		log.Println("关闭维护模式")
+	}
+	syncScheduler()
+	return nil
+}
+
+// 命令行写操作前检查维护模式（读取配置文件中的状态）
+func requireNoMaintenance() error {
+	if viper.GetBool("maintenance.enabled") {
+		return errors.New("系统维护中，暂不允许修改：" + viper.GetString("maintenance.reason"))
+	}
+	return nil
+}
+
+// 维护模式中间件：仅放行只读请求及登录、维护开关等少数接口
+func maintenanceMiddleware(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	if !inMaintenance() || maintenanceExemptPaths[c.Request.URL.Path] {
+		c.Next()
+		return
+	}
+	maintenanceState.RLock()
+	reason := maintenanceState.reason
+	maintenanceState.RUnlock()
+	msg := "系统维护中，暂不允许修改"
+	if reason != "" {
+		msg += "：" + reason
+	}
+	respondError(c, http.StatusServiceUnavailable, codeMaintenance, msg)
+}
+
+// 注册维护模式路由
+func registerMaintenanceRoutes(r *gin.Engine) {
+	// 查询维护模式状态
+	r.GET("/maintenance", authMiddleware, func(c *gin.Context) {
+		maintenanceState.RLock()
+		defer maintenanceState.RUnlock()
+		c.JSON(http.StatusOK, gin.H{"enabled": maintenanceState.enabled, "reason": maintenanceState.reason, "since": maintenanceState.since})
+	})
+
+	// 开启或关闭维护模式：enabled=1/0，reason 为可选说明
+	r.POST("/maintenance", authMiddleware, func(c *gin.Context) {
+		var enabled bool
+		switch c.PostForm("enabled") {
+		case "1", "true":
+			enabled = true
+		case "0", "false":
+		default:
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "enabled 只能为 1 或 0")
+			return
+		}
+		if err := setMaintenance(enabled, c.PostForm("reason")); err != nil {
+			log.Printf("切换维护模式失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "切换维护模式失败："+err.Error())
+			return
+		}
+		if enabled {
+			c.JSON(http.StatusOK, gin.H{"message": "维护模式已开启", "enabled": true})
+		} else {
+			c.JSON(http.StatusOK, gin.H{"message": "维护模式已关闭", "enabled": false})
+		}
+	})
+}
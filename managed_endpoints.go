@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// 面板（V2Board）服务器表
+var panelServerTables = []string{"v2_server_vless", "v2_server_shadowsocks", "v2_server_vmess"}
+
+// 托管端点类型
+const (
+	endpointTypeTable = "table" // 租户数据库中的任意表，列名通过 [columns.<表名>] 映射
+	endpointTypeFile  = "file"  // JSON/YAML 文件中的服务器列表（如 sing-box outbounds），镜像到 endpoint_<名称> 表
+)
+
+// ManagedEndpoint 托管端点：在三张面板表之外轮换主机和端口的服务器集合，配置于 [endpoints.<名称>]
+type ManagedEndpoint struct {
+	Name   string
+	Type   string
+	Tenant string
+	Table  string // 轮换使用的表：table 类型为配置的表名，file 类型为 endpoint_<名称>
+	// 以下仅 file 类型
+	Path      string
+	Format    string // json 或 yaml，默认按扩展名判断
+	List      string // 服务器数组所在的路径，以 . 分隔，为空表示文件本身是数组
+	KeyField  string // 条目名称字段，用于与表中的行对应，默认 tag
+	HostField string // 主机字段，默认 server
+	PortField string // 端口字段，默认 server_port
+}
+
+var (
+	endpointsOnce    sync.Once
+	managedEndpoints map[string]*ManagedEndpoint // 表名 -> 端点
+)
+
+// 加载 [endpoints.<名称>] 配置，无效的端点记录日志后忽略
+func loadManagedEndpoints() {
+	managedEndpoints = map[string]*ManagedEndpoint{}
+	for name := range viper.GetStringMap("endpoints") {
+		cfg := viper.Sub("endpoints." + name)
+		if cfg == nil {
+			continue
+		}
+		ep, err := newManagedEndpoint(name, cfg)
+		if err != nil {
+			log.Printf("托管端点 %s 配置无效: %v", name, err)
+			continue
+		}
+		managedEndpoints[ep.Table] = ep
+		log.Printf("已加载托管端点: 名称=%s, 类型=%s, 租户=%s, 表=%s", ep.Name, ep.Type, ep.Tenant, ep.Table)
+	}
+}
+
+func newManagedEndpoint(name string, cfg *viper.Viper) (*ManagedEndpoint, error) {
+	if !columnNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("名称只能包含小写字母、数字和下划线")
+	}
+	ep := &ManagedEndpoint{Name: name, Type: cfg.GetString("type"), Tenant: cfg.GetString("tenant")}
+	if ep.Tenant == "" {
+		ep.Tenant = defaultTenantName
+	}
+	switch ep.Type {
+	case endpointTypeTable:
+		ep.Table = cfg.GetString("table")
+		if !columnNamePattern.MatchString(ep.Table) {
+			return nil, fmt.Errorf("无效的表名 %q", ep.Table)
+		}
+		for _, t := range panelServerTables {
+			if t == ep.Table {
+				return nil, fmt.Errorf("表 %s 已由面板管理", ep.Table)
+			}
+		}
+	case endpointTypeFile:
+		ep.Table = "endpoint_" + name
+		ep.Path = cfg.GetString("path")
+		if ep.Path == "" {
+			return nil, fmt.Errorf("缺少 path")
+		}
+		ep.Format = cfg.GetString("format")
+		if ep.Format == "" {
+			ep.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(ep.Path)), ".")
+			if ep.Format == "yml" {
+				ep.Format = "yaml"
+			}
+		}
+		if ep.Format != "json" && ep.Format != "yaml" {
+			return nil, fmt.Errorf("不支持的文件格式 %q（可选 json, yaml）", ep.Format)
+		}
+		ep.List = cfg.GetString("list")
+		ep.KeyField = stringOr(cfg.GetString("key"), "tag")
+		ep.HostField = stringOr(cfg.GetString("host"), "server")
+		ep.PortField = stringOr(cfg.GetString("port"), "server_port")
+	default:
+		return nil, fmt.Errorf("不支持的类型 %q（可选 table, file）", ep.Type)
+	}
+	return ep, nil
+}
+
+func stringOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// 表对应的托管端点，不是托管表时返回 nil
+func managedEndpoint(table string) *ManagedEndpoint {
+	endpointsOnce.Do(loadManagedEndpoints)
+	return managedEndpoints[table]
+}
+
+// 按配置列出租户的服务器表，由 serverTables 缓存
+func tenantServerTables(t *Tenant) []string {
+	endpointsOnce.Do(loadManagedEndpoints)
+	tables := append([]string{}, panelServerTables...)
+	var managed []string
+	for table, ep := range managedEndpoints {
+		if ep.Tenant == t.Name {
+			managed = append(managed, table)
+		}
+	}
+	sort.Strings(managed)
+	return append(tables, managed...)
+}
+
+// EndpointRow 结构体，file 类型端点在租户数据库中的镜像表（endpoint_<名称>），列与面板服务器表一致
+type EndpointRow struct {
+	ID                   int    `gorm:"primaryKey"`
+	Name                 string `gorm:"column:name;type:varchar(255);not null"`
+	Port                 string `gorm:"column:port;type:varchar(16);default:''"`
+	ServerPort           int    `gorm:"column:server_port;default:0"`
+	Host                 string `gorm:"column:host;type:varchar(255);default:''"`
+	Show                 bool   `gorm:"column:show;default:true"`
+	NextUpdateTime       int64  `gorm:"column:next_update_time;default:0"`
+	LastUpdateStatus     string `gorm:"column:last_update_status;type:varchar(255);default:''"`
+	LastUpdateStatusCode string `gorm:"column:last_update_status_code;type:varchar(32);default:''"`
+}
+
+// 准备租户的托管端点表：table 类型补齐轮换所需的列（无 server_port 列时与 port 共用），
+// file 类型创建镜像表并导入文件中新增的条目
+func migrateManagedEndpoints(t *Tenant) {
+	for _, table := range serverTables(t)[len(panelServerTables):] {
+		ep := managedEndpoint(table)
+		if ep.Type == endpointTypeFile {
+			if err := t.DB.Table(table).AutoMigrate(&EndpointRow{}); err != nil {
+				log.Fatalf("创建托管端点表 %s 失败: 租户=%s, 错误=%v", table, t.Name, err)
+			}
+			if n, err := importEndpointFile(t, ep); err != nil {
+				log.Printf("导入托管端点文件失败: 端点=%s, 文件=%s, 错误=%v", ep.Name, ep.Path, err)
+			} else if n > 0 {
+				log.Printf("已从文件导入 %d 个托管端点条目: 端点=%s, 文件=%s", n, ep.Name, ep.Path)
+			}
+			continue
+		}
+		if !t.DB.Migrator().HasTable(table) {
+			log.Printf("托管端点表 %s 不存在: 租户=%s", table, t.Name)
+			continue
+		}
+		if !t.DB.Migrator().HasColumn(table, serverColumn(table, "server_port")) {
+			viper.SetDefault("columns."+table+".server_port", serverColumn(table, "port"))
+		}
+		addColumnIfNotExists(t.DB, table, serverColumn(table, "show"), "TINYINT DEFAULT 1")
+	}
+}
+
+// 读取端点文件，返回整个文档及服务器数组
+func readEndpointFile(ep *ManagedEndpoint) (interface{}, []interface{}, error) {
+	data, err := os.ReadFile(ep.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc interface{}
+	if ep.Format == "yaml" {
+		err = yaml.Unmarshal(data, &doc)
+	} else {
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析文件失败: %v", err)
+	}
+	node := doc
+	if ep.List != "" {
+		for _, key := range strings.Split(ep.List, ".") {
+			m, ok := node.(map[string]interface{})
+			if !ok {
+				return nil, nil, fmt.Errorf("路径 %s 不存在", ep.List)
+			}
+			node = m[key]
+		}
+	}
+	list, ok := node.([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("路径 %q 不是数组", ep.List)
+	}
+	return doc, list, nil
+}
+
+// 条目的字符串字段
+func entryString(entry map[string]interface{}, field string) string {
+	switch v := entry[field].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// 将文件中尚未镜像的条目导入镜像表（按名称字段对应），已有的行以表为准，返回导入条数
+func importEndpointFile(t *Tenant, ep *ManagedEndpoint) (int, error) {
+	_, list, err := readEndpointFile(ep)
+	if err != nil {
+		return 0, err
+	}
+	var existing []string
+	if err := t.DB.Table(ep.Table).Pluck("name", &existing).Error; err != nil {
+		return 0, err
+	}
+	known := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		known[name] = true
+	}
+	imported := 0
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// 没有主机字段的条目（如 direct、block 等出站）不参与轮换
+		name := entryString(entry, ep.KeyField)
+		if name == "" || known[name] || entryString(entry, ep.HostField) == "" {
+			continue
+		}
+		port, _ := strconv.Atoi(entryString(entry, ep.PortField))
+		row := EndpointRow{Name: name, Port: strconv.Itoa(port), ServerPort: port, Host: entryString(entry, ep.HostField), Show: true}
+		if err := t.DB.Table(ep.Table).Create(&row).Error; err != nil {
+			return imported, err
+		}
+		known[name] = true
+		imported++
+	}
+	return imported, nil
+}
+
+// 将镜像表中的主机和端口写回端点文件，只修改主机和端口字段，先写临时文件再替换
+func writeEndpointFile(t *Tenant, ep *ManagedEndpoint) error {
+	var rows []EndpointRow
+	if err := t.DB.Table(ep.Table).Find(&rows).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]EndpointRow, len(rows))
+	for _, r := range rows {
+		byName[r.Name] = r
+	}
+	doc, list, err := readEndpointFile(ep)
+	if err != nil {
+		return err
+	}
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if r, ok := byName[entryString(entry, ep.KeyField)]; ok && r.Host != "" {
+			entry[ep.HostField] = r.Host
+			entry[ep.PortField] = r.ServerPort
+		}
+	}
+	var data []byte
+	if ep.Format == "yaml" {
+		data, err = yaml.Marshal(doc)
+	} else {
+		data, err = json.MarshalIndent(doc, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	tmp := ep.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ep.Path)
+}
+
+// 轮换后同步到服务器的来源：file 类型端点写回文件，面板表回写 V2Board，table 类型端点无需额外处理
+func syncRotatedServer(t *Tenant, table string, id int, host string, port int) error {
+	ep := managedEndpoint(table)
+	if ep == nil {
+		return pushServerToV2board(t, table, id, host, port)
+	}
+	if ep.Type == endpointTypeFile {
+		return writeEndpointFile(t, ep)
+	}
+	return nil
+}
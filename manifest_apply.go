@@ -0,0 +1,585 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// 声明式清单：以 YAML（JSON 亦可）描述服务器、域名池、标签及轮换策略，apply 时把数据库调整为清单描述的状态，
+// 便于将整个节点群的配置放在 Git 中管理。清单中省略的字段保持不变；prune_domains 为 true 时退役清单中未列出的域名；
+// 演练（dry run）只返回将要执行的修改，不写入数据库
+
+// 清单移除的域名的退役原因
+const manifestRetiredReason = "清单中已移除"
+
+// Manifest 清单
+type Manifest struct {
+	Servers []ManifestServer `yaml:"servers"`
+}
+
+// ManifestServer 清单中的服务器：id 为 0 时按 name 在表中查找，不存在时按 template 新建并立即轮换
+type ManifestServer struct {
+	Table         string           `yaml:"table"`
+	ID            int              `yaml:"id"`
+	Name          string           `yaml:"name"`
+	Template      string           `yaml:"template"`
+	Archived      bool             `yaml:"archived"` // true 时下线归档（隐藏并退役全部域名），已归档的服务器不能通过清单恢复
+	Tags          *[]string        `yaml:"tags"`
+	IntervalHours *int             `yaml:"interval_hours"` // 0 表示使用全局配置
+	NodeIP        *string          `yaml:"node_ip"`        // 空字符串表示删除节点 IP
+	Policy        *[]PolicyRule    `yaml:"policy"`         // 空列表表示删除轮换策略
+	Domains       []ManifestDomain `yaml:"domains"`
+	PruneDomains  bool             `yaml:"prune_domains"`
+
+	policyJSON string // 校验后规范化的策略规则
+}
+
+// ManifestDomain 清单中的域名
+type ManifestDomain struct {
+	Domain    string    `yaml:"domain"`
+	Tags      *[]string `yaml:"tags"`
+	Note      *string   `yaml:"note"`
+	CDN       *bool     `yaml:"cdn"`
+	Protected *bool     `yaml:"protected"`
+	Retired   *bool     `yaml:"retired"`
+}
+
+// ApplyChange 清单应用中的一项修改
+type ApplyChange struct {
+	Server string `json:"server"` // 表名:ID，待新建的服务器为 表名:名称
+	Kind   string `json:"kind"`   // server、setting、node_ip、policy、domain
+	Target string `json:"target,omitempty"`
+	Action string `json:"action"` // create、update、delete、retire、archive、rotate
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ApplyResult 清单应用结果
+type ApplyResult struct {
+	DryRun  bool          `json:"dry_run"`
+	Changes []ApplyChange `json:"changes"`
+	Failed  int           `json:"failed"`
+}
+
+// 标签列表转换为规范化的逗号分隔形式
+func manifestTags(tags []string) string {
+	return normalizeTags(strings.Join(tags, ","))
+}
+
+func boolInt8(b bool) int8 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// 解析清单，拒绝未知字段以便发现拼写错误
+func parseManifest(data []byte) (Manifest, error) {
+	var m Manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		if errors.Is(err, io.EOF) {
+			return m, errors.New("清单为空")
+		}
+		return m, fmt.Errorf("清单格式无效: %v", err)
+	}
+	return m, nil
+}
+
+// 校验清单并规范化域名、策略，返回各项问题（位置 -> 原因）
+func validateManifest(m *Manifest) map[string]string {
+	errs := map[string]string{}
+	seen := map[string]bool{}
+	for i := range m.Servers {
+		s := &m.Servers[i]
+		at := fmt.Sprintf("servers[%d]", i)
+		if !isValidServerTable(s.Table) {
+			errs[at+".table"] = "无效的表名"
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", s.Table, s.ID)
+		switch {
+		case s.ID < 0:
+			errs[at+".id"] = "无效的服务器ID"
+		case s.ID == 0 && strings.TrimSpace(s.Name) == "":
+			errs[at+".name"] = "未指定 id 时 name 不能为空"
+		case s.ID == 0:
+			key = s.Table + ":" + s.Name
+		}
+		if seen[key] {
+			errs[at] = "服务器重复：" + key
+		}
+		seen[key] = true
+		if s.Tags != nil && len(manifestTags(*s.Tags)) > 255 {
+			errs[at+".tags"] = "标签过长（最多 255 字节）"
+		}
+		if s.IntervalHours != nil && *s.IntervalHours < 0 {
+			errs[at+".interval_hours"] = "不能为负数"
+		}
+		if s.NodeIP != nil && *s.NodeIP != "" && net.ParseIP(*s.NodeIP) == nil {
+			errs[at+".node_ip"] = "无效的 IP 地址"
+		}
+		if s.Policy != nil && len(*s.Policy) > 0 {
+			data, _ := json.Marshal(*s.Policy)
+			rules, err := parsePolicyRules(string(data))
+			if err != nil {
+				errs[at+".policy"] = err.Error()
+			} else {
+				data, _ = json.Marshal(rules)
+				s.policyJSON = string(data)
+			}
+		}
+		domains := map[string]bool{}
+		for j := range s.Domains {
+			d := &s.Domains[j]
+			dat := fmt.Sprintf("%s.domains[%d]", at, j)
+			domain, err := normalizeDomain(d.Domain)
+			if err != nil {
+				errs[dat] = err.Error()
+				continue
+			}
+			if domains[domain] {
+				errs[dat] = "域名重复：" + domain
+			}
+			domains[domain] = true
+			d.Domain = domain
+			if d.Tags != nil && len(manifestTags(*d.Tags)) > 255 {
+				errs[dat+".tags"] = "标签过长（最多 255 字节）"
+			}
+			if d.Note != nil && len(*d.Note) > 1024 {
+				errs[dat+".note"] = "备注过长（最多 1024 字节）"
+			}
+		}
+	}
+	return errs
+}
+
+// 与现有域名比较，只包含需要修改的字段
+func (d ManifestDomain) patch(existing ServerDomain) DomainPatch {
+	var p DomainPatch
+	if d.Tags != nil {
+		if tags := manifestTags(*d.Tags); tags != existing.Tags {
+			p.Tags = &tags
+		}
+	}
+	if d.Note != nil && *d.Note != existing.Note {
+		p.Note = d.Note
+	}
+	if d.CDN != nil {
+		if v := boolInt8(*d.CDN); v != existing.CDN {
+			p.CDN = &v
+		}
+	}
+	if d.Protected != nil {
+		if v := boolInt8(*d.Protected); v != existing.Protected {
+			p.Protected = &v
+		}
+	}
+	if d.Retired != nil {
+		if v := boolInt8(*d.Retired); v != existing.Retired {
+			p.Retired = &v
+			if v == 1 {
+				reason := manifestRetiredReason
+				p.RetiredReason = &reason
+			}
+		}
+	}
+	return p
+}
+
+// 字段级错误合并为一条说明
+func joinFieldErrors(errs map[string]string) error {
+	parts := make([]string, 0, len(errs))
+	for field, msg := range errs {
+		parts = append(parts, field+": "+msg)
+	}
+	sort.Strings(parts)
+	return errors.New(strings.Join(parts, "; "))
+}
+
+// 待更新字段名，按字母排序
+func updateKeys(updates map[string]interface{}) string {
+	keys := make([]string, 0, len(updates))
+	for k := range updates {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// 清单应用过程
+type manifestApplier struct {
+	t        *Tenant
+	dryRun   bool
+	cause    RotationCause
+	now      int64
+	archived map[string]bool
+	result   ApplyResult
+}
+
+// 记录一项修改，非演练时执行 apply
+func (a *manifestApplier) change(c ApplyChange, apply func() error) bool {
+	var err error
+	if !a.dryRun && apply != nil {
+		err = apply()
+	}
+	return a.record(c, err)
+}
+
+// 记录一项无法执行的修改
+func (a *manifestApplier) fail(c ApplyChange, err error) {
+	a.record(c, err)
+}
+
+func (a *manifestApplier) record(c ApplyChange, err error) bool {
+	if err != nil {
+		c.Error = err.Error()
+		a.result.Failed++
+		log.Printf("应用清单修改失败: 租户=%s, 服务器=%s, 类型=%s, 对象=%s, 操作=%s, 错误=%v", a.t.Name, c.Server, c.Kind, c.Target, c.Action, err)
+	}
+	a.result.Changes = append(a.result.Changes, c)
+	return err == nil
+}
+
+// 按清单调整单台服务器
+func (a *manifestApplier) applyServer(s ManifestServer) {
+	t := a.t
+	id := s.ID
+	ref := fmt.Sprintf("%s:%d", s.Table, id)
+	if id > 0 {
+		if exists, err := serverExists(t, s.Table, id); err != nil || !exists {
+			a.fail(ApplyChange{Server: ref, Kind: "server", Action: "update"}, errors.New("服务器不存在"))
+			return
+		}
+	} else {
+		var ids []int
+		if err := t.DB.Table(s.Table).Where(serverCond(s.Table, "name"), s.Name).Pluck("id", &ids).Error; err != nil {
+			a.fail(ApplyChange{Server: s.Table + ":" + s.Name, Kind: "server", Action: "update"}, fmt.Errorf("查找服务器失败: %v", err))
+			return
+		}
+		switch len(ids) {
+		case 0:
+			if s.Archived {
+				return
+			}
+			var ok bool
+			if id, ok = a.createServer(s); !ok || a.dryRun {
+				return
+			}
+			ref = fmt.Sprintf("%s:%d", s.Table, id)
+			defer func() {
+				a.change(ApplyChange{Server: ref, Kind: "server", Action: "rotate"}, func() error {
+					return rotateServerNow(t, s.Table, id, a.cause)
+				})
+			}()
+		case 1:
+			id = ids[0]
+			ref = fmt.Sprintf("%s:%d", s.Table, id)
+		default:
+			a.fail(ApplyChange{Server: s.Table + ":" + s.Name, Kind: "server", Action: "update"}, fmt.Errorf("表中有 %d 台同名服务器，请改用 id 指定", len(ids)))
+			return
+		}
+	}
+
+	archived := a.archived[ref]
+	if s.Archived {
+		if !archived {
+			a.change(ApplyChange{Server: ref, Kind: "server", Action: "archive", Detail: "隐藏并退役全部域名"}, func() error {
+				_, err := archiveServer(t, s.Table, id, archiveModeHide, archiveDomainsRetire, "", 0, a.cause.Actor)
+				return err
+			})
+		}
+		return
+	}
+	if archived {
+		a.fail(ApplyChange{Server: ref, Kind: "server", Action: "update"}, errors.New("服务器已下线归档，不能通过清单恢复"))
+		return
+	}
+
+	a.applySetting(ref, s, id)
+	a.applyNodeIP(ref, s, id)
+	a.applyPolicy(ref, s, id)
+	if s.Domains != nil || s.PruneDomains {
+		a.applyDomains(ref, s, id)
+	}
+}
+
+// 按模板新建服务器，域名池为清单中的域名
+func (a *manifestApplier) createServer(s ManifestServer) (int, bool) {
+	c := ApplyChange{Server: s.Table + ":" + s.Name, Kind: "server", Target: s.Name, Action: "create"}
+	if s.Template == "" {
+		a.fail(c, errors.New("服务器不存在且未指定 template"))
+		return 0, false
+	}
+	var tpl ServerTemplate
+	if err := a.t.DB.Where("name = ?", s.Template).First(&tpl).Error; err != nil {
+		a.fail(c, fmt.Errorf("模板 %s 不存在", s.Template))
+		return 0, false
+	}
+	if tpl.ServerTable != s.Table {
+		a.fail(c, fmt.Errorf("模板 %s 的表为 %s，与清单中的 %s 不一致", tpl.Name, tpl.ServerTable, s.Table))
+		return 0, false
+	}
+	domains := make([]string, len(s.Domains))
+	for i, d := range s.Domains {
+		domains[i] = d.Domain
+	}
+	c.Detail = fmt.Sprintf("模板=%s, 清单域名 %d 个", tpl.Name, len(domains))
+	var id int
+	ok := a.change(c, func() error {
+		var err error
+		id, err = createServerFromTemplate(a.t, tpl, NewServerRequest{Template: tpl.Name, Name: s.Name, Domains: domains})
+		return err
+	})
+	return id, ok
+}
+
+// 调整服务器标签及轮换间隔
+func (a *manifestApplier) applySetting(ref string, s ManifestServer, id int) {
+	setting := loadServerSetting(a.t.DB, s.Table, id)
+	var diffs []string
+	if s.Tags != nil {
+		if tags := manifestTags(*s.Tags); tags != setting.Tags {
+			diffs = append(diffs, fmt.Sprintf("tags: %q -> %q", setting.Tags, tags))
+			setting.Tags = tags
+		}
+	}
+	if s.IntervalHours != nil && *s.IntervalHours != setting.IntervalHours {
+		diffs = append(diffs, fmt.Sprintf("interval_hours: %d -> %d", setting.IntervalHours, *s.IntervalHours))
+		setting.IntervalHours = *s.IntervalHours
+	}
+	if len(diffs) == 0 {
+		return
+	}
+	a.change(ApplyChange{Server: ref, Kind: "setting", Action: "update", Detail: strings.Join(diffs, "; ")}, func() error {
+		return a.t.DB.Save(&setting).Error
+	})
+}
+
+// 调整节点 IP
+func (a *manifestApplier) applyNodeIP(ref string, s ManifestServer, id int) {
+	if s.NodeIP == nil {
+		return
+	}
+	ip := *s.NodeIP
+	var node ServerNode
+	err := a.t.DB.Where("server_table = ? AND server_id = ?", s.Table, id).First(&node).Error
+	exists := err == nil
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		a.fail(ApplyChange{Server: ref, Kind: "node_ip", Action: "update"}, err)
+	case ip == "" && exists:
+		a.change(ApplyChange{Server: ref, Kind: "node_ip", Target: node.IP, Action: "delete"}, func() error {
+			return a.t.DB.Delete(&ServerNode{}, node.ID).Error
+		})
+	case ip != "" && node.IP != ip:
+		action, detail := "update", node.IP+" -> "+ip
+		if !exists {
+			action, detail = "create", ""
+			node = ServerNode{ServerTable: s.Table, ServerID: id}
+		}
+		node.IP = ip
+		a.change(ApplyChange{Server: ref, Kind: "node_ip", Target: ip, Action: action, Detail: detail}, func() error {
+			return a.t.DB.Save(&node).Error
+		})
+	}
+}
+
+// 调整轮换策略
+func (a *manifestApplier) applyPolicy(ref string, s ManifestServer, id int) {
+	if s.Policy == nil {
+		return
+	}
+	var policy RotationPolicy
+	err := a.t.DB.Where("server_table = ? AND server_id = ?", s.Table, id).First(&policy).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		a.fail(ApplyChange{Server: ref, Kind: "policy", Action: "update"}, err)
+		return
+	}
+	exists := err == nil
+	if s.policyJSON == "" {
+		if exists {
+			a.change(ApplyChange{Server: ref, Kind: "policy", Action: "delete"}, func() error {
+				return a.t.DB.Delete(&RotationPolicy{}, policy.ID).Error
+			})
+		}
+		return
+	}
+	current := policy.Rules
+	if rules, err := parsePolicyRules(policy.Rules); err == nil && len(rules) > 0 {
+		data, _ := json.Marshal(rules)
+		current = string(data)
+	}
+	if exists && current == s.policyJSON {
+		return
+	}
+	action := "update"
+	if !exists {
+		action = "create"
+		policy = RotationPolicy{ServerTable: s.Table, ServerID: id}
+	}
+	policy.Rules = s.policyJSON
+	a.change(ApplyChange{Server: ref, Kind: "policy", Action: action, Detail: s.policyJSON}, func() error {
+		return a.t.DB.Save(&policy).Error
+	})
+}
+
+// 调整域名池：添加缺少的域名、修改域名属性，prune_domains 时退役清单中未列出的域名
+func (a *manifestApplier) applyDomains(ref string, s ManifestServer, id int) {
+	t := a.t
+	var existing []ServerDomain
+	if err := t.DB.Where("server_table = ? AND server_id = ?", s.Table, id).Order("`order`").Find(&existing).Error; err != nil {
+		a.fail(ApplyChange{Server: ref, Kind: "domain", Action: "update"}, err)
+		return
+	}
+	meta, err := loadServerMeta(t, s.Table, id)
+	if err != nil {
+		a.fail(ApplyChange{Server: ref, Kind: "domain", Action: "update"}, err)
+		return
+	}
+	host := meta.Host
+	byName := make(map[string]ServerDomain, len(existing))
+	for _, d := range existing {
+		byName[d.Domain] = d
+	}
+	update := func(domain ServerDomain, patch DomainPatch) error {
+		updates, errs := patch.updates(domain, host, a.now)
+		if len(errs) > 0 {
+			return joinFieldErrors(errs)
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return t.DB.Model(&ServerDomain{}).Where("id = ?", domain.ID).Updates(updates).Error
+	}
+
+	listed := map[string]bool{}
+	for _, md := range s.Domains {
+		listed[md.Domain] = true
+		domain, ok := byName[md.Domain]
+		if !ok {
+			a.change(ApplyChange{Server: ref, Kind: "domain", Target: md.Domain, Action: "create"}, func() error {
+				if err := addServerDomain(t, s.Table, id, md.Domain); err != nil {
+					return err
+				}
+				if err := t.DB.Where("server_table = ? AND server_id = ? AND domain = ?", s.Table, id, md.Domain).First(&domain).Error; err != nil {
+					return err
+				}
+				return update(domain, md.patch(domain))
+			})
+			continue
+		}
+		patch := md.patch(domain)
+		updates, errs := patch.updates(domain, host, a.now)
+		c := ApplyChange{Server: ref, Kind: "domain", Target: md.Domain, Action: "update"}
+		if patch.Retired != nil && *patch.Retired == 1 {
+			c.Action = "retire"
+		}
+		if len(errs) > 0 {
+			a.fail(c, joinFieldErrors(errs))
+			continue
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		c.Detail = "字段=" + updateKeys(updates)
+		a.change(c, func() error {
+			return t.DB.Model(&ServerDomain{}).Where("id = ?", domain.ID).Updates(updates).Error
+		})
+	}
+
+	if !s.PruneDomains {
+		return
+	}
+	for _, domain := range existing {
+		if listed[domain.Domain] || domain.Retired == 1 {
+			continue
+		}
+		retired, reason := int8(1), manifestRetiredReason
+		patch := DomainPatch{Retired: &retired, RetiredReason: &reason}
+		c := ApplyChange{Server: ref, Kind: "domain", Target: domain.Domain, Action: "retire", Detail: reason}
+		if _, errs := patch.updates(domain, host, a.now); len(errs) > 0 {
+			a.fail(c, joinFieldErrors(errs))
+			continue
+		}
+		a.change(c, func() error { return update(domain, patch) })
+	}
+}
+
+// 应用清单：逐台服务器调整，单项修改失败不影响其余修改；非演练时写入审计日志
+func applyManifest(t *Tenant, m Manifest, dryRun bool, cause RotationCause, ip string) ApplyResult {
+	a := &manifestApplier{
+		t:        t,
+		dryRun:   dryRun,
+		cause:    cause,
+		now:      time.Now().Unix(),
+		archived: archivedServers(t.DB),
+		result:   ApplyResult{DryRun: dryRun, Changes: []ApplyChange{}},
+	}
+	for _, s := range m.Servers {
+		a.applyServer(s)
+	}
+	if !dryRun {
+		recordAudit(t.DB, "apply_manifest", "", cause.Actor, ip, fmt.Sprintf("服务器=%d, 修改=%d, 失败=%d", len(m.Servers), len(a.result.Changes), a.result.Failed))
+		log.Printf("清单已应用: 租户=%s, 服务器=%d, 修改=%d, 失败=%d", t.Name, len(m.Servers), len(a.result.Changes), a.result.Failed)
+	}
+	return a.result
+}
+
+// 结果中的破坏性修改：归档服务器、删除节点 IP 或策略、退役域名
+func destructiveChanges(result ApplyResult) []ApplyChange {
+	var changes []ApplyChange
+	for _, c := range result.Changes {
+		switch c.Action {
+		case "archive", "delete", "retire":
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// 注册清单应用路由
+func registerManifestRoutes(r *gin.Engine) {
+	// 应用声明式清单：请求体为 YAML 或 JSON，dry_run=1 时只返回将要执行的修改；
+	// 清单校验失败时不做任何修改，单项修改失败时其余修改照常执行，响应中 failed 为失败项数。
+	// 包含破坏性修改（归档、删除、退役）时须携带 apply-manifest 确认令牌，演练不需要
+	r.POST("/api/v1/apply", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		body, err := c.GetRawData()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "读取请求失败")
+			return
+		}
+		m, err := parseManifest(body)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+			return
+		}
+		if errs := validateManifest(&m); len(errs) > 0 {
+			respondError(c, http.StatusBadRequest, codeValidationFailed, "清单校验失败", errs)
+			return
+		}
+		dryRun := c.Query("dry_run") == "1"
+		if !dryRun {
+			if plan := applyManifest(t, m, true, requestCause(c), c.ClientIP()); len(destructiveChanges(plan)) > 0 && !consumeConfirmToken(c, confirmApplyManifest) {
+				return
+			}
+		}
+		result := applyManifest(t, m, dryRun, requestCause(c), c.ClientIP())
+		c.JSON(http.StatusOK, result)
+	})
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// NodeMetric 结构体，节点代理上报的流量计数及连接数
+type NodeMetric struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	ServerTable   string `gorm:"column:server_table;type:varchar(255);index:idx_node_metrics_server;not null" json:"server_table"`
+	ServerID      int    `gorm:"column:server_id;index:idx_node_metrics_server;not null" json:"server_id"`
+	UploadBytes   int64  `gorm:"column:upload_bytes;default:0" json:"upload_bytes"`
+	DownloadBytes int64  `gorm:"column:download_bytes;default:0" json:"download_bytes"`
+	UploadDelta   int64  `gorm:"column:upload_delta;default:0" json:"upload_delta"`
+	DownloadDelta int64  `gorm:"column:download_delta;default:0" json:"download_delta"`
+	Connections   int    `gorm:"column:connections;default:0" json:"connections"`
+	OnlineUsers   *int   `gorm:"column:online_users" json:"online_users"` // 在线用户数，节点未上报时为空
+	ReportedAt    int64  `gorm:"column:reported_at;index:idx_node_metrics_server;not null" json:"reported_at"`
+}
+
+// 节点上报请求，upload/download 为累计计数（节点重启后可归零）
+type nodeMetricRequest struct {
+	Table         string `json:"table" binding:"required"`
+	ID            int    `json:"id" binding:"required"`
+	UploadBytes   int64  `json:"upload_bytes"`
+	DownloadBytes int64  `json:"download_bytes"`
+	Connections   int    `json:"connections"`
+	OnlineUsers   *int   `json:"online_users"` // 可选
+}
+
+// TrafficSummary 服务器流量摘要
+type TrafficSummary struct {
+	LastHour    int64 `json:"last_hour"`
+	PrevHour    int64 `json:"prev_hour"`
+	Connections int   `json:"connections"`
+	ReportedAt  int64 `json:"reported_at"`
+}
+
+// 计数增量，计数回退（节点重启）时以当前值作为增量
+func counterDelta(prev, cur int64) int64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	return cur
+}
+
+// 保存节点上报的流量数据
+func ingestNodeMetric(tdb *gorm.DB, req nodeMetricRequest, now int64) (NodeMetric, error) {
+	metric := NodeMetric{
+		ServerTable:   req.Table,
+		ServerID:      req.ID,
+		UploadBytes:   req.UploadBytes,
+		DownloadBytes: req.DownloadBytes,
+		Connections:   req.Connections,
+		OnlineUsers:   req.OnlineUsers,
+		ReportedAt:    now,
+	}
+	var prev NodeMetric
+	if err := tdb.Where("server_table = ? AND server_id = ?", req.Table, req.ID).Order("reported_at DESC, id DESC").First(&prev).Error; err == nil {
+		metric.UploadDelta = counterDelta(prev.UploadBytes, req.UploadBytes)
+		metric.DownloadDelta = counterDelta(prev.DownloadBytes, req.DownloadBytes)
+	}
+	err := tdb.Create(&metric).Error
+	return metric, err
+}
+
+// 统计服务器最近一小时及前一小时的流量
+func trafficSummary(tdb *gorm.DB, table string, id int, now int64) TrafficSummary {
+	var summary TrafficSummary
+	tdb.Model(&NodeMetric{}).Where("server_table = ? AND server_id = ? AND reported_at > ?", table, id, now-3600).
+		Select("COALESCE(SUM(upload_delta + download_delta), 0)").Scan(&summary.LastHour)
+	tdb.Model(&NodeMetric{}).Where("server_table = ? AND server_id = ? AND reported_at > ? AND reported_at <= ?", table, id, now-7200, now-3600).
+		Select("COALESCE(SUM(upload_delta + download_delta), 0)").Scan(&summary.PrevHour)
+	var latest NodeMetric
+	if err := tdb.Where("server_table = ? AND server_id = ?", table, id).Order("reported_at DESC, id DESC").First(&latest).Error; err == nil {
+		summary.Connections = latest.Connections
+		summary.ReportedAt = latest.ReportedAt
+	}
+	return summary
+}
+
+// 批量统计租户全部服务器的流量摘要（键为 "表名:ID"），用于服务器列表等按服务器逐个统计代价过高的场景；
+// 没有上报数据的服务器不在结果中
+func trafficSummaries(tdb *gorm.DB, now int64) map[string]TrafficSummary {
+	summaries := map[string]TrafficSummary{}
+	var sums []struct {
+		ServerTable string
+		ServerID    int
+		LastHour    int64
+		PrevHour    int64
+	}
+	if err := tdb.Model(&NodeMetric{}).
+		Select("server_table, server_id, "+
+			"COALESCE(SUM(CASE WHEN reported_at > ? THEN upload_delta + download_delta ELSE 0 END), 0) AS last_hour, "+
+			"COALESCE(SUM(CASE WHEN reported_at <= ? THEN upload_delta + download_delta ELSE 0 END), 0) AS prev_hour", now-3600, now-3600).
+		Where("reported_at > ?", now-7200).Group("server_table, server_id").Scan(&sums).Error; err != nil {
+		log.Printf("批量统计流量失败: %v", err)
+	}
+	for _, s := range sums {
+		summaries[s.ServerTable+":"+strconv.Itoa(s.ServerID)] = TrafficSummary{LastHour: s.LastHour, PrevHour: s.PrevHour}
+	}
+	// 每台服务器最近一次上报（同一时间多条时取 ID 最大的），按 ID 升序读取，后读到的覆盖先读到的
+	var latest []NodeMetric
+	if err := tdb.Table("node_metrics AS m").Select("m.id, m.server_table, m.server_id, m.connections, m.reported_at").
+		Joins("JOIN (SELECT server_table, server_id, MAX(reported_at) AS latest FROM node_metrics GROUP BY server_table, server_id) l " +
+			"ON m.server_table = l.server_table AND m.server_id = l.server_id AND m.reported_at = l.latest").
+		Order("m.id").Scan(&latest).Error; err != nil {
+		log.Printf("获取最近一次上报失败: %v", err)
+	}
+	for _, m := range latest {
+		key := m.ServerTable + ":" + strconv.Itoa(m.ServerID)
+		summary := summaries[key]
+		summary.Connections = m.Connections
+		summary.ReportedAt = m.ReportedAt
+		summaries[key] = summary
+	}
+	return summaries
+}
+
+// 格式化字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// 流量趋势箭头
+func trafficTrend(s TrafficSummary) string {
+	switch {
+	case s.LastHour > s.PrevHour:
+		return "↑"
+	case s.LastHour < s.PrevHour:
+		return "↓"
+	}
+	return "→"
+}
+
+// 清理所有租户过期的流量数据
+func purgeNodeMetrics() {
+	days := viper.GetInt("metrics.retentionDays")
+	if days <= 0 {
+		days = 7
+	}
+	for _, t := range tenantList() {
+		result := t.DB.Where("reported_at < ?", time.Now().Unix()-int64(days*86400)).Delete(&NodeMetric{})
+		if result.Error != nil {
+			log.Printf("清理过期流量数据失败: 租户=%s, 错误=%v", t.Name, result.Error)
+			continue
+		}
+		log.Printf("清理过期流量数据 %d 条: 租户=%s", result.RowsAffected, t.Name)
+	}
+}
+
+// 注册节点流量路由
+func registerNodeMetricRoutes(r *gin.Engine) {
+	// 节点代理上报流量（需要 metrics 或 admin 权限的 API 令牌）
+	r.POST("/node-metrics", authMiddleware, func(c *gin.Context) {
+		var req nodeMetricRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效参数")
+			return
+		}
+		if !isValidServerTable(req.Table) || req.ID <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的表名或ID")
+			return
+		}
+		if req.UploadBytes < 0 || req.DownloadBytes < 0 || req.Connections < 0 || (req.OnlineUsers != nil && *req.OnlineUsers < 0) {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "流量计数不能为负数")
+			return
+		}
+		metric, err := ingestNodeMetric(currentTenant(c).DB, req, time.Now().Unix())
+		if err != nil {
+			log.Printf("保存节点流量失败: 表=%s, ID=%d, 错误=%v", req.Table, req.ID, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存流量数据失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "已接收", "metric": metric})
+	})
+
+	// 查询服务器流量序列
+	r.GET("/node-metrics", authMiddleware, func(c *gin.Context) {
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		if !isValidServerTable(table) {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+		if err != nil || hours <= 0 || hours > 24*30 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的时间范围")
+			return
+		}
+		tdb := currentTenant(c).DB
+		now := time.Now().Unix()
+		var metrics []NodeMetric
+		if err := tdb.Where("server_table = ? AND server_id = ? AND reported_at > ?", table, id, now-int64(hours*3600)).
+			Order("reported_at ASC").Find(&metrics).Error; err != nil {
+			log.Printf("获取节点流量失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取流量数据失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"metrics": metrics, "summary": trafficSummary(tdb, table, id, now)})
+	})
+}
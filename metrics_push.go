@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// Prometheus 文本格式的 Content-Type
+const promContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// 单个样本，Labels 为按顺序排列的 name、value 对
+type promSample struct {
+	Labels []string
+	Value  float64
+}
+
+// 一个指标及其样本
+type promMetric struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []promSample
+}
+
+// 收集所有租户的指标
+func collectPromMetrics(now time.Time) []promMetric {
+	gauge := func(name, help string) *promMetric {
+		return &promMetric{Name: name, Help: help, Type: "gauge"}
+	}
+	boolValue := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	up := gauge("server_manager_up", "管理服务是否运行")
+	up.Samples = []promSample{{Value: 1}}
+	leader := gauge("server_manager_leader", "本实例是否为主节点")
+	leader.Samples = []promSample{{Value: boolValue(isLeader())}}
+	maintenance := gauge("server_manager_maintenance", "是否处于维护模式")
+	maintenance.Samples = []promSample{{Value: boolValue(inMaintenance())}}
+	domains := gauge("server_manager_domains", "服务器域名池中的域名数")
+	available := gauge("server_manager_domains_available", "服务器当前可用于轮换的域名数")
+	nextUpdate := gauge("server_manager_server_next_update_timestamp_seconds", "服务器下次计划轮换时间")
+	connections := gauge("server_manager_node_connections", "节点最近上报的连接数")
+	traffic := gauge("server_manager_node_traffic_last_hour_bytes", "节点最近一小时的流量")
+	rotations := gauge("server_manager_rotation_history", "保留的轮换历史记录数")
+	blocks := gauge("server_manager_domain_blocks", "记录的域名封锁次数")
+
+	for _, t := range tenantList() {
+		trafficByServer := trafficSummaries(t.DB, now.Unix())
+		domainCounts, err := t.Domains.CountAll(now.Unix())
+		if err != nil {
+			log.Printf("收集指标: 批量统计域名失败: 租户=%s, 错误=%v", t.Name, err)
+		}
+		for _, table := range serverTables(t) {
+			servers, err := listServerRows(t, table)
+			if err != nil {
+				log.Printf("收集指标: 从表 %s 获取服务器失败: 租户=%s, 错误=%v", table, t.Name, err)
+				continue
+			}
+			for _, s := range servers {
+				labels := []string{"tenant", t.Name, "table", table, "server_id", strconv.Itoa(s.ID)}
+				if counts, err := lookupDomainCounts(t.Domains, domainCounts, table, s.ID, now.Unix()); err == nil {
+					domains.Samples = append(domains.Samples, promSample{labels, float64(counts.Total)})
+					available.Samples = append(available.Samples, promSample{labels, float64(counts.Available)})
+				}
+				nextUpdate.Samples = append(nextUpdate.Samples, promSample{labels, float64(s.NextUpdateTime)})
+				summary := trafficByServer[table+":"+strconv.Itoa(s.ID)]
+				connections.Samples = append(connections.Samples, promSample{labels, float64(summary.Connections)})
+				traffic.Samples = append(traffic.Samples, promSample{labels, float64(summary.LastHour)})
+			}
+		}
+		var statuses []struct {
+			Status string
+			Count  int64
+		}
+		t.DB.Model(&RotationHistory{}).Select("status, COUNT(*) AS count").Group("status").Scan(&statuses)
+		for _, s := range statuses {
+			rotations.Samples = append(rotations.Samples, promSample{[]string{"tenant", t.Name, "status", s.Status}, float64(s.Count)})
+		}
+		var registrars []struct {
+			Registrar string
+			Count     int64
+		}
+		t.DB.Model(&DomainBlock{}).Select("registrar, COUNT(*) AS count").Group("registrar").Scan(&registrars)
+		for _, r := range registrars {
+			blocks.Samples = append(blocks.Samples, promSample{[]string{"tenant", t.Name, "registrar", r.Registrar}, float64(r.Count)})
+		}
+	}
+	return []promMetric{*up, *leader, *maintenance, *domains, *available, *nextUpdate, *connections, *traffic, *rotations, *blocks}
+}
+
+// 转义标签值
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// 按 Prometheus 文本格式输出指标
+func renderPromText(metrics []promMetric) []byte {
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, m.Type)
+		for _, s := range m.Samples {
+			buf.WriteString(m.Name)
+			if len(s.Labels) > 0 {
+				buf.WriteByte('{')
+				for i := 0; i+1 < len(s.Labels); i += 2 {
+					if i > 0 {
+						buf.WriteByte(',')
+					}
+					fmt.Fprintf(&buf, `%s="%s"`, s.Labels[i], promLabelEscaper.Replace(s.Labels[i+1]))
+				}
+				buf.WriteByte('}')
+			}
+			buf.WriteByte(' ')
+			buf.WriteString(strconv.FormatFloat(s.Value, 'g', -1, 64))
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// 按 remote write 协议编码（prometheus.WriteRequest 的 protobuf 编码，无外部依赖）
+func encodeRemoteWrite(metrics []promMetric, extra []string, ts int64) []byte {
+	var req []byte
+	for _, m := range metrics {
+		for _, s := range m.Samples {
+			labels := map[string]string{"__name__": m.Name}
+			for i := 0; i+1 < len(extra); i += 2 {
+				labels[extra[i]] = extra[i+1]
+			}
+			for i := 0; i+1 < len(s.Labels); i += 2 {
+				labels[s.Labels[i]] = s.Labels[i+1]
+			}
+			names := make([]string, 0, len(labels))
+			for name := range labels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var series []byte
+			for _, name := range names {
+				var label []byte
+				label = protoBytes(label, 1, []byte(name))
+				label = protoBytes(label, 2, []byte(labels[name]))
+				series = protoBytes(series, 1, label)
+			}
+			var sample []byte
+			sample = append(sample, 1<<3|1)
+			sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(s.Value))
+			sample = append(sample, 2<<3)
+			sample = binary.AppendUvarint(sample, uint64(ts))
+			series = protoBytes(series, 2, sample)
+			req = protoBytes(req, 1, series)
+		}
+	}
+	return req
+}
+
+// 追加 protobuf length-delimited 字段
+func protoBytes(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|2))
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// snappy 块格式编码：只输出字面量块（不压缩），remote write 接收端均可解码
+func snappyLiteral(data []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > 65536 {
+			chunk = chunk[:65536]
+		}
+		n := len(chunk) - 1
+		switch {
+		case n < 60:
+			out = append(out, byte(n)<<2)
+		case n < 1<<8:
+			out = append(out, 60<<2, byte(n))
+		default:
+			out = append(out, 61<<2, byte(n), byte(n>>8))
+		}
+		out = append(out, chunk...)
+		data = data[len(chunk):]
+	}
+	return out
+}
+
+// 推送一次指标：metrics.push.mode 为 pushgateway（默认）或 remote_write
+func pushMetrics(client *http.Client) error {
+	target := viper.GetString("metrics.push.url")
+	job := viper.GetString("metrics.push.job")
+	if job == "" {
+		job = "server_manager"
+	}
+	metrics := collectPromMetrics(time.Now())
+	var req *http.Request
+	var err error
+	switch mode := viper.GetString("metrics.push.mode"); mode {
+	case "", "pushgateway":
+		// PUT 替换该 job/instance 分组下的全部指标
+		endpoint := strings.TrimRight(target, "/") + "/metrics/job/" + url.PathEscape(job) + "/instance/" + url.PathEscape(haState.instanceID)
+		req, err = http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(renderPromText(metrics)))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", promContentType)
+	case "remote_write":
+		body := snappyLiteral(encodeRemoteWrite(metrics, []string{"job", job, "instance", haState.instanceID}, time.Now().UnixMilli()))
+		req, err = http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	default:
+		return fmt.Errorf("未知的推送方式 %q，可选值: pushgateway, remote_write", mode)
+	}
+	if username := viper.GetString("metrics.push.username"); username != "" {
+		req.SetBasicAuth(username, viper.GetString("metrics.push.password"))
+	} else if token := viper.GetString("metrics.push.bearerToken"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("推送地址返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// 启动指标定时推送（metrics.push.enabled），用于无法从外部抓取 /metrics 的部署；
+// 与调度器无关，维护模式及备用节点同样推送
+func setupMetricsPush() {
+	if !viper.GetBool("metrics.push.enabled") {
+		return
+	}
+	if viper.GetString("metrics.push.url") == "" {
+		log.Println("已开启指标推送但未配置 metrics.push.url，跳过")
+		return
+	}
+	interval := viper.GetInt("metrics.push.intervalSeconds")
+	if interval <= 0 {
+		interval = 60
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	log.Printf("指标推送已开启: 方式=%s, 地址=%s, 间隔=%d 秒", viper.GetString("metrics.push.mode"), viper.GetString("metrics.push.url"), interval)
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := pushMetrics(client); err != nil {
+				log.Printf("推送指标失败: %v", err)
+			}
+		}
+	}()
+}
+
+// 注册 Prometheus 指标路由
+func registerPromMetricsRoutes(r *gin.Engine) {
+	// Prometheus 抓取端点（需登录或 metrics 权限的 API 令牌）
+	r.GET("/metrics", authMiddleware, func(c *gin.Context) {
+		c.Data(http.StatusOK, promContentType, renderPromText(collectPromMetrics(time.Now())))
+	})
+}
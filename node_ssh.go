@@ -0,0 +1,529 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+// 节点 SSH 凭据保管：私钥或密码以主密钥（SERVER_MANAGER_MASTER_KEY）加密后存入数据库，
+// 接口只返回公钥及指纹等元数据，运维无需在配置文件中明文写入私钥。
+// 首次连接时记录节点主机密钥，之后连接须匹配；支持生成新密钥并替换节点 authorized_keys 中的旧公钥。
+// 轮换成功后可登录节点执行命令（post_rotate_command 或 ssh.postRotateCommand），例如重载节点配置
+
+// SSH 认证方式
+const (
+	sshAuthKey      = "key"
+	sshAuthPassword = "password"
+)
+
+// SSH 连接超时
+const sshDialTimeout = 10 * time.Second
+
+// 生成密钥时写入公钥的注释
+const sshKeyComment = "server_manager"
+
+// NodeCredential 节点 SSH 凭据，Secret 为加密后的私钥（OpenSSH 格式）或密码，不随接口返回
+type NodeCredential struct {
+	ID             uint   `gorm:"primaryKey" json:"id"`
+	ServerTable    string `gorm:"column:server_table;type:varchar(255);uniqueIndex:idx_node_credential;not null" json:"server_table"`
+	ServerID       int    `gorm:"column:server_id;uniqueIndex:idx_node_credential;not null" json:"server_id"`
+	Host           string `gorm:"column:host;type:varchar(255);default:''" json:"host"` // 为空时使用节点 IP（server-node-ip）
+	Port           int    `gorm:"column:port;default:22" json:"port"`
+	User           string `gorm:"column:user;type:varchar(64);not null" json:"user"`
+	AuthType       string `gorm:"column:auth_type;type:varchar(16);not null" json:"auth_type"` // key 或 password
+	Secret         string `gorm:"column:secret;type:text" json:"-"`
+	PublicKey      string `gorm:"column:public_key;type:varchar(1024);default:''" json:"public_key"` // authorized_keys 格式，密码认证时为空
+	Fingerprint    string `gorm:"column:fingerprint;type:varchar(128);default:''" json:"fingerprint"`
+	HostKey        string `gorm:"column:host_key;type:varchar(128);default:''" json:"host_key"` // 节点主机密钥指纹，首次连接成功时记录
+	KeyRotatedAt   int64  `gorm:"column:key_rotated_at;default:0" json:"key_rotated_at"`
+	LastTestAt     int64  `gorm:"column:last_test_at;default:0" json:"last_test_at"`
+	LastTestStatus string `gorm:"column:last_test_status;type:varchar(16);default:''" json:"last_test_status"` // ok 或 failed
+	LastTestError  string `gorm:"column:last_test_error;type:varchar(1024);default:''" json:"last_test_error"`
+	// 轮换成功后在节点上执行的命令，为空时使用 ssh.postRotateCommand
+	PostRotateCommand string `gorm:"column:post_rotate_command;type:varchar(1024);default:''" json:"post_rotate_command"`
+	UpdatedAt         int64  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// 读取服务器的 SSH 凭据
+func loadNodeCredential(tdb *gorm.DB, table string, id int) (NodeCredential, error) {
+	var cred NodeCredential
+	err := tdb.Where("server_table = ? AND server_id = ?", table, id).First(&cred).Error
+	return cred, err
+}
+
+// 解析私钥（可带口令），统一转换为无口令的 OpenSSH 格式，返回 PEM 及公钥
+func normalizePrivateKey(keyPEM, passphrase string) (string, ssh.PublicKey, error) {
+	var raw interface{}
+	var err error
+	if passphrase != "" {
+		raw, err = ssh.ParseRawPrivateKeyWithPassphrase([]byte(keyPEM), []byte(passphrase))
+	} else {
+		raw, err = ssh.ParseRawPrivateKey([]byte(keyPEM))
+	}
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return "", nil, errors.New("私钥受口令保护，请提供 passphrase")
+		}
+		return "", nil, fmt.Errorf("私钥无效: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(raw)
+	if err != nil {
+		return "", nil, fmt.Errorf("不支持的私钥类型: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(raw, sshKeyComment)
+	if err != nil {
+		return "", nil, fmt.Errorf("转换私钥失败: %v", err)
+	}
+	return string(pem.EncodeToMemory(block)), signer.PublicKey(), nil
+}
+
+// 生成 Ed25519 密钥对，返回 OpenSSH 格式私钥及公钥
+func generateSSHKey() (string, ssh.PublicKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(priv, sshKeyComment)
+	if err != nil {
+		return "", nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(pem.EncodeToMemory(block)), signer.PublicKey(), nil
+}
+
+// 以私钥设置凭据的密钥字段（加密私钥、公钥及指纹）
+func setCredentialKey(cred *NodeCredential, keyPEM string, pub ssh.PublicKey) error {
+	secret, err := encryptConfigValue(keyPEM)
+	if err != nil {
+		return fmt.Errorf("加密私钥失败: %v", err)
+	}
+	cred.AuthType = sshAuthKey
+	cred.Secret = secret
+	cred.PublicKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))) + " " + sshKeyComment
+	cred.Fingerprint = ssh.FingerprintSHA256(pub)
+	return nil
+}
+
+// 连接地址：凭据中的主机，未设置时为节点 IP
+func credentialAddr(tdb *gorm.DB, cred NodeCredential) (string, error) {
+	host := cred.Host
+	if host == "" {
+		var node ServerNode
+		if err := tdb.Where("server_table = ? AND server_id = ?", cred.ServerTable, cred.ServerID).First(&node).Error; err != nil {
+			return "", errors.New("未设置 SSH 主机且服务器没有节点 IP")
+		}
+		host = node.IP
+	}
+	return net.JoinHostPort(host, strconv.Itoa(cred.Port)), nil
+}
+
+// 按凭据连接节点：主机密钥须与已记录的指纹一致；未记录时接受首次连接的主机密钥，
+// 登录成功后立即记录到数据库及 cred，之后的连接（包括并发的其他连接）都须匹配
+func dialNode(tdb *gorm.DB, cred *NodeCredential) (*ssh.Client, error) {
+	addr, err := credentialAddr(tdb, *cred)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := decryptConfigValue(cred.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("解密凭据失败: %v", err)
+	}
+	var auth ssh.AuthMethod
+	if cred.AuthType == sshAuthPassword {
+		auth = ssh.Password(secret)
+	} else {
+		signer, err := ssh.ParsePrivateKey([]byte(secret))
+		if err != nil {
+			return nil, fmt.Errorf("私钥无效: %v", err)
+		}
+		auth = ssh.PublicKeys(signer)
+	}
+	var hostKey string
+	config := &ssh.ClientConfig{
+		User:    cred.User,
+		Auth:    []ssh.AuthMethod{auth},
+		Timeout: sshDialTimeout,
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			hostKey = ssh.FingerprintSHA256(key)
+			if cred.HostKey != "" && cred.HostKey != hostKey {
+				return fmt.Errorf("主机密钥不匹配（记录为 %s，实际为 %s），如节点已重装请重置主机密钥", cred.HostKey, hostKey)
+			}
+			return nil
+		},
+	}
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	if cred.HostKey == "" {
+		if err := pinHostKey(tdb, cred, hostKey); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// 记录首次连接的主机密钥：只在尚未记录时写入，并发连接已记录了其他密钥时拒绝本次连接
+func pinHostKey(tdb *gorm.DB, cred *NodeCredential, hostKey string) error {
+	result := tdb.Model(&NodeCredential{}).Where("id = ? AND host_key = ''", cred.ID).Update("host_key", hostKey)
+	if result.Error != nil {
+		return fmt.Errorf("记录主机密钥失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var recorded string
+		if err := tdb.Model(&NodeCredential{}).Where("id = ?", cred.ID).Select("host_key").Scan(&recorded).Error; err != nil {
+			return fmt.Errorf("读取主机密钥失败: %v", err)
+		}
+		if recorded != hostKey {
+			return fmt.Errorf("主机密钥不匹配（记录为 %s，实际为 %s），如节点已重装请重置主机密钥", recorded, hostKey)
+		}
+	}
+	cred.HostKey = hostKey
+	log.Printf("已记录节点主机密钥: 表=%s, ID=%d, 指纹=%s", cred.ServerTable, cred.ServerID, hostKey)
+	return nil
+}
+
+// 连接服务器节点，供轮换后需要登录节点的操作使用
+func nodeSSHClient(tdb *gorm.DB, table string, id int) (*ssh.Client, error) {
+	cred, err := loadNodeCredential(tdb, table, id)
+	if err != nil {
+		return nil, fmt.Errorf("服务器未配置 SSH 凭据: %v", err)
+	}
+	return dialNode(tdb, &cred)
+}
+
+// 在节点上执行命令，返回合并的输出
+func runSSHCommand(client *ssh.Client, command string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	var out bytes.Buffer
+	session.Stdout = &out
+	session.Stderr = &out
+	err = session.Run(command)
+	return strings.TrimSpace(out.String()), err
+}
+
+// 测试凭据能否登录节点并执行命令，记录结果；首次成功时记录主机密钥
+func testNodeCredential(tdb *gorm.DB, cred *NodeCredential) error {
+	client, err := dialNode(tdb, cred)
+	if err == nil {
+		_, err = runSSHCommand(client, "true")
+		client.Close()
+	}
+	cred.LastTestAt = time.Now().Unix()
+	updates := map[string]interface{}{"last_test_at": cred.LastTestAt}
+	if err != nil {
+		cred.LastTestStatus, cred.LastTestError = "failed", truncate(err.Error(), 1024)
+	} else {
+		cred.LastTestStatus, cred.LastTestError = "ok", ""
+	}
+	updates["last_test_status"], updates["last_test_error"] = cred.LastTestStatus, cred.LastTestError
+	if dbErr := tdb.Model(&NodeCredential{}).Where("id = ?", cred.ID).Updates(updates).Error; dbErr != nil {
+		log.Printf("保存 SSH 测试结果失败: 表=%s, ID=%d, 错误=%v", cred.ServerTable, cred.ServerID, dbErr)
+	}
+	return err
+}
+
+// 公钥在 authorized_keys 中的标识（密钥类型后的 base64 部分）
+func authorizedKeyBlob(publicKey string) string {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+// 轮换节点密钥：生成新密钥并用现有凭据加入 authorized_keys，确认新密钥可登录并保存后才删除旧公钥；
+// 保存失败时旧公钥仍在节点上，旧凭据继续可用
+func rotateNodeKey(tdb *gorm.DB, cred *NodeCredential) error {
+	keyPEM, pub, err := generateSSHKey()
+	if err != nil {
+		return fmt.Errorf("生成密钥失败: %v", err)
+	}
+
+	client, err := dialNode(tdb, cred)
+	if err != nil {
+		return fmt.Errorf("使用现有凭据连接失败: %v", err)
+	}
+	next := *cred
+	if err := setCredentialKey(&next, keyPEM, pub); err != nil {
+		client.Close()
+		return err
+	}
+	install := fmt.Sprintf("mkdir -p ~/.ssh && chmod 700 ~/.ssh && printf '%%s\\n' '%s' >> ~/.ssh/authorized_keys && chmod 600 ~/.ssh/authorized_keys", next.PublicKey)
+	out, err := runSSHCommand(client, install)
+	client.Close()
+	if err != nil {
+		return fmt.Errorf("写入新公钥失败: %v %s", err, out)
+	}
+
+	client, err = dialNode(tdb, &next)
+	if err != nil {
+		return fmt.Errorf("新密钥登录失败，旧凭据保持不变: %v", err)
+	}
+	defer client.Close()
+	old := *cred
+	next.KeyRotatedAt = time.Now().Unix()
+	next.UpdatedAt = next.KeyRotatedAt
+	if err := tdb.Save(&next).Error; err != nil {
+		return fmt.Errorf("保存新密钥失败，旧凭据及旧公钥保持不变（新公钥已写入节点）: %v", err)
+	}
+	*cred = next
+	if blob := authorizedKeyBlob(old.PublicKey); old.AuthType == sshAuthKey && blob != "" {
+		remove := fmt.Sprintf("grep -vF '%s' ~/.ssh/authorized_keys > ~/.ssh/authorized_keys.tmp; mv ~/.ssh/authorized_keys.tmp ~/.ssh/authorized_keys && chmod 600 ~/.ssh/authorized_keys", blob)
+		if out, err := runSSHCommand(client, remove); err != nil {
+			log.Printf("删除旧公钥失败，请手动清理: 表=%s, ID=%d, 错误=%v %s", old.ServerTable, old.ServerID, err, out)
+		}
+	}
+	return nil
+}
+
+// 轮换后在节点上执行的命令：凭据中的命令优先，未设置时使用 ssh.postRotateCommand。
+// 可用占位符 {host}、{port}、{old_host}、{old_port}，替换为单引号转义后的值
+func postRotateCommand(cred NodeCredential, oldHost string, oldPort int, host string, port int) string {
+	command := cred.PostRotateCommand
+	if command == "" {
+		command = viper.GetString("ssh.postRotateCommand")
+	}
+	if command == "" {
+		return ""
+	}
+	return strings.NewReplacer(
+		"{host}", shellQuote(host),
+		"{port}", strconv.Itoa(port),
+		"{old_host}", shellQuote(oldHost),
+		"{old_port}", strconv.Itoa(oldPort),
+	).Replace(command)
+}
+
+// 单引号转义，用于拼接 shell 命令
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// 轮换成功后的 SSH 钩子：服务器配置了 SSH 凭据且有命令时，异步登录节点执行，结果写入审计日志；
+// 未配置凭据或命令的服务器直接跳过
+func runPostRotateHook(t *Tenant, table string, id int, oldHost string, oldPort int, host string, port int) {
+	cred, err := loadNodeCredential(t.DB, table, id)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("读取 SSH 凭据失败，跳过轮换后命令: 表=%s, ID=%d, 错误=%v", table, id, err)
+		}
+		return
+	}
+	command := postRotateCommand(cred, oldHost, oldPort, host, port)
+	if command == "" {
+		return
+	}
+	go func() {
+		target := fmt.Sprintf("%s:%d", table, id)
+		client, err := nodeSSHClient(t.DB, table, id)
+		var out string
+		if err == nil {
+			out, err = runSSHCommand(client, command)
+			client.Close()
+		}
+		if err != nil {
+			log.Printf("轮换后命令执行失败: 租户=%s, 表=%s, ID=%d, 错误=%v %s", t.Name, table, id, err, out)
+			recordAudit(t.DB, "node_post_rotate", target, "system", "", truncate("失败: "+err.Error()+" "+out, 1024))
+			return
+		}
+		log.Printf("轮换后命令已执行: 租户=%s, 表=%s, ID=%d", t.Name, table, id)
+		recordAudit(t.DB, "node_post_rotate", target, "system", "", truncate("成功: "+out, 1024))
+	}()
+}
+
+// 由请求参数 table、id 读取服务器的 SSH 凭据，失败时写入错误响应并返回 false
+func nodeCredentialParam(c *gin.Context) (NodeCredential, bool) {
+	table := serverParam(c, "table")
+	if !isValidServerTable(table) {
+		respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+		return NodeCredential{}, false
+	}
+	id, err := strconv.Atoi(serverParam(c, "id"))
+	if err != nil || id <= 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "无效的服务器ID")
+		return NodeCredential{}, false
+	}
+	cred, err := loadNodeCredential(currentTenant(c).DB, table, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, codeNotFound, "服务器未配置 SSH 凭据")
+			return NodeCredential{}, false
+		}
+		respondError(c, http.StatusInternalServerError, codeInternal, "获取 SSH 凭据失败："+err.Error())
+		return NodeCredential{}, false
+	}
+	return cred, true
+}
+
+// 注册节点 SSH 凭据路由
+func registerNodeSSHRoutes(r *gin.Engine) {
+	// 查看服务器的 SSH 凭据（不含私钥及密码）
+	r.GET("/node-credentials", authMiddleware, func(c *gin.Context) {
+		cred, ok := nodeCredentialParam(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"credential": cred})
+	})
+
+	// 保存服务器的 SSH 凭据：user 必填，port 默认 22，host 为空时使用节点 IP；
+	// 提供 private_key（可带 passphrase）或 password，或 generate=1 生成新密钥（返回公钥供加入节点 authorized_keys）；
+	// post_rotate_command 为轮换成功后在节点上执行的命令
+	r.POST("/node-credentials", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		table := serverParam(c, "table")
+		if !isValidServerTable(table) {
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		id, err := strconv.Atoi(serverParam(c, "id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的服务器ID")
+			return
+		}
+		cred := NodeCredential{ServerTable: table, ServerID: id, Port: 22}
+		if existing, err := loadNodeCredential(t.DB, table, id); err == nil {
+			cred = existing
+		}
+		cred.User = strings.TrimSpace(c.PostForm("user"))
+		if cred.User == "" || len(cred.User) > 64 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 SSH 用户名")
+			return
+		}
+		cred.Host = strings.TrimSpace(c.PostForm("host"))
+		cred.Port = 22
+		if v := c.PostForm("port"); v != "" {
+			if cred.Port, err = strconv.Atoi(v); err != nil || cred.Port <= 0 || cred.Port > 65535 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 SSH 端口")
+				return
+			}
+		}
+		if _, err := masterCipher(); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无法加密保存凭据："+err.Error())
+			return
+		}
+		privateKey, password := c.PostForm("private_key"), c.PostForm("password")
+		switch {
+		case c.PostForm("generate") == "1":
+			keyPEM, pub, err := generateSSHKey()
+			if err == nil {
+				err = setCredentialKey(&cred, keyPEM, pub)
+			}
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, codeInternal, "生成密钥失败："+err.Error())
+				return
+			}
+		case strings.TrimSpace(privateKey) != "":
+			keyPEM, pub, err := normalizePrivateKey(privateKey, c.PostForm("passphrase"))
+			if err != nil {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+				return
+			}
+			if err := setCredentialKey(&cred, keyPEM, pub); err != nil {
+				respondError(c, http.StatusInternalServerError, codeInternal, err.Error())
+				return
+			}
+		case password != "":
+			secret, err := encryptConfigValue(password)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, codeInternal, "加密密码失败："+err.Error())
+				return
+			}
+			cred.AuthType, cred.Secret, cred.PublicKey, cred.Fingerprint = sshAuthPassword, secret, "", ""
+		case cred.ID == 0:
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "请提供 private_key、password 或 generate=1")
+			return
+		}
+		if v, ok := c.GetPostForm("post_rotate_command"); ok {
+			if len(v) > 1024 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "轮换后命令过长")
+				return
+			}
+			cred.PostRotateCommand = strings.TrimSpace(v)
+		}
+		if c.PostForm("reset_host_key") == "1" {
+			cred.HostKey = ""
+		}
+		cred.UpdatedAt = time.Now().Unix()
+		if err := t.DB.Save(&cred).Error; err != nil {
+			log.Printf("保存 SSH 凭据失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存 SSH 凭据失败："+err.Error())
+			return
+		}
+		recordAudit(t.DB, "set_node_credential", fmt.Sprintf("%s:%d", table, id), operatorName(c), c.ClientIP(), "认证方式="+cred.AuthType+", 用户="+cred.User)
+		log.Printf("已保存 SSH 凭据: 表=%s, ID=%d, 用户=%s, 认证方式=%s", table, id, cred.User, cred.AuthType)
+		c.JSON(http.StatusOK, gin.H{"message": "SSH 凭据已保存", "credential": cred})
+	})
+
+	// 删除服务器的 SSH 凭据
+	r.POST("/node-credentials/delete", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		cred, ok := nodeCredentialParam(c)
+		if !ok {
+			return
+		}
+		if err := t.DB.Delete(&NodeCredential{}, cred.ID).Error; err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternal, "删除 SSH 凭据失败："+err.Error())
+			return
+		}
+		recordAudit(t.DB, "delete_node_credential", fmt.Sprintf("%s:%d", cred.ServerTable, cred.ServerID), operatorName(c), c.ClientIP(), "")
+		c.JSON(http.StatusOK, gin.H{"message": "SSH 凭据已删除"})
+	})
+
+	// 测试 SSH 连接：登录节点并执行 true，首次成功时记录主机密钥
+	r.POST("/node-credentials/test", authMiddleware, func(c *gin.Context) {
+		cred, ok := nodeCredentialParam(c)
+		if !ok {
+			return
+		}
+		if err := testNodeCredential(currentTenant(c).DB, &cred); err != nil {
+			log.Printf("SSH 连接测试失败: 表=%s, ID=%d, 错误=%v", cred.ServerTable, cred.ServerID, err)
+			respondError(c, http.StatusBadGateway, codeUpstreamFailed, "SSH 连接失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "SSH 连接成功", "credential": cred})
+	})
+
+	// 轮换节点密钥：生成新密钥写入节点 authorized_keys，确认可登录后删除旧公钥
+	r.POST("/node-credentials/rotate-key", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		cred, ok := nodeCredentialParam(c)
+		if !ok {
+			return
+		}
+		oldFingerprint := cred.Fingerprint
+		if err := rotateNodeKey(t.DB, &cred); err != nil {
+			log.Printf("轮换 SSH 密钥失败: 表=%s, ID=%d, 错误=%v", cred.ServerTable, cred.ServerID, err)
+			respondError(c, http.StatusBadGateway, codeUpstreamFailed, "轮换 SSH 密钥失败："+err.Error())
+			return
+		}
+		recordAudit(t.DB, "rotate_node_key", fmt.Sprintf("%s:%d", cred.ServerTable, cred.ServerID), operatorName(c), c.ClientIP(), "旧指纹="+oldFingerprint+", 新指纹="+cred.Fingerprint)
+		log.Printf("已轮换 SSH 密钥: 表=%s, ID=%d, 新指纹=%s", cred.ServerTable, cred.ServerID, cred.Fingerprint)
+		c.JSON(http.StatusOK, gin.H{"message": "SSH 密钥已轮换", "credential": cred})
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestPinHostKey(t *testing.T) {
+	tdb := newTestDB(t, &NodeCredential{})
+	cred := NodeCredential{ServerTable: "v2_server_vless", ServerID: 1, User: "root", AuthType: sshAuthKey}
+	if err := tdb.Create(&cred).Error; err != nil {
+		t.Fatalf("创建凭据失败: %v", err)
+	}
+	first := cred
+	if err := pinHostKey(tdb, &first, "SHA256:first"); err != nil {
+		t.Fatalf("首次记录主机密钥失败: %v", err)
+	}
+	if first.HostKey != "SHA256:first" {
+		t.Errorf("HostKey = %q，期望 SHA256:first", first.HostKey)
+	}
+	// 并发连接读取凭据时尚未记录主机密钥，得到不同密钥时须拒绝
+	if err := pinHostKey(tdb, &cred, "SHA256:other"); err == nil {
+		t.Error("主机密钥与已记录的不一致时应返回错误")
+	}
+	if err := pinHostKey(tdb, &cred, "SHA256:first"); err != nil {
+		t.Errorf("主机密钥与已记录的一致时不应返回错误: %v", err)
+	}
+	saved, _ := loadNodeCredential(tdb, "v2_server_vless", 1)
+	if saved.HostKey != "SHA256:first" {
+		t.Errorf("数据库中的主机密钥 = %q，期望 SHA256:first", saved.HostKey)
+	}
+}
+
+func TestPostRotateCommand(t *testing.T) {
+	cred := NodeCredential{PostRotateCommand: "reload.sh {host} {port} {old_host} {old_port}"}
+	got := postRotateCommand(cred, "old.example.com", 443, "new'.example.com", 8443)
+	want := `reload.sh 'new'\''.example.com' 8443 'old.example.com' 443`
+	if got != want {
+		t.Errorf("postRotateCommand = %s，期望 %s", got, want)
+	}
+	if got := postRotateCommand(NodeCredential{}, "a", 1, "b", 2); got != "" {
+		t.Errorf("未配置命令时 postRotateCommand = %q，期望为空", got)
+	}
+}
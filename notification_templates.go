@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 自定义通知模板：[events.<渠道>.templates] 中按事件类型配置 Go text/template 模板，
+// default 用于未单独配置的事件类型；未配置模板的渠道及事件仍使用默认的单行描述。
+// 适用于 log、telegram、slack、discord、email（正文）渠道，webhook 始终发送 JSON
+
+// 对所有事件类型生效的模板键
+const defaultTemplateKey = "default"
+
+// 可配置模板的事件类型
+var templateEventTypes = map[string]bool{
+	eventRotationStarted:   true,
+	eventRotationSucceeded: true,
+	eventRotationFailed:    true,
+	eventDomainAdded:       true,
+	eventDomainExhausted:   true,
+	eventPortUnreachable:   true,
+	eventDomainBlocked:     true,
+	eventServerModified:    true,
+	eventRotationReport:    true,
+	defaultTemplateKey:     true,
+}
+
+// 模板中可用的函数
+var templateFuncs = template.FuncMap{
+	"formatTime": func(timestamp int64) string { return formatTimeIn(timestamp, "") },
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+}
+
+// NotificationData 模板变量
+type NotificationData struct {
+	Type          string // 事件类型
+	Tenant        string
+	ServerTable   string
+	ServerID      int
+	ServerName    string // 服务器名称，服务器不存在时为空
+	Domain        string
+	OldHost       string
+	NewHost       string
+	OldPort       int
+	NewPort       int
+	Error         string
+	Trigger       string // 轮换的触发来源
+	Actor         string // 轮换的操作者
+	AffectedUsers int    // 轮换影响的在线用户数，无统计数据时为 0
+	Time          int64
+	Message       string // 默认的单行描述
+}
+
+// 事件对应的模板变量
+func notificationData(e Event) NotificationData {
+	d := NotificationData{
+		Type:        e.Type,
+		Tenant:      e.Tenant,
+		ServerTable: e.ServerTable,
+		ServerID:    e.ServerID,
+		Domain:      e.Domain,
+		OldHost:     e.OldHost,
+		NewHost:     e.NewHost,
+		OldPort:     e.OldPort,
+		NewPort:     e.NewPort,
+		Error:       e.Error,
+		Trigger:     e.Trigger,
+		Actor:       e.Actor,
+		Time:        e.Time,
+		Message:     e.String(),
+	}
+	if e.AffectedUsers != nil {
+		d.AffectedUsers = *e.AffectedUsers
+	}
+	if t, ok := lookupTenant(e.Tenant); ok && t != nil && e.ServerTable != "" && isValidServerTable(e.ServerTable) {
+		if meta, err := loadServerMeta(t, e.ServerTable, e.ServerID); err == nil {
+			d.ServerName = meta.Name
+		}
+	}
+	return d
+}
+
+// notificationTemplates 渠道的模板，按事件类型索引，为 nil 表示未配置
+type notificationTemplates map[string]*template.Template
+
+// 解析单个模板
+func parseNotificationTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// 读取并解析渠道的模板（events.<渠道>.templates）
+func loadNotificationTemplates(channel string) (notificationTemplates, error) {
+	raw := viper.GetStringMapString("events." + channel + ".templates")
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	templates := notificationTemplates{}
+	for eventType, text := range raw {
+		if !templateEventTypes[eventType] {
+			return nil, fmt.Errorf("events.%s.templates.%s: 未知的事件类型", channel, eventType)
+		}
+		tpl, err := parseNotificationTemplate(channel+"."+eventType, text)
+		if err != nil {
+			return nil, fmt.Errorf("events.%s.templates.%s: %v", channel, eventType, err)
+		}
+		templates[eventType] = tpl
+	}
+	return templates, nil
+}
+
+// 渲染事件消息：优先使用事件类型的模板，其次 default，均未配置或渲染失败时返回默认的单行描述
+func (ts notificationTemplates) render(e Event) string {
+	tpl := ts[e.Type]
+	if tpl == nil {
+		tpl = ts[defaultTemplateKey]
+	}
+	if tpl == nil {
+		return e.String()
+	}
+	text, err := executeNotificationTemplate(tpl, e)
+	if err != nil {
+		log.Printf("渲染通知模板失败，使用默认消息: 模板=%s, 错误=%v", tpl.Name(), err)
+		return e.String()
+	}
+	return text
+}
+
+func executeNotificationTemplate(tpl *template.Template, e Event) (string, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, notificationData(e)); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// 注册通知模板路由
+func registerNotificationTemplateRoutes(r *gin.Engine) {
+	// 预览通知模板：template 为模板内容，type 为事件类型；使用该类型最近一次事件渲染，启动以来未发生时使用示例事件
+	r.POST("/events/templates/preview", authMiddleware, func(c *gin.Context) {
+		eventType := c.PostForm("type")
+		if !templateEventTypes[eventType] || eventType == defaultTemplateKey {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的事件类型："+eventType)
+			return
+		}
+		tpl, err := parseNotificationTemplate("preview", c.PostForm("template"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "模板解析失败："+err.Error())
+			return
+		}
+		_, last := eventCounter.snapshot()
+		e, ok := last[eventType]
+		sample := !ok || e.Tenant != currentTenant(c).Name
+		if sample {
+			e = Event{Type: eventType, Tenant: currentTenant(c).Name, ServerTable: panelServerTables[0], ServerID: 1,
+				Domain: "new.example.com", OldHost: "old.example.com", NewHost: "new.example.com", OldPort: 20000, NewPort: 30000,
+				Error: "示例错误", Trigger: triggerManual, Actor: operatorName(c), Time: time.Now().Unix()}
+		}
+		text, err := executeNotificationTemplate(tpl, e)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "模板渲染失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": text, "sample": sample, "event": e})
+	})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// OIDC 客户端凭证：除静态 API 令牌外，JSON 接口也接受身份提供方（IdP）通过
+// OAuth2 client credentials 签发的 JWT 访问令牌。签名（JWKS 公钥）、签发者、受众及有效期由 go-oidc 校验，
+// 受众（oidc.audience）必须配置；令牌中的 scope 映射为 API 令牌的权限范围。
+// 配置 oidc.serversClaim 时，该声明（字符串或数组，格式同 API 令牌的 servers，"*" 表示不限制）限定可管理的服务器组，
+// 缺少该声明的令牌被拒绝
+
+// 获取 OpenID 发现文档失败后，至少间隔这么多秒再重试
+const oidcDiscoveryRetrySeconds = 60
+
+// 接受的签名算法（只接受非对称算法）
+var oidcSigningAlgs = []string{
+	oidc.RS256, oidc.RS384, oidc.RS512,
+	oidc.PS256, oidc.PS384, oidc.PS512,
+	oidc.ES256, oidc.ES384, oidc.ES512,
+}
+
+// 是否开启 OIDC 访问令牌校验（配置了 oidc.issuer）
+func oidcEnabled() bool {
+	return viper.GetString("oidc.issuer") != ""
+}
+
+// Bearer 令牌是否为 JWT（三段 base64url，静态 API 令牌不含点号）
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+var oidcState struct {
+	sync.Mutex
+	verifier    *oidc.IDTokenVerifier
+	attemptedAt int64
+}
+
+// 访问令牌校验器：配置了 oidc.jwksURL 时直接使用该地址的公钥，否则通过签发者的 OpenID 发现文档获取；
+// 公钥由 go-oidc 缓存，遇到未知 kid 时自动刷新
+func oidcTokenVerifier() (*oidc.IDTokenVerifier, error) {
+	oidcState.Lock()
+	defer oidcState.Unlock()
+	if oidcState.verifier != nil {
+		return oidcState.verifier, nil
+	}
+	audience := viper.GetString("oidc.audience")
+	if audience == "" {
+		return nil, errors.New("未配置 oidc.audience")
+	}
+	now := time.Now().Unix()
+	if now-oidcState.attemptedAt < oidcDiscoveryRetrySeconds {
+		return nil, errors.New("身份提供方暂不可用")
+	}
+	oidcState.attemptedAt = now
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: 10 * time.Second})
+	issuer := viper.GetString("oidc.issuer")
+	config := oidcVerifierConfig(audience)
+	if u := viper.GetString("oidc.jwksURL"); u != "" {
+		oidcState.verifier = oidc.NewVerifier(issuer, oidc.NewRemoteKeySet(ctx, u), config)
+	} else {
+		provider, err := oidc.NewProvider(ctx, issuer)
+		if err != nil {
+			log.Printf("获取 OpenID 发现文档失败: %v", err)
+			return nil, fmt.Errorf("获取 OpenID 发现文档失败: %v", err)
+		}
+		oidcState.verifier = provider.Verifier(config)
+	}
+	log.Printf("OIDC 访问令牌校验已就绪: 签发者=%s, 受众=%s", issuer, audience)
+	return oidcState.verifier, nil
+}
+
+// 校验器配置：受众须包含 audience，只接受非对称签名算法
+func oidcVerifierConfig(audience string) *oidc.Config {
+	return &oidc.Config{ClientID: audience, SupportedSigningAlgs: oidcSigningAlgs}
+}
+
+// oidcClaims 访问令牌中用到的声明（签发者、受众及有效期已由校验器检查）；scp 可能是字符串或数组
+type oidcClaims struct {
+	Subject  string          `json:"sub"`
+	ClientID string          `json:"client_id"`
+	AZP      string          `json:"azp"`
+	Scope    string          `json:"scope"`
+	SCP      json.RawMessage `json:"scp"`
+
+	raw map[string]json.RawMessage
+}
+
+// 全部服务器，用于 OIDC 服务器组声明
+const oidcAllServers = "*"
+
+// 字符串或字符串数组
+func stringOrList(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		return strings.Fields(one)
+	}
+	var list []string
+	json.Unmarshal(raw, &list)
+	return list
+}
+
+// 调用方名称：client_id，其次 azp、sub
+func (cl oidcClaims) clientName() string {
+	for _, name := range []string{cl.ClientID, cl.AZP, cl.Subject} {
+		if name != "" {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// 将令牌中的 scope 映射为 API 令牌权限范围：去掉 oidc.scopePrefix 前缀后为 admin、read、domains、metrics 之一
+func (cl oidcClaims) apiScopes() string {
+	prefix := viper.GetString("oidc.scopePrefix")
+	var scopes []string
+	for _, s := range append(strings.Fields(cl.Scope), stringOrList(cl.SCP)...) {
+		name, ok := strings.CutPrefix(s, prefix)
+		if !ok {
+			continue
+		}
+		if mapped, valid := parseScopes(name); valid {
+			scopes = append(scopes, mapped)
+		}
+	}
+	return strings.Join(scopes, ",")
+}
+
+// 由 oidc.serversClaim 指定的声明得到服务器组，未配置该项或声明为 "*" 时不限制
+func (cl oidcClaims) serverGroups() (string, error) {
+	name := viper.GetString("oidc.serversClaim")
+	if name == "" {
+		return "", nil
+	}
+	var groups []string
+	for _, g := range stringOrList(cl.raw[name]) {
+		if g == oidcAllServers {
+			return "", nil
+		}
+		groups = append(groups, g)
+	}
+	servers, err := parseServerGroups(strings.Join(groups, ","))
+	if err != nil {
+		return "", err
+	}
+	if servers == "" {
+		return "", fmt.Errorf("访问令牌缺少服务器组声明 %s", name)
+	}
+	return servers, nil
+}
+
+// 校验 JWT 访问令牌的签名、签发者、受众及有效期，返回声明
+func verifyOIDCToken(ctx context.Context, token string) (*oidcClaims, error) {
+	verifier, err := oidcTokenVerifier()
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, errors.New("载荷格式错误")
+	}
+	if err := idToken.Claims(&claims.raw); err != nil {
+		return nil, errors.New("载荷格式错误")
+	}
+	return &claims, nil
+}
+
+// 使用 OIDC 访问令牌认证，成功返回 true；失败时已写入响应
+func authenticateOIDCToken(c *gin.Context, token string) bool {
+	claims, err := verifyOIDCToken(c.Request.Context(), token)
+	if err != nil {
+		log.Printf("无效的 OIDC 访问令牌: 路径=%s, 来源=%s, 错误=%v", c.Request.URL.Path, c.ClientIP(), err)
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "无效的访问令牌："+err.Error())
+		return false
+	}
+	name := "oidc:" + claims.clientName()
+	scopes := claims.apiScopes()
+	if scopes == "" || !tokenAllows(scopes, c) {
+		log.Printf("OIDC 访问令牌权限不足: 客户端=%s, 范围=%q, 路径=%s %s", name, scopes, c.Request.Method, c.Request.URL.Path)
+		respondError(c, http.StatusForbidden, codeForbidden, "访问令牌权限不足")
+		return false
+	}
+	servers, err := claims.serverGroups()
+	if err != nil {
+		log.Printf("OIDC 访问令牌的服务器组无效: 客户端=%s, 错误=%v", name, err)
+		respondError(c, http.StatusForbidden, codeForbidden, "访问令牌的服务器组无效："+err.Error())
+		return false
+	}
+	if access := newServerAccess(servers); access != nil {
+		c.Set("server_access", access)
+	}
+	c.Set("api_token", name)
+	c.Set("principal", name)
+	return true
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/spf13/viper"
+)
+
+// 签发测试用的 ES256 访问令牌
+func signTestToken(t *testing.T, key *ecdsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	if err != nil {
+		t.Fatalf("创建签名器失败: %v", err)
+	}
+	payload, _ := json.Marshal(claims)
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	return token
+}
+
+func TestVerifyOIDCToken(t *testing.T) {
+	const issuer = "https://idp.example.com"
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	prevScopePrefix := viper.Get("oidc.scopePrefix")
+	viper.Set("oidc.scopePrefix", "server-manager/")
+	oidcState.Lock()
+	prevVerifier := oidcState.verifier
+	oidcState.verifier = oidc.NewVerifier(issuer, &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{key.Public()}}, oidcVerifierConfig("server-manager"))
+	oidcState.Unlock()
+	t.Cleanup(func() {
+		viper.Set("oidc.scopePrefix", prevScopePrefix)
+		oidcState.Lock()
+		oidcState.verifier = prevVerifier
+		oidcState.Unlock()
+	})
+
+	now := time.Now().Unix()
+	valid := map[string]interface{}{
+		"iss": issuer, "aud": "server-manager", "exp": now + 300, "iat": now,
+		"client_id": "deployer", "scope": "openid server-manager/read server-manager/domains other/admin",
+	}
+	claims, err := verifyOIDCToken(context.Background(), signTestToken(t, key, valid))
+	if err != nil {
+		t.Fatalf("有效令牌校验失败: %v", err)
+	}
+	if claims.clientName() != "deployer" || claims.apiScopes() != "read,domains" {
+		t.Fatalf("声明解析错误: 客户端=%s, 范围=%s", claims.clientName(), claims.apiScopes())
+	}
+
+	cases := map[string]struct {
+		key    *ecdsa.PrivateKey
+		change map[string]interface{}
+	}{
+		"其他应用的受众": {key, map[string]interface{}{"aud": "another-app"}},
+		"缺少受众":    {key, map[string]interface{}{"aud": nil}},
+		"其他签发者":   {key, map[string]interface{}{"iss": "https://evil.example.com"}},
+		"已过期":     {key, map[string]interface{}{"exp": now - 60}},
+		"未知密钥签名":  {other, nil},
+	}
+	for name, tc := range cases {
+		claims := map[string]interface{}{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		for k, v := range tc.change {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		if _, err := verifyOIDCToken(context.Background(), signTestToken(t, tc.key, claims)); err == nil {
+			t.Errorf("%s: 应校验失败", name)
+		}
+	}
+}
+
+func TestOIDCServerGroups(t *testing.T) {
+	prev := viper.Get("oidc.serversClaim")
+	t.Cleanup(func() { viper.Set("oidc.serversClaim", prev) })
+
+	claimsWith := func(raw string) oidcClaims {
+		cl := oidcClaims{raw: map[string]json.RawMessage{}}
+		if raw != "" {
+			cl.raw["server_groups"] = json.RawMessage(raw)
+		}
+		return cl
+	}
+
+	viper.Set("oidc.serversClaim", "")
+	if servers, err := claimsWith(`"tag:sg"`).serverGroups(); err != nil || servers != "" {
+		t.Fatalf("未配置 oidc.serversClaim 时不应限制: %q, %v", servers, err)
+	}
+
+	viper.Set("oidc.serversClaim", "server_groups")
+	cases := []struct {
+		raw     string
+		servers string
+		wantErr bool
+	}{
+		{`["tag:sg", "tag:hk"]`, "tag:sg,tag:hk", false},
+		{`"tag:sg tag:sg"`, "tag:sg", false},
+		{`"*"`, "", false},
+		{``, "", true},
+		{`[]`, "", true},
+		{`["no_such_table"]`, "", true},
+	}
+	for _, tc := range cases {
+		servers, err := claimsWith(tc.raw).serverGroups()
+		if (err != nil) != tc.wantErr || servers != tc.servers {
+			t.Errorf("声明 %s: 服务器组=%q, 错误=%v", tc.raw, servers, err)
+		}
+	}
+}
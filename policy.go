@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 策略规则类型
+const (
+	ruleAvoidRecentUse = "avoid_recent_use" // 排除 Hours 小时内在任一服务器上使用过的域名
+	rulePreferTag      = "prefer_tag"       // 优先选择带 Tag 标签的域名
+	ruleRequireTag     = "require_tag"      // 只选择带 Tag 标签的域名
+	ruleExcludeTag     = "exclude_tag"      // 排除带 Tag 标签的域名
+	rulePortRange      = "port_range"       // 新端口必须在 [Min, Max] 内，0 表示不限
+	ruleBlackout       = "blackout"         // Start-End（HH:MM，可跨午夜）时段内禁止轮换
+)
+
+// 处于禁止轮换时段
+var errPolicyBlackout = errors.New("处于策略禁止轮换时段")
+
+// RotationPolicy 结构体，服务器的轮换策略，Rules 为按顺序执行的规则列表（JSON）
+type RotationPolicy struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ServerTable string `gorm:"column:server_table;type:varchar(255);uniqueIndex:unique_rotation_policy;not null" json:"server_table"`
+	ServerID    int    `gorm:"column:server_id;uniqueIndex:unique_rotation_policy;not null" json:"server_id"`
+	Rules       string `gorm:"column:rules;type:text" json:"rules"`
+	UpdatedAt   int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// PolicyRule 单条策略规则；Soft 为 true 的域名规则在会排除全部候选域名时跳过，而不是使轮换失败
+type PolicyRule struct {
+	Type  string `json:"type"`
+	Hours int    `json:"hours,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	Min   int    `json:"min,omitempty"`
+	Max   int    `json:"max,omitempty"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	Soft  bool   `json:"soft,omitempty"`
+}
+
+// 解析并校验规则列表
+func parsePolicyRules(data string) ([]PolicyRule, error) {
+	var rules []PolicyRule
+	if strings.TrimSpace(data) == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(data), &rules); err != nil {
+		return nil, fmt.Errorf("规则不是有效的 JSON 数组: %v", err)
+	}
+	for i, r := range rules {
+		var err error
+		switch r.Type {
+		case ruleAvoidRecentUse:
+			if r.Hours <= 0 {
+				err = errors.New("hours 必须大于 0")
+			}
+		case rulePreferTag, ruleRequireTag, ruleExcludeTag:
+			if normalizeTags(r.Tag) == "" {
+				err = errors.New("tag 不能为空")
+			}
+			rules[i].Tag = normalizeTags(r.Tag)
+		case rulePortRange:
+			if r.Min < 0 || r.Max < 0 || r.Max > 65535 || (r.Max > 0 && r.Min > r.Max) {
+				err = errors.New("min/max 无效")
+			}
+		case ruleBlackout:
+			if _, e := parseClock(r.Start); e != nil {
+				err = e
+			} else if _, e := parseClock(r.End); e != nil {
+				err = e
+			}
+		default:
+			err = fmt.Errorf("未知的规则类型 %q", r.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条规则无效: %v", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// 解析 HH:MM，返回当天的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间 %q，格式应为 HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// 规范化标签列表：小写、去空格、去重，以逗号分隔
+func normalizeTags(tags string) string {
+	seen := map[string]bool{}
+	var list []string
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			list = append(list, tag)
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+// 域名是否带有指定标签
+func domainHasTag(d ServerDomain, tag string) bool {
+	for _, t := range strings.Split(d.Tags, ",") {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// 加载服务器的策略规则，未配置或规则无效时返回空
+func loadPolicyRules(tx *gorm.DB, table string, id int) []PolicyRule {
+	var policy RotationPolicy
+	if err := tx.Where("server_table = ? AND server_id = ?", table, id).First(&policy).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			log.Printf("获取轮换策略失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		}
+		return nil
+	}
+	rules, err := parsePolicyRules(policy.Rules)
+	if err != nil {
+		log.Printf("轮换策略无效，忽略: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return nil
+	}
+	return rules
+}
+
+// 当前时间命中的禁止轮换规则，未命中返回 nil
+func activeBlackout(rules []PolicyRule, now time.Time) *PolicyRule {
+	minute := now.Hour()*60 + now.Minute()
+	for i, r := range rules {
+		if r.Type != ruleBlackout {
+			continue
+		}
+		start, _ := parseClock(r.Start)
+		end, _ := parseClock(r.End)
+		if (start <= end && minute >= start && minute < end) || (start > end && (minute >= start || minute < end)) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// 端口是否满足全部端口规则
+func portAllowedByPolicy(rules []PolicyRule, port int) bool {
+	for _, r := range rules {
+		if r.Type != rulePortRange {
+			continue
+		}
+		if (r.Min > 0 && port < r.Min) || (r.Max > 0 && port > r.Max) {
+			return false
+		}
+	}
+	return true
+}
+
+// 按顺序对候选域名执行域名规则
+func applyDomainPolicy(tx *gorm.DB, rules []PolicyRule, candidates []ServerDomain, now int64) ([]ServerDomain, error) {
+	for _, r := range rules {
+		var result []ServerDomain
+		switch r.Type {
+		case ruleAvoidRecentUse:
+			names := make([]string, 0, len(candidates))
+			for _, d := range candidates {
+				names = append(names, d.Domain)
+			}
+			var recent []string
+			if len(names) > 0 {
+				if err := tx.Model(&ServerDomain{}).Where("domain IN ? AND (in_use = 1 OR last_used_time > ?)", names, now-int64(r.Hours)*3600).
+					Distinct().Pluck("domain", &recent).Error; err != nil {
+					return nil, fmt.Errorf("查询域名使用记录失败: %v", err)
+				}
+			}
+			recentSet := make(map[string]bool, len(recent))
+			for _, name := range recent {
+				recentSet[name] = true
+			}
+			for _, d := range candidates {
+				if !recentSet[d.Domain] {
+					result = append(result, d)
+				}
+			}
+		case rulePreferTag:
+			var others []ServerDomain
+			for _, d := range candidates {
+				if domainHasTag(d, r.Tag) {
+					result = append(result, d)
+				} else {
+					others = append(others, d)
+				}
+			}
+			result = append(result, others...)
+		case ruleRequireTag, ruleExcludeTag:
+			for _, d := range candidates {
+				if domainHasTag(d, r.Tag) == (r.Type == ruleRequireTag) {
+					result = append(result, d)
+				}
+			}
+		default:
+			continue
+		}
+		if len(result) == 0 {
+			if r.Soft {
+				log.Printf("策略规则 %s 将排除全部候选域名，已跳过（soft）", r.Type)
+				continue
+			}
+			return nil, fmt.Errorf("%w（策略规则 %s 排除了全部候选域名）", errNoAvailableDomain, r.Type)
+		}
+		candidates = result
+	}
+	return candidates, nil
+}
+
+// 注册轮换策略路由
+func registerPolicyRoutes(r *gin.Engine) {
+	// 列出轮换策略，可按 table、id 过滤
+	r.GET("/rotation-policies", authMiddleware, func(c *gin.Context) {
+		q := currentTenant(c).DB.Order("server_table ASC, server_id ASC")
+		if table := c.Query("table"); table != "" {
+			q = q.Where("server_table = ?", table)
+		}
+		if id, err := strconv.Atoi(c.Query("id")); err == nil {
+			q = q.Where("server_id = ?", id)
+		}
+		var policies []RotationPolicy
+		if err := q.Find(&policies).Error; err != nil {
+			log.Printf("获取轮换策略失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取轮换策略失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"policies": policies})
+	})
+
+	// 创建或替换服务器的轮换策略，rules 为规则 JSON 数组
+	r.POST("/rotation-policies", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		if !isValidServerTable(table) {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		rules, err := parsePolicyRules(c.PostForm("rules"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+			return
+		}
+		data, _ := json.Marshal(rules)
+		policy := RotationPolicy{ServerTable: table, ServerID: id, Rules: string(data)}
+		var existing RotationPolicy
+		if err := tdb.Where("server_table = ? AND server_id = ?", table, id).First(&existing).Error; err == nil {
+			policy.ID = existing.ID
+		}
+		if err := tdb.Save(&policy).Error; err != nil {
+			log.Printf("保存轮换策略失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存轮换策略失败："+err.Error())
+			return
+		}
+		log.Printf("保存轮换策略成功: 表=%s, ID=%d, 规则=%s", table, id, policy.Rules)
+		c.JSON(http.StatusOK, gin.H{"message": "轮换策略已保存", "policy": policy})
+	})
+
+	// 删除服务器的轮换策略
+	r.POST("/rotation-policies/delete", authMiddleware, func(c *gin.Context) {
+		table := serverParam(c, "table")
+		id, err := strconv.Atoi(serverParam(c, "id"))
+		if err != nil || id <= 0 || !isValidServerTable(table) {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的表名或ID")
+			return
+		}
+		result := currentTenant(c).DB.Where("server_table = ? AND server_id = ?", table, id).Delete(&RotationPolicy{})
+		if result.Error != nil {
+			log.Printf("删除轮换策略失败: 表=%s, ID=%d, 错误=%v", table, id, result.Error)
+			respondError(c, http.StatusInternalServerError, codeInternal, "删除轮换策略失败："+result.Error.Error())
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "该服务器没有轮换策略")
+			return
+		}
+		log.Printf("删除轮换策略成功: 表=%s, ID=%d", table, id)
+		c.JSON(http.StatusOK, gin.H{"message": "轮换策略已删除"})
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+// 常见服务占用的知名端口，轮换端口不应落在这些端口上
+var wellKnownPorts = map[int]string{
+	21:   "FTP",
+	22:   "SSH",
+	23:   "Telnet",
+	25:   "SMTP",
+	53:   "DNS",
+	80:   "HTTP",
+	110:  "POP3",
+	143:  "IMAP",
+	443:  "HTTPS",
+	465:  "SMTPS",
+	587:  "SMTP 提交",
+	993:  "IMAPS",
+	995:  "POP3S",
+	3306: "MySQL",
+	5432: "PostgreSQL",
+	6379: "Redis",
+}
+
+// PortConflict 端口范围校验发现的冲突
+type PortConflict struct {
+	Port    int    `json:"port"`
+	Kind    string `json:"kind"` // reserved：保留端口；panel：面板端口；protocol：协议限制；invalid：端口无效
+	Table   string `json:"table,omitempty"`
+	Message string `json:"message"`
+}
+
+// 协议端口限制（port.protocols.<表名>.min / max），如 hysteria 只能使用指定的 UDP 端口段
+type protocolPortLimit struct {
+	Min int
+	Max int
+}
+
+// 保留端口：知名端口加上 port.reserved 中配置的端口
+func reservedPorts() map[int]string {
+	ports := make(map[int]string, len(wellKnownPorts))
+	for p, name := range wellKnownPorts {
+		ports[p] = name
+	}
+	for _, p := range viper.GetIntSlice("port.reserved") {
+		if _, ok := ports[p]; !ok {
+			ports[p] = "自定义保留端口"
+		}
+	}
+	return ports
+}
+
+// 面板自身监听的端口（Server.Addr），无法解析时返回 0
+func panelPort() int {
+	_, portStr, err := net.SplitHostPort(viper.GetString("Server.Addr"))
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	return port
+}
+
+// 表对应协议的端口限制，未配置时返回 false
+func protocolPortLimitFor(table string) (protocolPortLimit, bool) {
+	key := "port.protocols." + table
+	if !viper.IsSet(key) {
+		return protocolPortLimit{}, false
+	}
+	limit := protocolPortLimit{Min: viper.GetInt(key + ".min"), Max: viper.GetInt(key + ".max")}
+	if limit.Min <= 0 {
+		limit.Min = 1
+	}
+	if limit.Max <= 0 || limit.Max > 65535 {
+		limit.Max = 65535
+	}
+	return limit, true
+}
+
+// 校验端口范围 [min, max]（list 非空时改为校验离散端口列表）是否与保留端口、面板端口及 tables 的协议限制冲突
+func validatePorts(min, max int, list []int, tables []string) []PortConflict {
+	contains := func(p int) bool { return p >= min && p <= max }
+	lo, hi := min, max
+	if len(list) > 0 {
+		set := make(map[int]bool, len(list))
+		for _, p := range list {
+			set[p] = true
+		}
+		contains = func(p int) bool { return set[p] }
+		lo, hi = list[0], list[len(list)-1]
+	}
+
+	var conflicts []PortConflict
+	if p := panelPort(); p > 0 && contains(p) {
+		conflicts = append(conflicts, PortConflict{Port: p, Kind: "panel", Message: fmt.Sprintf("端口 %d 为面板自身监听端口", p)})
+	}
+	reserved := reservedPorts()
+	ports := make([]int, 0, len(reserved))
+	for p := range reserved {
+		ports = append(ports, p)
+	}
+	sort.Ints(ports)
+	for _, p := range ports {
+		if contains(p) {
+			conflicts = append(conflicts, PortConflict{Port: p, Kind: "reserved", Message: fmt.Sprintf("端口 %d 为保留端口（%s）", p, reserved[p])})
+		}
+	}
+	for _, table := range tables {
+		limit, ok := protocolPortLimitFor(table)
+		if !ok {
+			continue
+		}
+		if lo < limit.Min {
+			conflicts = append(conflicts, PortConflict{Port: lo, Kind: "protocol", Table: table,
+				Message: fmt.Sprintf("端口 %d 低于 %s 允许的范围 %d-%d", lo, table, limit.Min, limit.Max)})
+		}
+		if hi > limit.Max {
+			conflicts = append(conflicts, PortConflict{Port: hi, Kind: "protocol", Table: table,
+				Message: fmt.Sprintf("端口 %d 超出 %s 允许的范围 %d-%d", hi, table, limit.Min, limit.Max)})
+		}
+	}
+	return conflicts
+}
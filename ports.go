@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PortPreset 结构体，命名的端口预设：连续范围（MinPort-MaxPort）或离散端口列表（Ports）
+type PortPreset struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	Name    string `gorm:"column:name;type:varchar(255);uniqueIndex;not null" json:"name"`
+	MinPort int    `gorm:"column:min_port;default:0" json:"min_port"`
+	MaxPort int    `gorm:"column:max_port;default:0" json:"max_port"`
+	Ports   string `gorm:"column:ports;type:varchar(1024);default:''" json:"ports"`
+}
+
+// PortPresetBinding 结构体，将端口预设绑定到整张表（ServerID=0）或单个服务器
+type PortPresetBinding struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ServerTable string `gorm:"column:server_table;type:varchar(255);uniqueIndex:unique_port_binding;not null" json:"server_table"`
+	ServerID    int    `gorm:"column:server_id;uniqueIndex:unique_port_binding;default:0" json:"server_id"`
+	PresetID    uint   `gorm:"column:preset_id;not null" json:"preset_id"`
+}
+
+// 解析离散端口列表（如 "2053/2083,8443"），返回去重排序后的端口
+func parsePortList(raw string) ([]int, error) {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '/' || r == ' ' || r == ';'
+	})
+	seen := map[int]bool{}
+	var ports []int
+	for _, f := range fields {
+		p, err := strconv.Atoi(f)
+		if err != nil || p <= 0 || p > 65535 {
+			return nil, fmt.Errorf("无效的端口: %s", f)
+		}
+		if !seen[p] {
+			seen[p] = true
+			ports = append(ports, p)
+		}
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// 将端口列表格式化为存储格式
+func formatPortList(ports []int) string {
+	parts := make([]string, len(ports))
+	for i, p := range ports {
+		parts[i] = strconv.Itoa(p)
+	}
+	return strings.Join(parts, ",")
+}
+
+// 查找服务器生效的端口预设：服务器绑定优先，其次表绑定；均未绑定时返回 nil
+func resolvePortPreset(tx *gorm.DB, table string, id int) (*PortPreset, error) {
+	var bindings []PortPresetBinding
+	if err := tx.Where("server_table = ? AND server_id IN ?", table, []int{0, id}).
+		Order("server_id DESC").Find(&bindings).Error; err != nil {
+		return nil, err
+	}
+	if len(bindings) == 0 {
+		return nil, nil
+	}
+	var preset PortPreset
+	if err := tx.First(&preset, bindings[0].PresetID).Error; err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+// 为服务器选择与当前端口不同的新端口，使用绑定的预设或全局端口范围
+func pickNextPort(tx *gorm.DB, table string, id int, currentPort int, rules []PolicyRule) (int, error) {
+	settings := currentSettings()
+	min, max := settings.MinPort, settings.MaxPort
+	preset, err := resolvePortPreset(tx, table, id)
+	if err != nil {
+		return 0, fmt.Errorf("获取端口预设失败: %v", err)
+	}
+	if preset != nil {
+		log.Printf("使用端口预设 %s: 表=%s, ID=%d", preset.Name, table, id)
+		if preset.Ports != "" {
+			ports, err := parsePortList(preset.Ports)
+			if err != nil || len(ports) == 0 {
+				return 0, fmt.Errorf("端口预设 %s 的端口列表无效", preset.Name)
+			}
+			allowed := ports[:0]
+			for _, p := range ports {
+				if portAllowedByPolicy(rules, p) {
+					allowed = append(allowed, p)
+				}
+			}
+			if len(allowed) == 0 {
+				return 0, fmt.Errorf("端口预设 %s 中没有满足轮换策略的端口", preset.Name)
+			}
+			// 离散列表只有一个端口时只能沿用该端口
+			if len(allowed) == 1 {
+				return allowed[0], nil
+			}
+			candidates := make([]int, 0, len(allowed))
+			for _, p := range allowed {
+				if p != currentPort {
+					candidates = append(candidates, p)
+				}
+			}
+			return candidates[rand.Intn(len(candidates))], nil
+		}
+		min, max = preset.MinPort, preset.MaxPort
+	}
+	// 与轮换策略的端口规则取交集
+	for _, r := range rules {
+		if r.Type != rulePortRange {
+			continue
+		}
+		if r.Min > min {
+			min = r.Min
+		}
+		if r.Max > 0 && r.Max < max {
+			max = r.Max
+		}
+	}
+	if min > max {
+		return 0, errors.New("可用端口范围与轮换策略的端口规则没有交集")
+	}
+	if min == max {
+		return min, nil
+	}
+	for i := 0; i < 100; i++ {
+		nextPort := rand.Intn(max-min+1) + min
+		if nextPort != currentPort {
+			return nextPort, nil
+		}
+	}
+	return 0, errors.New("无法找到不同的端口")
+}
+
+// 校验端口预设的范围或端口列表
+func validatePreset(preset PortPreset, tables []string) []PortConflict {
+	if preset.Ports != "" {
+		ports, err := parsePortList(preset.Ports)
+		if err != nil || len(ports) == 0 {
+			return []PortConflict{{Kind: "invalid", Message: "无效的端口列表"}}
+		}
+		return validatePorts(0, 0, ports, tables)
+	}
+	return validatePorts(preset.MinPort, preset.MaxPort, nil, tables)
+}
+
+// 注册端口预设管理路由（预设及绑定按租户隔离）
+func registerPortPresetRoutes(r *gin.Engine) {
+	// 列出端口预设及绑定关系
+	r.GET("/port-presets", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		var presets []PortPreset
+		if err := tdb.Order("name ASC").Find(&presets).Error; err != nil {
+			log.Printf("获取端口预设失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取端口预设失败："+err.Error())
+			return
+		}
+		var bindings []PortPresetBinding
+		if err := tdb.Order("server_table ASC, server_id ASC").Find(&bindings).Error; err != nil {
+			log.Printf("获取端口预设绑定失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取端口预设绑定失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"presets": presets, "bindings": bindings})
+	})
+
+	// 创建或更新端口预设（按名称），ports 与 min_port/max_port 二选一
+	r.POST("/port-presets", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		name := strings.TrimSpace(c.PostForm("name"))
+		if name == "" {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "预设名称不能为空")
+			return
+		}
+		preset := PortPreset{Name: name}
+		if portsStr := strings.TrimSpace(c.PostForm("ports")); portsStr != "" {
+			ports, err := parsePortList(portsStr)
+			if err != nil || len(ports) == 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的端口列表")
+				return
+			}
+			preset.Ports = formatPortList(ports)
+		} else {
+			min, err := strconv.Atoi(c.PostForm("min_port"))
+			if err != nil || min <= 0 || min > 65535 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的最小端口")
+				return
+			}
+			max, err := strconv.Atoi(c.PostForm("max_port"))
+			if err != nil || max <= min || max > 65535 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的最大端口")
+				return
+			}
+			preset.MinPort = min
+			preset.MaxPort = max
+		}
+		var existing PortPreset
+		var tables []string
+		if err := tdb.Where("name = ?", name).First(&existing).Error; err == nil {
+			preset.ID = existing.ID
+			// 更新已绑定的预设时，还需满足所绑定表的协议限制
+			tdb.Model(&PortPresetBinding{}).Where("preset_id = ?", existing.ID).Distinct().Pluck("server_table", &tables)
+		}
+		if conflicts := validatePreset(preset, tables); len(conflicts) > 0 {
+			respondError(c, http.StatusBadRequest, codeValidationFailed, "端口范围校验失败", conflicts)
+			return
+		}
+		if err := tdb.Save(&preset).Error; err != nil {
+			log.Printf("保存端口预设失败: 名称=%s, 错误=%v", name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存端口预设失败："+err.Error())
+			return
+		}
+		log.Printf("保存端口预设成功: ID=%d, 名称=%s, 范围=%d-%d, 列表=%s", preset.ID, name, preset.MinPort, preset.MaxPort, preset.Ports)
+		c.JSON(http.StatusOK, gin.H{"message": "端口预设 " + name + " 已保存", "preset": preset})
+	})
+
+	// 删除端口预设及其绑定
+	r.POST("/port-presets/delete", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		id, err := strconv.Atoi(c.PostForm("id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的预设ID")
+			return
+		}
+		err = tdb.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("preset_id = ?", id).Delete(&PortPresetBinding{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&PortPreset{}, id).Error
+		})
+		if err != nil {
+			log.Printf("删除端口预设失败: ID=%d, 错误=%v", id, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "删除端口预设失败："+err.Error())
+			return
+		}
+		log.Printf("删除端口预设成功: ID=%d", id)
+		c.JSON(http.StatusOK, gin.H{"message": "端口预设已删除"})
+	})
+
+	// 绑定端口预设到表或服务器，id 为空或 0 表示整张表，preset_id 为 0 表示解除绑定
+	r.POST("/port-presets/bind", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		table := serverParam(c, "table")
+		if !isValidServerTable(table) {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		id := 0
+		if idStr := serverParam(c, "id"); idStr != "" {
+			var err error
+			id, err = strconv.Atoi(idStr)
+			if err != nil || id < 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+				return
+			}
+		}
+		presetID, err := strconv.Atoi(c.PostForm("preset_id"))
+		if err != nil || presetID < 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的预设ID")
+			return
+		}
+		if presetID == 0 {
+			if err := tdb.Where("server_table = ? AND server_id = ?", table, id).Delete(&PortPresetBinding{}).Error; err != nil {
+				log.Printf("解除端口预设绑定失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+				respondError(c, http.StatusInternalServerError, codeInternal, "解除绑定失败："+err.Error())
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "已解除端口预设绑定"})
+			return
+		}
+		var preset PortPreset
+		if err := tdb.First(&preset, presetID).Error; err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "端口预设不存在")
+			return
+		}
+		if conflicts := validatePreset(preset, []string{table}); len(conflicts) > 0 {
+			respondError(c, http.StatusBadRequest, codeValidationFailed, "端口范围校验失败", conflicts)
+			return
+		}
+		binding := PortPresetBinding{ServerTable: table, ServerID: id, PresetID: preset.ID}
+		var existing PortPresetBinding
+		if err := tdb.Where("server_table = ? AND server_id = ?", table, id).First(&existing).Error; err == nil {
+			binding.ID = existing.ID
+		}
+		if err := tdb.Save(&binding).Error; err != nil {
+			log.Printf("绑定端口预设失败: 表=%s, ID=%d, 预设=%s, 错误=%v", table, id, preset.Name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "绑定端口预设失败："+err.Error())
+			return
+		}
+		log.Printf("绑定端口预设成功: 表=%s, ID=%d, 预设=%s", table, id, preset.Name)
+		c.JSON(http.StatusOK, gin.H{"message": "已绑定端口预设 " + preset.Name})
+	})
+}
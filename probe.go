@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 端口探测结果
+const (
+	probeOpen   = "open"
+	probeClosed = "closed"
+)
+
+// 轮换后端口不可达时写入的状态前缀
+const degradedStatusPrefix = "降级：新端口不可达，"
+
+// 从管理端直接探测 TCP 端口
+func probeTCP(host string, port int, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// 通过远程探测节点探测端口：GET <probe.remoteURL>?host=&port=，响应 {"open": bool, "error": string}
+func probeRemote(remoteURL, host string, port int, timeout time.Duration) error {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return fmt.Errorf("远程探测地址无效: %v", err)
+	}
+	q := u.Query()
+	q.Set("host", host)
+	q.Set("port", strconv.Itoa(port))
+	u.RawQuery = q.Encode()
+	client := &http.Client{Timeout: timeout + 5*time.Second}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return fmt.Errorf("远程探测请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Open  bool   `json:"open"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("远程探测响应无效: %v", err)
+	}
+	if !result.Open {
+		if result.Error == "" {
+			result.Error = "端口未开放"
+		}
+		return fmt.Errorf("远程探测: %s", result.Error)
+	}
+	return nil
+}
+
+// 探测端口，失败时按 probe.attempts 重试
+func probePort(host string, port int) error {
+	timeout := time.Duration(viper.GetInt("probe.timeoutSeconds")) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	attempts := viper.GetInt("probe.attempts")
+	if attempts <= 0 {
+		attempts = 3
+	}
+	remoteURL := viper.GetString("probe.remoteURL")
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(5 * time.Second)
+		}
+		if remoteURL != "" {
+			err = probeRemote(remoteURL, host, port, timeout)
+		} else {
+			err = probeTCP(host, port, timeout)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// 轮换成功后异步探测新端口（probe.enabled 开启时），等待 probe.delaySeconds 让节点侧完成配置变更；
+// 结果记录到本次轮换历史，可达时回写节点心跳，不可达时将服务器状态标记为降级；未开启探测时直接回写心跳
+func schedulePortProbe(t *Tenant, table string, id int, host string, port int) {
+	if !viper.GetBool("probe.enabled") {
+		writeServerHeartbeat(t, table, id, host, port)
+		return
+	}
+	delay := viper.GetInt("probe.delaySeconds")
+	if delay < 0 {
+		delay = 0
+	}
+	go func() {
+		time.Sleep(time.Duration(delay) * time.Second)
+		target := host
+		if ip := lookupNodeIP(t.DB, table, id); ip != "" {
+			target = ip
+		}
+		err := probePort(target, port)
+		if inMaintenance() {
+			log.Printf("维护模式中，丢弃端口探测结果: 表=%s, ID=%d, 错误=%v", table, id, err)
+			return
+		}
+		status, detail := probeOpen, ""
+		if err != nil {
+			status, detail = probeClosed, err.Error()
+		}
+		// 记录到最近一次分配该主机和端口的成功轮换
+		var history RotationHistory
+		if dbErr := t.DB.Where("server_table = ? AND server_id = ? AND status = ? AND new_host = ? AND new_port = ?", table, id, rotationSuccess, host, port).
+			Order("created_at DESC, id DESC").First(&history).Error; dbErr == nil {
+			if dbErr := t.DB.Model(&RotationHistory{}).Where("id = ?", history.ID).Updates(map[string]interface{}{
+				"probe_status": status,
+				"probe_detail": truncate(detail, 255),
+			}).Error; dbErr != nil {
+				log.Printf("记录端口探测结果失败: 表=%s, ID=%d, 错误=%v", table, id, dbErr)
+			}
+		}
+		if err == nil {
+			log.Printf("端口探测通过: 租户=%s, 表=%s, ID=%d, 目标=%s:%d", t.Name, table, id, target, port)
+			writeServerHeartbeat(t, table, id, host, port)
+			return
+		}
+		log.Printf("端口探测失败: 租户=%s, 表=%s, ID=%d, 目标=%s:%d, 错误=%v", t.Name, table, id, target, port, err)
+		// 仅当服务器仍使用本次分配的主机和端口时才标记降级，避免覆盖之后的轮换结果
+		if dbErr := t.DB.Table(table).Where(serverCond(table, "id", "host", "server_port"), id, host, port).
+			Updates(serverFields(table, map[string]interface{}{
+				"last_update_status":      truncate(degradedStatusPrefix+err.Error(), 255),
+				"last_update_status_code": failurePortProbe,
+			})).Error; dbErr != nil {
+			log.Printf("标记服务器降级失败: 表=%s, ID=%d, 错误=%v", table, id, dbErr)
+		}
+		publishEvent(Event{Type: eventPortUnreachable, Tenant: t.Name, ServerTable: table, ServerID: id, NewHost: host, NewPort: port, Error: err.Error()})
+	}()
+}
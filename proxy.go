@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// URL 基础路径（server.basePath，如 /server-manager），用于挂载在反向代理的子路径下；为空表示根路径
+func basePath() string {
+	p := strings.Trim(viper.GetString("server.basePath"), "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// 加上基础路径的站内路径
+func appPath(p string) string {
+	return basePath() + p
+}
+
+// 信任的反向代理（server.trustedProxies，IP 或 CIDR），默认仅本机
+func trustedProxies() []string {
+	if proxies := viper.GetStringSlice("server.trustedProxies"); len(proxies) > 0 {
+		return proxies
+	}
+	return []string{"127.0.0.1"}
+}
+
+// 请求是否来自信任的反向代理
+func fromTrustedProxy(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, p := range trustedProxies() {
+		if _, cidr, err := net.ParseCIDR(p); err == nil {
+			if cidr.Contains(ip) {
+				return true
+			}
+		} else if proxyIP := net.ParseIP(p); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 对外访问地址的协议及主机：来自信任代理时使用 X-Forwarded-Proto / X-Forwarded-Host
+func externalOrigin(req *http.Request) (string, string) {
+	scheme, host := "http", req.Host
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if fromTrustedProxy(req) {
+		if proto := req.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fh := req.Header.Get("X-Forwarded-Host"); fh != "" {
+			// 多级代理时取第一个
+			host, _, _ = strings.Cut(fh, ",")
+			host = strings.TrimSpace(host)
+		}
+	}
+	return scheme, host
+}
+
+// 站内重定向：目标加上基础路径，经信任代理访问时使用代理提供的协议和主机生成完整地址
+func redirectTo(c *gin.Context, p string) {
+	target := appPath(p)
+	if fromTrustedProxy(c.Request) && (c.GetHeader("X-Forwarded-Proto") != "" || c.GetHeader("X-Forwarded-Host") != "") {
+		scheme, host := externalOrigin(c.Request)
+		target = scheme + "://" + host + target
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// 去掉请求路径中的基础路径；不在基础路径下的请求返回 404，访问基础路径本身时重定向到带斜杠的地址
+func basePathHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		base := basePath()
+		if base == "" {
+			h.ServeHTTP(w, req)
+			return
+		}
+		if req.URL.Path == base {
+			http.Redirect(w, req, base+"/", http.StatusFound)
+			return
+		}
+		rest, ok := strings.CutPrefix(req.URL.Path, base+"/")
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		req.URL.Path = "/" + rest
+		req.URL.RawPath = ""
+		h.ServeHTTP(w, req)
+	})
+}
+
+// 自定义响应头中间件：server.headers 中配置的响应头（如安全相关头）附加到所有响应
+func customHeadersMiddleware(c *gin.Context) {
+	for name, value := range viper.GetStringMapString("server.headers") {
+		c.Header(name, value)
+	}
+	c.Next()
+}
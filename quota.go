@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 释放服务器当前域名并累计使用时长，超出使用配额的域名自动退役（受删除保护的域名除外）
+func releaseDomain(tx *gorm.DB, table string, id int, host string, now int64) error {
+	var domain ServerDomain
+	if err := tx.Where("server_table = ? AND server_id = ? AND domain = ?", table, id, host).First(&domain).Error; err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"in_use": 0}
+	if domain.InUse == 1 && domain.LastUsedTime > 0 && now > domain.LastUsedTime {
+		domain.InUseSeconds += now - domain.LastUsedTime
+		updates["in_use_seconds"] = domain.InUseSeconds
+	}
+	if reason := quotaExceeded(domain); reason != "" && domain.Retired == 0 && isProtectedDomain(domain) {
+		log.Printf("域名 %s 超出使用配额但已开启删除保护，不退役: %s, 表=%s, ID=%d", host, reason, table, id)
+	} else if reason != "" && domain.Retired == 0 {
+		updates["retired"] = 1
+		updates["retired_time"] = now
+		updates["retired_reason"] = reason
+		log.Printf("域名 %s 超出使用配额，已退役: %s, 表=%s, ID=%d", host, reason, table, id)
+	}
+	return tx.Model(&ServerDomain{}).Where("id = ?", domain.ID).Updates(updates).Error
+}
+
+// 判断域名是否超出使用配额，返回原因；未超出返回空字符串
+func quotaExceeded(d ServerDomain) string {
+	if d.MaxUses > 0 && d.UseCount >= d.MaxUses {
+		return fmt.Sprintf("使用次数已达上限 %d", d.MaxUses)
+	}
+	if d.MaxInUseHours > 0 && d.InUseSeconds >= int64(d.MaxInUseHours)*3600 {
+		return fmt.Sprintf("累计使用时长已达上限 %d 小时", d.MaxInUseHours)
+	}
+	return ""
+}
+
+// 注册域名配额路由
+func registerDomainQuotaRoutes(r *gin.Engine) {
+	// 设置域名使用配额（0 表示不限制）
+	r.POST("/domain-quota", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		domain, ok := findRequestDomain(c)
+		if !ok {
+			return
+		}
+		updates := map[string]interface{}{}
+		if v, ok := c.GetPostForm("max_uses"); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的最大使用次数")
+				return
+			}
+			updates["max_uses"] = n
+		}
+		if v, ok := c.GetPostForm("max_in_use_hours"); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的最大使用时长")
+				return
+			}
+			updates["max_in_use_hours"] = n
+		}
+		if len(updates) == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "没有需要更新的字段")
+			return
+		}
+		if err := tdb.Model(&ServerDomain{}).Where("id = ?", domain.ID).Updates(updates).Error; err != nil {
+			log.Printf("设置域名配额失败: ID=%d, 域名=%s, 错误=%v", domain.ID, domain.Domain, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "设置域名配额失败："+err.Error())
+			return
+		}
+		log.Printf("设置域名配额成功: ID=%d, 域名=%s, 配额=%v", domain.ID, domain.Domain, updates)
+		c.JSON(http.StatusOK, gin.H{"message": "域名 " + domain.Domain + " 配额已更新"})
+	})
+
+	// 恢复已退役的域名，reset_usage=1 时同时清零使用统计
+	r.POST("/domain-restore-retired", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		domain, ok := findRequestDomain(c)
+		if !ok {
+			return
+		}
+		if domain.Retired == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "域名未退役")
+			return
+		}
+		updates := map[string]interface{}{"retired": 0, "retired_time": 0, "retired_reason": ""}
+		if c.PostForm("reset_usage") == "1" {
+			updates["use_count"] = 0
+			updates["in_use_seconds"] = 0
+		}
+		if err := tdb.Model(&ServerDomain{}).Where("id = ?", domain.ID).Updates(updates).Error; err != nil {
+			log.Printf("恢复退役域名失败: ID=%d, 域名=%s, 错误=%v", domain.ID, domain.Domain, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "恢复域名失败："+err.Error())
+			return
+		}
+		log.Printf("恢复退役域名成功: ID=%d, 域名=%s", domain.ID, domain.Domain)
+		c.JSON(http.StatusOK, gin.H{"message": "域名 " + domain.Domain + " 已恢复轮换"})
+	})
+}
+
+// 根据表单中的 table、id、domain_id 在当前租户中查找域名，失败时已写入响应
+func findRequestDomain(c *gin.Context) (ServerDomain, bool) {
+	var domain ServerDomain
+	table := serverParam(c, "table")
+	idStr := serverParam(c, "id")
+	domainIDStr := serverParam(c, "domain_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		log.Printf("无效的服务器ID: %s", idStr)
+		respondError(c, http.StatusBadRequest, codeInvalidID, "无效的服务器ID")
+		return domain, false
+	}
+	domainID, err := strconv.Atoi(domainIDStr)
+	if err != nil || domainID <= 0 {
+		log.Printf("无效的域名ID: %s", domainIDStr)
+		respondError(c, http.StatusBadRequest, codeInvalidID, "无效的域名ID")
+		return domain, false
+	}
+	if !isValidServerTable(table) {
+		log.Printf("无效的表名: %s", table)
+		respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+		return domain, false
+	}
+	if err := currentTenant(c).DB.Where("id = ? AND server_table = ? AND server_id = ?", domainID, table, id).First(&domain).Error; err != nil {
+		log.Printf("域名不存在: ID=%d, 表=%s, 服务器ID=%d, 错误=%v", domainID, table, id, err)
+		respondError(c, http.StatusBadRequest, codeDomainNotFound, "域名不存在")
+		return domain, false
+	}
+	return domain, true
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DomainMove 再平衡中的一次域名迁移
+type DomainMove struct {
+	DomainID  uint   `json:"domain_id"`
+	Domain    string `json:"domain"`
+	FromTable string `json:"from_table"`
+	FromID    int    `json:"from_id"`
+	ToTable   string `json:"to_table"`
+	ToID      int    `json:"to_id"`
+	Skipped   string `json:"skipped,omitempty"` // 执行时跳过的原因
+}
+
+// 参与再平衡的服务器
+type rebalanceServer struct {
+	Table     string
+	ID        int
+	Group     string // 服务器标签，只在标签相同的服务器之间迁移
+	Available []ServerDomain
+	Names     map[string]bool // 域名池中已有的域名
+}
+
+// 计算再平衡方案：可用域名数高于 threshold 的服务器把多出的未使用域名迁移给低于 threshold 的服务器，
+// 只在同组（服务器标签相同）服务器之间迁移；tag 非空时只处理带该标签的服务器；返回迁移方案及仍不足的服务器
+func planDomainRebalance(t *Tenant, threshold int, table, tag string, now int64) ([]DomainMove, []gin.H, error) {
+	var settings []ServerSetting
+	if err := t.DB.Find(&settings).Error; err != nil {
+		return nil, nil, err
+	}
+	tags := make(map[string]string, len(settings))
+	for _, s := range settings {
+		tags[s.ServerTable+":"+strconv.Itoa(s.ServerID)] = s.Tags
+	}
+	groups := map[string][]*rebalanceServer{}
+	for _, tbl := range serverTables(t) {
+		if table != "" && tbl != table {
+			continue
+		}
+		var servers []struct {
+			ID   int
+			Host string
+		}
+		if err := t.DB.Table(tbl).Select(serverSelect(tbl, "id", "host")).Find(&servers).Error; err != nil {
+			return nil, nil, err
+		}
+		for _, s := range servers {
+			group := tags[tbl+":"+strconv.Itoa(s.ID)]
+			if tag != "" && !serverTagsContain(group, tag) {
+				continue
+			}
+			available, err := t.Domains.Available(t.DB, tbl, s.ID, s.Host, now)
+			if err != nil {
+				return nil, nil, err
+			}
+			var names []string
+			if err := t.DB.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", tbl, s.ID).Pluck("domain", &names).Error; err != nil {
+				return nil, nil, err
+			}
+			server := &rebalanceServer{Table: tbl, ID: s.ID, Group: group, Available: available, Names: map[string]bool{}}
+			for _, name := range names {
+				server.Names[name] = true
+			}
+			groups[group] = append(groups[group], server)
+		}
+	}
+	var moves []DomainMove
+	var short []gin.H
+	groupNames := make([]string, 0, len(groups))
+	for group := range groups {
+		groupNames = append(groupNames, group)
+	}
+	sort.Strings(groupNames)
+	for _, group := range groupNames {
+		servers := groups[group]
+		// 缺口最大的服务器优先接收，富余最多的服务器优先转出
+		sort.SliceStable(servers, func(i, j int) bool { return len(servers[i].Available) < len(servers[j].Available) })
+		for _, recipient := range servers {
+			for len(recipient.Available) < threshold {
+				var donor *rebalanceServer
+				for _, s := range servers {
+					if s != recipient && len(s.Available) > threshold && (donor == nil || len(s.Available) > len(donor.Available)) {
+						donor = s
+					}
+				}
+				if donor == nil {
+					break
+				}
+				// 选择接收方池中没有的、最久未使用的域名
+				picked := -1
+				for i, d := range donor.Available {
+					if !recipient.Names[d.Domain] {
+						picked = i
+						break
+					}
+				}
+				if picked < 0 {
+					break
+				}
+				d := donor.Available[picked]
+				donor.Available = append(donor.Available[:picked], donor.Available[picked+1:]...)
+				delete(donor.Names, d.Domain)
+				recipient.Available = append(recipient.Available, d)
+				recipient.Names[d.Domain] = true
+				moves = append(moves, DomainMove{DomainID: d.ID, Domain: d.Domain, FromTable: donor.Table, FromID: donor.ID, ToTable: recipient.Table, ToID: recipient.ID})
+			}
+			if len(recipient.Available) < threshold {
+				short = append(short, gin.H{"table": recipient.Table, "id": recipient.ID, "group": group, "available": len(recipient.Available)})
+			}
+		}
+	}
+	return moves, short, nil
+}
+
+// 服务器标签列表是否包含指定标签
+func serverTagsContain(tags, tag string) bool {
+	return domainHasTag(ServerDomain{Tags: tags}, tag)
+}
+
+// 执行迁移：每个域名仅在仍位于原服务器且未被使用时迁移，解析校验结果因节点不同一并清空
+func applyDomainMoves(t *Tenant, moves []DomainMove) (int, error) {
+	moved := 0
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		for i, m := range moves {
+			var maxOrder int
+			tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", m.ToTable, m.ToID).Select("MAX(`order`)").Scan(&maxOrder)
+			var count int64
+			tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND domain = ?", m.ToTable, m.ToID, m.Domain).Count(&count)
+			if count > 0 {
+				moves[i].Skipped = "目标服务器已有该域名"
+				continue
+			}
+			result := tx.Model(&ServerDomain{}).
+				Where("id = ? AND server_table = ? AND server_id = ? AND in_use = 0", m.DomainID, m.FromTable, m.FromID).
+				Updates(map[string]interface{}{
+					"server_table":     m.ToTable,
+					"server_id":        m.ToID,
+					"order":            maxOrder + 1,
+					"dns_status":       "",
+					"dns_detail":       "",
+					"dns_checked_time": 0,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				moves[i].Skipped = "域名已被使用或已变更"
+				continue
+			}
+			moved++
+		}
+		return nil
+	})
+	return moved, err
+}
+
+// 注册域名池再平衡路由
+func registerRebalanceRoutes(r *gin.Engine) {
+	// 域名池再平衡：threshold 为目标最少可用域名数（默认 3），可按 table、tag 限定范围；
+	// dry_run 默认为 1，仅返回迁移方案，dry_run=0 时执行
+	r.POST("/rebalance-domains", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		threshold := 3
+		if v := c.PostForm("threshold"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的阈值")
+				return
+			}
+			threshold = n
+		}
+		table := c.PostForm("table")
+		if table != "" && !isValidServerTable(table) {
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		moves, short, err := planDomainRebalance(t, threshold, table, normalizeTags(c.PostForm("tag")), time.Now().Unix())
+		if err != nil {
+			log.Printf("计算域名再平衡方案失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "计算再平衡方案失败："+err.Error())
+			return
+		}
+		if moves == nil {
+			moves = []DomainMove{}
+		}
+		if c.DefaultPostForm("dry_run", "1") != "0" {
+			c.JSON(http.StatusOK, gin.H{"dry_run": true, "moves": moves, "still_short": short})
+			return
+		}
+		moved, err := applyDomainMoves(t, moves)
+		if err != nil {
+			log.Printf("执行域名再平衡失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "执行再平衡失败："+err.Error())
+			return
+		}
+		log.Printf("域名再平衡完成: 租户=%s, 阈值=%d, 迁移 %d/%d 个域名", t.Name, threshold, moved, len(moves))
+		c.JSON(http.StatusOK, gin.H{"dry_run": false, "moved": moved, "moves": moves, "still_short": short})
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// DeletedDomain 结构体，回收站中的已删除域名，Data 为删除时完整记录的快照
+type DeletedDomain struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	OriginalID  uint   `gorm:"column:original_id;not null" json:"original_id"`
+	ServerTable string `gorm:"column:server_table;type:varchar(255);index:idx_deleted_domains_server;not null" json:"server_table"`
+	ServerID    int    `gorm:"column:server_id;index:idx_deleted_domains_server;not null" json:"server_id"`
+	Domain      string `gorm:"column:domain;type:varchar(255);not null" json:"domain"`
+	Data        string `gorm:"column:data;type:text" json:"-"`
+	DeletedAt   int64  `gorm:"column:deleted_at;index;not null" json:"deleted_at"`
+}
+
+// 回收站保留天数，默认 30 天
+func recycleRetentionDays() int {
+	days := viper.GetInt("recycle.retentionDays")
+	if days <= 0 {
+		days = 30
+	}
+	return days
+}
+
+// 在 tx 中将域名移入回收站并从域名池删除
+func moveDomainToRecycleBin(tx *gorm.DB, domain ServerDomain, now int64) error {
+	data, err := json.Marshal(domain)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(&DeletedDomain{
+		OriginalID:  domain.ID,
+		ServerTable: domain.ServerTable,
+		ServerID:    domain.ServerID,
+		Domain:      domain.Domain,
+		Data:        string(data),
+		DeletedAt:   now,
+	}).Error; err != nil {
+		return fmt.Errorf("移入回收站失败: %v", err)
+	}
+	return tx.Delete(&ServerDomain{}, domain.ID).Error
+}
+
+// 从回收站恢复域名：保留原有元数据及使用统计，重新排在服务器域名末尾且不处于使用中
+func restoreDeletedDomain(t *Tenant, deletedID int) (ServerDomain, error) {
+	var restored ServerDomain
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		var deleted DeletedDomain
+		if err := tx.First(&deleted, deletedID).Error; err != nil {
+			return errors.New("回收站中不存在该域名")
+		}
+		var count int64
+		tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND domain = ?", deleted.ServerTable, deleted.ServerID, deleted.Domain).Count(&count)
+		if count > 0 {
+			return errDomainExists
+		}
+		if err := json.Unmarshal([]byte(deleted.Data), &restored); err != nil {
+			return fmt.Errorf("回收站记录损坏: %v", err)
+		}
+		var maxOrder int
+		tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", deleted.ServerTable, deleted.ServerID).Select("MAX(`order`)").Scan(&maxOrder)
+		restored.ID = 0
+		restored.InUse = 0
+		restored.Order = maxOrder + 1
+		if err := tx.Create(&restored).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&DeletedDomain{}, deleted.ID).Error
+	})
+	return restored, err
+}
+
+// 清理所有租户回收站中超过保留期的域名
+func purgeRecycleBin() {
+	cutoff := time.Now().Unix() - int64(recycleRetentionDays()*86400)
+	for _, t := range tenantList() {
+		result := t.DB.Where("deleted_at < ?", cutoff).Delete(&DeletedDomain{})
+		if result.Error != nil {
+			log.Printf("清理回收站失败: 租户=%s, 错误=%v", t.Name, result.Error)
+			continue
+		}
+		log.Printf("清理回收站过期域名 %d 个: 租户=%s", result.RowsAffected, t.Name)
+	}
+}
+
+// 注册回收站路由
+func registerRecycleBinRoutes(r *gin.Engine) {
+	// 列出回收站中的域名，可按 table、id 过滤
+	r.GET("/deleted-domains", authMiddleware, httpCacheMiddleware, func(c *gin.Context) {
+		q := currentTenant(c).DB.Scopes(serverAccessScope(c)).Order("deleted_at DESC, id DESC")
+		if table := c.Query("table"); table != "" {
+			if !isValidServerTable(table) {
+				respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+				return
+			}
+			q = q.Where("server_table = ?", table)
+		}
+		if idStr := c.Query("id"); idStr != "" {
+			id, err := strconv.Atoi(idStr)
+			if err != nil || id <= 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+				return
+			}
+			q = q.Where("server_id = ?", id)
+		}
+		var deleted []DeletedDomain
+		if err := q.Find(&deleted).Error; err != nil {
+			log.Printf("获取回收站失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取回收站失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"domains": deleted, "retention_days": recycleRetentionDays()})
+	})
+
+	// 从回收站恢复域名
+	r.POST("/deleted-domains/restore", authMiddleware, func(c *gin.Context) {
+		id, err := strconv.Atoi(serverParam(c, "id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的回收站记录ID")
+			return
+		}
+		t := currentTenant(c)
+		restored, err := restoreDeletedDomain(t, id)
+		if err != nil {
+			log.Printf("恢复域名失败: 回收站ID=%d, 错误=%v", id, err)
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "恢复域名失败："+err.Error())
+			return
+		}
+		log.Printf("从回收站恢复域名成功: 域名=%s, 表=%s, 服务器ID=%d", restored.Domain, restored.ServerTable, restored.ServerID)
+		publishEvent(Event{Type: eventDomainAdded, Tenant: t.Name, ServerTable: restored.ServerTable, ServerID: restored.ServerID, Domain: restored.Domain})
+		c.JSON(http.StatusOK, gin.H{"message": "域名 " + restored.Domain + " 已恢复", "domain": restored})
+	})
+
+	// 从回收站永久删除域名，需确认令牌 purge-domain
+	r.POST("/deleted-domains/purge", authMiddleware, func(c *gin.Context) {
+		id, err := strconv.Atoi(serverParam(c, "id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的回收站记录ID")
+			return
+		}
+		if !consumeConfirmToken(c, confirmPurgeDomain) {
+			return
+		}
+		result := currentTenant(c).DB.Delete(&DeletedDomain{}, id)
+		if result.Error != nil {
+			log.Printf("永久删除域名失败: 回收站ID=%d, 错误=%v", id, result.Error)
+			respondError(c, http.StatusInternalServerError, codeInternal, "永久删除失败："+result.Error.Error())
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "回收站中不存在该域名")
+			return
+		}
+		log.Printf("永久删除回收站域名: 回收站ID=%d", id)
+		c.JSON(http.StatusOK, gin.H{"message": "域名已永久删除"})
+	})
+}
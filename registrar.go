@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// Registrar 域名注册商，域名库存不足时自动购买；新增注册商只需实现此接口并在 newRegistrar 中注册
+type Registrar interface {
+	Name() string
+	// 查询域名是否可注册及首年价格（美元）
+	Check(ctx context.Context, domain string) (bool, float64, error)
+	// 注册域名 years 年，price 为 Check 返回的价格
+	Register(ctx context.Context, domain string, years int, price float64) error
+}
+
+// 已配置的注册商（[registrars.<名称>]，type 为 namecheap、porkbun 或 dryrun），首次使用时加载
+var (
+	registrarsOnce sync.Once
+	registrars     map[string]Registrar
+)
+
+func loadRegistrars() {
+	registrars = map[string]Registrar{}
+	for name := range viper.GetStringMap("registrars") {
+		cfg := viper.Sub("registrars." + name)
+		if cfg == nil {
+			continue
+		}
+		registrar, err := newRegistrar(name, cfg)
+		if err != nil {
+			log.Printf("注册商 %s 配置无效: %v", name, err)
+			continue
+		}
+		registrars[name] = registrar
+	}
+}
+
+func newRegistrar(name string, cfg *viper.Viper) (Registrar, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	switch cfg.GetString("type") {
+	case "namecheap":
+		if cfg.GetString("apiUser") == "" || cfg.GetString("apiKey") == "" || cfg.GetString("clientIP") == "" {
+			return nil, errors.New("缺少 apiUser、apiKey 或 clientIP")
+		}
+		return &namecheapRegistrar{
+			api:     &namecheapProvider{name: name, apiUser: cfg.GetString("apiUser"), apiKey: cfg.GetString("apiKey"), clientIP: cfg.GetString("clientIP"), client: client},
+			price:   cfg.GetFloat64("price"),
+			contact: cfg.GetStringMapString("contact"),
+		}, nil
+	case "porkbun":
+		if cfg.GetString("apiKey") == "" || cfg.GetString("secretKey") == "" {
+			return nil, errors.New("缺少 apiKey 或 secretKey")
+		}
+		return &porkbunRegistrar{name: name, apiKey: cfg.GetString("apiKey"), secretKey: cfg.GetString("secretKey"), client: client}, nil
+	case "dryrun":
+		return &dryrunRegistrar{name: name, price: cfg.GetFloat64("price")}, nil
+	}
+	return nil, fmt.Errorf("不支持的类型: %q", cfg.GetString("type"))
+}
+
+// Namecheap：domains.check 查询可注册性，普通域名价格取配置的 price；domains.create 需要完整的联系人信息（contact）
+type namecheapRegistrar struct {
+	api     *namecheapProvider
+	price   float64
+	contact map[string]string
+}
+
+// Namecheap 联系人参数名（不含 Registrant/Tech/Admin/AuxBilling 前缀）
+var namecheapContactFields = []string{"FirstName", "LastName", "Address1", "City", "StateProvince", "PostalCode", "Country", "Phone", "EmailAddress"}
+
+func (r *namecheapRegistrar) Name() string { return r.api.name }
+
+func (r *namecheapRegistrar) Check(ctx context.Context, domain string) (bool, float64, error) {
+	result, err := r.api.call(ctx, url.Values{"Command": {"namecheap.domains.check"}, "DomainList": {domain}})
+	if err != nil {
+		return false, 0, err
+	}
+	for _, c := range result.Checks {
+		if !strings.EqualFold(c.Domain, domain) {
+			continue
+		}
+		if c.IsPremium {
+			price, _ := strconv.ParseFloat(c.PremiumPrice, 64)
+			return c.Available, price, nil
+		}
+		return c.Available, r.price, nil
+	}
+	return false, 0, fmt.Errorf("响应中没有域名 %s 的查询结果", domain)
+}
+
+func (r *namecheapRegistrar) Register(ctx context.Context, domain string, years int, price float64) error {
+	form := url.Values{"Command": {"namecheap.domains.create"}, "DomainName": {domain}, "Years": {strconv.Itoa(years)}}
+	for _, prefix := range []string{"Registrant", "Tech", "Admin", "AuxBilling"} {
+		for _, field := range namecheapContactFields {
+			value := r.contact[strings.ToLower(field)]
+			if value == "" {
+				return fmt.Errorf("缺少联系人信息 contact.%s", field)
+			}
+			form.Set(prefix+field, value)
+		}
+	}
+	result, err := r.api.call(ctx, form)
+	if err != nil {
+		return err
+	}
+	if !result.Created.Registered {
+		return fmt.Errorf("Namecheap 未完成注册: %s", domain)
+	}
+	return nil
+}
+
+// Porkbun：checkDomain 返回可注册性及价格，domain/create 以美分提交确认的价格
+type porkbunRegistrar struct {
+	name      string
+	apiKey    string
+	secretKey string
+	client    *http.Client
+}
+
+func (r *porkbunRegistrar) Name() string { return r.name }
+
+func (r *porkbunRegistrar) call(ctx context.Context, path string, params map[string]interface{}, out interface{}) error {
+	body := map[string]interface{}{"apikey": r.apiKey, "secretapikey": r.secretKey}
+	for k, v := range params {
+		body[k] = v
+	}
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.porkbun.com/api/json/v3"+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var status struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return fmt.Errorf("响应无效（状态码 %d）: %v", resp.StatusCode, err)
+	}
+	if status.Status != "SUCCESS" {
+		return fmt.Errorf("Porkbun 返回错误: %s", status.Message)
+	}
+	if out != nil {
+		return json.Unmarshal(raw, out)
+	}
+	return nil
+}
+
+func (r *porkbunRegistrar) Check(ctx context.Context, domain string) (bool, float64, error) {
+	var result struct {
+		Response struct {
+			Avail string `json:"avail"`
+			Price string `json:"price"`
+		} `json:"response"`
+	}
+	if err := r.call(ctx, "/domain/checkDomain/"+domain, nil, &result); err != nil {
+		return false, 0, err
+	}
+	price, _ := strconv.ParseFloat(result.Response.Price, 64)
+	return result.Response.Avail == "yes", price, nil
+}
+
+func (r *porkbunRegistrar) Register(ctx context.Context, domain string, years int, price float64) error {
+	return r.call(ctx, "/domain/create/"+domain, map[string]interface{}{
+		"cost":          int64(price*100+0.5) * int64(years),
+		"agreeToTerms":  "yes",
+		"minDuration":   years,
+		"autoRenewFlag": 0,
+	}, nil)
+}
+
+// 试运行注册商：所有域名均可注册，价格为配置的 price，不发起真实购买，用于验证购买流程
+type dryrunRegistrar struct {
+	name  string
+	price float64
+}
+
+func (r *dryrunRegistrar) Name() string { return r.name }
+
+func (r *dryrunRegistrar) Check(ctx context.Context, domain string) (bool, float64, error) {
+	return true, r.price, nil
+}
+
+func (r *dryrunRegistrar) Register(ctx context.Context, domain string, years int, price float64) error {
+	log.Printf("试运行注册商 %s: 模拟注册域名 %s，%d 年，价格 %.2f", r.name, domain, years, price)
+	return nil
+}
+
+// DomainPurchase 结构体，自动购买域名的记录，用于预算统计及审计
+type DomainPurchase struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	Domain      string  `gorm:"column:domain;type:varchar(255);index;not null" json:"domain"`
+	Registrar   string  `gorm:"column:registrar;type:varchar(255);not null" json:"registrar"`
+	Price       float64 `gorm:"column:price;type:decimal(10,2);default:0" json:"price"`
+	ServerTable string  `gorm:"column:server_table;type:varchar(255);not null" json:"server_table"`
+	ServerID    int     `gorm:"column:server_id;not null" json:"server_id"`
+	Status      string  `gorm:"column:status;type:varchar(32);not null" json:"status"` // registered 或 failed
+	Error       string  `gorm:"column:error;type:varchar(1024);default:''" json:"error"`
+	CreatedAt   int64   `gorm:"column:created_at;index;not null" json:"created_at"`
+}
+
+// 购买记录状态
+const (
+	purchaseRegistered = "registered"
+	purchaseFailed     = "failed"
+)
+
+// 自动购买使用的注册商（acquire.registrar）
+func acquireRegistrar() (Registrar, error) {
+	registrarsOnce.Do(loadRegistrars)
+	name := viper.GetString("acquire.registrar")
+	if name == "" {
+		return nil, errors.New("未配置 acquire.registrar")
+	}
+	registrar, ok := registrars[name]
+	if !ok {
+		return nil, fmt.Errorf("注册商 %s 未配置或配置无效", name)
+	}
+	return registrar, nil
+}
+
+// 触发自动购买的可用域名阈值（acquire.threshold），默认 3
+func acquireThreshold() int64 {
+	if n := viper.GetInt64("acquire.threshold"); n > 0 {
+		return n
+	}
+	return 3
+}
+
+// 本月已花费的购买金额
+func monthlyPurchaseSpend(t *Tenant, now time.Time) (float64, error) {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).Unix()
+	var spent float64
+	err := t.DB.Model(&DomainPurchase{}).Where("status = ? AND created_at >= ?", purchaseRegistered, start).
+		Select("COALESCE(SUM(price), 0)").Scan(&spent).Error
+	return spent, err
+}
+
+// 按 acquire.pattern 生成候选域名：{random} 替换为 6 位随机字母数字，{id} 替换为服务器 ID
+func candidateDomain(pattern string, id int) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	random := make([]byte, 6)
+	for i := range random {
+		n, _ := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		random[i] = alphabet[n.Int64()]
+	}
+	d := strings.ReplaceAll(pattern, "{random}", string(random))
+	return strings.ReplaceAll(d, "{id}", strconv.Itoa(id))
+}
+
+// 同一服务器同一时间只进行一次购买
+var acquiring sync.Map
+
+// 为服务器购买 count 个域名：按模式生成候选，跳过不可注册、超出单价上限（acquire.maxPrice）或
+// 月度预算（acquire.monthlyBudget）的域名；购买成功的域名加入服务器，标记为等待解析，
+// 在 acquire.pendingSeconds 内不参与轮换。返回购买成功的域名
+func acquireDomains(t *Tenant, table string, id int, count int) ([]string, error) {
+	key := fmt.Sprintf("%s:%s:%d", t.Name, table, id)
+	if _, busy := acquiring.LoadOrStore(key, true); busy {
+		return nil, errors.New("该服务器正在购买域名")
+	}
+	defer acquiring.Delete(key)
+
+	registrar, err := acquireRegistrar()
+	if err != nil {
+		return nil, err
+	}
+	pattern := viper.GetString("acquire.pattern")
+	if !strings.Contains(pattern, "{random}") {
+		return nil, errors.New("acquire.pattern 须包含 {random}")
+	}
+	maxPrice := viper.GetFloat64("acquire.maxPrice")
+	budget := viper.GetFloat64("acquire.monthlyBudget")
+	if budget <= 0 {
+		return nil, errors.New("未配置月度预算 acquire.monthlyBudget")
+	}
+	years := viper.GetInt("acquire.years")
+	if years <= 0 {
+		years = 1
+	}
+	attempts := viper.GetInt("acquire.maxAttempts")
+	if attempts <= 0 {
+		attempts = 10
+	}
+
+	var bought []string
+	for i := 0; i < attempts && len(bought) < count; i++ {
+		domain, err := normalizeDomain(candidateDomain(pattern, id))
+		if err != nil {
+			return bought, fmt.Errorf("acquire.pattern 生成的域名无效: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		available, price, err := registrar.Check(ctx, domain)
+		cancel()
+		if err != nil {
+			log.Printf("自动购买: 查询域名 %s 失败: 注册商=%s, 错误=%v", domain, registrar.Name(), err)
+			continue
+		}
+		if !available {
+			continue
+		}
+		if maxPrice > 0 && price > maxPrice {
+			log.Printf("自动购买: 域名 %s 价格 %.2f 超出单价上限 %.2f，跳过", domain, price, maxPrice)
+			continue
+		}
+		spent, err := monthlyPurchaseSpend(t, time.Now().In(appLocation()))
+		if err != nil {
+			return bought, err
+		}
+		if spent+price*float64(years) > budget {
+			return bought, fmt.Errorf("本月已花费 %.2f，购买 %s（%.2f）将超出月度预算 %.2f", spent, domain, price*float64(years), budget)
+		}
+
+		purchase := DomainPurchase{Domain: domain, Registrar: registrar.Name(), Price: price * float64(years), ServerTable: table, ServerID: id, Status: purchaseRegistered, CreatedAt: time.Now().Unix()}
+		ctx, cancel = context.WithTimeout(context.Background(), 60*time.Second)
+		err = registrar.Register(ctx, domain, years, price)
+		cancel()
+		if err != nil {
+			purchase.Status, purchase.Error = purchaseFailed, truncate(err.Error(), 1024)
+			log.Printf("自动购买: 注册域名 %s 失败: 注册商=%s, 错误=%v", domain, registrar.Name(), err)
+		}
+		if dbErr := t.DB.Create(&purchase).Error; dbErr != nil {
+			log.Printf("记录域名购买失败: 域名=%s, 错误=%v", domain, dbErr)
+		}
+		if err != nil {
+			continue
+		}
+
+		if err := addServerDomain(t, table, id, domain); err != nil {
+			log.Printf("自动购买: 域名 %s 已注册但加入服务器失败: 表=%s, ID=%d, 错误=%v", domain, table, id, err)
+			continue
+		}
+		now := time.Now().Unix()
+		pending := viper.GetInt64("acquire.pendingSeconds")
+		if pending <= 0 {
+			pending = 3600
+		}
+		if err := t.DB.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND domain = ?", table, id, domain).
+			Updates(map[string]interface{}{
+				"registrar":     registrar.Name(),
+				"purchase_date": now,
+				"cost":          purchase.Price,
+				"dns_status":    dnsStatusPending,
+				"dns_detail":    "新购域名，等待解析生效",
+				"staged_until":  now + pending,
+			}).Error; err != nil {
+			log.Printf("自动购买: 更新域名 %s 信息失败: %v", domain, err)
+		}
+		log.Printf("自动购买域名成功: 租户=%s, 表=%s, ID=%d, 域名=%s, 注册商=%s, 价格=%.2f", t.Name, table, id, domain, registrar.Name(), purchase.Price)
+		bought = append(bought, domain)
+	}
+	if len(bought) < count {
+		return bought, fmt.Errorf("尝试 %d 个候选域名，仅购买成功 %d/%d 个", attempts, len(bought), count)
+	}
+	return bought, nil
+}
+
+// 自动购买接收端：域名耗尽或轮换后可用域名低于阈值时，后台为该服务器购买域名
+type acquireSink struct{}
+
+func (acquireSink) Name() string { return "acquire" }
+
+func (acquireSink) Handle(e Event) error {
+	if e.Type != eventDomainExhausted && e.Type != eventRotationSucceeded {
+		return nil
+	}
+	t, ok := lookupTenant(e.Tenant)
+	if !ok {
+		return fmt.Errorf("未知的租户: %s", e.Tenant)
+	}
+	counts, err := t.Domains.Count(e.ServerTable, e.ServerID, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	threshold := acquireThreshold()
+	if counts.Available >= threshold {
+		return nil
+	}
+	count := viper.GetInt("acquire.count")
+	if count <= 0 {
+		count = 1
+	}
+	log.Printf("可用域名 %d 个，低于阈值 %d，开始自动购买 %d 个: 租户=%s, 表=%s, ID=%d", counts.Available, threshold, count, t.Name, e.ServerTable, e.ServerID)
+	go func() {
+		if _, err := acquireDomains(t, e.ServerTable, e.ServerID, count); err != nil {
+			log.Printf("自动购买域名未完成: 租户=%s, 表=%s, ID=%d, 错误=%v", t.Name, e.ServerTable, e.ServerID, err)
+		}
+	}()
+	return nil
+}
+
+// 注册域名购买路由
+func registerRegistrarRoutes(r *gin.Engine) {
+	// 购买记录
+	r.GET("/domain-purchases", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		var purchases []DomainPurchase
+		if err := t.DB.Order("id DESC").Limit(200).Find(&purchases).Error; err != nil {
+			log.Printf("获取域名购买记录失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取购买记录失败："+err.Error())
+			return
+		}
+		spent, err := monthlyPurchaseSpend(t, time.Now().In(appLocation()))
+		if err != nil {
+			log.Printf("统计本月购买金额失败: %v", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"purchases": purchases, "monthly_spent": spent, "monthly_budget": viper.GetFloat64("acquire.monthlyBudget")})
+	})
+
+	// 手动为服务器购买域名（count 默认 acquire.count），不受 acquire.enabled 限制
+	r.POST("/acquire-domains", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		table := serverParam(c, "table")
+		if !isValidServerTable(table) {
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		id, err := strconv.Atoi(serverParam(c, "id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		count := viper.GetInt("acquire.count")
+		if v := c.PostForm("count"); v != "" {
+			if count, err = strconv.Atoi(v); err != nil || count <= 0 || count > 20 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的购买数量（1-20）")
+				return
+			}
+		}
+		if count <= 0 {
+			count = 1
+		}
+		bought, err := acquireDomains(t, table, id, count)
+		if err != nil && len(bought) == 0 {
+			respondError(c, http.StatusBadGateway, codeUpstreamFailed, "购买域名失败："+err.Error())
+			return
+		}
+		resp := gin.H{"message": fmt.Sprintf("已购买 %d 个域名", len(bought)), "domains": bought}
+		if err != nil {
+			resp["warning"] = err.Error()
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+}
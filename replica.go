@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// 只读副本：配置 [database.replica]（附加租户为 [tenants.<名称>.replica]）的 host 后，
+// 列表及统计查询改读副本以减轻面板主库负载，未配置的字段沿用主库配置。
+// 副本查询出错时改查主库；连接故障时暂停使用副本，后台定期探测，恢复后自动启用。写操作始终在主库执行
+
+// 副本探测间隔
+const replicaCheckInterval = 15 * time.Second
+
+// replicaPool 查询优先读副本、失败时回退主库的连接池，写操作直接走主库
+type replicaPool struct {
+	tenant  string
+	primary *sql.DB
+	replica *sql.DB
+	healthy atomic.Bool
+}
+
+func (p *replicaPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.primary.PrepareContext(ctx, query)
+}
+
+func (p *replicaPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.primary.ExecContext(ctx, query, args...)
+}
+
+func (p *replicaPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if p.healthy.Load() {
+		rows, err := p.replica.QueryContext(ctx, query, args...)
+		if err == nil {
+			return rows, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		p.queryFailed(err)
+	}
+	return p.primary.QueryContext(ctx, query, args...)
+}
+
+func (p *replicaPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if p.healthy.Load() {
+		return p.replica.QueryRowContext(ctx, query, args...)
+	}
+	return p.primary.QueryRowContext(ctx, query, args...)
+}
+
+// 副本查询失败：SQL 错误（如副本尚未同步新加的列）只回退本次查询，连接故障时暂停使用副本直到探测恢复
+func (p *replicaPool) queryFailed(err error) {
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		log.Printf("只读副本查询失败，改查主库: 租户=%s, 错误=%v", p.tenant, err)
+		return
+	}
+	if p.healthy.CompareAndSwap(true, false) {
+		log.Printf("只读副本不可用，暂时改读主库: 租户=%s, 错误=%v", p.tenant, err)
+	}
+}
+
+// 定期探测副本，恢复后重新启用
+func (p *replicaPool) monitor() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err := p.replica.PingContext(ctx)
+		cancel()
+		switch {
+		case err == nil && p.healthy.CompareAndSwap(false, true):
+			log.Printf("只读副本已恢复: 租户=%s", p.tenant)
+		case err != nil && p.healthy.CompareAndSwap(true, false):
+			log.Printf("只读副本探测失败，暂时改读主库: 租户=%s, 错误=%v", p.tenant, err)
+		}
+	}
+}
+
+// 按租户配置段（database 或 tenants.<名称>）连接只读副本，未配置副本时不做处理。
+// 副本启动时不可用不影响启动，由后台探测在恢复后启用
+func setupReadReplica(t *Tenant, key string) {
+	replicaKey := key + ".replica"
+	if mysqlConfigValue(replicaKey, "", "host") == "" {
+		return
+	}
+	primary, err := t.DB.DB()
+	if err != nil {
+		log.Printf("获取主库连接失败，不启用只读副本: 租户=%s, 错误=%v", t.Name, err)
+		return
+	}
+	replica, err := sql.Open("mysql", mysqlDSN(replicaKey, key))
+	if err != nil {
+		log.Printf("只读副本配置无效: 租户=%s, 错误=%v", t.Name, err)
+		return
+	}
+	replica.SetMaxIdleConns(10)
+	replica.SetMaxOpenConns(100)
+	replica.SetConnMaxLifetime(time.Hour)
+	pool := &replicaPool{tenant: t.Name, primary: primary, replica: replica}
+	rdb, err := gorm.Open(mysql.New(mysql.Config{Conn: pool, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		log.Printf("初始化只读副本失败: 租户=%s, 错误=%v", t.Name, err)
+		return
+	}
+	setupDBTracing(rdb, t.Name)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := replica.PingContext(ctx); err != nil {
+		log.Printf("只读副本暂不可用，先读主库: 租户=%s, 错误=%v", t.Name, err)
+	} else {
+		pool.healthy.Store(true)
+		log.Printf("只读副本已连接: 租户=%s, 主机=%s", t.Name, mysqlConfigValue(replicaKey, key, "host"))
+	}
+	t.Reader = rdb
+	go pool.monitor()
+}
+
+// 列表及统计查询使用的数据库：配置了只读副本时读副本（失败回退主库），否则为主库。
+// 副本可能有复制延迟，写入后立即读取的场景仍应使用 t.DB
+func readDB(t *Tenant) *gorm.DB {
+	if t.Reader != nil {
+		return t.Reader
+	}
+	return t.DB
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 续费提醒的提前天数
+const reportRenewalDays = 30
+
+// 报告中可用域名偏少的阈值
+const reportLowDomainThreshold = 3
+
+// RotationReport 周期轮换报告
+type RotationReport struct {
+	Tenant           string          `json:"tenant"`
+	Since            int64           `json:"since"`
+	Until            int64           `json:"until"`
+	Rotations        int64           `json:"rotations"`
+	Succeeded        int64           `json:"succeeded"`
+	Failed           int64           `json:"failed"`
+	DomainsConsumed  int64           `json:"domains_consumed"` // 期间分配出去的不同域名数
+	DomainsRetired   int64           `json:"domains_retired"`
+	DomainsAvailable int64           `json:"domains_available"` // 报告生成时可分配的域名数
+	DomainsUnused    int64           `json:"domains_unused"`    // 加入超过 report.unusedDays 天仍从未使用的域名数
+	UnusedCost       float64         `json:"unused_cost"`       // 上述闲置域名的费用合计
+	FailedServers    []ReportServer  `json:"failed_servers"`    // 期间有失败的服务器，按失败次数降序
+	LowServers       []ReportServer  `json:"low_servers"`       // 可用域名少于阈值的服务器
+	Renewals         []ReportRenewal `json:"renewals"`          // 即将到期续费的域名
+	GeneratedAt      int64           `json:"generated_at"`
+}
+
+// ReportServer 报告中的服务器条目
+type ReportServer struct {
+	Table     string `json:"table"`
+	ID        int    `json:"id"`
+	Failures  int64  `json:"failures,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+	Available int64  `json:"available"`
+}
+
+// ReportRenewal 即将续费的域名，到期时间按购买日期的周年推算
+type ReportRenewal struct {
+	Domain string `json:"domain"`
+	Table  string `json:"table"`
+	ID     int    `json:"id"`
+	DueAt  int64  `json:"due_at"`
+}
+
+// 购买日期之后、不早于 now 的最近一个周年日
+func nextAnniversary(purchase int64, now time.Time) time.Time {
+	p := time.Unix(purchase, 0).In(now.Location())
+	years := now.Year() - p.Year()
+	due := p.AddDate(years, 0, 0)
+	if due.Before(now) {
+		due = p.AddDate(years+1, 0, 0)
+	}
+	return due
+}
+
+// 统计租户在 [since, until] 内的轮换报告
+func buildRotationReport(t *Tenant, since, until int64) (RotationReport, error) {
+	report := RotationReport{Tenant: t.Name, Since: since, Until: until, GeneratedAt: time.Now().Unix()}
+	rdb := readDB(t)
+	window := func() *gorm.DB {
+		return rdb.Model(&RotationHistory{}).Where("created_at >= ? AND created_at <= ?", since, until)
+	}
+	if err := window().Where("status = ?", rotationSuccess).Count(&report.Succeeded).Error; err != nil {
+		return report, err
+	}
+	if err := window().Where("status = ?", rotationFailed).Count(&report.Failed).Error; err != nil {
+		return report, err
+	}
+	report.Rotations = report.Succeeded + report.Failed
+	if err := window().Where("status = ? AND new_host != ''", rotationSuccess).Distinct("new_host").Count(&report.DomainsConsumed).Error; err != nil {
+		return report, err
+	}
+	if err := rdb.Model(&ServerDomain{}).Where("retired = ? AND retired_time >= ? AND retired_time <= ?", 1, since, until).Count(&report.DomainsRetired).Error; err != nil {
+		return report, err
+	}
+	if err := rdb.Model(&ServerDomain{}).Scopes(availableDomainScope(until)).Count(&report.DomainsAvailable).Error; err != nil {
+		return report, err
+	}
+	unused := func() *gorm.DB {
+		return rdb.Model(&ServerDomain{}).Scopes(unusedDomainScope(until - int64(unusedDomainDays())*86400))
+	}
+	if err := unused().Count(&report.DomainsUnused).Error; err != nil {
+		return report, err
+	}
+	if report.DomainsUnused > 0 {
+		if err := unused().Select("COALESCE(SUM(cost), 0)").Scan(&report.UnusedCost).Error; err != nil {
+			return report, err
+		}
+	}
+
+	var failures []struct {
+		ServerTable string
+		ServerID    int
+		Count       int64
+	}
+	if err := window().Select("server_table, server_id, COUNT(*) AS count").Where("status = ?", rotationFailed).
+		Group("server_table, server_id").Order("count DESC").Limit(20).Scan(&failures).Error; err != nil {
+		return report, err
+	}
+	for _, f := range failures {
+		var last RotationHistory
+		window().Where("status = ? AND server_table = ? AND server_id = ?", rotationFailed, f.ServerTable, f.ServerID).Order("created_at DESC").First(&last)
+		counts, _ := t.Domains.Count(f.ServerTable, f.ServerID, until)
+		report.FailedServers = append(report.FailedServers, ReportServer{Table: f.ServerTable, ID: f.ServerID, Failures: f.Count, LastError: last.Error, Available: counts.Available})
+	}
+
+	for _, table := range serverTables(t) {
+		rows, err := listServerRows(t, table)
+		if err != nil {
+			return report, err
+		}
+		for _, s := range rows {
+			counts, err := t.Domains.Count(table, s.ID, until)
+			if err != nil {
+				return report, err
+			}
+			if counts.Available < reportLowDomainThreshold {
+				report.LowServers = append(report.LowServers, ReportServer{Table: table, ID: s.ID, Available: counts.Available})
+			}
+		}
+	}
+
+	var purchased []ServerDomain
+	if err := rdb.Select("domain, server_table, server_id, purchase_date").Where("purchase_date > 0 AND retired = ?", 0).Find(&purchased).Error; err != nil {
+		return report, err
+	}
+	now := time.Unix(until, 0).In(appLocation())
+	limit := now.AddDate(0, 0, reportRenewalDays)
+	for _, d := range purchased {
+		if due := nextAnniversary(d.PurchaseDate, now); !due.After(limit) {
+			report.Renewals = append(report.Renewals, ReportRenewal{Domain: d.Domain, Table: d.ServerTable, ID: d.ServerID, DueAt: due.Unix()})
+		}
+	}
+	sort.Slice(report.Renewals, func(i, j int) bool { return report.Renewals[i].DueAt < report.Renewals[j].DueAt })
+	return report, nil
+}
+
+// 报告的文字摘要，供日志及聊天类通知使用
+func (r RotationReport) summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "轮换报告 %s ~ %s: 轮换 %d 次（成功 %d，失败 %d），消耗域名 %d 个，退役 %d 个，当前可用 %d 个",
+		formatTimeIn(r.Since, ""), formatTimeIn(r.Until, ""), r.Rotations, r.Succeeded, r.Failed, r.DomainsConsumed, r.DomainsRetired, r.DomainsAvailable)
+	if len(r.FailedServers) > 0 {
+		fmt.Fprintf(&b, "；%d 台服务器有失败", len(r.FailedServers))
+	}
+	if len(r.LowServers) > 0 {
+		fmt.Fprintf(&b, "；%d 台服务器可用域名少于 %d 个", len(r.LowServers), reportLowDomainThreshold)
+	}
+	if len(r.Renewals) > 0 {
+		fmt.Fprintf(&b, "；%d 个域名将在 %d 天内到期续费", len(r.Renewals), reportRenewalDays)
+	}
+	if r.DomainsUnused > 0 {
+		fmt.Fprintf(&b, "；%d 个域名加入超过 %d 天从未使用（费用 %.2f）", r.DomainsUnused, unusedDomainDays(), r.UnusedCost)
+	}
+	return b.String()
+}
+
+// 渲染报告 HTML（邮件正文及页面预览共用 templates/report.html）
+func renderRotationReport(r RotationReport) (string, error) {
+	tpl, err := template.New("report.html").Funcs(template.FuncMap{
+		"formatUnixTime": func(timestamp int64) string { return formatTimeIn(timestamp, "") },
+	}).ParseFS(assetsFS(), "templates/report.html")
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, r); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// 报告统计的天数（report.days），默认 7
+func reportDays() int {
+	if n := viper.GetInt("report.days"); n > 0 {
+		return n
+	}
+	return 7
+}
+
+// 为所有租户生成报告并通过通知渠道发送
+func sendRotationReports() {
+	until := time.Now().Unix()
+	since := until - int64(reportDays())*86400
+	for _, t := range tenantList() {
+		report, err := buildRotationReport(t, since, until)
+		if err != nil {
+			log.Printf("生成轮换报告失败: 租户=%s, 错误=%v", t.Name, err)
+			continue
+		}
+		publishEvent(Event{Type: eventRotationReport, Tenant: t.Name, Report: &report, Time: until})
+	}
+}
+
+// 注册轮换报告路由
+func registerReportRoutes(r *gin.Engine) {
+	// 查看轮换报告：days 为统计天数（默认 report.days），format=html 时返回邮件同款的 HTML
+	r.GET("/reports/rotation", authMiddleware, httpCacheMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		days := reportDays()
+		if v := c.Query("days"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 366 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的天数")
+				return
+			}
+			days = n
+		}
+		until := time.Now().Unix()
+		report, err := buildRotationReport(t, until-int64(days)*86400, until)
+		if err != nil {
+			log.Printf("生成轮换报告失败: 租户=%s, 错误=%v", t.Name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "生成报告失败："+err.Error())
+			return
+		}
+		if c.Query("format") != "html" {
+			c.JSON(http.StatusOK, report)
+			return
+		}
+		html, err := renderRotationReport(report)
+		if err != nil {
+			log.Printf("渲染轮换报告失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "渲染报告失败："+err.Error())
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+	})
+
+	// 立即生成并发送报告
+	r.POST("/reports/rotation/send", authMiddleware, func(c *gin.Context) {
+		sendRotationReports()
+		c.JSON(http.StatusOK, gin.H{"message": "报告已提交发送"})
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 轮换失败时的重试次数（rotation.retryAttempts），默认 3
+func rotationRetryAttempts() int {
+	if n := viper.GetInt("rotation.retryAttempts"); n > 0 {
+		return n
+	}
+	return 3
+}
+
+// 第 attempt 次（从 1 开始）重试前的等待时间：rotation.retryBackoffSeconds × attempt，默认不等待
+func rotationRetryBackoff(attempt int) time.Duration {
+	return time.Duration(viper.GetInt("rotation.retryBackoffSeconds")*attempt) * time.Second
+}
+
+// 连续多少次定时轮换失败后自动隐藏节点（rotation.hideAfterFailures），0 表示不隐藏
+func hideAfterFailures() int {
+	return viper.GetInt("rotation.hideAfterFailures")
+}
+
+// 最近连续 hideAfterFailures 次轮换均失败时隐藏节点（show=0），返回是否已隐藏
+func hideServerAfterFailures(t *Tenant, table string, id int) bool {
+	n := hideAfterFailures()
+	if n <= 0 {
+		return false
+	}
+	var statuses []string
+	if err := t.DB.Model(&RotationHistory{}).Where("server_table = ? AND server_id = ?", table, id).
+		Order("created_at DESC, id DESC").Limit(n).Pluck("status", &statuses).Error; err != nil {
+		log.Printf("获取轮换历史失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return false
+	}
+	if len(statuses) < n {
+		return false
+	}
+	for _, s := range statuses {
+		if s != rotationFailed {
+			return false
+		}
+	}
+	result := t.DB.Table(table).Where(serverCond(table, "id", "show"), id, 1).Update(serverColumn(table, "show"), 0)
+	if result.Error != nil {
+		log.Printf("自动隐藏节点失败: 表=%s, ID=%d, 错误=%v", table, id, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	log.Printf("连续 %d 次轮换失败，已自动隐藏节点: 租户=%s, 表=%s, ID=%d", n, t.Name, table, id)
+	return true
+}
+
+// 单次定时检查最多轮换的服务器数（rotation.maxPerTick），未配置或为 0 时不限，返回 -1
+func maxRotationsPerTick() int {
+	if n := viper.GetInt("rotation.maxPerTick"); n > 0 {
+		return n
+	}
+	return -1
+}
+
+// 注册重试设置路由（含单次检查轮换上限）
+func registerRetrySettingRoutes(r *gin.Engine) {
+	// 查看轮换重试设置
+	r.GET("/retry-settings", authMiddleware, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"retry_attempts":        rotationRetryAttempts(),
+			"retry_backoff_seconds": viper.GetInt("rotation.retryBackoffSeconds"),
+			"hide_after_failures":   hideAfterFailures(),
+			"max_per_tick":          viper.GetInt("rotation.maxPerTick"),
+		})
+	})
+
+	// 修改轮换重试设置，仅更新提交的字段，立即生效并写入配置文件
+	r.POST("/retry-settings", authMiddleware, func(c *gin.Context) {
+		fields := []struct {
+			form, key, name string
+			min, max        int
+		}{
+			{"retry_attempts", "rotation.retryAttempts", "重试次数", 1, 10},
+			{"retry_backoff_seconds", "rotation.retryBackoffSeconds", "重试间隔", 0, 300},
+			{"hide_after_failures", "rotation.hideAfterFailures", "自动隐藏前的连续失败次数", 0, 100},
+			{"max_per_tick", "rotation.maxPerTick", "单次检查轮换上限", 0, 10000},
+		}
+		updates := map[string]int{}
+		for _, f := range fields {
+			v, ok := c.GetPostForm(f.form)
+			if !ok {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < f.min || n > f.max {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的"+f.name+"，范围 "+strconv.Itoa(f.min)+"-"+strconv.Itoa(f.max))
+				return
+			}
+			updates[f.key] = n
+		}
+		if len(updates) == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "没有需要更新的字段")
+			return
+		}
+		for key, n := range updates {
+			viper.Set(key, n)
+		}
+		if err := writeConfig(); err != nil {
+			log.Printf("写入配置文件失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存重试设置失败")
+			return
+		}
+		log.Printf("轮换重试设置已更新: %v", updates)
+		c.JSON(http.StatusOK, gin.H{"message": "重试设置已更新"})
+	})
+}
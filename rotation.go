@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// 服务器行在轮换期间被并发修改
+var errServerConflict = errors.New("服务器记录已被并发修改，请重试")
+
+// 服务器表是否带 updated_at 列（V2Board 表默认带有），用于乐观并发控制；按租户缓存
+var updatedAtColumns sync.Map
+
+func serverTableHasUpdatedAt(t *Tenant, table string) bool {
+	key := t.Name + ":" + table
+	if v, ok := updatedAtColumns.Load(key); ok {
+		return v.(bool)
+	}
+	has := t.DB.Migrator().HasColumn(table, serverColumn(table, "updated_at"))
+	updatedAtColumns.Store(key, has)
+	return has
+}
+
+// 轮换服务器，遇到并发修改冲突时重新读取并重试
+func updateServerWithRetry(t *Tenant, table string, id int, now int64, useOrder bool, cause RotationCause) error {
+	var err error
+	for attempt := 0; attempt < rotationRetryAttempts(); attempt++ {
+		if attempt > 0 {
+			time.Sleep(rotationRetryBackoff(attempt))
+		}
+		err = updateServer(t, table, id, now, useOrder, cause)
+		if !errors.Is(err, errServerConflict) {
+			return err
+		}
+		log.Printf("轮换冲突，重试 %d: 表=%s, ID=%d", attempt+1, table, id)
+	}
+	return err
+}
+
+// 立即轮换服务器并记录结果状态
+func rotateServerNow(t *Tenant, table string, id int, cause RotationCause) error {
+	now := time.Now().Unix()
+	if err := updateServerWithRetry(t, table, id, now, false, cause); err != nil {
+		log.Printf("更新服务器失败: 租户=%s, 表=%s, ID=%d, 错误=%v", t.Name, table, id, err)
+		recordRotationFailure(t, table, id, cause, err)
+		if updateErr := setServerStatus(t.DB, table, id, "更新失败："+err.Error(), classifyFailure(err)); updateErr != nil {
+			log.Printf("更新 last_update_status 失败: 表=%s, ID=%d, 错误=%v", table, id, updateErr)
+		}
+		return err
+	}
+	if err := setServerStatus(t.DB, table, id, "更新成功", ""); err != nil {
+		log.Printf("更新 last_update_status 失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return err
+	}
+	return nil
+}
+
+// 更新单个服务器
+func updateServer(t *Tenant, table string, id int, now int64, useOrder bool, cause RotationCause) (err error) {
+	ctx, span := startSpan(cause.ctx, "rotation",
+		attribute.String("tenant", t.Name), attribute.String("server.table", table), attribute.Int("server.id", id),
+		attribute.String("rotation.trigger", cause.Trigger), attribute.String("rotation.actor", cause.Actor))
+	defer func() { endSpan(span, err) }()
+	log.Printf("开始 updateServer: 租户=%s, 表=%s, ID=%d, 当前时间=%d, 使用顺序=%v, 触发=%s, 操作者=%s", t.Name, table, id, now, useOrder, cause.Trigger, cause.Actor)
+	publishEvent(Event{Type: eventRotationStarted, Tenant: t.Name, ServerTable: table, ServerID: id, Trigger: cause.Trigger, Actor: cause.Actor, Time: now})
+	prof := startRotationProfile(t.Name, table, id)
+	defer func() { prof.finish(err) }()
+
+	hasUpdatedAt := serverTableHasUpdatedAt(t, table)
+
+	// 估算受影响的在线用户数，随轮换历史及事件记录
+	impact := estimateUserImpact(t, table, id, now)
+	if impact.known() {
+		log.Printf("轮换预计影响在线用户 %d 人: 表=%s, ID=%d, 来源=%s", impact.OnlineUsers, table, id, impact.Source)
+		span.SetAttributes(attribute.Int("rotation.affected_users", impact.OnlineUsers))
+	}
+
+	// 轮换策略：禁止轮换时段内直接拒绝
+	rules := loadPolicyRules(t.DB, table, id)
+	if blackout := activeBlackout(rules, time.Unix(now, 0).In(appLocation())); blackout != nil {
+		log.Printf("处于禁止轮换时段 %s-%s，跳过轮换: 表=%s, ID=%d", blackout.Start, blackout.End, table, id)
+		return fmt.Errorf("%w（%s-%s）", errPolicyBlackout, blackout.Start, blackout.End)
+	}
+
+	prof.phase(phaseDomainQuery)
+	// 开启解析校验时先在事务外校验候选域名（需要网络查询），事务中只从通过校验的域名中选择
+	var hostBefore struct {
+		Host string
+	}
+	if err := t.DB.Table(table).Select(serverSelect(table, "host")).Where("id = ?", id).First(&hostBefore).Error; err != nil {
+		log.Printf("获取当前服务器失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return dbFailure(fmt.Errorf("获取服务器数据失败: %v", err))
+	}
+	verified, err := t.Domains.VerifyCandidates(table, id, hostBefore.Host, now)
+	if err != nil {
+		if errors.Is(err, errNoAvailableDomain) {
+			publishEvent(Event{Type: eventDomainExhausted, Tenant: t.Name, ServerTable: table, ServerID: id, OldHost: hostBefore.Host, Error: err.Error(), Time: now})
+		}
+		return err
+	}
+
+	tx := t.DB.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			log.Printf("updateServer 发生恐慌: 表=%s, ID=%d, 错误=%v", table, id, r)
+		}
+	}()
+
+	// 获取当前服务器信息
+	var currentServer struct {
+		Port       string
+		ServerPort int
+		Host       string
+		UpdatedAt  int64
+	}
+	serverColumns := serverSelect(table, "port", "server_port", "host")
+	if hasUpdatedAt {
+		serverColumns += ", " + serverSelect(table, "updated_at")
+	}
+	if err := tx.Table(table).Select(serverColumns).Where("id = ?", id).First(&currentServer).Error; err != nil {
+		tx.Rollback()
+		log.Printf("获取当前服务器失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return dbFailure(fmt.Errorf("获取服务器数据失败: %v", err))
+	}
+	log.Printf("当前服务器: 表=%s, ID=%d, 端口=%s, 服务器端口=%d, 主机=%s",
+		table, id, currentServer.Port, currentServer.ServerPort, currentServer.Host)
+
+	// 释放当前域名（如果存在），设置 in_use=0 并累计使用时长，不重置 last_used_time；
+	// 配置了轮换宽限期时旧域名保持使用中，到期后由定时任务释放
+	graceSeconds := rotationGraceSeconds()
+	graceHost := ""
+	if currentServer.Host != "" {
+		var domainCount int64
+		tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND domain = ?", table, id, currentServer.Host).Count(&domainCount)
+		if domainCount == 0 {
+			log.Printf("警告: 当前主机 %s 在 server_domains 中未找到: 表=%s, ID=%d", currentServer.Host, table, id)
+		} else if graceSeconds > 0 {
+			graceHost = currentServer.Host
+		} else {
+			if err := releaseDomain(tx, table, id, currentServer.Host, now); err != nil {
+				tx.Rollback()
+				log.Printf("释放域名 %s 失败: 表=%s, ID=%d, 错误=%v", currentServer.Host, table, id, err)
+				return dbFailure(fmt.Errorf("释放域名失败: %v", err))
+			}
+			log.Printf("释放域名 %s 成功: 表=%s, ID=%d", currentServer.Host, table, id)
+		}
+	}
+
+	// 获取新的随机端口（优先使用绑定的端口预设），并满足轮换策略的端口规则
+	nextPort, err := pickNextPort(tx, table, id, currentServer.ServerPort, rules)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("选择新端口失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return err
+	}
+	log.Printf("选择新端口: %d, 表=%s, ID=%d", nextPort, table, id)
+
+	// 按轮换策略选择新域名
+	nextDomain, err := t.Domains.PickNext(tx, table, id, currentServer.Host, now, verified)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, errNoAvailableDomain) {
+			publishEvent(Event{Type: eventDomainExhausted, Tenant: t.Name, ServerTable: table, ServerID: id, OldHost: currentServer.Host, Error: err.Error(), Time: now})
+		}
+		return err
+	}
+	log.Printf("选择新域名: %s, 表=%s, ID=%d, last_used_time=%d", nextDomain.Domain, table, id, nextDomain.LastUsedTime)
+
+	// 通过 DNS 服务商将新域名解析到节点 IP
+	prof.phase(phaseDNSUpdate)
+	_, dnsSpan := startSpan(ctx, "rotation.dns", attribute.String("domain", nextDomain.Domain))
+	err = syncDomainRecord(tx, table, id, nextDomain)
+	endSpan(dnsSpan, err)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("更新域名 %s 解析失败: 表=%s, ID=%d, 错误=%v", nextDomain.Domain, table, id, err)
+		return withFailureClass(failureDNSProvider, fmt.Errorf("更新域名解析失败: %v", err))
+	}
+
+	// 更新服务器记录（CDN 域名保留更久）
+	prof.phase(phaseServerUpdate)
+	nextUpdateTime := now + rotationIntervalSeconds(tx, table, id, nextDomain)
+	updateFields := map[string]interface{}{
+		"port":             strconv.Itoa(nextPort),
+		"server_port":      nextPort,
+		"host":             nextDomain.Domain,
+		"next_update_time": nextUpdateTime,
+	}
+	// 按 SNI/伪装域名设置及改写规则一并更新 TLS 及传输设置
+	settingsFields, err := settingsUpdateFields(t, tx, table, id, nextDomain.Domain, nextPort)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("改写协议设置失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return dbFailure(fmt.Errorf("改写协议设置失败: %v", err))
+	}
+	for k, v := range settingsFields {
+		updateFields[k] = v
+	}
+	// 乐观并发控制：仅当服务器行仍是读取时的值才写入，否则说明面板或其他实例已修改
+	updateQuery := tx.Table(table).Where(serverCond(table, "id", "port", "server_port", "host"), id, currentServer.Port, currentServer.ServerPort, currentServer.Host)
+	if hasUpdatedAt {
+		updateQuery = updateQuery.Where(serverCond(table, "updated_at"), currentServer.UpdatedAt)
+		updateFields["updated_at"] = now
+	}
+	result := updateQuery.Updates(serverFields(table, updateFields))
+	if result.Error != nil {
+		tx.Rollback()
+		log.Printf("更新服务器记录失败: 表=%s, ID=%d, 错误=%v", table, id, result.Error)
+		return dbFailure(fmt.Errorf("更新服务器记录失败: %v", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		log.Printf("服务器记录已被并发修改: 表=%s, ID=%d", table, id)
+		return errServerConflict
+	}
+	if err := saveServerSnapshot(tx, table, id, nextDomain.Domain, strconv.Itoa(nextPort), nextPort, now); err != nil {
+		tx.Rollback()
+		log.Printf("保存服务器快照失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return dbFailure(fmt.Errorf("保存服务器快照失败: %v", err))
+	}
+	log.Printf("更新服务器记录成功: 表=%s, ID=%d, 端口=%s, 主机=%s, 下次更新时间=%d", table, id, updateFields["port"], nextDomain.Domain, nextUpdateTime)
+
+	// 标记新域名为已使用，并更新 last_used_time
+	if err := tx.Model(&ServerDomain{}).Where("id = ?", nextDomain.ID).Updates(map[string]interface{}{
+		"in_use":         1,
+		"last_used_time": now,
+		"use_count":      gorm.Expr("use_count + 1"),
+	}).Error; err != nil {
+		tx.Rollback()
+		log.Printf("标记域名 %s 为已使用失败: 表=%s, ID=%d, 错误=%v", nextDomain.Domain, table, id, err)
+		return dbFailure(fmt.Errorf("标记域名失败: %v", err))
+	}
+	log.Printf("标记域名 %s 为已使用成功: 表=%s, ID=%d, last_used_time=%d", nextDomain.Domain, table, id, now)
+	if graceHost != "" {
+		if err := beginDomainGrace(tx, table, id, graceHost, nextDomain.Domain, now, graceSeconds); err != nil {
+			tx.Rollback()
+			log.Printf("记录旧域名 %s 的宽限期失败: 表=%s, ID=%d, 错误=%v", graceHost, table, id, err)
+			return dbFailure(fmt.Errorf("记录旧域名宽限期失败: %v", err))
+		}
+		log.Printf("旧域名 %s 进入宽限期，%d 分钟后释放: 表=%s, ID=%d", graceHost, graceSeconds/60, table, id)
+	}
+
+	// 如果是 cron 任务，更新域名顺序
+	if useOrder {
+		var maxDomainOrder int
+		tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ?", table, id).Select("MAX(`order`)").Scan(&maxDomainOrder)
+		if err := tx.Model(&ServerDomain{}).Where("id = ?", nextDomain.ID).Update("order", maxDomainOrder+1).Error; err != nil {
+			tx.Rollback()
+			log.Printf("更新域名顺序失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			return dbFailure(fmt.Errorf("更新域名顺序失败: %v", err))
+		}
+		log.Printf("更新域名顺序到 %d: 域名=%s, 表=%s, ID=%d", maxDomainOrder+1, nextDomain.Domain, table, id)
+	}
+
+	// 记录轮换历史
+	if err := tx.Create(&RotationHistory{
+		ServerTable:   table,
+		ServerID:      id,
+		OldHost:       currentServer.Host,
+		NewHost:       nextDomain.Domain,
+		OldPort:       currentServer.ServerPort,
+		NewPort:       nextPort,
+		Status:        rotationSuccess,
+		Trigger:       cause.Trigger,
+		Actor:         cause.Actor,
+		AffectedUsers: impact.affectedUsers(),
+		CreatedAt:     now,
+	}).Error; err != nil {
+		tx.Rollback()
+		log.Printf("记录轮换历史失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return dbFailure(fmt.Errorf("记录轮换历史失败: %v", err))
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("提交事务失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return dbFailure(fmt.Errorf("事务提交失败: %v", err))
+	}
+	log.Printf("事务提交成功: 表=%s, ID=%d", table, id)
+	publishEvent(Event{
+		Type:          eventRotationSucceeded,
+		Tenant:        t.Name,
+		ServerTable:   table,
+		ServerID:      id,
+		OldHost:       currentServer.Host,
+		NewHost:       nextDomain.Domain,
+		OldPort:       currentServer.ServerPort,
+		NewPort:       nextPort,
+		Trigger:       cause.Trigger,
+		Actor:         cause.Actor,
+		AffectedUsers: impact.affectedUsers(),
+		Time:          now,
+	})
+
+	// 回写面板（面板数据库无法直连时）或托管端点文件
+	prof.phase(phaseHooks)
+	_, syncSpan := startSpan(ctx, "rotation.sync")
+	syncErr := syncRotatedServer(t, table, id, nextDomain.Domain, nextPort)
+	endSpan(syncSpan, syncErr)
+	if syncErr != nil {
+		log.Printf("同步轮换结果失败: 表=%s, ID=%d, 错误=%v", table, id, syncErr)
+	}
+
+	// 验证新端口是否可达并回写节点心跳
+	schedulePortProbe(t, table, id, nextDomain.Domain, nextPort)
+	// 登录节点执行轮换后命令（已配置 SSH 凭据时）
+	runPostRotateHook(t, table, id, currentServer.Host, currentServer.ServerPort, nextDomain.Domain, nextPort)
+	prof.endPhase(time.Now())
+
+	// 调试：查询更新后的域名状态
+	var updatedDomain ServerDomain
+	if err := t.DB.Where("server_table = ? AND server_id = ? AND domain = ?", table, id, nextDomain.Domain).First(&updatedDomain).Error; err != nil {
+		log.Printf("查询更新后的域名失败: 表=%s, ID=%d, 域名=%s, 错误=%v", table, id, nextDomain.Domain, err)
+	} else {
+		log.Printf("更新后域名状态: 表=%s, ID=%d, 域名=%s, in_use=%d, last_used_time=%d", table, id, updatedDomain.Domain, updatedDomain.InUse, updatedDomain.LastUsedTime)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+)
+
+// 轮换日历：按小时或天汇总未来一段时间内计划的定时轮换，便于发现集中在同一时段的轮换并错开。
+// 第一次轮换按 next_update_time 推算（与轮换计划接口的 expected_rotation_time 相同），
+// 之后按服务器的轮换间隔依次推算；CDN 域名延长的间隔、在线用户数及禁止轮换时段造成的推迟无法预知，不计入
+
+// 轮换日历最多查看的天数
+const maxCalendarDays = 31
+
+// CalendarRotation 日历中的一次轮换
+type CalendarRotation struct {
+	Table     string `json:"table"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Time      int64  `json:"time"`
+	Projected bool   `json:"projected"` // 按轮换间隔推算的后续轮换，false 表示由 next_update_time 确定的下一次轮换
+}
+
+// CalendarBucket 一个小时或一天内的轮换
+type CalendarBucket struct {
+	Start       int64              `json:"start"`
+	Label       string             `json:"label"`
+	Count       int                `json:"count"`
+	MaxPerCheck int                `json:"max_per_check"` // 时段内单次检查任务需要轮换的最多服务器数
+	Rotations   []CalendarRotation `json:"rotations"`
+}
+
+// 时段的开始时间
+func calendarBucketStart(ts time.Time, group string) time.Time {
+	if group == "hour" {
+		return time.Date(ts.Year(), ts.Month(), ts.Day(), ts.Hour(), 0, 0, 0, ts.Location())
+	}
+	return time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, ts.Location())
+}
+
+// 推算租户的服务器在 [now, end) 内的定时轮换（按时间排序），已下线归档及受限调用方无权访问的服务器不列出
+func projectRotations(t *Tenant, access *serverAccess, sched cron.Schedule, now time.Time, end int64) []CalendarRotation {
+	var rotations []CalendarRotation
+	archived := archivedServers(t.DB)
+	for _, table := range serverTables(t) {
+		rows, err := listServerRows(t, table)
+		if err != nil {
+			log.Printf("从表 %s 获取记录失败: 租户=%s, 错误=%v", table, t.Name, err)
+			continue
+		}
+		for _, s := range rows {
+			if archived[table+":"+strconv.Itoa(s.ID)] || !access.allows(t.DB, serverRef{Table: table, ID: s.ID}) {
+				continue
+			}
+			window := loadServerSetting(t.DB, table, s.ID).RotationWindow
+			interval := int64(serverIntervalHours(t.DB, table, s.ID)) * 3600
+			next := expectedRotationTime(sched, window, s.NextUpdateTime, now)
+			for projected := false; !next.IsZero() && next.Unix() < end; projected = true {
+				rotations = append(rotations, CalendarRotation{Table: table, ID: s.ID, Name: s.Name, Time: next.Unix(), Projected: projected})
+				following := expectedRotationTime(sched, window, next.Unix()+interval, next)
+				if !following.After(next) {
+					break
+				}
+				next = following
+			}
+		}
+	}
+	sort.SliceStable(rotations, func(i, j int) bool { return rotations[i].Time < rotations[j].Time })
+	return rotations
+}
+
+// 将轮换按时段分组，包含没有轮换的时段
+func groupCalendar(rotations []CalendarRotation, group string, loc *time.Location, now time.Time, end int64) []CalendarBucket {
+	layout := "2006-01-02"
+	step := func(ts time.Time) time.Time { return ts.AddDate(0, 0, 1) }
+	if group == "hour" {
+		layout = "2006-01-02 15:00"
+		step = func(ts time.Time) time.Time { return ts.Add(time.Hour) }
+	}
+	var buckets []CalendarBucket
+	index := map[int64]int{}
+	for start := calendarBucketStart(now.In(loc), group); start.Unix() < end; start = step(start) {
+		index[start.Unix()] = len(buckets)
+		buckets = append(buckets, CalendarBucket{Start: start.Unix(), Label: start.Format(layout), Rotations: []CalendarRotation{}})
+	}
+	perCheck := map[int64]int{}
+	for _, r := range rotations {
+		i, ok := index[calendarBucketStart(time.Unix(r.Time, 0).In(loc), group).Unix()]
+		if !ok {
+			continue
+		}
+		b := &buckets[i]
+		b.Rotations = append(b.Rotations, r)
+		b.Count++
+		perCheck[r.Time]++
+		if perCheck[r.Time] > b.MaxPerCheck {
+			b.MaxPerCheck = perCheck[r.Time]
+		}
+	}
+	return buckets
+}
+
+// 注册轮换日历路由
+func registerRotationCalendarRoutes(r *gin.Engine) {
+	// 轮换日历：days 为查看的天数（默认 7，最多 31），group=hour 按小时分组，默认按天；
+	// 时段按当前用户的显示时区划分
+	r.GET("/api/v1/rotation-calendar", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		days := 7
+		if v := c.Query("days"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > maxCalendarDays {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 days，可选范围: 1-"+strconv.Itoa(maxCalendarDays))
+				return
+			}
+			days = n
+		}
+		group := c.DefaultQuery("group", "day")
+		if group != "hour" && group != "day" {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 group，可选值: hour, day")
+			return
+		}
+		spec, _ := checkSchedule()
+		sched, err := cron.ParseStandard(spec)
+		if err != nil {
+			log.Printf("解析检查任务的 Cron 表达式失败: %s, 错误=%v", spec, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "无法解析检查任务的 Cron 表达式："+spec)
+			return
+		}
+
+		now := time.Now()
+		end := now.Unix() + int64(days)*86400
+		loc := userLocation(c)
+		rotations := projectRotations(t, requestServerAccess(c), sched, now, end)
+		buckets := groupCalendar(rotations, group, loc, now, end)
+		peak := 0
+		for _, b := range buckets {
+			if b.Count > peak {
+				peak = b.Count
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"from":                   now.Unix(),
+			"to":                     end,
+			"group":                  group,
+			"timezone":               loc.String(),
+			"check_cron":             spec,
+			"max_rotations_per_tick": maxRotationsPerTick(),
+			"paused":                 inMaintenance(),
+			"total":                  len(rotations),
+			"peak":                   peak,
+			"buckets":                buckets,
+		})
+	})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 轮换耗时分析：记录最近的轮换各阶段耗时（保存在内存中，重启后清空），
+// 由 /debug/rotation-profile 汇总平均值及分位数，用于定位轮换变慢的环节
+
+// 轮换阶段
+const (
+	phaseDomainQuery  = "domain_query"  // 读取服务器、释放旧域名、选择端口及新域名
+	phaseDNSUpdate    = "dns_update"    // 通过 DNS 服务商更新解析
+	phaseServerUpdate = "server_update" // 更新服务器记录、标记域名、记录历史并提交事务
+	phaseHooks        = "hooks"         // 提交后回写面板或托管端点、安排端口探测
+)
+
+// 汇总时的阶段顺序
+var rotationPhases = []string{phaseDomainQuery, phaseDNSUpdate, phaseServerUpdate, phaseHooks}
+
+// 内存中保留的轮换记录数
+const rotationProfileCapacity = 1000
+
+// 汇总默认及最多使用的轮换次数
+const (
+	defaultProfileRotations = 100
+	maxProfileRotations     = rotationProfileCapacity
+)
+
+// rotationProfile 一次轮换的各阶段耗时（毫秒），未执行到的阶段不出现在 Phases 中
+type rotationProfile struct {
+	Tenant      string             `json:"tenant"`
+	ServerTable string             `json:"server_table"`
+	ServerID    int                `json:"server_id"`
+	StartedAt   int64              `json:"started_at"`
+	TotalMs     float64            `json:"total_ms"`
+	Phases      map[string]float64 `json:"phases"`
+	Failed      bool               `json:"failed"`
+
+	start      time.Time
+	current    string
+	phaseStart time.Time
+}
+
+// 最近的轮换耗时记录（环形缓冲）
+var rotationProfiles = struct {
+	sync.Mutex
+	items []rotationProfile
+	next  int
+}{}
+
+// 开始记录一次轮换的耗时
+func startRotationProfile(tenant, table string, id int) *rotationProfile {
+	now := time.Now()
+	return &rotationProfile{Tenant: tenant, ServerTable: table, ServerID: id, StartedAt: now.Unix(), Phases: map[string]float64{}, start: now}
+}
+
+// 进入下一阶段，结束当前阶段的计时
+func (p *rotationProfile) phase(name string) {
+	now := time.Now()
+	p.endPhase(now)
+	p.current, p.phaseStart = name, now
+}
+
+func (p *rotationProfile) endPhase(now time.Time) {
+	if p.current != "" {
+		p.Phases[p.current] += float64(now.Sub(p.phaseStart).Microseconds()) / 1000
+		p.current = ""
+	}
+}
+
+// 轮换结束（成功或失败），保存耗时记录
+func (p *rotationProfile) finish(err error) {
+	now := time.Now()
+	p.endPhase(now)
+	p.TotalMs = float64(now.Sub(p.start).Microseconds()) / 1000
+	p.Failed = err != nil
+
+	rotationProfiles.Lock()
+	defer rotationProfiles.Unlock()
+	if len(rotationProfiles.items) < rotationProfileCapacity {
+		rotationProfiles.items = append(rotationProfiles.items, *p)
+		return
+	}
+	rotationProfiles.items[rotationProfiles.next] = *p
+	rotationProfiles.next = (rotationProfiles.next + 1) % rotationProfileCapacity
+}
+
+// 租户最近 n 次轮换的耗时记录，按时间从新到旧
+func recentRotationProfiles(tenant string, n int) []rotationProfile {
+	rotationProfiles.Lock()
+	defer rotationProfiles.Unlock()
+	items := rotationProfiles.items
+	var list []rotationProfile
+	for i := 0; i < len(items) && len(list) < n; i++ {
+		// 从最后写入的记录往前取
+		p := items[(rotationProfiles.next-1-i+2*len(items))%len(items)]
+		if p.Tenant == tenant {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// PhaseStats 某阶段的耗时统计（毫秒）
+type PhaseStats struct {
+	Phase string  `json:"phase"`
+	Count int     `json:"count"`
+	AvgMs float64 `json:"avg_ms"`
+	P50Ms float64 `json:"p50_ms"`
+	P90Ms float64 `json:"p90_ms"`
+	P99Ms float64 `json:"p99_ms"`
+	MaxMs float64 `json:"max_ms"`
+}
+
+// 按最近秩法取分位数，values 须已排序
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(values))))
+	if rank < 1 {
+		rank = 1
+	}
+	return values[rank-1]
+}
+
+// 统计一组耗时
+func phaseStats(phase string, values []float64) PhaseStats {
+	s := PhaseStats{Phase: phase, Count: len(values)}
+	if len(values) == 0 {
+		return s
+	}
+	sort.Float64s(values)
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	s.AvgMs = math.Round(total/float64(len(values))*1000) / 1000
+	s.P50Ms, s.P90Ms, s.P99Ms = percentile(values, 50), percentile(values, 90), percentile(values, 99)
+	s.MaxMs = values[len(values)-1]
+	return s
+}
+
+// 注册轮换耗时分析路由
+func registerRotationProfileRoutes(r *gin.Engine) {
+	// 汇总当前租户最近 n 次轮换（默认 100）各阶段的平均及分位数耗时，并列出最慢的 5 次
+	r.GET("/debug/rotation-profile", authMiddleware, func(c *gin.Context) {
+		n := defaultProfileRotations
+		if v := c.Query("n"); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil || n <= 0 || n > maxProfileRotations {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "n 须为 1-"+strconv.Itoa(maxProfileRotations)+" 的整数")
+				return
+			}
+		}
+		profiles := recentRotationProfiles(currentTenant(c).Name, n)
+		durations := map[string][]float64{}
+		var totals []float64
+		failed := 0
+		for _, p := range profiles {
+			for phase, ms := range p.Phases {
+				durations[phase] = append(durations[phase], ms)
+			}
+			totals = append(totals, p.TotalMs)
+			if p.Failed {
+				failed++
+			}
+		}
+		phases := make([]PhaseStats, 0, len(rotationPhases))
+		for _, phase := range rotationPhases {
+			phases = append(phases, phaseStats(phase, durations[phase]))
+		}
+		slowest := append([]rotationProfile(nil), profiles...)
+		sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].TotalMs > slowest[j].TotalMs })
+		if len(slowest) > 5 {
+			slowest = slowest[:5]
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"rotations": len(profiles),
+			"failed":    failed,
+			"phases":    phases,
+			"total":     phaseStats("total", totals),
+			"slowest":   slowest,
+		})
+	})
+}
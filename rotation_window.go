@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 服务器的允许轮换时段（如 02:00-06:00，可跨午夜）：定时检查只在时段内轮换该服务器，
+// 时段外到期的服务器推迟到下一个时段开始；与轮换策略的禁止时段不同，不影响立即更新
+
+// 解析允许轮换时段 HH:MM-HH:MM，返回开始、结束在当天的分钟数
+func parseRotationWindow(window string) (int, int, error) {
+	startStr, endStr, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("无效的轮换时段 %q，格式应为 HH:MM-HH:MM", window)
+	}
+	start, err := parseClock(strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(strings.TrimSpace(endStr))
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("轮换时段的开始与结束时间不能相同")
+	}
+	return start, end, nil
+}
+
+// 规范化允许轮换时段，空字符串表示不限制
+func normalizeRotationWindow(window string) (string, error) {
+	window = strings.TrimSpace(window)
+	if window == "" {
+		return "", nil
+	}
+	start, end, err := parseRotationWindow(window)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", start/60, start%60, end/60, end%60), nil
+}
+
+// 时间是否在允许轮换时段内，未设置或无效时视为不限制
+func inRotationWindow(window string, now time.Time) bool {
+	if window == "" {
+		return true
+	}
+	start, end, err := parseRotationWindow(window)
+	if err != nil {
+		return true
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// 下一个允许轮换时段的开始时间（now 所在时区）
+func nextRotationWindowStart(window string, now time.Time) time.Time {
+	start, _, err := parseRotationWindow(window)
+	if err != nil {
+		return now
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), start/60, start%60, 0, 0, now.Location())
+	if !next.After(now) {
+		next = time.Date(now.Year(), now.Month(), now.Day()+1, start/60, start%60, 0, 0, now.Location())
+	}
+	return next
+}
+
+// 服务器设置了允许轮换时段且当前不在时段内时，将下次更新时间推迟到下一个时段开始并返回 true
+func deferToRotationWindow(t *Tenant, table string, id int, now int64) bool {
+	window := loadServerSetting(t.DB, table, id).RotationWindow
+	current := time.Unix(now, 0).In(appLocation())
+	if inRotationWindow(window, current) {
+		return false
+	}
+	next := nextRotationWindowStart(window, current)
+	if err := t.DB.Table(table).Where("id = ?", id).Updates(serverFields(table, map[string]interface{}{
+		"next_update_time":        next.Unix(),
+		"last_update_status":      "不在允许轮换时段 " + window + "，推迟到时段开始",
+		"last_update_status_code": "",
+	})).Error; err != nil {
+		log.Printf("推迟到轮换时段失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		return false
+	}
+	log.Printf("不在允许轮换时段 %s，推迟轮换到 %s: 表=%s, ID=%d", window, next.Format("2006-01-02 15:04:05"), table, id)
+	return true
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"ser_manger/internal/scheduler"
+	"ser_manger/internal/service"
+)
+
+// 默认检查频率（每 5 分钟）
+const defaultCheckCron = "*/5 * * * *"
+
+// 默认域名占用状态校对频率（每小时）
+const defaultReconcileCron = "0 * * * *"
+
+// 检查任务在调度器中的名称，检查频率可在运行中修改
+const checkJobName = "check"
+
+// 定时任务调度器，startScheduler 之前为空
+var appScheduler *scheduler.Scheduler
+
+// 启动定时任务：检查、校对及各项清理、报告、备份任务
+func startScheduler(checkCron, reconcileCron string) {
+	appScheduler = scheduler.New(scheduler.Settings{Location: appLocation()})
+	if err := scheduleCheck(checkCron); err != nil {
+		log.Fatal("添加检查任务失败: ", err)
+	}
+	if err := appScheduler.Add(reconcileCron, func() {
+		for _, t := range tenantList() {
+			reconcileDomainUsage(t)
+		}
+	}); err != nil {
+		log.Fatal("添加校对任务失败: ", err)
+	}
+	if err := appScheduler.Add("* * * * *", releaseGraceDomains); err != nil {
+		log.Fatal("添加宽限期域名释放任务失败: ", err)
+	}
+	if err := appScheduler.Add("30 3 * * *", purgeNodeMetrics); err != nil {
+		log.Fatal("添加流量数据清理任务失败: ", err)
+	}
+	if err := appScheduler.Add("40 3 * * *", purgeRecycleBin); err != nil {
+		log.Fatal("添加回收站清理任务失败: ", err)
+	}
+	if err := appScheduler.Add("50 3 * * *", purgeRememberTokens); err != nil {
+		log.Fatal("添加记住登录令牌清理任务失败: ", err)
+	}
+	if err := appScheduler.Add("55 3 * * *", purgeUserSessions); err != nil {
+		log.Fatal("添加会话清理任务失败: ", err)
+	}
+	if viper.GetBool("anomaly.enabled") {
+		anomalyCron := viper.GetString("anomaly.cron")
+		if anomalyCron == "" {
+			anomalyCron = "*/10 * * * *"
+		}
+		if err := appScheduler.Add(anomalyCron, runAnomalyDetection); err != nil {
+			log.Fatal("添加异常检测任务失败: ", err)
+		}
+	}
+	if viper.GetBool("report.enabled") {
+		reportCron := viper.GetString("report.cron")
+		if reportCron == "" {
+			reportCron = "0 9 * * 1"
+		}
+		if err := appScheduler.Add(reportCron, sendRotationReports); err != nil {
+			log.Fatal("添加轮换报告任务失败: ", err)
+		}
+	}
+	if viper.GetBool("health.enabled") && !devMode {
+		if err := appScheduler.Add(healthCronSpec(), runHealthChecks); err != nil {
+			log.Fatal("添加健康检查任务失败: ", err)
+		}
+	}
+	if backupCron := viper.GetString("backup.cron"); backupCron != "" {
+		if err := appScheduler.Add(backupCron, runScheduledBackups); err != nil {
+			log.Fatal("添加定时备份任务失败: ", err)
+		}
+	}
+	if importCron := viper.GetString("v2board.importCron"); importCron != "" && !devMode {
+		if err := appScheduler.Add(importCron, func() {
+			if _, _, err := importV2boardNodes(); err != nil {
+				log.Printf("定时从 V2Board 导入节点失败: %v", err)
+			}
+		}); err != nil {
+			log.Fatal("添加 V2Board 导入任务失败: ", err)
+		}
+	}
+	if inMaintenance() {
+		log.Println("处于维护模式，定时任务暂不启动")
+	} else if !isLeader() {
+		log.Println("本实例为备用节点，定时任务暂不启动")
+	}
+	syncScheduler()
+}
+
+// 按给定表达式（重新）调度检查任务，先添加新任务再移除旧任务，避免出现空档
+func scheduleCheck(spec string) error {
+	if err := appScheduler.Schedule(checkJobName, spec, checkAndUpdateServers); err != nil {
+		return err
+	}
+	log.Printf("检查任务已调度: %s", spec)
+	return nil
+}
+
+// checkCronSchedule 检查任务的调度，修改后写入 server.checkCron
+type checkCronSchedule struct{}
+
+func (checkCronSchedule) Current() (string, time.Time) { return checkSchedule() }
+
+func (checkCronSchedule) Reschedule(spec string) error { return scheduleCheck(spec) }
+
+func (checkCronSchedule) Save(spec string) error {
+	viper.Set("server.checkCron", spec)
+	return writeConfig()
+}
+
+// 检查任务当前的表达式及下次执行时间，调度器未启动时下次执行时间为零值
+func checkSchedule() (string, time.Time) {
+	if appScheduler == nil {
+		return "", time.Time{}
+	}
+	return appScheduler.Spec(checkJobName), appScheduler.Next(checkJobName)
+}
+
+// 校对租户的域名占用状态：in_use 标记必须与服务器当前 host 一致，修正孤立或遗漏的标记，返回修正条数
+func reconcileDomainUsage(t *Tenant) int {
+	log.Printf("运行 reconcileDomainUsage，租户=%s，时间: %s", t.Name, time.Now().Format("2006-01-02 15:04:05"))
+	issues, _ := auditDomainConsistency(t, true)
+	_, fixed := countIssues(issues)
+	log.Printf("域名占用状态校对完成，修正 %d 条记录: 租户=%s", fixed, t.Name)
+	return fixed
+}
+
+// 检查并更新所有租户的服务器
+func checkAndUpdateServers() {
+	log.Println("运行 checkAndUpdateServers，时间:", time.Now().Format("2006-01-02 15:04:05"))
+	now := time.Now().Unix()
+	// 本次检查最多轮换的服务器数，超出部分留到下次检查
+	budget := maxRotationsPerTick()
+	for _, t := range tenantList() {
+		if deferred := checkAndUpdateTenantServers(t, now, &budget); deferred > 0 {
+			log.Printf("已达到单次检查轮换上限 %d，租户 %s 的 %d 台到期服务器推迟到下次检查", maxRotationsPerTick(), t.Name, deferred)
+		}
+	}
+}
+
+// 定时检查用到的配置，每次检查时读取
+func configCheckSettings() service.CheckSettings {
+	return service.CheckSettings{
+		RetryAttempts:       rotationRetryAttempts(),
+		RetryBackoffSeconds: viper.GetInt("rotation.retryBackoffSeconds"),
+		HideAfterFailures:   hideAfterFailures(),
+	}
+}
+
+// tenantRotator 租户的轮换动作，供定时检查服务使用
+type tenantRotator struct {
+	t *Tenant
+}
+
+func (r tenantRotator) Tables() []string { return serverTables(r.t) }
+
+func (r tenantRotator) Archived() map[string]bool { return archivedServers(r.t.DB) }
+
+// 不在服务器的允许轮换时段内时推迟到下一个时段开始；节点繁忙时推迟；禁止轮换时段内不视为失败，时段结束后的首次检查再轮换
+func (r tenantRotator) Defer(table string, id int, now int64) bool {
+	if deferToRotationWindow(r.t, table, id, now) || deferRotationIfBusy(r.t, table, id, now) {
+		return true
+	}
+	if blackout := activeBlackout(loadPolicyRules(r.t.DB, table, id), time.Unix(now, 0).In(appLocation())); blackout != nil {
+		log.Printf("处于禁止轮换时段 %s-%s，推迟轮换: 表=%s, ID=%d", blackout.Start, blackout.End, table, id)
+		return true
+	}
+	return false
+}
+
+func (r tenantRotator) Rotate(table string, id int, now int64) error {
+	return updateServer(r.t, table, id, now, true, systemCause(triggerCron))
+}
+
+func (r tenantRotator) RecordFailure(table string, id int, err error) bool {
+	recordRotationFailure(r.t, table, id, systemCause(triggerCron), err)
+	return hideServerAfterFailures(r.t, table, id)
+}
+
+func (r tenantRotator) IntervalHours(table string, id int) int {
+	return serverIntervalHours(r.t.DB, table, id)
+}
+
+func (r tenantRotator) Classify(err error) string { return classifyFailure(err) }
+
+// 创建租户的定时检查服务
+func newCheckService(t *Tenant) *service.CheckService {
+	return service.NewCheckService(t.Servers, tenantRotator{t: t}, configCheckSettings)
+}
+
+// 检查并更新单个租户中到期的服务器，最早到期的先轮换；budget 为剩余可轮换数（小于 0 表示不限），
+// 返回因达到上限而推迟的服务器数
+func checkAndUpdateTenantServers(t *Tenant, now int64, budget *int) int {
+	return t.Checker.Run(now, budget)
+}
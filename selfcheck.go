@@ -0,0 +1,217 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 自检结果级别
+const (
+	checkOK      = "ok"
+	checkWarning = "warning"
+	checkFatal   = "fatal"
+)
+
+// SelfCheckItem 单项自检结果
+type SelfCheckItem struct {
+	Name    string `json:"name"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// SelfCheckReport 启动自检报告
+type SelfCheckReport struct {
+	CheckedAt int64           `json:"checked_at"`
+	Fatal     int             `json:"fatal"`
+	Warnings  int             `json:"warnings"`
+	Items     []SelfCheckItem `json:"items"`
+}
+
+// 最近一次自检报告
+var (
+	selfCheckMu     sync.Mutex
+	lastSelfCheck   SelfCheckReport
+	serverTableCols = []string{"id", "name", "port", "server_port", "host", "show", "next_update_time", "last_update_status"}
+)
+
+func (r *SelfCheckReport) add(name, level, message string) {
+	r.Items = append(r.Items, SelfCheckItem{Name: name, Level: level, Message: message})
+	switch level {
+	case checkFatal:
+		r.Fatal++
+	case checkWarning:
+		r.Warnings++
+	}
+}
+
+// 校验配置及数据库结构，返回自检报告
+func runSelfCheck() SelfCheckReport {
+	report := SelfCheckReport{CheckedAt: time.Now().Unix()}
+
+	// 端口范围
+	settings := currentSettings()
+	switch {
+	case settings.MinPort <= 0 || settings.MaxPort > 65535 || settings.MinPort >= settings.MaxPort:
+		report.add("port.range", checkFatal, "端口范围无效，应满足 0 < min < max <= 65535")
+	case settings.MaxPort-settings.MinPort < 100:
+		report.add("port.range", checkWarning, "端口范围过小，随机端口容易重复")
+	default:
+		report.add("port.range", checkOK, "")
+	}
+
+	// 更新间隔
+	if settings.UpdateIntervalHours <= 0 {
+		report.add("server.updateIntervalHours", checkWarning, "更新间隔未配置或无效，服务器将在每次检查时都被轮换")
+	} else {
+		report.add("server.updateIntervalHours", checkOK, "")
+	}
+
+	// 定时任务表达式
+	for _, key := range []string{"server.checkCron", "server.reconcileCron", "health.cron", "v2board.importCron"} {
+		spec := viper.GetString(key)
+		if spec == "" {
+			continue
+		}
+		if _, err := cron.ParseStandard(spec); err != nil {
+			report.add(key, checkFatal, "定时表达式无效: "+err.Error())
+		} else {
+			report.add(key, checkOK, "")
+		}
+	}
+
+	// 登录用户：至少有一个启用的管理员，且不使用默认密码
+	var admins []User
+	if err := db.Where("role = ? AND disabled_at = 0", roleAdmin).Find(&admins).Error; err != nil {
+		report.add("auth", checkFatal, "读取用户表失败: "+err.Error())
+	} else {
+		var defaultPassword []string
+		for _, u := range admins {
+			if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte("password123")) == nil {
+				defaultPassword = append(defaultPassword, u.Username)
+			}
+		}
+		switch {
+		case len(admins) == 0:
+			report.add("auth", checkFatal, "没有可登录的管理员，请配置 auth.username、auth.password 后重新启动以创建管理员")
+		case len(defaultPassword) > 0:
+			report.add("auth", checkWarning, "管理员密码为默认密码，请修改: "+strings.Join(defaultPassword, ", "))
+		case viper.GetString("auth.password") != "" && !isPasswordHash(viper.GetString("auth.password")) && !configValueEncrypted("auth.password"):
+			report.add("auth", checkWarning, "配置文件中仍有明文的 auth.password，管理员已迁移到用户表，可删除该配置")
+		default:
+			report.add("auth", checkOK, "")
+		}
+	}
+
+	// OIDC 访问令牌：不校验受众时其他应用的令牌也能访问接口
+	if oidcEnabled() {
+		if viper.GetString("oidc.audience") == "" {
+			report.add("oidc", checkFatal, "已配置 oidc.issuer 但未配置 oidc.audience")
+		} else {
+			report.add("oidc", checkOK, "")
+		}
+	}
+
+	// 域名解析校验
+	if viper.GetBool("dns.verify") {
+		var nodeCount int64
+		for _, t := range tenantList() {
+			var n int64
+			t.DB.Model(&ServerNode{}).Count(&n)
+			nodeCount += n
+		}
+		if nodeCount == 0 && len(viper.GetStringMapString("dns.nodeIPs")) == 0 {
+			report.add("dns.verify", checkWarning, "已开启域名解析校验但未配置任何节点 IP，校验将被跳过")
+		} else {
+			report.add("dns.verify", checkOK, "")
+		}
+	}
+
+	// V2Board 集成
+	if viper.GetString("v2board.url") != "" || viper.GetBool("v2board.pushBack") || viper.GetString("v2board.importCron") != "" {
+		switch {
+		case viper.GetString("v2board.url") == "" || viper.GetString("v2board.securePath") == "":
+			report.add("v2board", checkWarning, "V2Board 集成缺少 url 或 securePath")
+		case viper.GetString("v2board.authData") == "" && (viper.GetString("v2board.email") == "" || viper.GetString("v2board.password") == ""):
+			report.add("v2board", checkWarning, "V2Board 集成缺少 authData 或管理员账号")
+		default:
+			report.add("v2board", checkOK, "")
+		}
+	}
+
+	// 服务器表列映射
+	if problems := checkColumnMappings(); len(problems) > 0 {
+		report.add("columns", checkFatal, strings.Join(problems, "; "))
+	} else {
+		report.add("columns", checkOK, "")
+	}
+
+	// 各租户的服务器表及必需列，非默认租户的检查项带租户前缀
+	for _, t := range tenantList() {
+		prefix := "table."
+		if t.Name != defaultTenantName {
+			prefix = t.Name + ".table."
+		}
+		migrator := t.DB.Migrator()
+		for _, table := range panelServerTables {
+			if !migrator.HasTable(table) {
+				report.add(prefix+table, checkWarning, "服务器表不存在")
+				continue
+			}
+			var missing []string
+			for _, col := range serverTableCols {
+				if col != "id" {
+					col = serverColumn(table, col)
+				}
+				if !migrator.HasColumn(table, col) {
+					missing = append(missing, col)
+				}
+			}
+			if len(missing) > 0 {
+				report.add(prefix+table, checkFatal, "缺少必需列: "+strings.Join(missing, ", "))
+			} else {
+				report.add(prefix+table, checkOK, "")
+			}
+		}
+	}
+	return report
+}
+
+// 执行自检并打印报告，存在致命问题时拒绝启动
+func startupSelfCheck() {
+	report := runSelfCheck()
+	selfCheckMu.Lock()
+	lastSelfCheck = report
+	selfCheckMu.Unlock()
+	log.Printf("启动自检报告: 致命 %d 项, 警告 %d 项", report.Fatal, report.Warnings)
+	for _, item := range report.Items {
+		if item.Level == checkOK {
+			log.Printf("  [%s] %s", item.Level, item.Name)
+		} else {
+			log.Printf("  [%s] %s: %s", item.Level, item.Name, item.Message)
+		}
+	}
+	if report.Fatal > 0 {
+		log.Fatal("启动自检发现致命问题，拒绝启动")
+	}
+}
+
+// 注册系统自检路由
+func registerSelfCheckRoutes(r *gin.Engine) {
+	// 查看自检报告，refresh=1 时重新执行
+	r.GET("/system-check", authMiddleware, func(c *gin.Context) {
+		selfCheckMu.Lock()
+		defer selfCheckMu.Unlock()
+		if c.Query("refresh") == "1" {
+			lastSelfCheck = runSelfCheck()
+		}
+		c.JSON(http.StatusOK, lastSelfCheck)
+	})
+}
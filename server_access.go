@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// API 令牌及登录用户可限定只管理部分服务器组（如东南亚团队只管理新加坡节点）：servers 为逗号分隔的表名
+// （如 v2_server_vless）或 tag:<标签>（服务器设置中的标签），为空表示不限制；OIDC 访问令牌的服务器组
+// 取自 oidc.serversClaim 指定的声明。受限的调用方只能访问针对允许服务器的接口，列表接口只返回允许的服务器，
+// 全局操作一律拒绝
+
+// 服务器组中按标签匹配的前缀
+const serverGroupTagPrefix = "tag:"
+
+// serverAccess 受限调用方可访问的服务器组
+type serverAccess struct {
+	tables map[string]bool
+	tags   []string
+}
+
+// serverRef 请求涉及的服务器，ID 为 0 表示整张表
+type serverRef struct {
+	Table string
+	ID    int
+}
+
+// 解析并校验服务器组列表，返回规范化后的字符串
+func parseServerGroups(raw string) (string, error) {
+	var groups []string
+	seen := map[string]bool{}
+	for _, g := range strings.Split(raw, ",") {
+		g = strings.TrimSpace(g)
+		if g == "" || seen[g] {
+			continue
+		}
+		if tag, ok := strings.CutPrefix(g, serverGroupTagPrefix); ok {
+			if tag = normalizeTags(tag); tag == "" || strings.Contains(tag, ",") {
+				return "", fmt.Errorf("无效的服务器组：%s", g)
+			}
+			g = serverGroupTagPrefix + tag
+		} else if !isValidServerTable(g) {
+			return "", fmt.Errorf("无效的服务器组：%s，应为服务器表名或 tag:<标签>", g)
+		}
+		seen[g] = true
+		groups = append(groups, g)
+	}
+	return strings.Join(groups, ","), nil
+}
+
+// 由服务器组构造访问限制，为空时返回 nil（不限制）
+func newServerAccess(groups string) *serverAccess {
+	if strings.TrimSpace(groups) == "" {
+		return nil
+	}
+	a := &serverAccess{tables: map[string]bool{}}
+	for _, g := range strings.Split(groups, ",") {
+		if tag, ok := strings.CutPrefix(g, serverGroupTagPrefix); ok {
+			a.tags = append(a.tags, tag)
+		} else if g != "" {
+			a.tables[g] = true
+		}
+	}
+	return a
+}
+
+// 当前请求的服务器访问限制，不受限时返回 nil
+func requestServerAccess(c *gin.Context) *serverAccess {
+	if v, ok := c.Get("server_access"); ok {
+		return v.(*serverAccess)
+	}
+	return nil
+}
+
+// 是否允许访问指定服务器；ID 为 0 时要求整张表都在允许范围内
+func (a *serverAccess) allows(tdb *gorm.DB, ref serverRef) bool {
+	if a == nil || a.tables[ref.Table] {
+		return true
+	}
+	if ref.ID <= 0 {
+		return false
+	}
+	for _, tag := range a.tags {
+		if serverHasTag(tdb, ref.Table, ref.ID, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按标签允许访问的服务器（表 -> ID 列表）
+func (a *serverAccess) taggedServers(tdb *gorm.DB) map[string][]int {
+	servers := map[string][]int{}
+	if len(a.tags) == 0 {
+		return servers
+	}
+	var settings []ServerSetting
+	if err := tdb.Select("server_table", "server_id", "tags").Where("tags <> ''").Find(&settings).Error; err != nil {
+		log.Printf("获取服务器标签失败: %v", err)
+		return servers
+	}
+	for _, s := range settings {
+		for _, tag := range a.tags {
+			if serverTagsContain(s.Tags, tag) {
+				servers[s.ServerTable] = append(servers[s.ServerTable], s.ServerID)
+				break
+			}
+		}
+	}
+	return servers
+}
+
+// 查询范围：只保留允许访问的服务器的记录，用于带 server_table、server_id 列的表
+func (a *serverAccess) scope(tdb *gorm.DB) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		if a == nil {
+			return q
+		}
+		var conds []string
+		var args []interface{}
+		if len(a.tables) > 0 {
+			tables := make([]string, 0, len(a.tables))
+			for table := range a.tables {
+				tables = append(tables, table)
+			}
+			conds = append(conds, "server_table IN ?")
+			args = append(args, tables)
+		}
+		for table, ids := range a.taggedServers(tdb) {
+			conds = append(conds, "(server_table = ? AND server_id IN ?)")
+			args = append(args, table, ids)
+		}
+		if len(conds) == 0 {
+			return q.Where("1 = 0")
+		}
+		return q.Where("("+strings.Join(conds, " OR ")+")", args...)
+	}
+}
+
+// 当前请求的查询范围，不受限时不做过滤
+func serverAccessScope(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	return requestServerAccess(c).scope(currentTenant(c).DB)
+}
+
+// 从请求中取出涉及的服务器，无法确定时返回空列表（受限调用方将被拒绝）
+type serverResolver func(c *gin.Context, tdb *gorm.DB) []serverRef
+
+// 请求参数：依次从路径参数、查询字符串、表单中读取
+func requestParam(c *gin.Context, key string) string {
+	if v := c.Param(key); v != "" {
+		return v
+	}
+	if v := c.Query(key); v != "" {
+		return v
+	}
+	return c.PostForm(key)
+}
+
+// 上下文中保存服务器参数的键前缀
+const serverParamKeyPrefix = "server_param:"
+
+// 涉及服务器的请求参数（表名、ID、记录 ID 等）：路由带同名路径参数时读取路径参数，GET、DELETE 请求读取查询字符串，
+// 其余请求只读取表单，不回退到查询字符串，避免校验与处理函数读到不同的服务器。
+// 首次读取的值保存在上下文中，处理函数读到的就是访问校验时解析出的值
+func serverParam(c *gin.Context, key string) string {
+	if v, ok := c.Get(serverParamKeyPrefix + key); ok {
+		return v.(string)
+	}
+	var v string
+	switch {
+	case strings.Contains(c.FullPath()+"/", "/:"+key+"/"):
+		v = c.Param(key)
+	case c.Request.Method == http.MethodGet || c.Request.Method == http.MethodDelete:
+		v = c.Query(key)
+	default:
+		v = c.PostForm(key)
+	}
+	c.Set(serverParamKeyPrefix+key, v)
+	return v
+}
+
+// 由指定参数名的表名及 ID 得到服务器，allowTable 为 true 时 ID 为空或 0 表示整张表
+func paramServer(tableKey, idKey string, allowTable bool) serverResolver {
+	return func(c *gin.Context, tdb *gorm.DB) []serverRef {
+		table := serverParam(c, tableKey)
+		if !isValidServerTable(table) {
+			return nil
+		}
+		id, err := strconv.Atoi(serverParam(c, idKey))
+		if err != nil || id <= 0 {
+			if allowTable && id == 0 {
+				return []serverRef{{Table: table}}
+			}
+			return nil
+		}
+		return []serverRef{{Table: table, ID: id}}
+	}
+}
+
+// 请求参数 table、id 指定的服务器
+var serverFromParams = paramServer("table", "id", false)
+
+// 由请求参数中的记录 ID 查找记录所属的服务器，model 需带 server_table、server_id 列
+func recordServer(idKey string, model interface{}) serverResolver {
+	return func(c *gin.Context, tdb *gorm.DB) []serverRef {
+		id, err := strconv.Atoi(serverParam(c, idKey))
+		if err != nil || id <= 0 {
+			return nil
+		}
+		var ref struct {
+			ServerTable string
+			ServerID    int
+		}
+		if err := tdb.Model(model).Select("server_table", "server_id").Where("id = ?", id).Take(&ref).Error; err != nil {
+			return nil
+		}
+		return []serverRef{{Table: ref.ServerTable, ID: ref.ServerID}}
+	}
+}
+
+// 节点上报的 JSON 请求体中的服务器，读取后恢复请求体供处理函数解析
+func serverFromJSONBody(c *gin.Context, tdb *gorm.DB) []serverRef {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	var req nodeMetricRequest
+	if json.Unmarshal(body, &req) != nil || !isValidServerTable(req.Table) || req.ID <= 0 {
+		return nil
+	}
+	return []serverRef{{Table: req.Table, ID: req.ID}}
+}
+
+// 复制域名池的源服务器及目标服务器
+func serversFromClone(c *gin.Context, tdb *gorm.DB) []serverRef {
+	from := paramServer("from_table", "from_id", false)(c, tdb)
+	to := paramServer("to_table", "to_id", false)(c, tdb)
+	if len(from) == 0 || len(to) == 0 {
+		return nil
+	}
+	return append(from, to...)
+}
+
+// 下线服务器，domains=release 时还包括接收域名的目标服务器
+func serversFromArchive(c *gin.Context, tdb *gorm.DB) []serverRef {
+	refs := serverFromParams(c, tdb)
+	if len(refs) == 0 || c.Query("domains") != archiveDomainsRelease {
+		return refs
+	}
+	to := paramServer("target_table", "target_id", false)(c, tdb)
+	if len(to) == 0 {
+		return nil
+	}
+	return append(refs, to...)
+}
+
+// 重新分配已下线服务器域名的源服务器及目标服务器
+func serversFromReassign(c *gin.Context, tdb *gorm.DB) []serverRef {
+	from := serverFromParams(c, tdb)
+	to := paramServer("target_table", "target_id", false)(c, tdb)
+	if len(from) == 0 || len(to) == 0 {
+		return nil
+	}
+	return append(from, to...)
+}
+
+// 按范围设置轮换间隔涉及的服务器：指定 ids 时为这些服务器，只按标签时为带该标签的服务器，
+// 只指定 table 时为整张表；不指定范围（全局间隔）时无法确定
+func serversFromIntervalScope(c *gin.Context, tdb *gorm.DB) []serverRef {
+	table, tag, idsStr := c.PostForm("table"), normalizeTags(c.PostForm("tag")), c.PostForm("ids")
+	if table != "" && !isValidServerTable(table) {
+		return nil
+	}
+	var refs []serverRef
+	if strings.TrimSpace(idsStr) != "" {
+		if table == "" {
+			return nil
+		}
+		for _, f := range strings.Split(idsStr, ",") {
+			if f = strings.TrimSpace(f); f == "" {
+				continue
+			}
+			id, err := strconv.Atoi(f)
+			if err != nil || id <= 0 {
+				return nil
+			}
+			refs = append(refs, serverRef{Table: table, ID: id})
+		}
+		return refs
+	}
+	if tag != "" {
+		var settings []ServerSetting
+		if err := tdb.Select("server_table", "server_id", "tags").Where("tags <> ''").Find(&settings).Error; err != nil {
+			return nil
+		}
+		for _, s := range settings {
+			if (table == "" || s.ServerTable == table) && serverTagsContain(s.Tags, tag) {
+				refs = append(refs, serverRef{Table: s.ServerTable, ID: s.ServerID})
+			}
+		}
+		return refs
+	}
+	if table != "" {
+		return []serverRef{{Table: table}}
+	}
+	return nil
+}
+
+// 针对具体服务器的接口（方法 + 路由）及取出服务器的方式
+var serverAccessResolvers = map[string]serverResolver{
+	"GET /available-domains":                            serverFromParams,
+	"POST /add-domain":                                  serverFromParams,
+	"POST /delete-domain":                               serverFromParams,
+	"POST /update-domain-meta":                          serverFromParams,
+	"POST /update-now":                                  serverFromParams,
+	"POST /set-interval":                                serversFromIntervalScope,
+	"POST /server-node-ip":                              serverFromParams,
+	"GET /node-credentials":                             serverFromParams,
+	"POST /node-credentials":                            serverFromParams,
+	"POST /node-credentials/delete":                     serverFromParams,
+	"POST /node-credentials/test":                       serverFromParams,
+	"POST /node-credentials/rotate-key":                 serverFromParams,
+	"GET /node-metrics":                                 serverFromParams,
+	"POST /node-metrics":                                serverFromJSONBody,
+	"GET /server-settings":                              serverFromParams,
+	"POST /server-settings":                             serverFromParams,
+	"GET /servers/:table/:id":                           serverFromParams,
+	"GET /api/v1/servers/:table/:id/schedule":           serverFromParams,
+	"DELETE /api/v1/servers/:table/:id":                 serversFromArchive,
+	"GET /api/v1/archived-servers/:table/:id":           serverFromParams,
+	"POST /api/v1/archived-servers/:table/:id/reassign": serversFromReassign,
+	"GET /user-impact":                                  serverFromParams,
+	"POST /rotation-policies":                           serverFromParams,
+	"POST /rotation-policies/delete":                    serverFromParams,
+	"POST /domain-quota":                                serverFromParams,
+	"POST /domain-restore-retired":                      serverFromParams,
+	"POST /acquire-domains":                             serverFromParams,
+	"POST /port-presets/bind":                           paramServer("table", "id", true),
+	"POST /clone-domains":                               serversFromClone,
+	"PATCH /api/v1/domains/:id":                         recordServer("id", &ServerDomain{}),
+	"POST /release-domain":                              recordServer("domain_id", &ServerDomain{}),
+	"POST /stage-domain":                                recordServer("domain_id", &ServerDomain{}),
+	"POST /server-anomalies/ack":                        recordServer("id", &ServerAnomaly{}),
+	"POST /rotation-approvals/decide":                   recordServer("id", &RotationApproval{}),
+	"POST /deleted-domains/restore":                     recordServer("id", &DeletedDomain{}),
+	"POST /deleted-domains/purge":                       recordServer("id", &DeletedDomain{}),
+}
+
+// 按服务器过滤结果的列表接口，受限调用方可访问，处理函数只返回允许的服务器
+var serverFilteredRoutes = map[string]bool{
+	"GET /servers":                  true,
+	"GET /search-domains":           true,
+	"GET /rotation-history":         true,
+	"GET /server-anomalies":         true,
+	"GET /rotation-approvals":       true,
+	"GET /deleted-domains":          true,
+	"GET /domain-aliases":           true,
+	"GET /health-checks":            true,
+	"GET /api/v1/archived-servers":  true,
+	"GET /domain-transitions":       true,
+	"GET /api/v1/domains/unused":    true,
+	"POST /bulk-edit-domains":       true,
+	"GET /api/v1/rotation-calendar": true,
+}
+
+// 与服务器无关的个人设置及账号接口，受限调用方可访问
+var serverNeutralRoutes = map[string]bool{
+	"GET /tenants":               true,
+	"GET /confirm-token":         true,
+	"GET /switch-tenant":         true,
+	"GET /preferences/timezone":  true,
+	"POST /preferences/timezone": true,
+	"GET /sessions":              true,
+	"POST /sessions/revoke":      true,
+	"POST /logout-all":           true,
+	"POST /change-password":      true,
+}
+
+// 校验受限调用方（principal 为 token:<名称>、user:<用户名> 或 oidc:<客户端>）能否访问当前请求涉及的服务器，
+// 不允许时写入 403 响应并返回 false
+func checkServerAccess(c *gin.Context, a *serverAccess, principal string) bool {
+	if a == nil {
+		return true
+	}
+	route := c.Request.Method + " " + c.FullPath()
+	tdb := currentTenant(c).DB
+	var refs []serverRef
+	switch {
+	case serverNeutralRoutes[route]:
+		return true
+	case serverFilteredRoutes[route]:
+		return true
+	case serverAccessResolvers[route] != nil:
+		if refs = serverAccessResolvers[route](c, tdb); len(refs) == 0 {
+			log.Printf("受限调用方无法确定请求的服务器: 调用方=%s, 路径=%s", principal, route)
+			respondError(c, http.StatusForbidden, codeForbidden, "仅限指定服务器组，请求未指明允许的服务器")
+			return false
+		}
+	default:
+		log.Printf("受限调用方不能执行全局操作: 调用方=%s, 路径=%s", principal, route)
+		respondError(c, http.StatusForbidden, codeForbidden, "仅限指定服务器组，不能执行全局操作")
+		return false
+	}
+	for _, ref := range refs {
+		if !a.allows(tdb, ref) {
+			log.Printf("受限调用方访问不允许的服务器: 调用方=%s, 路径=%s, 表=%s, ID=%d", principal, route, ref.Table, ref.ID)
+			respondError(c, http.StatusForbidden, codeForbidden, "无权管理该服务器")
+			return false
+		}
+	}
+	return true
+}
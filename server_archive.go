@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 服务器下线方式
+const (
+	archiveModeHide   = "hide"   // 隐藏面板行并标记归档，不再轮换
+	archiveModeDelete = "delete" // 删除面板行及服务器相关配置
+)
+
+// 下线服务器的域名处理方式
+const (
+	archiveDomainsRetire  = "retire"  // 全部退役
+	archiveDomainsRelease = "release" // 释放并移交给目标服务器，目标已有的域名改为退役
+)
+
+// 服务器下线时退役域名的原因
+const archiveRetiredReason = "服务器下线"
+
+// ArchiveResult 服务器下线结果
+type ArchiveResult struct {
+	Table    string   `json:"table"`
+	ID       int      `json:"id"`
+	Mode     string   `json:"mode"`
+	Domains  string   `json:"domains"`
+	Released int      `json:"released"`
+	Retired  int      `json:"retired"`
+	Skipped  []string `json:"skipped,omitempty"` // 目标服务器已有而改为退役的域名
+}
+
+// 已归档的服务器，键为 表名:ID
+func archivedServers(tdb *gorm.DB) map[string]bool {
+	var settings []ServerSetting
+	if err := tdb.Select("server_table, server_id").Where("archived_at > ?", 0).Find(&settings).Error; err != nil {
+		log.Printf("获取已归档服务器失败: %v", err)
+	}
+	archived := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		archived[s.ServerTable+":"+strconv.Itoa(s.ServerID)] = true
+	}
+	return archived
+}
+
+// 下线服务器：按 domains 退役或移交其域名，写入最后一条轮换历史及下线档案，再按 mode 隐藏或删除面板行；
+// 需要退役的域名开启了删除保护时不做任何修改，返回 errDomainProtected
+func archiveServer(t *Tenant, table string, id int, mode, domains, targetTable string, targetID int, operator string) (ArchiveResult, error) {
+	result := ArchiveResult{Table: table, ID: id, Mode: mode, Domains: domains}
+	var server struct {
+		Host string
+		Port string
+	}
+	if err := t.DB.Table(table).Select(serverSelect(table, "host", "port")).Where("id = ?", id).First(&server).Error; err != nil {
+		return result, err
+	}
+	now := time.Now().Unix()
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		var owned []ServerDomain
+		if err := tx.Where("server_table = ? AND server_id = ? AND retired = ?", table, id, 0).Order("`order`").Find(&owned).Error; err != nil {
+			return err
+		}
+		retire := func(d ServerDomain) error {
+			if isProtectedDomain(d) {
+				return fmt.Errorf("%w：%s", errDomainProtected, d.Domain)
+			}
+			result.Retired++
+			return tx.Model(&ServerDomain{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+				"in_use":         0,
+				"retired":        1,
+				"retired_time":   now,
+				"retired_reason": archiveRetiredReason,
+			}).Error
+		}
+		for _, d := range owned {
+			if domains != archiveDomainsRelease {
+				if err := retire(d); err != nil {
+					return err
+				}
+				continue
+			}
+			var count int64
+			tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND domain = ?", targetTable, targetID, d.Domain).Count(&count)
+			if count > 0 {
+				result.Skipped = append(result.Skipped, d.Domain)
+				if err := retire(d); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := moveDomainToServer(tx, d, targetTable, targetID, nil); err != nil {
+				return err
+			}
+			result.Released++
+		}
+
+		oldPort, _ := strconv.Atoi(server.Port)
+		if err := tx.Create(&RotationHistory{ServerTable: table, ServerID: id, OldHost: server.Host, OldPort: oldPort, Status: rotationArchived, Actor: operator, CreatedAt: now}).Error; err != nil {
+			return err
+		}
+		if err := saveArchivedServer(tx, ArchivedServer{ServerTable: table, ServerID: id, Host: server.Host, Port: oldPort, Mode: mode, Operator: operator, ArchivedAt: now}); err != nil {
+			return err
+		}
+
+		if mode == archiveModeDelete {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE id = ?", id).Error; err != nil {
+				return err
+			}
+			for _, model := range []interface{}{&ServerSetting{}, &ServerNode{}, &RotationPolicy{}, &PortPresetBinding{}, &ServerSnapshot{}, &DomainSummary{}} {
+				if err := tx.Where("server_table = ? AND server_id = ?", table, id).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := tx.Table(table).Where("id = ?", id).Updates(serverFields(table, map[string]interface{}{
+			"show":                    0,
+			"last_update_status":      "已下线归档",
+			"last_update_status_code": "",
+		})).Error; err != nil {
+			return err
+		}
+		setting := loadServerSetting(tx, table, id)
+		setting.ArchivedAt = now
+		return tx.Save(&setting).Error
+	})
+	return result, err
+}
+
+// 注册服务器下线路由
+func registerServerArchiveRoutes(r *gin.Engine) {
+	// 下线服务器：mode=hide（默认，隐藏并归档）或 delete（删除面板行，需确认令牌 delete-server）；
+	// domains=retire（默认，退役全部域名）或 release（移交给 target_table/target_id 指定的服务器）
+	r.DELETE("/api/v1/servers/:table/:id", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		table := serverParam(c, "table")
+		if !isValidServerTable(table) {
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		id, err := strconv.Atoi(serverParam(c, "id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的服务器ID")
+			return
+		}
+		mode := c.DefaultQuery("mode", archiveModeHide)
+		if mode != archiveModeHide && mode != archiveModeDelete {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的下线方式（可选 hide, delete）")
+			return
+		}
+		domains := c.DefaultQuery("domains", archiveDomainsRetire)
+		if domains != archiveDomainsRetire && domains != archiveDomainsRelease {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的域名处理方式（可选 retire, release）")
+			return
+		}
+		var targetTable string
+		var targetID int
+		if domains == archiveDomainsRelease {
+			targetTable = serverParam(c, "target_table")
+			if !isValidServerTable(targetTable) {
+				respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的目标表名")
+				return
+			}
+			targetID, err = strconv.Atoi(serverParam(c, "target_id"))
+			if err != nil || targetID <= 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidID, "无效的目标服务器ID")
+				return
+			}
+			if targetTable == table && targetID == id {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "目标服务器不能是下线的服务器")
+				return
+			}
+			if exists, err := serverExists(t, targetTable, targetID); err != nil || !exists {
+				respondError(c, http.StatusNotFound, codeNotFound, "目标服务器不存在")
+				return
+			}
+			if archivedServers(t.DB)[targetTable+":"+strconv.Itoa(targetID)] {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "目标服务器已下线归档")
+				return
+			}
+		}
+
+		if mode == archiveModeDelete && !consumeConfirmToken(c, confirmDeleteServer) {
+			return
+		}
+		result, err := archiveServer(t, table, id, mode, domains, targetTable, targetID, operatorName(c))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondError(c, http.StatusNotFound, codeNotFound, "服务器不存在")
+				return
+			}
+			if errors.Is(err, errDomainProtected) {
+				respondError(c, http.StatusConflict, codeDomainProtected, "无法退役域名，"+err.Error())
+				return
+			}
+			log.Printf("下线服务器失败: 租户=%s, 表=%s, ID=%d, 错误=%v", t.Name, table, id, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "下线服务器失败："+err.Error())
+			return
+		}
+		detail := fmt.Sprintf("方式=%s, 域名=%s, 移交=%d, 退役=%d", mode, domains, result.Released, result.Retired)
+		if domains == archiveDomainsRelease {
+			detail += fmt.Sprintf(", 目标=%s:%d", targetTable, targetID)
+		}
+		recordAudit(t.DB, "archive_server", fmt.Sprintf("%s:%d", table, id), operatorName(c), c.ClientIP(), detail)
+		log.Printf("服务器已下线: 租户=%s, 表=%s, ID=%d, %s", t.Name, table, id, detail)
+		c.JSON(http.StatusOK, gin.H{"message": "服务器已下线", "result": result})
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// CachedServer 结构体，面板服务器行在本地 SQLite 缓存中的副本
+type CachedServer struct {
+	ServerTable          string `gorm:"column:server_table;type:varchar(64);primaryKey"`
+	ID                   int    `gorm:"column:id;primaryKey;autoIncrement:false"`
+	Name                 string `gorm:"column:name"`
+	Port                 string `gorm:"column:port"`
+	ServerPort           int    `gorm:"column:server_port"`
+	Host                 string `gorm:"column:host"`
+	Show                 bool   `gorm:"column:show"`
+	NextUpdateTime       int64  `gorm:"column:next_update_time"`
+	LastUpdateStatus     string `gorm:"column:last_update_status"`
+	LastUpdateStatusCode string `gorm:"column:last_update_status_code"`
+}
+
+// 租户的服务器缓存：写入面板服务器表时标记失效，下次读取或定时刷新时重新加载
+type serverCache struct {
+	db          *gorm.DB
+	mu          sync.Mutex // 串行化刷新
+	dirty       atomic.Bool
+	refreshedAt atomic.Int64
+}
+
+// 租户名称 -> *serverCache，仅在 cache.enabled 时创建
+var serverCaches sync.Map
+
+// 缓存刷新间隔（cache.refreshSeconds），默认 30 秒
+func serverCacheRefreshSeconds() int64 {
+	if n := viper.GetInt64("cache.refreshSeconds"); n > 0 {
+		return n
+	}
+	return 30
+}
+
+// 开启 cache.enabled 时为每个租户建立内存 SQLite 缓存并定时刷新，
+// 服务器列表及指标等只读接口从缓存读取，减少对面板 MySQL 的查询
+func setupServerCache() {
+	if !viper.GetBool("cache.enabled") {
+		return
+	}
+	for _, t := range tenantList() {
+		cacheDB, err := gorm.Open(sqlite.Open("file:server_manager_cache_"+t.Name+"?mode=memory&cache=shared&_pragma=busy_timeout(5000)"), &gorm.Config{})
+		if err != nil {
+			log.Printf("打开服务器缓存失败，租户 %s 不使用缓存: %v", t.Name, err)
+			continue
+		}
+		if err := cacheDB.AutoMigrate(&CachedServer{}); err != nil {
+			log.Printf("创建服务器缓存表失败，租户 %s 不使用缓存: %v", t.Name, err)
+			continue
+		}
+		cache := &serverCache{db: cacheDB}
+		registerServerWriteCallback(t.DB, "server_cache:invalidate", func() { cache.dirty.Store(true) })
+		if err := cache.refresh(t); err != nil {
+			log.Printf("初始化服务器缓存失败: 租户=%s, 错误=%v", t.Name, err)
+		}
+		serverCaches.Store(t.Name, cache)
+	}
+	interval := serverCacheRefreshSeconds()
+	log.Printf("服务器缓存已开启，刷新间隔 %d 秒", interval)
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			for _, t := range tenantList() {
+				if v, ok := serverCaches.Load(t.Name); ok {
+					if err := v.(*serverCache).refresh(t); err != nil {
+						log.Printf("刷新服务器缓存失败: 租户=%s, 错误=%v", t.Name, err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// 在租户数据库上注册回调：创建、更新、删除服务器表或执行涉及面板表的原生 SQL 成功后调用 fn
+func registerServerWriteCallback(tdb *gorm.DB, name string, fn func()) {
+	onWrite := func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		if isValidServerTable(tx.Statement.Table) || strings.Contains(tx.Statement.SQL.String(), "v2_server_") {
+			fn()
+		}
+	}
+	cb := tdb.Callback()
+	cb.Create().After("gorm:create").Register(name, onWrite)
+	cb.Update().After("gorm:update").Register(name, onWrite)
+	cb.Delete().After("gorm:delete").Register(name, onWrite)
+	cb.Raw().After("gorm:raw").Register(name, onWrite)
+}
+
+// 从面板数据库重新加载全部服务器行
+func (sc *serverCache) refresh(t *Tenant) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	// 先清除失效标记，刷新期间发生的写入会重新标记
+	sc.dirty.Store(false)
+	var rows []CachedServer
+	for _, table := range serverTables(t) {
+		records, err := queryServerRows(t.DB, table)
+		if err != nil {
+			sc.dirty.Store(true)
+			return err
+		}
+		rows = append(rows, records...)
+	}
+	err := sc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&CachedServer{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, 200).Error
+	})
+	if err != nil {
+		sc.dirty.Store(true)
+		return err
+	}
+	sc.refreshedAt.Store(time.Now().Unix())
+	return nil
+}
+
+// 直接从面板数据库查询指定表的服务器行
+func queryServerRows(tdb *gorm.DB, table string) ([]CachedServer, error) {
+	var rows []CachedServer
+	if err := tdb.Table(table).Select(serverSelect(table, "id", "name", "port", "server_port", "host", "show", "next_update_time", "last_update_status", "last_update_status_code")).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].ServerTable = table
+	}
+	return rows, nil
+}
+
+// 读取指定表的服务器行：开启缓存时从缓存读取（已失效或过期时先刷新），否则直接查询面板数据库
+func listServerRows(t *Tenant, table string) ([]CachedServer, error) {
+	v, ok := serverCaches.Load(t.Name)
+	if !ok {
+		return queryServerRows(t.DB, table)
+	}
+	cache := v.(*serverCache)
+	if cache.dirty.Load() || time.Now().Unix()-cache.refreshedAt.Load() > serverCacheRefreshSeconds() {
+		if err := cache.refresh(t); err != nil {
+			log.Printf("刷新服务器缓存失败，直接查询面板数据库: 租户=%s, 错误=%v", t.Name, err)
+			return queryServerRows(t.DB, table)
+		}
+	}
+	var rows []CachedServer
+	if err := cache.db.Where("server_table = ?", table).Order("id").Find(&rows).Error; err != nil {
+		log.Printf("读取服务器缓存失败，直接查询面板数据库: 租户=%s, 错误=%v", t.Name, err)
+		return queryServerRows(t.DB, table)
+	}
+	return rows, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"ser_manger/internal/repository"
+)
+
+// 可映射的面板服务器表列（逻辑名）；部分面板分支重命名了列（如 host 改为 server_name），
+// 可在 [columns.<表名>] 中配置 逻辑名 = '实际列名'。主键固定为 id
+var mappableServerColumns = []string{"name", "port", "server_port", "host", "show", "next_update_time", "last_update_status", "last_update_status_code", "created_at", "updated_at", "tls_settings", "network_settings", "last_check_at"}
+
+// 已提示过的无效映射，避免重复日志
+var invalidColumnMappings sync.Map
+
+// 逻辑列名对应的实际列名，未配置或配置无效时使用逻辑名
+func serverColumn(table, column string) string {
+	name := viper.GetString("columns." + table + "." + column)
+	if name == "" {
+		return column
+	}
+	if !columnNamePattern.MatchString(name) {
+		if _, logged := invalidColumnMappings.LoadOrStore(table+"."+column, true); !logged {
+			log.Printf("无效的列映射 columns.%s.%s = %q，使用默认列名", table, column, name)
+		}
+		return column
+	}
+	return name
+}
+
+// configColumns 按 columns.<表名>.<列名> 配置映射服务器表的列名
+type configColumns struct{}
+
+func (configColumns) Column(table, column string) string { return serverColumn(table, column) }
+
+// 创建服务器表的数据访问，列名按配置映射
+func newServerRepository(tdb *gorm.DB) *repository.ServerRepository {
+	return repository.NewServerRepository(tdb, repository.Settings{Columns: configColumns{}})
+}
+
+// 带反引号的实际列名，用于拼接 SQL
+func quotedServerColumn(table, column string) string {
+	return "`" + serverColumn(table, column) + "`"
+}
+
+// 查询列表达式：实际列名以逻辑名作为别名返回，扫描结构体无需关心映射
+func serverSelect(table string, columns ...string) string {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		if column == "id" {
+			parts[i] = "id"
+			continue
+		}
+		parts[i] = fmt.Sprintf("%s AS `%s`", quotedServerColumn(table, column), column)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// 等值条件：每个逻辑列生成 `实际列名` = ?，以 AND 连接
+func serverCond(table string, columns ...string) string {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		if column == "id" {
+			parts[i] = "id = ?"
+			continue
+		}
+		parts[i] = quotedServerColumn(table, column) + " = ?"
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// 将以逻辑列名为键的更新字段转换为实际列名
+func serverFields(table string, fields map[string]interface{}) map[string]interface{} {
+	mapped := make(map[string]interface{}, len(fields))
+	for column, value := range fields {
+		mapped[serverColumn(table, column)] = value
+	}
+	return mapped
+}
+
+// 校验列映射配置，返回问题描述（用于启动自检）
+func checkColumnMappings() []string {
+	var problems []string
+	known := map[string]bool{}
+	for _, column := range mappableServerColumns {
+		known[column] = true
+	}
+	for table, v := range viper.GetStringMap("columns") {
+		if !isValidServerTable(table) {
+			problems = append(problems, "未知的服务器表 "+table)
+			continue
+		}
+		mapping, ok := v.(map[string]interface{})
+		if !ok {
+			problems = append(problems, table+" 的列映射格式无效")
+			continue
+		}
+		for column, name := range mapping {
+			if !known[column] {
+				problems = append(problems, fmt.Sprintf("%s.%s 不是可映射的列", table, column))
+				continue
+			}
+			if s, ok := name.(string); !ok || !columnNamePattern.MatchString(s) {
+				problems = append(problems, fmt.Sprintf("%s.%s 的实际列名无效", table, column))
+			}
+		}
+	}
+	return problems
+}
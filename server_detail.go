@@ -0,0 +1,220 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+)
+
+// 详情页展示的轮换历史条数
+const detailHistoryLimit = 50
+
+// ServerDetail 服务器详情：当前配置、域名池、轮换历史及计划
+type ServerDetail struct {
+	Tenant               string            `json:"tenant"`
+	TableName            string            `json:"table"`
+	ID                   int               `json:"id"`
+	Name                 string            `json:"name"`
+	Port                 string            `json:"port"`
+	ServerPort           int               `json:"server_port"`
+	Host                 string            `json:"host"`
+	Show                 bool              `json:"show"`
+	NextUpdateTime       int64             `json:"next_update_time"`
+	LastUpdateStatus     string            `json:"last_update_status"`
+	LastUpdateStatusCode string            `json:"last_update_status_code"` // 失败分类，成功时为空
+	Remediation          string            `json:"remediation"`             // 失败分类对应的处理建议
+	NextCheckTime        int64             `json:"next_check_time"`
+	NodeIP               string            `json:"node_ip"`
+	PortPreset           *PortPreset       `json:"port_preset"`
+	Setting              ServerSetting     `json:"setting"`
+	DomainTotal          int64             `json:"domain_total"`
+	DomainAvailable      int64             `json:"domain_available"`
+	DomainCooldown       int64             `json:"domain_in_cooldown"`
+	Traffic              TrafficSummary    `json:"traffic"`
+	Impact               UserImpact        `json:"impact"` // 轮换预计影响的在线用户数
+	Domains              []ServerDomain    `json:"domains"`
+	Rotations            []RotationHistory `json:"rotations"`
+	Failures             []RotationHistory `json:"failures"`
+}
+
+// 加载服务器详情
+func loadServerDetail(t *Tenant, table string, id int) (*ServerDetail, error) {
+	var record struct {
+		ID                   int
+		Name                 string
+		Port                 string
+		ServerPort           int
+		Host                 string
+		Show                 bool
+		NextUpdateTime       int64
+		LastUpdateStatus     string
+		LastUpdateStatusCode string
+	}
+	if err := t.DB.Table(table).Select(serverSelect(table, "id", "name", "port", "server_port", "host", "show", "next_update_time", "last_update_status", "last_update_status_code")).Where("id = ?", id).First(&record).Error; err != nil {
+		return nil, err
+	}
+	detail := &ServerDetail{
+		Tenant:               t.Name,
+		TableName:            table,
+		ID:                   record.ID,
+		Name:                 record.Name,
+		Port:                 record.Port,
+		ServerPort:           record.ServerPort,
+		Host:                 record.Host,
+		Show:                 record.Show,
+		NextUpdateTime:       record.NextUpdateTime,
+		LastUpdateStatus:     record.LastUpdateStatus,
+		LastUpdateStatusCode: record.LastUpdateStatusCode,
+		Remediation:          failureRemediation(record.LastUpdateStatusCode),
+		NodeIP:               lookupNodeIP(t.DB, table, id),
+		Setting:              loadServerSetting(t.DB, table, id),
+	}
+	if _, next := checkSchedule(); !next.IsZero() {
+		detail.NextCheckTime = next.Unix()
+	}
+	preset, err := resolvePortPreset(t.DB, table, id)
+	if err != nil {
+		log.Printf("获取端口预设失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+	}
+	detail.PortPreset = preset
+	detail.Traffic = trafficSummary(t.DB, table, id, time.Now().Unix())
+	detail.Impact = estimateUserImpact(t, table, id, time.Now().Unix())
+	counts, err := t.Domains.Count(table, id, time.Now().Unix())
+	if err != nil {
+		log.Printf("统计域名失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+	}
+	detail.DomainTotal = counts.Total
+	detail.DomainAvailable = counts.Available
+	detail.DomainCooldown = counts.InCooldown
+	if detail.Domains, err = t.Domains.List(table, id); err != nil {
+		return nil, err
+	}
+	if err := t.DB.Where("server_table = ? AND server_id = ?", table, id).
+		Order("created_at DESC, id DESC").Limit(detailHistoryLimit).Find(&detail.Rotations).Error; err != nil {
+		return nil, err
+	}
+	for _, h := range detail.Rotations {
+		if h.Status == rotationFailed {
+			detail.Failures = append(detail.Failures, h)
+		}
+	}
+	return detail, nil
+}
+
+// ServerSchedule 服务器轮换计划，供前端及外部看板显示倒计时
+type ServerSchedule struct {
+	Table                string `json:"table"`
+	ID                   int    `json:"id"`
+	NextUpdateTime       int64  `json:"next_update_time"`       // 0 表示下次检查时立即轮换
+	RemainingSeconds     int64  `json:"remaining_seconds"`      // 距 next_update_time 的秒数，已到期为 0
+	ExpectedRotationTime int64  `json:"expected_rotation_time"` // 到期后第一次检查任务的执行时间（到期时不在允许轮换时段内则为时段开始后）
+	RotationWindow       string `json:"rotation_window"`        // 允许轮换时段，为空表示不限制
+	IntervalHours        int    `json:"interval_hours"`
+	IntervalSeconds      int64  `json:"interval_seconds"`
+	CheckCron            string `json:"check_cron"`
+	Paused               bool   `json:"paused"` // 维护模式中定时任务暂停
+	ServerTime           int64  `json:"server_time"`
+}
+
+// 加载服务器轮换计划
+func loadServerSchedule(t *Tenant, table string, id int, now time.Time) (*ServerSchedule, error) {
+	var record struct {
+		NextUpdateTime int64
+	}
+	if err := t.DB.Table(table).Select(serverSelect(table, "next_update_time")).Where("id = ?", id).First(&record).Error; err != nil {
+		return nil, err
+	}
+	interval := serverIntervalHours(t.DB, table, id)
+	schedule := &ServerSchedule{
+		Table:           table,
+		ID:              id,
+		NextUpdateTime:  record.NextUpdateTime,
+		RotationWindow:  loadServerSetting(t.DB, table, id).RotationWindow,
+		IntervalHours:   interval,
+		IntervalSeconds: int64(interval) * 3600,
+		Paused:          inMaintenance(),
+		ServerTime:      now.Unix(),
+	}
+	if remaining := record.NextUpdateTime - now.Unix(); remaining > 0 {
+		schedule.RemainingSeconds = remaining
+	}
+	schedule.CheckCron, _ = checkSchedule()
+	if sched, err := cron.ParseStandard(schedule.CheckCron); err == nil {
+		schedule.ExpectedRotationTime = expectedRotationTime(sched, schedule.RotationWindow, record.NextUpdateTime, now).Unix()
+	}
+	return schedule, nil
+}
+
+// 到期时间为 nextUpdate 的服务器实际轮换的时间：到期（已到期时为 now）后第一次检查任务的执行时间，
+// 到期时不在允许轮换时段内则为时段开始后的第一次检查
+func expectedRotationTime(sched cron.Schedule, window string, nextUpdate int64, now time.Time) time.Time {
+	due := now.In(appLocation())
+	if nextUpdate > now.Unix() {
+		due = time.Unix(nextUpdate, 0).In(appLocation())
+	}
+	if !inRotationWindow(window, due) {
+		due = nextRotationWindowStart(window, due)
+	}
+	// 检查任务在到期时刻恰好执行时也会轮换，因此从到期前一秒开始计算
+	return sched.Next(due.Add(-time.Second))
+}
+
+// 注册服务器详情路由
+func registerServerDetailRoutes(r *gin.Engine) {
+	// 服务器详情，Accept: application/json 或 ?format=json 时返回 JSON
+	r.GET("/servers/:table/:id", authMiddleware, httpCacheMiddleware, func(c *gin.Context) {
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		if !isValidServerTable(table) {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		detail, err := loadServerDetail(currentTenant(c), table, id)
+		if err != nil {
+			log.Printf("获取服务器详情失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			respondError(c, http.StatusNotFound, codeNotFound, "服务器不存在或无法获取详情")
+			return
+		}
+		if c.Query("format") == "json" || strings.Contains(c.GetHeader("Accept"), "application/json") {
+			c.JSON(http.StatusOK, detail)
+			return
+		}
+		c.HTML(http.StatusOK, "server_detail.html", gin.H{"Server": detail, "TimeZone": locationName(userLocation(c))})
+	})
+
+	// 服务器轮换计划（下次轮换时间、剩余秒数及更新间隔）
+	r.GET("/api/v1/servers/:table/:id/schedule", authMiddleware, func(c *gin.Context) {
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		if !isValidServerTable(table) {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		schedule, err := loadServerSchedule(currentTenant(c), table, id, time.Now())
+		if err != nil {
+			log.Printf("获取轮换计划失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			respondError(c, http.StatusNotFound, codeNotFound, "服务器不存在")
+			return
+		}
+		c.JSON(http.StatusOK, schedule)
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 服务器表及服务器元数据缓存：有效表名在加载托管端点后确定，运行期间不变；
+// 服务器名称、主机、端口按租户缓存在内存中，本实例写入服务器表时整体失效，
+// 面板或其他实例直接修改的行在 cache.metaSeconds（默认 10 秒）后过期重新读取。
+// 事务内的读取及轮换本身仍直接查询数据库
+
+var (
+	serverTablesOnce  sync.Once
+	validServerTables map[string]bool
+	tenantTables      sync.Map // 租户名称 -> 该租户的服务器表列表
+)
+
+// 校验表名是否为受管理的服务器表（面板表或托管端点表）
+func isValidServerTable(table string) bool {
+	serverTablesOnce.Do(func() {
+		endpointsOnce.Do(loadManagedEndpoints)
+		validServerTables = make(map[string]bool, len(panelServerTables)+len(managedEndpoints))
+		for _, t := range panelServerTables {
+			validServerTables[t] = true
+		}
+		for table := range managedEndpoints {
+			validServerTables[table] = true
+		}
+	})
+	return validServerTables[table]
+}
+
+// 租户轮换的全部服务器表：三张面板表及分配给该租户的托管端点表（按表名排序）
+func serverTables(t *Tenant) []string {
+	if v, ok := tenantTables.Load(t.Name); ok {
+		return slices.Clone(v.([]string))
+	}
+	tables := tenantServerTables(t)
+	tenantTables.Store(t.Name, tables)
+	return slices.Clone(tables)
+}
+
+// ServerMeta 服务器行中常用的元数据
+type ServerMeta struct {
+	Name       string `json:"name"`
+	Host       string `json:"host"`
+	Port       string `json:"port"`
+	ServerPort int    `json:"server_port"`
+	Show       bool   `json:"show"`
+}
+
+type serverMetaEntry struct {
+	meta     ServerMeta
+	loadedAt int64
+}
+
+// 租户的服务器元数据缓存，gen 在每次失效时递增，避免失效前开始的查询写回旧数据
+type serverMetaCache struct {
+	mu    sync.RWMutex
+	gen   uint64
+	items map[string]serverMetaEntry
+}
+
+// 租户名称 -> *serverMetaCache
+var serverMetaCaches sync.Map
+
+// 元数据缓存有效期（cache.metaSeconds），默认 10 秒，0 及负数使用默认值
+func serverMetaTTL() int64 {
+	if n := viper.GetInt64("cache.metaSeconds"); n > 0 {
+		return n
+	}
+	return 10
+}
+
+func metaCacheFor(t *Tenant) *serverMetaCache {
+	v, _ := serverMetaCaches.LoadOrStore(t.Name, &serverMetaCache{items: map[string]serverMetaEntry{}})
+	return v.(*serverMetaCache)
+}
+
+func (mc *serverMetaCache) invalidate() {
+	mc.mu.Lock()
+	mc.gen++
+	mc.items = map[string]serverMetaEntry{}
+	mc.mu.Unlock()
+}
+
+// 在租户数据库上注册回调：写入服务器表后清空该租户的元数据缓存
+func registerServerMetaInvalidation(t *Tenant) {
+	mc := metaCacheFor(t)
+	registerServerWriteCallback(t.DB, "server_meta:invalidate", mc.invalidate)
+}
+
+// 读取服务器元数据，优先使用缓存；服务器不存在时返回 gorm.ErrRecordNotFound（不缓存）
+func loadServerMeta(t *Tenant, table string, id int) (ServerMeta, error) {
+	key := table + ":" + strconv.Itoa(id)
+	mc := metaCacheFor(t)
+	now := time.Now().Unix()
+	mc.mu.RLock()
+	entry, ok := mc.items[key]
+	gen := mc.gen
+	mc.mu.RUnlock()
+	if ok && now-entry.loadedAt < serverMetaTTL() {
+		return entry.meta, nil
+	}
+	var meta ServerMeta
+	if err := t.DB.Table(table).Select(serverSelect(table, "name", "host", "port", "server_port", "show")).Where("id = ?", id).First(&meta).Error; err != nil {
+		return meta, err
+	}
+	mc.mu.Lock()
+	if mc.gen == gen {
+		mc.items[key] = serverMetaEntry{meta: meta, loadedAt: now}
+	}
+	mc.mu.Unlock()
+	return meta, nil
+}
+
+// 服务器是否存在
+func serverExists(t *Tenant, table string, id int) (bool, error) {
+	_, err := loadServerMeta(t, table, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"ser_manger/internal/handlers"
+)
+
+// 注册服务器列表、轮换设置及检查任务路由
+func registerServerRoutes(r *gin.Engine) {
+	// 服务器列表，Accept: application/json 或 ?format=json 时返回 JSON
+	r.GET("/servers", authMiddleware, httpCacheMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		access := requestServerAccess(c)
+		now := time.Now().Unix()
+		traffic := trafficSummaries(readDB(t), now)
+		impacts := estimateUserImpacts(t, now)
+		domainCounts, err := t.Domains.CountAll(now)
+		if err != nil {
+			log.Printf("批量统计域名失败: 租户=%s, 错误=%v", t.Name, err)
+		}
+		var servers []Server
+		for _, table := range serverTables(t) {
+			records, err := listServerRows(t, table)
+			if err != nil {
+				log.Printf("从表 %s 获取记录失败: 租户=%s, 错误=%v", table, t.Name, err)
+				continue
+			}
+			for _, s := range records {
+				// 受限的令牌或用户只列出允许管理的服务器
+				if !access.allows(t.DB, serverRef{Table: table, ID: s.ID}) {
+					continue
+				}
+				key := table + ":" + strconv.Itoa(s.ID)
+				counts, err := lookupDomainCounts(t.Domains, domainCounts, table, s.ID, now)
+				if err != nil {
+					log.Printf("统计域名失败: 表=%s, ID=%d, 错误=%v", table, s.ID, err)
+				}
+				impact, ok := impacts[key]
+				if !ok {
+					impact = UserImpact{OnlineUsers: -1}
+				}
+				servers = append(servers, Server{
+					TableName:            table,
+					ID:                   s.ID,
+					Name:                 s.Name,
+					Port:                 s.Port,
+					ServerPort:           s.ServerPort,
+					Host:                 s.Host,
+					Show:                 s.Show,
+					NextUpdateTime:       s.NextUpdateTime,
+					LastUpdateStatus:     s.LastUpdateStatus,
+					LastUpdateStatusCode: s.LastUpdateStatusCode,
+					Remediation:          failureRemediation(s.LastUpdateStatusCode),
+					DomainTotal:          int(counts.Total),
+					DomainAvailable:      int(counts.Available),
+					Traffic:              traffic[key],
+					Impact:               impact,
+				})
+			}
+		}
+		if c.Query("format") == "json" || strings.Contains(c.GetHeader("Accept"), "application/json") {
+			if servers == nil {
+				servers = []Server{}
+			}
+			c.JSON(http.StatusOK, gin.H{"servers": servers, "total": len(servers)})
+			return
+		}
+		settings := currentSettings()
+		user, _ := currentUser(c)
+		c.HTML(http.StatusOK, "servers.html", gin.H{
+			"Servers":        servers,
+			"Interval":       settings.UpdateIntervalHours,
+			"MinPort":        settings.MinPort,
+			"MaxPort":        settings.MaxPort,
+			"Tenant":         t.Name,
+			"Tenants":        tenantNames,
+			"Maintenance":    inMaintenance(),
+			"PasswordPolicy": passwordPolicyHint(),
+			"TimeZone":       locationName(userLocation(c)),
+			"IsAdmin":        user.Role == roleAdmin,
+		})
+	})
+
+	// 设置更新间隔；未指定范围时修改全局间隔，需确认令牌 set-interval
+	r.POST("/set-interval", authMiddleware, func(c *gin.Context) {
+		intervalStr := c.PostForm("interval")
+		interval, err := strconv.Atoi(intervalStr)
+		if err != nil || interval <= 0 {
+			log.Printf("无效的间隔: %s", intervalStr)
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的间隔")
+			return
+		}
+		now := time.Now().Unix()
+
+		// 指定 table、tag（分组）或 ids 时仅修改当前租户中对应服务器的间隔
+		table, tag, idsStr := c.PostForm("table"), normalizeTags(c.PostForm("tag")), c.PostForm("ids")
+		if table != "" || tag != "" || idsStr != "" {
+			if table != "" && !isValidServerTable(table) {
+				log.Printf("无效的表名: %s", table)
+				respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+				return
+			}
+			var ids []int
+			for _, f := range strings.Split(idsStr, ",") {
+				if f = strings.TrimSpace(f); f == "" {
+					continue
+				}
+				id, err := strconv.Atoi(f)
+				if err != nil || id <= 0 {
+					respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的ID："+f)
+					return
+				}
+				ids = append(ids, id)
+			}
+			t := currentTenant(c)
+			count, err := applyScopedInterval(t, interval, table, tag, ids, now)
+			if err != nil {
+				log.Printf("按范围设置更新间隔失败: 租户=%s, 表=%s, 标签=%s, ID=%s, 错误=%v", t.Name, table, tag, idsStr, err)
+				respondError(c, http.StatusInternalServerError, codeInternal, "更新间隔失败："+err.Error())
+				return
+			}
+			log.Printf("按范围设置更新间隔: 租户=%s, 表=%s, 标签=%s, ID=%s, 间隔=%d 小时, 服务器数=%d", t.Name, table, tag, idsStr, interval, count)
+			c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("已将 %d 台服务器的更新间隔设置为 %d 小时并刷新下次更新时间", count, interval), "count": count})
+			return
+		}
+
+		if !consumeConfirmToken(c, confirmSetInterval) {
+			return
+		}
+		viper.Set("server.updateIntervalHours", interval)
+		updateSettings(func(s *Settings) { s.UpdateIntervalHours = interval })
+		newNextUpdateTime := now + int64(interval*3600)
+		for _, t := range tenantList() {
+			// 设置了独立间隔的服务器不受全局间隔影响
+			own, err := serversWithOwnInterval(t.DB)
+			if err != nil {
+				log.Printf("获取独立间隔的服务器失败: 租户=%s, 错误=%v", t.Name, err)
+				respondError(c, http.StatusInternalServerError, codeInternal, "更新间隔失败："+err.Error())
+				return
+			}
+			for _, table := range serverTables(t) {
+				q := t.DB.Table(table).Where("1 = 1")
+				if len(own[table]) > 0 {
+					q = q.Where("id NOT IN ?", own[table])
+				}
+				if err := q.Update(serverColumn(table, "next_update_time"), newNextUpdateTime).Error; err != nil {
+					log.Printf("更新表 %s 的 next_update_time 失败: 租户=%s, 错误=%v", table, t.Name, err)
+					respondError(c, http.StatusInternalServerError, codeInternal, "更新间隔失败："+err.Error())
+					return
+				}
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "更新间隔已设置为 " + intervalStr + " 小时，所有服务器下次更新时间已刷新"})
+	})
+
+	// 立即更新服务器
+	r.POST("/update-now", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		isValidTable := isValidServerTable(table)
+		if !isValidTable {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		if approvalRequired(t.DB, table, id) {
+			approval, created, err := requestRotationApproval(t, table, id, operatorName(c), requestPrincipal(c), c.ClientIP(), c.PostForm("reason"))
+			if err != nil {
+				log.Printf("提交轮换审批失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+				respondError(c, http.StatusInternalServerError, codeInternal, "提交轮换审批失败："+err.Error())
+				return
+			}
+			message := "该服务器的手动轮换需要审批，已提交申请，请由另一位操作员确认"
+			if !created {
+				message = "该服务器已有待确认的轮换申请"
+			}
+			c.JSON(http.StatusAccepted, gin.H{"message": message, "approval": approval})
+			return
+		}
+		if err := rotateServerNow(t, table, id, requestCause(c)); err != nil {
+			failure := classifyFailure(err)
+			respondError(c, http.StatusInternalServerError, rotationErrorCode(err), "更新失败："+err.Error(), gin.H{"failure_code": failure, "remediation": failureRemediation(failure)})
+			return
+		}
+		var server struct {
+			Port             string
+			Host             string
+			NextUpdateTime   int64
+			LastUpdateStatus string
+		}
+		if err := t.DB.Table(table).Select(serverSelect(table, "port", "host", "next_update_time", "last_update_status")).Where("id = ?", id).First(&server).Error; err != nil {
+			log.Printf("获取更新后的服务器失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "无法获取更新后的服务器数据")
+			return
+		}
+		counts, err := t.Domains.Count(table, id, time.Now().Unix())
+		if err != nil {
+			log.Printf("统计域名失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+		}
+		log.Printf("更新服务器成功: 表=%s, ID=%d, 端口=%s, 主机=%s, 域名总数=%d, 可用域名=%d", table, id, server.Port, server.Host, counts.Total, counts.Available)
+		c.JSON(http.StatusOK, gin.H{
+			"message":            "服务器已立即更新",
+			"port":               server.Port,
+			"host":               server.Host,
+			"next_update_time":   server.NextUpdateTime,
+			"last_update_status": server.LastUpdateStatus,
+			"domain_total":       counts.Total,
+			"domain_available":   counts.Available,
+		})
+	})
+
+	// 设置端口范围
+	r.POST("/set-port-range", authMiddleware, func(c *gin.Context) {
+		minStr := c.PostForm("min_port")
+		maxStr := c.PostForm("max_port")
+		min, err := strconv.Atoi(minStr)
+		if err != nil || min <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的最小端口")
+			return
+		}
+		max, err := strconv.Atoi(maxStr)
+		if err != nil || max <= 0 || max <= min || max > 65535 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的最大端口")
+			return
+		}
+		// 全局范围适用于所有表，需满足每张表的协议限制
+		if conflicts := validatePorts(min, max, nil, panelServerTables); len(conflicts) > 0 {
+			respondError(c, http.StatusBadRequest, codeValidationFailed, "端口范围校验失败", conflicts)
+			return
+		}
+		updateSettings(func(s *Settings) {
+			s.MinPort = min
+			s.MaxPort = max
+		})
+		viper.Set("port.min", min)
+		viper.Set("port.max", max)
+		if err := writeConfig(); err != nil {
+			log.Printf("写入配置文件失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存端口范围失败")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "端口范围已更新"})
+	})
+
+	// 查看、修改检查频率
+	checkCron := handlers.NewCheckCronHandler(checkCronSchedule{})
+	r.GET("/check-cron", authMiddleware, checkCron.Get)
+	r.POST("/check-cron", authMiddleware, checkCron.Set)
+
+	// 立即校对域名占用状态，需确认令牌 reconcile-domains
+	r.POST("/reconcile-domains", authMiddleware, func(c *gin.Context) {
+		if !consumeConfirmToken(c, confirmReconcileDomains) {
+			return
+		}
+		fixed := reconcileDomainUsage(currentTenant(c))
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("域名占用状态校对完成，修正 %d 条记录", fixed), "fixed": fixed})
+	})
+
+	// 添加结构体
+	type ChinaAccessRequest struct {
+		Host string `json:"host" binding:"required"`
+		Port string `json:"port" binding:"required"`
+	}
+
+	// 添加路由
+	r.POST("/check-china-access", func(c *gin.Context) {
+		var req ChinaAccessRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效参数")
+			return
+		}
+
+		// 开发模式下不访问外部检测服务
+		if devMode {
+			c.JSON(http.StatusOK, gin.H{"accessible": true})
+			return
+		}
+
+		hostPort := req.Host + ":" + req.Port
+		accessible, err := isAccessibleFromChina(hostPort)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternal, fmt.Sprintf("检查失败: %v", err))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"accessible": accessible})
+	})
+}
+
+// 执行单次检查
+func isAccessibleFromChina(host string) (bool, error) {
+	// 创建 Chrome 实例
+	ctx, cancel := chromedp.NewContext(context.Background())
+	defer cancel()
+
+	// 设置超时
+	ctx, cancel = context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	// 存储表格 HTML
+	var tableHTML string
+
+	// 执行浏览器操作
+	err := chromedp.Run(ctx,
+		// 访问页面
+		chromedp.Navigate("https://tcp.ping.pe/"),
+		// 等待页面主体加载
+		chromedp.WaitVisible(`body`, chromedp.ByQuery),
+		// 等待输入框出现
+		chromedp.WaitVisible(`input[name="query"]`, chromedp.ByQuery, chromedp.NodeVisible),
+		// 输入域名和端口
+		chromedp.SetValue(`input[name="query"]`, host, chromedp.ByQuery),
+		// 调试：确认输入框值
+		chromedp.Evaluate(`document.querySelector('input[name="query"]').value`, &host),
+		// 点击提交按钮
+		chromedp.Click(`input#goButton`, chromedp.NodeVisible, chromedp.ByQuery),
+		// 等待结果表格加载
+		chromedp.WaitVisible(`table#megatable`, chromedp.ByQuery, chromedp.NodeVisible),
+		// 等待 AJAX 更新（最多10秒）
+		chromedp.Sleep(10*time.Second),
+		// 提取表格 HTML
+		chromedp.OuterHTML(`table#megatable`, &tableHTML, chromedp.ByQuery),
+	)
+	if err != nil {
+		return false, fmt.Errorf("浏览器操作失败: %v", err)
+	}
+
+	// 解析表格
+	lines := strings.Split(tableHTML, "\n")
+	for i, line := range lines {
+		if strings.Contains(strings.ToLower(line), "china") {
+			// 查找状态列（在同一行或下一行的 <span>）
+			for j := i; j < len(lines); j++ {
+				nextLine := strings.ToLower(lines[j])
+				if strings.Contains(nextLine, "tcp-") && strings.Contains(nextLine, "-result") {
+					log.Printf("中国行内容: %s, 状态行: %s", line, nextLine)
+					if strings.Contains(nextLine, "successful") {
+						return true, nil
+					}
+					break
+				}
+			}
+		}
+	}
+
+	return false, fmt.Errorf("未找到中国的结果或状态不可访问")
+}
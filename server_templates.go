@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ServerTemplate 结构体，新建节点的模板：协议表、端口预设、轮换策略、域名池及面板表其余列的默认值
+type ServerTemplate struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"column:name;type:varchar(255);uniqueIndex;not null" json:"name"`
+	ServerTable string `gorm:"column:server_table;type:varchar(255);not null" json:"server_table"`
+	PresetID    uint   `gorm:"column:preset_id;default:0" json:"preset_id"` // 0 表示不绑定端口预设
+	Rules       string `gorm:"column:rules;type:text" json:"rules"`         // 轮换策略规则 JSON，为空表示不创建策略
+	Domains     string `gorm:"column:domains;type:text" json:"domains"`     // 域名池，每行一个
+	Fields      string `gorm:"column:fields;type:text" json:"fields"`       // 面板表其余列的默认值（JSON 对象，如 group_id、network）
+	Tags        string `gorm:"column:tags;type:varchar(255);default:''" json:"tags"`
+	UpdatedAt   int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// 面板表列名格式
+var columnNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// 由管理器维护、不能通过模板设置的列
+var managedServerColumns = map[string]bool{
+	"id": true, "host": true, "port": true, "server_port": true,
+	"next_update_time": true, "last_update_status": true, "created_at": true, "updated_at": true,
+}
+
+// 解析并校验列默认值
+func parseTemplateFields(data string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if strings.TrimSpace(data) == "" {
+		return fields, nil
+	}
+	if err := json.Unmarshal([]byte(data), &fields); err != nil {
+		return nil, fmt.Errorf("fields 不是有效的 JSON 对象: %v", err)
+	}
+	for name := range fields {
+		if !columnNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("无效的列名 %q", name)
+		}
+		if managedServerColumns[name] {
+			return nil, fmt.Errorf("列 %s 由管理器维护，不能在模板中设置", name)
+		}
+	}
+	return fields, nil
+}
+
+// 解析域名池（每行一个，忽略空行及 # 注释），返回规范化后去重的域名
+func parseTemplateDomains(data string) ([]string, error) {
+	seen := map[string]bool{}
+	var domains []string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domain, err := normalizeDomain(line)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains, nil
+}
+
+// 获取刚插入行的自增 ID
+func lastInsertID(tx *gorm.DB) (int, error) {
+	query := "SELECT LAST_INSERT_ID()"
+	if tx.Dialector.Name() == "sqlite" {
+		query = "SELECT last_insert_rowid()"
+	}
+	var id int
+	err := tx.Raw(query).Scan(&id).Error
+	return id, err
+}
+
+// NewServerRequest 按模板新建服务器的请求
+type NewServerRequest struct {
+	Template string                 `json:"template" binding:"required"`
+	Name     string                 `json:"name" binding:"required"`
+	Fields   map[string]interface{} `json:"fields"`  // 覆盖模板中的列默认值
+	Domains  []string               `json:"domains"` // 追加到模板域名池
+	Rotate   *bool                  `json:"rotate"`  // 创建后是否立即轮换分配端口和域名，默认 true
+}
+
+// 按模板在面板表中新建服务器，并写入端口预设绑定、轮换策略、服务器标签及域名池，返回新服务器 ID
+func createServerFromTemplate(t *Tenant, tpl ServerTemplate, req NewServerRequest) (int, error) {
+	fields, err := parseTemplateFields(tpl.Fields)
+	if err != nil {
+		return 0, err
+	}
+	for name, value := range req.Fields {
+		if !columnNamePattern.MatchString(name) || managedServerColumns[name] {
+			return 0, fmt.Errorf("无效或不可设置的列 %q", name)
+		}
+		fields[name] = value
+	}
+	domains, err := parseTemplateDomains(tpl.Domains + "\n" + strings.Join(req.Domains, "\n"))
+	if err != nil {
+		return 0, err
+	}
+	if len(domains) == 0 {
+		return 0, errors.New("模板及请求中均没有域名")
+	}
+	rules, err := parsePolicyRules(tpl.Rules)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().Unix()
+	row := serverFields(tpl.ServerTable, map[string]interface{}{"name": req.Name, "host": "", "port": "", "server_port": 0})
+	for name, value := range fields {
+		row[name] = value
+	}
+	for _, column := range []string{"created_at", "updated_at"} {
+		column = serverColumn(tpl.ServerTable, column)
+		if _, ok := row[column]; !ok && t.DB.Migrator().HasColumn(tpl.ServerTable, column) {
+			row[column] = now
+		}
+	}
+	var id int
+	err = t.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tpl.ServerTable).Create(row).Error; err != nil {
+			return fmt.Errorf("创建服务器失败: %v", err)
+		}
+		var err error
+		if id, err = lastInsertID(tx); err != nil || id <= 0 {
+			return fmt.Errorf("获取新服务器ID失败: %v", err)
+		}
+		if tpl.PresetID > 0 {
+			if err := tx.Create(&PortPresetBinding{ServerTable: tpl.ServerTable, ServerID: id, PresetID: tpl.PresetID}).Error; err != nil {
+				return fmt.Errorf("绑定端口预设失败: %v", err)
+			}
+		}
+		if len(rules) > 0 {
+			data, _ := json.Marshal(rules)
+			if err := tx.Create(&RotationPolicy{ServerTable: tpl.ServerTable, ServerID: id, Rules: string(data)}).Error; err != nil {
+				return fmt.Errorf("保存轮换策略失败: %v", err)
+			}
+		}
+		if tpl.Tags != "" {
+			if err := tx.Create(&ServerSetting{ServerTable: tpl.ServerTable, ServerID: id, AvoidRecentDomains: -1, Tags: tpl.Tags}).Error; err != nil {
+				return fmt.Errorf("保存服务器标签失败: %v", err)
+			}
+		}
+		for i, domain := range domains {
+			conflicts, err := findDomainConflicts(tx, tpl.ServerTable, id, domain)
+			if err != nil {
+				return err
+			}
+			if len(conflicts) > 0 {
+				if domainConflictBlocks() {
+					return fmt.Errorf("%w: %s", errDomainConflict, domain)
+				}
+				log.Printf("警告: 域名已在其他 %d 台服务器的域名池中: 表=%s, ID=%d, 域名=%s", len(conflicts), tpl.ServerTable, id, domain)
+			}
+			if err := tx.Create(&ServerDomain{ServerTable: tpl.ServerTable, ServerID: id, Domain: domain, Order: i + 1}).Error; err != nil {
+				return fmt.Errorf("添加域名 %s 失败: %v", domain, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("按模板创建服务器成功: 租户=%s, 模板=%s, 表=%s, ID=%d, 名称=%s, 域名 %d 个", t.Name, tpl.Name, tpl.ServerTable, id, req.Name, len(domains))
+	return id, nil
+}
+
+// 注册服务器模板路由
+func registerServerTemplateRoutes(r *gin.Engine) {
+	// 列出服务器模板
+	r.GET("/server-templates", authMiddleware, func(c *gin.Context) {
+		var templates []ServerTemplate
+		if err := currentTenant(c).DB.Order("name ASC").Find(&templates).Error; err != nil {
+			log.Printf("获取服务器模板失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取服务器模板失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"templates": templates})
+	})
+
+	// 创建或替换服务器模板（按名称）：name、table、preset_id、rules、domains、fields、tags
+	r.POST("/server-templates", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		tpl := ServerTemplate{
+			Name:        strings.TrimSpace(c.PostForm("name")),
+			ServerTable: c.PostForm("table"),
+			Rules:       c.PostForm("rules"),
+			Domains:     c.PostForm("domains"),
+			Fields:      c.PostForm("fields"),
+			Tags:        normalizeTags(c.PostForm("tags")),
+		}
+		if tpl.Name == "" {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "模板名称不能为空")
+			return
+		}
+		if !isValidServerTable(tpl.ServerTable) {
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		if v := c.PostForm("preset_id"); v != "" {
+			presetID, err := strconv.Atoi(v)
+			if err != nil || presetID < 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidID, "无效的端口预设ID")
+				return
+			}
+			if presetID > 0 {
+				var preset PortPreset
+				if err := tdb.First(&preset, presetID).Error; err != nil {
+					respondError(c, http.StatusBadRequest, codeInvalidArgument, "端口预设不存在")
+					return
+				}
+			}
+			tpl.PresetID = uint(presetID)
+		}
+		if _, err := parsePolicyRules(tpl.Rules); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+			return
+		}
+		if _, err := parseTemplateDomains(tpl.Domains); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+			return
+		}
+		if _, err := parseTemplateFields(tpl.Fields); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+			return
+		}
+		if len(tpl.Tags) > 255 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "标签过长（最多 255 字节）")
+			return
+		}
+		var existing ServerTemplate
+		if err := tdb.Where("name = ?", tpl.Name).First(&existing).Error; err == nil {
+			tpl.ID = existing.ID
+		}
+		if err := tdb.Save(&tpl).Error; err != nil {
+			log.Printf("保存服务器模板失败: 名称=%s, 错误=%v", tpl.Name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存服务器模板失败："+err.Error())
+			return
+		}
+		log.Printf("保存服务器模板成功: 名称=%s, 表=%s", tpl.Name, tpl.ServerTable)
+		c.JSON(http.StatusOK, gin.H{"message": "服务器模板已保存", "template": tpl})
+	})
+
+	// 删除服务器模板
+	r.POST("/server-templates/delete", authMiddleware, func(c *gin.Context) {
+		name := c.PostForm("name")
+		result := currentTenant(c).DB.Where("name = ?", name).Delete(&ServerTemplate{})
+		if result.Error != nil {
+			log.Printf("删除服务器模板失败: 名称=%s, 错误=%v", name, result.Error)
+			respondError(c, http.StatusInternalServerError, codeInternal, "删除服务器模板失败："+result.Error.Error())
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "模板不存在")
+			return
+		}
+		log.Printf("删除服务器模板成功: 名称=%s", name)
+		c.JSON(http.StatusOK, gin.H{"message": "服务器模板已删除"})
+	})
+
+	// 按模板新建服务器，默认创建后立即轮换以分配端口和域名
+	r.POST("/api/v1/servers", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		var req NewServerRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效参数：template 及 name 为必填项")
+			return
+		}
+		var tpl ServerTemplate
+		if err := t.DB.Where("name = ?", req.Template).First(&tpl).Error; err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "模板不存在")
+			return
+		}
+		id, err := createServerFromTemplate(t, tpl, req)
+		if err != nil {
+			log.Printf("按模板创建服务器失败: 模板=%s, 错误=%v", tpl.Name, err)
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+			return
+		}
+		resp := gin.H{"message": "服务器已创建", "table": tpl.ServerTable, "id": id}
+		if req.Rotate == nil || *req.Rotate {
+			if err := rotateServerNow(t, tpl.ServerTable, id, requestCause(c)); err != nil {
+				resp["message"] = "服务器已创建，但首次轮换失败：" + err.Error()
+			}
+		}
+		if detail, err := loadServerDetail(t, tpl.ServerTable, id); err == nil {
+			resp["server"] = detail
+		}
+		c.JSON(http.StatusCreated, resp)
+	})
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 记住登录 Cookie 名称
+const rememberCookieName = "remember_token"
+
+// 会话滑动续期的最小间隔（秒），避免每个请求都重写 Cookie
+const sessionRefreshSeconds = 300
+
+// 密码最小长度：auth.minPasswordLength，默认 8
+func minPasswordLength() int {
+	if n := viper.GetInt("auth.minPasswordLength"); n > 0 {
+		return n
+	}
+	return 8
+}
+
+// 密码策略说明，用于页面提示
+func passwordPolicyHint() string {
+	hint := fmt.Sprintf("至少 %d 个字符", minPasswordLength())
+	if viper.GetBool("auth.passwordRequireMixed") {
+		hint += "，须同时包含字母和数字"
+	}
+	return hint + "，不能与用户名相同"
+}
+
+// 按密码策略校验密码，不满足时返回原因
+func checkPasswordPolicy(username, password string) error {
+	if len([]rune(password)) < minPasswordLength() {
+		return fmt.Errorf("密码至少 %d 个字符", minPasswordLength())
+	}
+	if strings.EqualFold(password, username) {
+		return errors.New("密码不能与用户名相同")
+	}
+	if viper.GetBool("auth.passwordRequireMixed") {
+		hasLetter, hasDigit := false, false
+		for _, r := range password {
+			hasLetter = hasLetter || unicode.IsLetter(r)
+			hasDigit = hasDigit || unicode.IsDigit(r)
+		}
+		if !hasLetter || !hasDigit {
+			return errors.New("密码须同时包含字母和数字")
+		}
+	}
+	return nil
+}
+
+// 是否为 bcrypt 哈希（auth.password 可直接配置哈希）
+func isPasswordHash(v string) bool {
+	_, err := bcrypt.Cost([]byte(v))
+	return err == nil
+}
+
+// 生成保存到用户表的 bcrypt 哈希
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// RememberToken 结构体，"记住我"长期登录令牌（仅保存哈希）
+type RememberToken struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	Username     string `gorm:"column:username;type:varchar(255);not null" json:"username"`
+	TokenHash    string `gorm:"column:token_hash;type:char(64);uniqueIndex;not null" json:"-"`
+	ExpiresAt    int64  `gorm:"column:expires_at;index;not null" json:"expires_at"`
+	LastUsedTime int64  `gorm:"column:last_used_time;default:0" json:"last_used_time"`
+	CreatedAt    int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// UserSession 结构体，服务端登录会话记录，Cookie 中仅保存会话 ID，吊销记录即可使会话失效
+type UserSession struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	Username     string `gorm:"column:username;type:varchar(255);index;not null" json:"username"`
+	SessionHash  string `gorm:"column:session_hash;type:char(64);uniqueIndex;not null" json:"-"`
+	ClientIP     string `gorm:"column:client_ip;type:varchar(64);default:''" json:"client_ip"`
+	UserAgent    string `gorm:"column:user_agent;type:varchar(255);default:''" json:"user_agent"`
+	ExpiresAt    int64  `gorm:"column:expires_at;index;not null" json:"expires_at"`
+	LastSeenTime int64  `gorm:"column:last_seen_time;default:0" json:"last_seen_time"`
+	RevokedAt    int64  `gorm:"column:revoked_at;default:0" json:"revoked_at"`
+	CreatedAt    int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// 会话有效期（秒），auth.sessionHours 默认 24 小时
+func sessionLifetime() int {
+	hours := viper.GetInt("auth.sessionHours")
+	if hours <= 0 {
+		hours = 24
+	}
+	return hours * 3600
+}
+
+// 记住登录有效期（秒），auth.rememberDays 默认 30 天，0 以下表示使用默认值
+func rememberLifetime() int {
+	days := viper.GetInt("auth.rememberDays")
+	if days <= 0 {
+		days = 30
+	}
+	return days * 86400
+}
+
+// 会话 Cookie 选项
+func sessionOptions() sessions.Options {
+	return sessions.Options{
+		Path:     "/",
+		MaxAge:   sessionLifetime(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// 建立登录会话：创建服务端会话记录，Cookie 中保存会话 ID 及过期时间
+func startSession(c *gin.Context, username string) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	sid := hex.EncodeToString(buf)
+	now := time.Now().Unix()
+	expiresAt := now + int64(sessionLifetime())
+	if err := db.Create(&UserSession{
+		Username:     username,
+		SessionHash:  hashToken(sid),
+		ClientIP:     c.ClientIP(),
+		UserAgent:    truncate(c.Request.UserAgent(), 255),
+		ExpiresAt:    expiresAt,
+		LastSeenTime: now,
+	}).Error; err != nil {
+		return err
+	}
+	session := sessions.Default(c)
+	session.Set("user", username)
+	session.Set("sid", sid)
+	session.Set("expires_at", expiresAt)
+	return session.Save()
+}
+
+// 校验会话并滑动续期，返回登录用户名；会话不存在、已过期或已被吊销时返回空字符串
+func sessionUser(c *gin.Context) string {
+	session := sessions.Default(c)
+	user, _ := session.Get("user").(string)
+	if user == "" {
+		return ""
+	}
+	now := time.Now().Unix()
+	expiresAt, _ := session.Get("expires_at").(int64)
+	sid, _ := session.Get("sid").(string)
+	var record UserSession
+	if expiresAt <= now || sid == "" ||
+		db.Where("session_hash = ? AND username = ? AND revoked_at = 0 AND expires_at > ?", hashToken(sid), user, now).First(&record).Error != nil {
+		session.Clear()
+		session.Save()
+		return ""
+	}
+	lifetime := int64(sessionLifetime())
+	if expiresAt-now < lifetime-sessionRefreshSeconds {
+		session.Set("expires_at", now+lifetime)
+		if err := session.Save(); err != nil {
+			log.Printf("会话续期失败: 用户=%s, 错误=%v", user, err)
+		}
+		if err := db.Model(&UserSession{}).Where("id = ?", record.ID).Updates(map[string]interface{}{
+			"expires_at":     now + lifetime,
+			"last_seen_time": now,
+		}).Error; err != nil {
+			log.Printf("更新会话记录失败: ID=%d, 错误=%v", record.ID, err)
+		}
+	}
+	return user
+}
+
+// 当前请求的会话 ID 哈希，无会话时返回空字符串
+func currentSessionHash(c *gin.Context) string {
+	if sid, _ := sessions.Default(c).Get("sid").(string); sid != "" {
+		return hashToken(sid)
+	}
+	return ""
+}
+
+// 吊销用户的所有会话，exceptHash 非空时保留该会话；返回吊销数量
+func revokeUserSessions(username, exceptHash string) (int64, error) {
+	q := db.Model(&UserSession{}).Where("username = ? AND revoked_at = 0", username)
+	if exceptHash != "" {
+		q = q.Where("session_hash != ?", exceptHash)
+	}
+	result := q.Update("revoked_at", time.Now().Unix())
+	return result.RowsAffected, result.Error
+}
+
+// 注销当前会话：吊销服务端记录并清空 Cookie
+func endSession(c *gin.Context) {
+	if hash := currentSessionHash(c); hash != "" {
+		if err := db.Model(&UserSession{}).Where("session_hash = ?", hash).Update("revoked_at", time.Now().Unix()).Error; err != nil {
+			log.Printf("吊销会话失败: %v", err)
+		}
+	}
+	session := sessions.Default(c)
+	session.Clear()
+	session.Save()
+}
+
+// 签发记住登录令牌并写入 Cookie
+func issueRememberToken(c *gin.Context, username string) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(buf)
+	lifetime := rememberLifetime()
+	if err := db.Create(&RememberToken{
+		Username:  username,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Unix() + int64(lifetime),
+	}).Error; err != nil {
+		return err
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(rememberCookieName, token, lifetime, "/", "", false, true)
+	return nil
+}
+
+// 使用记住登录令牌恢复会话，成功返回用户名
+func resumeFromRememberToken(c *gin.Context) string {
+	token, err := c.Cookie(rememberCookieName)
+	if err != nil || token == "" {
+		return ""
+	}
+	now := time.Now().Unix()
+	var rt RememberToken
+	if err := db.Where("token_hash = ? AND expires_at > ?", hashToken(token), now).First(&rt).Error; err != nil {
+		c.SetCookie(rememberCookieName, "", -1, "/", "", false, true)
+		return ""
+	}
+	// 用户已停用或删除时令牌作废
+	if _, err := loadUser(rt.Username); err != nil {
+		db.Delete(&rt)
+		c.SetCookie(rememberCookieName, "", -1, "/", "", false, true)
+		return ""
+	}
+	if err := startSession(c, rt.Username); err != nil {
+		log.Printf("通过记住登录恢复会话失败: 用户=%s, 错误=%v", rt.Username, err)
+		return ""
+	}
+	if err := db.Model(&RememberToken{}).Where("id = ?", rt.ID).Update("last_used_time", now).Error; err != nil {
+		log.Printf("更新记住登录令牌使用时间失败: ID=%d, 错误=%v", rt.ID, err)
+	}
+	log.Printf("通过记住登录恢复会话: 用户=%s, 来源=%s", rt.Username, c.ClientIP())
+	return rt.Username
+}
+
+// 注销时吊销当前的记住登录令牌
+func revokeRememberToken(c *gin.Context) {
+	if token, err := c.Cookie(rememberCookieName); err == nil && token != "" {
+		if err := db.Where("token_hash = ?", hashToken(token)).Delete(&RememberToken{}).Error; err != nil {
+			log.Printf("吊销记住登录令牌失败: %v", err)
+		}
+	}
+	c.SetCookie(rememberCookieName, "", -1, "/", "", false, true)
+}
+
+// 清理过期或已吊销的会话记录
+func purgeUserSessions() {
+	now := time.Now().Unix()
+	result := db.Where("expires_at <= ? OR (revoked_at > 0 AND revoked_at <= ?)", now, now-86400).Delete(&UserSession{})
+	if result.Error != nil {
+		log.Printf("清理过期会话失败: %v", result.Error)
+		return
+	}
+	log.Printf("清理过期会话 %d 个", result.RowsAffected)
+}
+
+// 清理过期的记住登录令牌
+func purgeRememberTokens() {
+	result := db.Where("expires_at <= ?", time.Now().Unix()).Delete(&RememberToken{})
+	if result.Error != nil {
+		log.Printf("清理过期记住登录令牌失败: %v", result.Error)
+		return
+	}
+	log.Printf("清理过期记住登录令牌 %d 个", result.RowsAffected)
+}
+
+// 注册会话管理及修改密码路由
+func registerSessionRoutes(r *gin.Engine) {
+	// 列出当前用户的有效会话
+	r.GET("/sessions", authMiddleware, func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			respondError(c, http.StatusForbidden, codeForbidden, "会话管理仅限登录用户")
+			return
+		}
+		var list []UserSession
+		if err := db.Where("username = ? AND revoked_at = 0 AND expires_at > ?", user.Username, time.Now().Unix()).
+			Order("last_seen_time DESC").Find(&list).Error; err != nil {
+			log.Printf("获取会话列表失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取会话列表失败："+err.Error())
+			return
+		}
+		current := currentSessionHash(c)
+		result := make([]gin.H, 0, len(list))
+		for _, s := range list {
+			result = append(result, gin.H{"session": s, "current": s.SessionHash == current})
+		}
+		c.JSON(http.StatusOK, gin.H{"sessions": result})
+	})
+
+	// 吊销当前用户的指定会话
+	r.POST("/sessions/revoke", authMiddleware, func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			respondError(c, http.StatusForbidden, codeForbidden, "会话管理仅限登录用户")
+			return
+		}
+		id, err := strconv.Atoi(c.PostForm("id"))
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的会话ID")
+			return
+		}
+		result := db.Model(&UserSession{}).Where("id = ? AND username = ? AND revoked_at = 0", id, user.Username).Update("revoked_at", time.Now().Unix())
+		if result.Error != nil {
+			log.Printf("吊销会话失败: ID=%d, 错误=%v", id, result.Error)
+			respondError(c, http.StatusInternalServerError, codeInternal, "吊销会话失败："+result.Error.Error())
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "会话不存在或已被吊销")
+			return
+		}
+		log.Printf("吊销会话成功: ID=%d", id)
+		c.JSON(http.StatusOK, gin.H{"message": "会话已吊销"})
+	})
+
+	// 在所有设备上登出：吊销用户的全部会话及记住登录令牌，需确认令牌 logout-all
+	r.POST("/logout-all", authMiddleware, func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			respondError(c, http.StatusForbidden, codeForbidden, "会话管理仅限登录用户")
+			return
+		}
+		if !consumeConfirmToken(c, confirmLogoutAll) {
+			return
+		}
+		username := user.Username
+		revoked, err := revokeUserSessions(username, "")
+		if err != nil {
+			log.Printf("吊销全部会话失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "登出失败："+err.Error())
+			return
+		}
+		if err := db.Where("username = ?", username).Delete(&RememberToken{}).Error; err != nil {
+			log.Printf("删除记住登录令牌失败: %v", err)
+		}
+		c.SetCookie(rememberCookieName, "", -1, "/", "", false, true)
+		endSession(c)
+		log.Printf("已在所有设备上登出: 用户=%s, 吊销会话 %d 个", username, revoked)
+		c.JSON(http.StatusOK, gin.H{"message": "已在所有设备上登出", "revoked_sessions": revoked})
+	})
+
+	// 修改当前用户的登录密码，新密码以 bcrypt 哈希保存到用户表：保留当前会话，吊销其他会话、全部记住登录令牌及标记为"凭据变更时失效"的 API 令牌
+	r.POST("/change-password", authMiddleware, func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			respondError(c, http.StatusForbidden, codeForbidden, "修改密码仅限登录用户")
+			return
+		}
+		oldPassword := c.PostForm("old_password")
+		newPassword := c.PostForm("new_password")
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword)) != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "原密码错误")
+			return
+		}
+		if newPassword == oldPassword {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "新密码不能与原密码相同")
+			return
+		}
+		if confirm, ok := c.GetPostForm("confirm_password"); ok && confirm != newPassword {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "两次输入的新密码不一致")
+			return
+		}
+		if err := setUserPassword(&user, newPassword); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "新密码不符合要求："+err.Error())
+			return
+		}
+		username := user.Username
+		revokedSessions := revokeUserLogins(username, currentSessionHash(c))
+		c.SetCookie(rememberCookieName, "", -1, "/", "", false, true)
+		result := db.Model(&ApiToken{}).Where("invalidate_on_credential_change = ? AND revoked_at = 0", true).Update("revoked_at", time.Now().Unix())
+		if result.Error != nil {
+			log.Printf("吊销 API 令牌失败: %v", result.Error)
+		}
+		log.Printf("登录密码已修改: 用户=%s, 吊销会话 %d 个, 吊销 API 令牌 %d 个, 来源=%s", username, revokedSessions, result.RowsAffected, c.ClientIP())
+		c.JSON(http.StatusOK, gin.H{
+			"message":          "密码已修改，其他设备上的登录已失效",
+			"revoked_sessions": revokedSessions,
+			"revoked_tokens":   result.RowsAffected,
+		})
+	})
+}
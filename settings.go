@@ -0,0 +1,217 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ServerSetting 结构体，存储单个服务器的轮换策略设置
+type ServerSetting struct {
+	ID                 uint   `gorm:"primaryKey" json:"id"`
+	ServerTable        string `gorm:"column:server_table;type:varchar(255);uniqueIndex:unique_server_setting;not null" json:"server_table"`
+	ServerID           int    `gorm:"column:server_id;uniqueIndex:unique_server_setting;not null" json:"server_id"`
+	AvoidRecentDomains int    `gorm:"column:avoid_recent_domains" json:"avoid_recent_domains"`                   // -1 表示使用全局配置；不设 default 标签，否则新建行时 0 被当作零值写成 -1
+	DeferredSince      int64  `gorm:"column:deferred_since;default:0" json:"deferred_since"`                     // 因节点繁忙首次推迟轮换的时间
+	Tags               string `gorm:"column:tags;type:varchar(255);default:''" json:"tags"`                      // 服务器标签，逗号分隔（如 production）
+	IntervalHours      int    `gorm:"column:interval_hours;default:0" json:"interval_hours"`                     // 轮换间隔（小时），0 表示使用全局配置
+	ArchivedAt         int64  `gorm:"column:archived_at;default:0" json:"archived_at"`                           // 下线归档时间，归档后不再轮换
+	SNIHost            string `gorm:"column:sni_host;type:varchar(255);default:''" json:"sni_host"`              // TLS SNI/伪装域名，为空时不修改设置 JSON，{domain} 代表新连接域名
+	MaxOnlineUsers     int    `gorm:"column:max_online_users;default:0" json:"max_online_users"`                 // 在线用户数超过此值时推迟定时轮换，0 表示不限制
+	RotationWindow     string `gorm:"column:rotation_window;type:varchar(16);default:''" json:"rotation_window"` // 允许定时轮换的时段 HH:MM-HH:MM，为空表示不限制
+}
+
+// 服务器是否带有指定标签
+func serverHasTag(tx *gorm.DB, table string, id int, tag string) bool {
+	for _, t := range strings.Split(loadServerSetting(tx, table, id).Tags, ",") {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取服务器设置，不存在时返回默认值（均使用全局配置）
+func loadServerSetting(tx *gorm.DB, table string, id int) ServerSetting {
+	setting := ServerSetting{ServerTable: table, ServerID: id, AvoidRecentDomains: -1}
+	if err := tx.Where("server_table = ? AND server_id = ?", table, id).First(&setting).Error; err != nil && err != gorm.ErrRecordNotFound {
+		log.Printf("获取服务器设置失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+	}
+	return setting
+}
+
+// 服务器生效的"不复用最近 N 个域名"数量
+func effectiveAvoidRecentDomains(setting ServerSetting) int {
+	return configDomainSettings().avoidRecentDomains(setting)
+}
+
+// 服务器生效的轮换间隔（小时）：服务器设置优先，其次全局配置
+func serverIntervalHours(tx *gorm.DB, table string, id int) int {
+	if hours := loadServerSetting(tx, table, id).IntervalHours; hours > 0 {
+		return hours
+	}
+	return currentSettings().UpdateIntervalHours
+}
+
+// 为指定范围内的服务器设置轮换间隔并刷新下次更新时间：table 为空表示所有表，
+// tag 为空表示不按标签（分组）过滤，ids 非空时仅限这些服务器；返回受影响的服务器数
+func applyScopedInterval(t *Tenant, interval int, table, tag string, ids []int, now int64) (int, error) {
+	idSet := map[int]bool{}
+	for _, id := range ids {
+		idSet[id] = true
+	}
+	count := 0
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		for _, tbl := range serverTables(t) {
+			if table != "" && tbl != table {
+				continue
+			}
+			var servers []int
+			if err := tx.Table(tbl).Pluck("id", &servers).Error; err != nil {
+				return err
+			}
+			var matched []int
+			for _, id := range servers {
+				if len(idSet) > 0 && !idSet[id] {
+					continue
+				}
+				setting := loadServerSetting(tx, tbl, id)
+				if tag != "" && !serverTagsContain(setting.Tags, tag) {
+					continue
+				}
+				setting.IntervalHours = interval
+				if err := tx.Save(&setting).Error; err != nil {
+					return err
+				}
+				matched = append(matched, id)
+			}
+			if len(matched) == 0 {
+				continue
+			}
+			if err := tx.Table(tbl).Where("id IN ?", matched).Update(serverColumn(tbl, "next_update_time"), now+int64(interval*3600)).Error; err != nil {
+				return err
+			}
+			count += len(matched)
+		}
+		return nil
+	})
+	return count, err
+}
+
+// 设置了独立轮换间隔的服务器 ID，按表分组
+func serversWithOwnInterval(tdb *gorm.DB) (map[string][]int, error) {
+	var settings []ServerSetting
+	if err := tdb.Where("interval_hours > ?", 0).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	result := map[string][]int{}
+	for _, s := range settings {
+		result[s.ServerTable] = append(result[s.ServerTable], s.ServerID)
+	}
+	return result, nil
+}
+
+// 注册服务器设置路由
+func registerServerSettingRoutes(r *gin.Engine) {
+	// 查看服务器设置
+	r.GET("/server-settings", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		if !isValidServerTable(table) {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		setting := loadServerSetting(tdb, table, id)
+		c.JSON(http.StatusOK, gin.H{
+			"setting":                        setting,
+			"effective_avoid_recent_domains": effectiveAvoidRecentDomains(setting),
+			"effective_interval_hours":       serverIntervalHours(tdb, table, id),
+		})
+	})
+
+	// 修改服务器设置，仅更新提交的字段
+	r.POST("/server-settings", authMiddleware, func(c *gin.Context) {
+		tdb := currentTenant(c).DB
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		if !isValidServerTable(table) {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		setting := loadServerSetting(tdb, table, id)
+		if v, ok := c.GetPostForm("avoid_recent_domains"); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < -1 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的避免复用域名数量（-1 表示使用全局配置）")
+				return
+			}
+			setting.AvoidRecentDomains = n
+		}
+		if v, ok := c.GetPostForm("interval_hours"); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的轮换间隔（0 表示使用全局配置）")
+				return
+			}
+			setting.IntervalHours = n
+		}
+		if tags, ok := c.GetPostForm("tags"); ok {
+			tags = normalizeTags(tags)
+			if len(tags) > 255 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "标签过长（最多 255 字节）")
+				return
+			}
+			setting.Tags = tags
+		}
+		if v, ok := c.GetPostForm("sni_host"); ok {
+			sni, err := normalizeSNIHost(v)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 SNI 域名："+err.Error())
+				return
+			}
+			setting.SNIHost = sni
+		}
+		if v, ok := c.GetPostForm("max_online_users"); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的在线用户上限（0 表示不限制）")
+				return
+			}
+			setting.MaxOnlineUsers = n
+		}
+		if v, ok := c.GetPostForm("rotation_window"); ok {
+			window, err := normalizeRotationWindow(v)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+				return
+			}
+			setting.RotationWindow = window
+		}
+		if err := tdb.Save(&setting).Error; err != nil {
+			log.Printf("保存服务器设置失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存服务器设置失败："+err.Error())
+			return
+		}
+		log.Printf("保存服务器设置成功: 表=%s, ID=%d, 设置=%+v", table, id, setting)
+		c.JSON(http.StatusOK, gin.H{"message": "服务器设置已保存", "setting": setting})
+	})
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 可改写的协议设置 JSON 列（逻辑名，实际列名按 [columns.<表名>] 映射）
+var settingsJSONColumnNames = []string{"tls_settings", "network_settings"}
+
+// SettingsRewriteRule 协议设置改写规则，配置于 [settingsrewrite.<名称>]：轮换后将 column 列 JSON 中
+// path 处的值改写为 value，value 中的 {host}、{port} 替换为新的域名和端口
+type SettingsRewriteRule struct {
+	Name   string
+	Table  string   // 为空表示所有服务器表
+	Column string   // tls_settings 或 network_settings
+	Path   []string // 以 . 分隔的路径，数字表示数组下标，如 headers.Host、grpcSettings.serviceName
+	Value  string
+}
+
+var (
+	settingsRewriteOnce  sync.Once
+	settingsRewriteRules []SettingsRewriteRule
+	settingsJSONColumns  sync.Map // 租户:表 -> 存在的设置 JSON 列（逻辑名）
+)
+
+// 加载 [settingsrewrite.<名称>] 配置，无效的规则记录日志后忽略
+func loadSettingsRewriteRules() {
+	settingsRewriteRules = nil
+	for name := range viper.GetStringMap("settingsrewrite") {
+		cfg := viper.Sub("settingsrewrite." + name)
+		if cfg == nil {
+			continue
+		}
+		rule := SettingsRewriteRule{Name: name, Table: cfg.GetString("table"), Column: cfg.GetString("column"), Value: cfg.GetString("value")}
+		if rule.Table != "" && !isValidServerTable(rule.Table) {
+			log.Printf("设置改写规则 %s 配置无效: 无效的表名 %q", name, rule.Table)
+			continue
+		}
+		if rule.Column != "tls_settings" && rule.Column != "network_settings" {
+			log.Printf("设置改写规则 %s 配置无效: 不支持的列 %q（可选 tls_settings, network_settings）", name, rule.Column)
+			continue
+		}
+		if path := strings.TrimSpace(cfg.GetString("path")); path != "" {
+			rule.Path = strings.Split(path, ".")
+		} else {
+			log.Printf("设置改写规则 %s 配置无效: 缺少 path", name)
+			continue
+		}
+		settingsRewriteRules = append(settingsRewriteRules, rule)
+		log.Printf("已加载设置改写规则: 名称=%s, 表=%s, 列=%s, 路径=%s, 值=%s", name, rule.Table, rule.Column, strings.Join(rule.Path, "."), rule.Value)
+	}
+}
+
+// 适用于指定表的改写规则
+func settingsRewriteRulesFor(table string) []SettingsRewriteRule {
+	settingsRewriteOnce.Do(loadSettingsRewriteRules)
+	var rules []SettingsRewriteRule
+	for _, rule := range settingsRewriteRules {
+		if rule.Table == "" || rule.Table == table {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// 将规则应用到设置上；路径的上级不存在时不创建，原值为数字且新值为整数时写入数字
+func (rule SettingsRewriteRule) apply(settings map[string]interface{}, host string, port int) {
+	value := strings.NewReplacer("{host}", host, "{port}", strconv.Itoa(port)).Replace(rule.Value)
+	var node interface{} = settings
+	for i, key := range rule.Path {
+		last := i == len(rule.Path)-1
+		switch n := node.(type) {
+		case map[string]interface{}:
+			if last {
+				n[key] = settingsValue(n[key], value)
+				return
+			}
+			node = n[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(n) {
+				return
+			}
+			if last {
+				n[index] = settingsValue(n[index], value)
+				return
+			}
+			node = n[index]
+		default:
+			return
+		}
+	}
+}
+
+// 保持原值的类型：原值为数字时尽量写入数字
+func settingsValue(old interface{}, value string) interface{} {
+	if _, ok := old.(float64); ok {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// 服务器表中存在的设置 JSON 列，结果按租户及表缓存
+func serverSettingsColumns(t *Tenant, table string) []string {
+	key := t.Name + ":" + table
+	if v, ok := settingsJSONColumns.Load(key); ok {
+		return v.([]string)
+	}
+	var columns []string
+	for _, column := range settingsJSONColumnNames {
+		if t.DB.Migrator().HasColumn(table, serverColumn(table, column)) {
+			columns = append(columns, column)
+		}
+	}
+	settingsJSONColumns.Store(key, columns)
+	return columns
+}
+
+// 对一列设置依次应用 SNI/伪装域名及改写规则
+func rewriteSettings(column string, settings map[string]interface{}, sni string, rules []SettingsRewriteRule, host string, port int) {
+	if sni != "" {
+		rewriteSNI(column, settings, sni)
+	}
+	for _, rule := range rules {
+		if rule.Column == column {
+			rule.apply(settings, host, port)
+		}
+	}
+}
+
+// 改写设置 JSON 字符串，返回改写后的 JSON 及是否有变化；原值为空时不修改
+func rewriteSettingsJSON(column, raw, sni string, rules []SettingsRewriteRule, host string, port int) (string, bool, error) {
+	if strings.TrimSpace(raw) == "" || strings.TrimSpace(raw) == "null" {
+		return raw, false, nil
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &settings); err != nil {
+		return raw, false, fmt.Errorf("解析 %s 失败: %v", column, err)
+	}
+	rewriteSettings(column, settings, sni, rules, host, port)
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return raw, false, err
+	}
+	return string(data), string(data) != raw, nil
+}
+
+// 轮换时需要一并写入的协议设置字段（逻辑列名 -> 新 JSON）：服务器设置了 SNI/伪装域名或有适用的改写规则时改写
+func settingsUpdateFields(t *Tenant, tx *gorm.DB, table string, id int, host string, port int) (map[string]interface{}, error) {
+	sni := resolveSNIHost(loadServerSetting(tx, table, id), host)
+	rules := settingsRewriteRulesFor(table)
+	columns := serverSettingsColumns(t, table)
+	if (sni == "" && len(rules) == 0) || len(columns) == 0 {
+		return nil, nil
+	}
+	row := map[string]interface{}{}
+	if err := tx.Table(table).Select(serverSelect(table, columns...)).Where("id = ?", id).Take(&row).Error; err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	for _, column := range columns {
+		raw := ""
+		switch v := row[column].(type) {
+		case string:
+			raw = v
+		case []byte:
+			raw = string(v)
+		}
+		updated, changed, err := rewriteSettingsJSON(column, raw, sni, rules, host, port)
+		if err != nil {
+			// 设置格式异常时只跳过该列，不影响轮换
+			log.Printf("跳过协议设置改写: 表=%s, ID=%d, 错误=%v", table, id, err)
+			continue
+		}
+		if changed {
+			fields[column] = updated
+			log.Printf("改写协议设置: 表=%s, ID=%d, 列=%s, SNI=%s", table, id, column, sni)
+		}
+	}
+	return fields, nil
+}
+
+// 回写 V2Board 时改写节点的协议设置，接口返回的设置可能是对象或 JSON 字符串
+func rewriteNodeSettings(t *Tenant, node map[string]interface{}, table string, id int, host string, port int) {
+	sni := resolveSNIHost(loadServerSetting(t.DB, table, id), host)
+	rules := settingsRewriteRulesFor(table)
+	if sni == "" && len(rules) == 0 {
+		return
+	}
+	for _, column := range settingsJSONColumnNames {
+		switch v := node[column].(type) {
+		case map[string]interface{}:
+			rewriteSettings(column, v, sni, rules, host, port)
+		case string:
+			if updated, changed, err := rewriteSettingsJSON(column, v, sni, rules, host, port); err != nil {
+				log.Printf("改写节点 %s 失败: %v", column, err)
+			} else if changed {
+				node[column] = updated
+			}
+		}
+	}
+}
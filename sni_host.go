@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SNI 设置中代表新连接域名的占位符
+const sniDomainPlaceholder = "{domain}"
+
+// 服务器生效的 SNI/伪装域名：未设置时返回空（不修改设置 JSON），{domain} 替换为新连接域名
+func resolveSNIHost(setting ServerSetting, host string) string {
+	return strings.ReplaceAll(setting.SNIHost, sniDomainPlaceholder, host)
+}
+
+// 规范化并校验 SNI/伪装域名设置，允许 {domain} 占位符
+func normalizeSNIHost(raw string) (string, error) {
+	value := strings.TrimSpace(raw)
+	if value == "" || value == sniDomainPlaceholder {
+		return value, nil
+	}
+	if !strings.Contains(value, sniDomainPlaceholder) {
+		return normalizeDomain(value)
+	}
+	if len(value) > 255 {
+		return "", fmt.Errorf("%w: SNI 域名过长", errInvalidDomain)
+	}
+	if _, err := normalizeDomain(strings.ReplaceAll(value, sniDomainPlaceholder, "example.com")); err != nil {
+		return "", err
+	}
+	return strings.ToLower(value), nil
+}
+
+// 改写 TLS 设置中的 SNI：server_name（V2Board）或 serverName（Xray 风格），都没有时写入 server_name
+func rewriteTLSSettings(settings map[string]interface{}, sni string) {
+	_, snake := settings["server_name"]
+	_, camel := settings["serverName"]
+	if camel {
+		settings["serverName"] = sni
+	}
+	if snake || !camel {
+		settings["server_name"] = sni
+	}
+}
+
+// 改写传输设置中的伪装 Host：headers 中的 Host 头（ws、tcp http 伪装），以及 host 字段（h2、httpupgrade）
+func rewriteNetworkSettings(settings map[string]interface{}, sni string) {
+	if headers, ok := settings["headers"].(map[string]interface{}); ok {
+		replaced := false
+		for k := range headers {
+			if strings.EqualFold(k, "host") {
+				headers[k] = sni
+				replaced = true
+			}
+		}
+		if !replaced {
+			headers["Host"] = sni
+		}
+	} else if _, ok := settings["path"]; ok {
+		settings["headers"] = map[string]interface{}{"Host": sni}
+	}
+	switch settings["host"].(type) {
+	case string:
+		settings["host"] = sni
+	case []interface{}:
+		settings["host"] = []interface{}{sni}
+	}
+}
+
+// 按逻辑列名改写设置中的 SNI/伪装域名
+func rewriteSNI(column string, settings map[string]interface{}, sni string) {
+	if column == "tls_settings" {
+		rewriteTLSSettings(settings, sni)
+	} else {
+		rewriteNetworkSettings(settings, sni)
+	}
+}
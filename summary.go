@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DashboardSummary 总览统计
+type DashboardSummary struct {
+	Servers         map[string]int `json:"servers"`           // 各表服务器数
+	ServersTotal    int            `json:"servers_total"`     // 服务器总数
+	Hidden          int            `json:"hidden"`            // 未显示的服务器数
+	Failed          int            `json:"failed"`            // 最近一次轮换失败的服务器数
+	Degraded        int            `json:"degraded"`          // 轮换后新端口不可达的服务器数
+	DueWithinHour   int            `json:"due_within_hour"`   // 一小时内（含已到期）需要轮换的服务器数
+	DomainsTotal    int64          `json:"domains_total"`     // 域名总数
+	DomainsAvail    int64          `json:"domains_available"` // 当前可分配的域名数
+	DomainsInUse    int64          `json:"domains_in_use"`    // 使用中的域名数
+	DomainsCooldown int64          `json:"domains_cooldown"`  // 冷却期内的域名数
+	DomainsRetired  int64          `json:"domains_retired"`   // 已退役的域名数
+	DomainsStaged   int64          `json:"domains_staged"`    // 预热中的域名数
+	GeneratedAt     int64          `json:"generated_at"`
+}
+
+// 统计租户的服务器及域名总览
+func buildDashboardSummary(t *Tenant, now int64) (DashboardSummary, error) {
+	summary := DashboardSummary{Servers: map[string]int{}, GeneratedAt: now}
+	rdb := readDB(t)
+	for _, table := range serverTables(t) {
+		rows, err := listServerRows(t, table)
+		if err != nil {
+			return summary, err
+		}
+		summary.Servers[table] = len(rows)
+		summary.ServersTotal += len(rows)
+		for _, s := range rows {
+			if !s.Show {
+				summary.Hidden++
+			}
+			switch {
+			case strings.Contains(s.LastUpdateStatus, "更新失败"):
+				summary.Failed++
+			case strings.HasPrefix(s.LastUpdateStatus, degradedStatusPrefix):
+				summary.Degraded++
+			}
+			if s.NextUpdateTime <= now+3600 {
+				summary.DueWithinHour++
+			}
+		}
+	}
+	if err := rdb.Model(&ServerDomain{}).Count(&summary.DomainsTotal).Error; err != nil {
+		return summary, err
+	}
+	if err := rdb.Model(&ServerDomain{}).Scopes(availableDomainScope(now)).Count(&summary.DomainsAvail).Error; err != nil {
+		return summary, err
+	}
+	if err := rdb.Model(&ServerDomain{}).Where("in_use = ?", 1).Count(&summary.DomainsInUse).Error; err != nil {
+		return summary, err
+	}
+	cooldownStart, args := cooldownStartExpr(now)
+	if err := rdb.Model(&ServerDomain{}).Where("in_use = ? AND retired = ?", 0, 0).Where("last_used_time > "+cooldownStart, args...).Count(&summary.DomainsCooldown).Error; err != nil {
+		return summary, err
+	}
+	if err := rdb.Model(&ServerDomain{}).Where("retired = ?", 1).Count(&summary.DomainsRetired).Error; err != nil {
+		return summary, err
+	}
+	if err := rdb.Model(&ServerDomain{}).Where("in_use = ? AND staged_until > ?", 0, now).Count(&summary.DomainsStaged).Error; err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// 注册总览路由
+func registerSummaryRoutes(r *gin.Engine) {
+	// 总览：各表服务器数、轮换失败及即将轮换的服务器数、域名池各状态数量
+	r.GET("/api/v1/summary", authMiddleware, httpCacheMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		summary, err := buildDashboardSummary(t, time.Now().Unix())
+		if err != nil {
+			log.Printf("统计总览失败: 租户=%s, 错误=%v", t.Name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "统计总览失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	})
+}
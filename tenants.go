@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"ser_manger/internal/repository"
+	"ser_manger/internal/service"
+)
+
+// 默认租户名，对应 [database] 配置
+const defaultTenantName = "default"
+
+// Tenant 租户：一个 V2Board 面板数据库，拥有独立的服务器、域名池及轮换数据
+type Tenant struct {
+	Name    string
+	DB      *gorm.DB
+	Reader  *gorm.DB // 只读副本（查询失败回退主库），未配置时为空，通过 readDB 使用
+	Domains DomainService
+	Servers *repository.ServerRepository
+	Checker *service.CheckService
+}
+
+// 已连接的租户，tenantNames 中默认租户在前、其余按名称排序
+var (
+	tenants     = map[string]*Tenant{}
+	tenantNames []string
+)
+
+// 默认租户
+func defaultTenant() *Tenant {
+	return tenants[defaultTenantName]
+}
+
+// 所有租户，按 tenantNames 顺序
+func tenantList() []*Tenant {
+	list := make([]*Tenant, 0, len(tenantNames))
+	for _, name := range tenantNames {
+		list = append(list, tenants[name])
+	}
+	return list
+}
+
+// 按名称查找租户，名称为空时返回默认租户
+func lookupTenant(name string) (*Tenant, bool) {
+	if name == "" {
+		return defaultTenant(), true
+	}
+	t, ok := tenants[name]
+	return t, ok
+}
+
+// 附加租户名称：[tenants.<名称>] 配置段，字段同 [database]
+func configuredTenantNames() []string {
+	var names []string
+	for name := range viper.GetStringMap("tenants") {
+		if name != defaultTenantName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 按配置段（database 或 tenants.<名称>）打开 MySQL 数据库
+func openMySQL(key string) (*gorm.DB, error) {
+	return gorm.Open(mysql.Open(mysqlDSN(key, "")), &gorm.Config{})
+}
+
+// 读取配置段的数据库连接字段，为空且 fallback 非空时取 fallback 段的值
+func mysqlConfigValue(key, fallback, field string) string {
+	if v := viper.GetString(key + "." + field); v != "" || fallback == "" {
+		return v
+	}
+	return viper.GetString(fallback + "." + field)
+}
+
+// 按配置段生成 MySQL DSN，未配置的字段取 fallback 段的值（只读副本沿用主库的账号、库名等）
+func mysqlDSN(key, fallback string) string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		mysqlConfigValue(key, fallback, "user"),
+		mysqlConfigValue(key, fallback, "password"),
+		mysqlConfigValue(key, fallback, "host"),
+		mysqlConfigValue(key, fallback, "port"),
+		mysqlConfigValue(key, fallback, "name"))
+}
+
+// 注册租户
+func addTenant(name string, tdb *gorm.DB) *Tenant {
+	t := &Tenant{Name: name, DB: tdb, Domains: newDomainService(tdb, configDomainSettings), Servers: newServerRepository(tdb)}
+	t.Checker = newCheckService(t)
+	tenants[name] = t
+	tenantNames = append(tenantNames, name)
+	return t
+}
+
+// 请求显式指定的租户：tenant 参数或 X-Tenant 头（/t/<名称>/ 路径前缀会被转换为该头）
+func requestTenantName(c *gin.Context) string {
+	if name := c.Query("tenant"); name != "" {
+		return name
+	}
+	if name := c.PostForm("tenant"); name != "" {
+		return name
+	}
+	return c.GetHeader("X-Tenant")
+}
+
+// 租户中间件：解析请求所选租户，显式指定未知租户时拒绝；
+// 未显式指定时使用界面切换写入的 tenant Cookie，Cookie 失效（租户已移除）时回退到默认租户
+func tenantMiddleware(c *gin.Context) {
+	t := defaultTenant()
+	if name := requestTenantName(c); name != "" {
+		var ok bool
+		if t, ok = lookupTenant(name); !ok {
+			log.Printf("未知的租户: %s, 路径=%s", name, c.Request.URL.Path)
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "未知的租户："+name)
+			return
+		}
+	} else if name, err := c.Cookie("tenant"); err == nil {
+		if cookieTenant, ok := lookupTenant(name); ok {
+			t = cookieTenant
+		}
+	}
+	c.Set("tenant", t)
+	c.Next()
+}
+
+// 当前请求的租户
+func currentTenant(c *gin.Context) *Tenant {
+	if t, ok := c.Get("tenant"); ok {
+		return t.(*Tenant)
+	}
+	return defaultTenant()
+}
+
+// 支持 /t/<名称>/... 形式的 API 路径：去掉前缀并通过 X-Tenant 头传递租户
+func tenantPathHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if rest, ok := strings.CutPrefix(req.URL.Path, "/t/"); ok {
+			name, path, _ := strings.Cut(rest, "/")
+			req.Header.Set("X-Tenant", name)
+			req.URL.Path = "/" + path
+			req.URL.RawPath = ""
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// 注册租户切换路由
+func registerTenantRoutes(r *gin.Engine) {
+	// 列出所有租户
+	r.GET("/tenants", authMiddleware, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"tenants": tenantNames, "current": currentTenant(c).Name})
+	})
+
+	// 切换界面使用的租户（写入 Cookie）并返回服务器列表
+	r.GET("/switch-tenant", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		c.SetCookie("tenant", t.Name, 0, "/", "", false, true)
+		redirectTo(c, "/servers")
+	})
+}
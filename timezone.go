@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 时区偏好 Cookie 名称
+const timeZoneCookieName = "tz"
+
+// 部署时区（server.timeZone），用于定时任务、禁止轮换时段及默认显示；未配置时为服务器本地时区
+var deployLocation = time.Local
+
+// 已加载的时区缓存
+var locationCache sync.Map
+
+// 按 IANA 名称加载时区（如 Asia/Shanghai），结果缓存
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locationCache.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locationCache.Store(name, loc)
+	return loc, nil
+}
+
+// 读取部署时区配置，无效时使用服务器本地时区
+func loadTimeZone() {
+	name := viper.GetString("server.timeZone")
+	if name == "" {
+		deployLocation = time.Local
+		return
+	}
+	loc, err := loadLocation(name)
+	if err != nil {
+		log.Printf("无效的时区 %q，使用服务器本地时区: %v", name, err)
+		deployLocation = time.Local
+		return
+	}
+	deployLocation = loc
+}
+
+// 部署时区
+func appLocation() *time.Location {
+	return deployLocation
+}
+
+// 当前用户的显示时区：优先使用 Cookie 中的偏好，其次部署时区
+func userLocation(c *gin.Context) *time.Location {
+	if name, err := c.Cookie(timeZoneCookieName); err == nil && name != "" {
+		if loc, err := loadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return appLocation()
+}
+
+// 时区名称，本地时区没有 IANA 名称时返回空字符串（页面脚本使用浏览器时区）
+func locationName(loc *time.Location) string {
+	if name := loc.String(); name != "Local" {
+		return name
+	}
+	return ""
+}
+
+// 按时区格式化时间戳，tz 为空时使用部署时区
+func formatTimeIn(timestamp int64, tz string) string {
+	loc := appLocation()
+	if tz != "" {
+		if l, err := loadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	return time.Unix(timestamp, 0).In(loc).Format("2006-01-02 15:04:05")
+}
+
+// 注册时区偏好路由
+func registerTimeZoneRoutes(r *gin.Engine) {
+	// 查看时区设置
+	r.GET("/preferences/timezone", authMiddleware, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"timezone":        userLocation(c).String(),
+			"deploy_timezone": appLocation().String(),
+		})
+	})
+
+	// 设置当前用户的显示时区（IANA 名称），为空时恢复为部署时区
+	r.POST("/preferences/timezone", authMiddleware, func(c *gin.Context) {
+		name := c.PostForm("timezone")
+		if name == "" {
+			c.SetCookie(timeZoneCookieName, "", -1, "/", "", false, true)
+			c.JSON(http.StatusOK, gin.H{"message": "已恢复为部署时区 " + appLocation().String()})
+			return
+		}
+		if _, err := loadLocation(name); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的时区，应为 IANA 名称（如 Asia/Shanghai）")
+			return
+		}
+		c.SetCookie(timeZoneCookieName, name, 365*86400, "/", "", false, true)
+		c.JSON(http.StatusOK, gin.H{"message": "显示时区已设置为 " + name})
+	})
+}
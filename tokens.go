@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API 令牌权限范围
+const (
+	scopeAdmin   = "admin"   // 全部权限
+	scopeRead    = "read"    // 只读（所有 GET 接口）
+	scopeDomains = "domains" // 仅域名管理接口
+	scopeMetrics = "metrics" // 仅节点流量上报及 Prometheus 抓取
+)
+
+// ApiToken 结构体，用于存储自动化脚本使用的 API 令牌（仅保存哈希）
+type ApiToken struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	Name         string `gorm:"column:name;type:varchar(255);not null" json:"name"`
+	TokenHash    string `gorm:"column:token_hash;type:char(64);uniqueIndex;not null" json:"-"`
+	Scopes       string `gorm:"column:scopes;type:varchar(255);not null" json:"scopes"`
+	ExpiresAt    int64  `gorm:"column:expires_at;default:0" json:"expires_at"`
+	LastUsedTime int64  `gorm:"column:last_used_time;default:0" json:"last_used_time"`
+	RevokedAt    int64  `gorm:"column:revoked_at;default:0" json:"revoked_at"`
+	CreatedAt    int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	// 修改登录密码时自动吊销
+	InvalidateOnCredentialChange bool `gorm:"column:invalidate_on_credential_change;default:false" json:"invalidate_on_credential_change"`
+	// 限定可管理的服务器组（表名或 tag:<标签>，逗号分隔），为空表示不限制
+	Servers string `gorm:"column:servers;type:varchar(1024);default:''" json:"servers"`
+	// 创建者身份（见 requestPrincipal），使用令牌的请求视为创建者本人
+	CreatedBy string `gorm:"column:created_by;type:varchar(255);default:''" json:"created_by"`
+}
+
+// 令牌背后的身份：创建者，创建者未知的旧令牌按令牌 ID 区分
+func (t ApiToken) principal() string {
+	if t.CreatedBy != "" {
+		return t.CreatedBy
+	}
+	return "token:" + strconv.FormatUint(uint64(t.ID), 10)
+}
+
+// 域名管理相关接口，domains 范围的令牌可访问
+var domainScopePaths = map[string]bool{
+	"/available-domains":       true,
+	"/add-domain":              true,
+	"/delete-domain":           true,
+	"/update-domain-meta":      true,
+	"/deleted-domains":         true,
+	"/deleted-domains/restore": true,
+	"/clone-domains":           true,
+	"/api/v1/domains/:id":      true,
+	"/duplicate-domains":       true,
+	"/rebalance-domains":       true,
+	"/stage-domain":            true,
+	"/release-domain":          true,
+	"/acquire-domains":         true,
+	"/domain-purchases":        true,
+	"/domain-aliases":          true,
+	"/search-domains":          true,
+	"/api/v1/domains/unused":   true,
+	"/bulk-edit-domains":       true,
+}
+
+// 判断令牌权限范围是否允许访问当前请求
+func tokenAllows(scopes string, c *gin.Context) bool {
+	path := c.FullPath()
+	for _, s := range strings.Split(scopes, ",") {
+		switch strings.TrimSpace(s) {
+		case scopeAdmin:
+			return true
+		case scopeRead:
+			if c.Request.Method == http.MethodGet && !adminOnlyRoute(c) {
+				return true
+			}
+		case scopeDomains:
+			if domainScopePaths[path] {
+				return true
+			}
+		case scopeMetrics:
+			if (path == "/node-metrics" && c.Request.Method == http.MethodPost) || (path == "/metrics" && c.Request.Method == http.MethodGet) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 计算令牌哈希
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 从 Authorization 头中取出 Bearer 令牌
+func bearerToken(c *gin.Context) string {
+	auth := c.GetHeader("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// 使用 API 令牌认证，成功返回 true；失败时已写入响应
+func authenticateToken(c *gin.Context, token string) bool {
+	var apiToken ApiToken
+	if err := db.Where("token_hash = ?", hashToken(token)).First(&apiToken).Error; err != nil {
+		log.Printf("无效的 API 令牌: 路径=%s, 来源=%s", c.Request.URL.Path, c.ClientIP())
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "无效的 API 令牌")
+		return false
+	}
+	now := time.Now().Unix()
+	if apiToken.RevokedAt != 0 {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "API 令牌已被吊销")
+		return false
+	}
+	if apiToken.ExpiresAt != 0 && apiToken.ExpiresAt <= now {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "API 令牌已过期")
+		return false
+	}
+	if !tokenAllows(apiToken.Scopes, c) {
+		log.Printf("API 令牌权限不足: 令牌=%s, 范围=%s, 路径=%s %s", apiToken.Name, apiToken.Scopes, c.Request.Method, c.Request.URL.Path)
+		respondError(c, http.StatusForbidden, codeForbidden, "API 令牌权限不足")
+		return false
+	}
+	if access := newServerAccess(apiToken.Servers); access != nil {
+		c.Set("server_access", access)
+	}
+	if err := db.Model(&ApiToken{}).Where("id = ?", apiToken.ID).Update("last_used_time", now).Error; err != nil {
+		log.Printf("更新 API 令牌最后使用时间失败: ID=%d, 错误=%v", apiToken.ID, err)
+	}
+	c.Set("api_token", apiToken.Name)
+	c.Set("principal", apiToken.principal())
+	return true
+}
+
+// 生成新的明文令牌
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "smt_" + hex.EncodeToString(buf), nil
+}
+
+// 解析并校验权限范围列表
+func parseScopes(raw string) (string, bool) {
+	var scopes []string
+	seen := map[string]bool{}
+	for _, s := range strings.Split(raw, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		if s != scopeAdmin && s != scopeRead && s != scopeDomains && s != scopeMetrics {
+			return "", false
+		}
+		seen[s] = true
+		scopes = append(scopes, s)
+	}
+	if len(scopes) == 0 {
+		return "", false
+	}
+	return strings.Join(scopes, ","), true
+}
+
+// 注册 API 令牌管理路由
+func registerTokenRoutes(r *gin.Engine) {
+	// 列出所有令牌
+	r.GET("/api-tokens", authMiddleware, func(c *gin.Context) {
+		var tokens []ApiToken
+		if err := db.Order("id DESC").Find(&tokens).Error; err != nil {
+			log.Printf("获取 API 令牌列表失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取令牌列表失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+	})
+
+	// 创建令牌，明文仅在创建时返回一次
+	r.POST("/api-tokens", authMiddleware, func(c *gin.Context) {
+		name := strings.TrimSpace(c.PostForm("name"))
+		if name == "" {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "令牌名称不能为空")
+			return
+		}
+		scopes, ok := parseScopes(c.PostForm("scopes"))
+		if !ok {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的权限范围，可选值: admin, read, domains, metrics")
+			return
+		}
+		servers, err := parseServerGroups(c.PostForm("servers"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+			return
+		}
+		var expiresAt int64
+		if hoursStr := c.PostForm("expires_in_hours"); hoursStr != "" {
+			hours, err := strconv.Atoi(hoursStr)
+			if err != nil || hours <= 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的有效期")
+				return
+			}
+			expiresAt = time.Now().Unix() + int64(hours*3600)
+		}
+		token, err := generateToken()
+		if err != nil {
+			log.Printf("生成 API 令牌失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "生成令牌失败")
+			return
+		}
+		apiToken := ApiToken{
+			Name:                         name,
+			TokenHash:                    hashToken(token),
+			Scopes:                       scopes,
+			ExpiresAt:                    expiresAt,
+			InvalidateOnCredentialChange: c.PostForm("invalidate_on_credential_change") == "1",
+			Servers:                      servers,
+			CreatedBy:                    requestPrincipal(c),
+		}
+		if err := db.Create(&apiToken).Error; err != nil {
+			log.Printf("保存 API 令牌失败: 名称=%s, 错误=%v", name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存令牌失败："+err.Error())
+			return
+		}
+		log.Printf("创建 API 令牌成功: ID=%d, 名称=%s, 范围=%s, 服务器组=%q, 过期时间=%d, 创建者=%s", apiToken.ID, name, scopes, servers, expiresAt, apiToken.CreatedBy)
+		c.JSON(http.StatusOK, gin.H{
+			"message": "令牌 " + name + " 创建成功，请妥善保存，此后将无法再次查看",
+			"token":   token,
+			"info":    apiToken,
+		})
+	})
+
+	// 吊销令牌
+	r.POST("/api-tokens/revoke", authMiddleware, func(c *gin.Context) {
+		idStr := c.PostForm("id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的令牌ID")
+			return
+		}
+		result := db.Model(&ApiToken{}).Where("id = ? AND revoked_at = 0", id).Update("revoked_at", time.Now().Unix())
+		if result.Error != nil {
+			log.Printf("吊销 API 令牌失败: ID=%d, 错误=%v", id, result.Error)
+			respondError(c, http.StatusInternalServerError, codeInternal, "吊销令牌失败："+result.Error.Error())
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "令牌不存在或已被吊销")
+			return
+		}
+		log.Printf("吊销 API 令牌成功: ID=%d", id)
+		c.JSON(http.StatusOK, gin.H{"message": "令牌已吊销"})
+	})
+}
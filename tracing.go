@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
+)
+
+// 追踪器名称
+const tracerName = "ser_manger"
+
+// 是否开启 OpenTelemetry 追踪（tracing.enabled）
+func tracingEnabled() bool {
+	return viper.GetBool("tracing.enabled")
+}
+
+// 服务名称（tracing.serviceName），默认 server_manager
+func tracingServiceName() string {
+	if name := viper.GetString("tracing.serviceName"); name != "" {
+		return name
+	}
+	return "server_manager"
+}
+
+// 开启 tracing.enabled 时通过 OTLP/HTTP 导出追踪数据到 tracing.endpoint（如 http://127.0.0.1:4318），
+// 未开启时使用默认的空追踪器，埋点不产生开销
+func setupTracing() {
+	if !tracingEnabled() {
+		return
+	}
+	opts := []otlptracehttp.Option{}
+	if endpoint := viper.GetString("tracing.endpoint"); endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	}
+	if headers := viper.GetStringMapString("tracing.headers"); len(headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(headers))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		log.Printf("创建 OTLP 导出器失败，追踪未开启: %v", err)
+		return
+	}
+	ratio := 1.0
+	if viper.IsSet("tracing.sampleRate") {
+		ratio = viper.GetFloat64("tracing.sampleRate")
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(tracingServiceName()))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	log.Printf("OpenTelemetry 追踪已开启: 服务=%s, 采样率=%.2f", tracingServiceName(), ratio)
+}
+
+// HTTP 请求追踪中间件，未开启追踪时返回 nil
+func tracingMiddleware() gin.HandlerFunc {
+	if !tracingEnabled() {
+		return nil
+	}
+	return otelgin.Middleware(tracingServiceName())
+}
+
+// 为租户数据库注册查询追踪，查询须通过 WithContext 传入上下文才能归入所属的请求或轮换
+func setupDBTracing(tdb *gorm.DB, tenant string) {
+	if !tracingEnabled() {
+		return
+	}
+	if err := tdb.Use(gormtracing.NewPlugin(
+		gormtracing.WithoutMetrics(),
+		gormtracing.WithoutQueryVariables(),
+		gormtracing.WithAttributes(attribute.String("tenant", tenant)),
+	)); err != nil {
+		log.Printf("注册数据库追踪失败: 租户=%s, 错误=%v", tenant, err)
+	}
+}
+
+// 开始一个追踪片段
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// 结束追踪片段，出错时记录错误及失败分类
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(attribute.String("failure_code", classifyFailure(err)))
+	}
+	span.End()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 从未使用的域名：加入域名池后从未被分配过（last_used_time 为 0）、未退役且不是别名的域名。
+// 长期闲置的域名仍在产生费用，可在此退役或移交给更需要的服务器；轮换报告中附带闲置数量及费用
+
+// 因从未使用而退役时记录的原因
+const unusedRetiredReason = "从未使用"
+
+// 从未使用的域名处理方式
+const (
+	unusedActionRetire       = "retire"       // 退役
+	unusedActionRedistribute = "redistribute" // 移交给目标服务器
+)
+
+// 加入域名池超过多少天仍未使用视为闲置（report.unusedDays），默认 30
+func unusedDomainDays() int {
+	if n := viper.GetInt("report.unusedDays"); n > 0 {
+		return n
+	}
+	return 30
+}
+
+// 加入域名池不晚于 since 且从未使用的域名；加入时间未知（早于记录该字段的版本）的域名一并列出
+func unusedDomainScope(since int64) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		return q.Where("last_used_time = ? AND in_use = ? AND retired = ? AND alias_of = ? AND created_at <= ?", 0, 0, 0, 0, since)
+	}
+}
+
+// UnusedDomainsResult 从未使用的域名处理结果
+type UnusedDomainsResult struct {
+	Processed int      `json:"processed"`
+	Skipped   []string `json:"skipped,omitempty"` // 已被使用、受删除保护或目标服务器已有而未处理的域名
+}
+
+// 退役或移交从未使用的域名：在同一事务中重新确认域名仍从未使用，期间被分配过的域名跳过；
+// 受删除保护的域名不退役，目标服务器已有的域名不移交
+func processUnusedDomains(t *Tenant, domainIDs []int, action, targetTable string, targetID int) (UnusedDomainsResult, error) {
+	result := UnusedDomainsResult{}
+	now := time.Now().Unix()
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		var domains []ServerDomain
+		if err := tx.Where("id IN ?", domainIDs).Order("id").Find(&domains).Error; err != nil {
+			return err
+		}
+		if len(domains) != len(domainIDs) {
+			return errDomainNotOwned
+		}
+		for _, d := range domains {
+			if d.LastUsedTime != 0 || d.InUse != 0 || d.Retired != 0 || d.AliasOf != 0 {
+				result.Skipped = append(result.Skipped, d.Domain)
+				continue
+			}
+			switch action {
+			case unusedActionRetire:
+				if isProtectedDomain(d) {
+					result.Skipped = append(result.Skipped, d.Domain)
+					continue
+				}
+				if err := tx.Model(&ServerDomain{}).Where("id = ?", d.ID).
+					Updates(map[string]interface{}{"retired": 1, "retired_time": now, "retired_reason": unusedRetiredReason}).Error; err != nil {
+					return err
+				}
+			case unusedActionRedistribute:
+				if d.ServerTable == targetTable && d.ServerID == targetID {
+					result.Skipped = append(result.Skipped, d.Domain)
+					continue
+				}
+				var count int64
+				tx.Model(&ServerDomain{}).Where("server_table = ? AND server_id = ? AND domain = ?", targetTable, targetID, d.Domain).Count(&count)
+				if count > 0 {
+					result.Skipped = append(result.Skipped, d.Domain)
+					continue
+				}
+				if err := moveDomainToServer(tx, d, targetTable, targetID, nil); err != nil {
+					return err
+				}
+			}
+			result.Processed++
+		}
+		return nil
+	})
+	return result, err
+}
+
+// 注册从未使用的域名路由
+func registerUnusedDomainRoutes(r *gin.Engine) {
+	// 列出从未使用的域名：since 为 Unix 时间戳，只列出此前加入域名池的域名，默认为 report.unusedDays 天前
+	r.GET("/api/v1/domains/unused", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		since := time.Now().Unix() - int64(unusedDomainDays())*86400
+		if v := c.Query("since"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 since（Unix 时间戳）")
+				return
+			}
+			since = n
+		}
+		var domains []ServerDomain
+		if err := readDB(t).Scopes(serverAccessScope(c), unusedDomainScope(since)).
+			Order("server_table ASC, server_id ASC, `order` ASC").Find(&domains).Error; err != nil {
+			log.Printf("获取从未使用的域名失败: 租户=%s, 错误=%v", t.Name, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取从未使用的域名失败："+err.Error())
+			return
+		}
+		cost := 0.0
+		for _, d := range domains {
+			cost += d.Cost
+		}
+		c.JSON(http.StatusOK, gin.H{"since": since, "count": len(domains), "total_cost": cost, "domains": domains})
+	})
+
+	// 处理从未使用的域名：action=retire 退役，action=redistribute 移交给 target_table、target_id 指定的服务器；
+	// domain_ids 为逗号分隔的域名ID
+	r.POST("/api/v1/domains/unused", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		action := c.PostForm("action")
+		if action != unusedActionRetire && action != unusedActionRedistribute {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的 action，可选值: retire, redistribute")
+			return
+		}
+		domainIDs, err := parseIDList(c.PostForm("domain_ids"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的域名ID列表："+err.Error())
+			return
+		}
+		if len(domainIDs) == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "缺少 domain_ids")
+			return
+		}
+		targetTable, targetID := "", 0
+		if action == unusedActionRedistribute {
+			targetTable = c.PostForm("target_table")
+			if !isValidServerTable(targetTable) {
+				respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的目标表名")
+				return
+			}
+			if targetID, err = strconv.Atoi(c.PostForm("target_id")); err != nil || targetID <= 0 {
+				respondError(c, http.StatusBadRequest, codeInvalidID, "无效的目标服务器ID")
+				return
+			}
+			if exists, err := serverExists(t, targetTable, targetID); err != nil || !exists {
+				respondError(c, http.StatusNotFound, codeNotFound, "目标服务器不存在")
+				return
+			}
+			if archivedServers(t.DB)[targetTable+":"+strconv.Itoa(targetID)] {
+				respondError(c, http.StatusBadRequest, codeInvalidArgument, "目标服务器已下线归档")
+				return
+			}
+		}
+
+		result, err := processUnusedDomains(t, domainIDs, action, targetTable, targetID)
+		if err != nil {
+			if errors.Is(err, errDomainNotOwned) {
+				respondError(c, http.StatusBadRequest, codeDomainNotFound, "部分域名不存在")
+				return
+			}
+			log.Printf("处理从未使用的域名失败: 租户=%s, 操作=%s, 错误=%v", t.Name, action, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "处理从未使用的域名失败："+err.Error())
+			return
+		}
+		detail := fmt.Sprintf("操作=%s, 处理=%d, 跳过=%d", action, result.Processed, len(result.Skipped))
+		if action == unusedActionRedistribute {
+			detail += fmt.Sprintf(", 目标=%s:%d", targetTable, targetID)
+		}
+		recordAudit(t.DB, "process_unused_domains", c.PostForm("domain_ids"), operatorName(c), c.ClientIP(), detail)
+		log.Printf("已处理从未使用的域名: 租户=%s, %s", t.Name, detail)
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("已处理 %d 个域名", result.Processed), "result": result})
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// V2Board 在线人数缓存时间，避免每次轮换及页面刷新都请求面板
+const onlineUsersCacheSeconds = 60
+
+// 在线用户数来源
+const (
+	impactSourceV2board = "v2board" // V2Board 节点列表的 online 字段
+	impactSourceNode    = "node"    // 节点代理通过 /node-metrics 上报
+)
+
+// UserImpact 轮换影响的在线用户估算，OnlineUsers 为 -1 表示无数据
+type UserImpact struct {
+	OnlineUsers int    `json:"online_users"`
+	Source      string `json:"source"`
+	ReportedAt  int64  `json:"reported_at"`
+}
+
+// 是否有在线用户数据
+func (i UserImpact) known() bool {
+	return i.OnlineUsers >= 0
+}
+
+// 轮换历史中记录的影响人数，无数据时为空
+func (i UserImpact) affectedUsers() *int {
+	if !i.known() {
+		return nil
+	}
+	n := i.OnlineUsers
+	return &n
+}
+
+var v2boardOnline struct {
+	sync.Mutex
+	fetchedAt int64
+	counts    map[string]int // 表:ID -> 在线人数
+}
+
+// 从 V2Board 获取各节点在线人数（缓存 onlineUsersCacheSeconds 秒），面板 API 配置仅对应默认租户
+func v2boardOnlineUsers(t *Tenant, now int64) (map[string]int, int64, error) {
+	if devMode || t.Name != defaultTenantName || viper.GetString("v2board.url") == "" {
+		return nil, 0, nil
+	}
+	v2boardOnline.Lock()
+	defer v2boardOnline.Unlock()
+	if v2boardOnline.counts != nil && now-v2boardOnline.fetchedAt < onlineUsersCacheSeconds {
+		return v2boardOnline.counts, v2boardOnline.fetchedAt, nil
+	}
+	client, err := newV2boardClient()
+	if err != nil {
+		return nil, 0, err
+	}
+	nodes, err := client.getNodes()
+	if err != nil {
+		return nil, 0, err
+	}
+	counts := map[string]int{}
+	for _, node := range nodes {
+		// 面板缓存中没有在线数据的节点不返回 online 字段
+		if _, ok := node["online"]; !ok {
+			continue
+		}
+		counts["v2_server_"+nodeString(node, "type")+":"+nodeString(node, "id")] = nodeInt(node, "online")
+	}
+	v2boardOnline.counts = counts
+	v2boardOnline.fetchedAt = now
+	return counts, now, nil
+}
+
+// 估算轮换服务器会影响的在线用户数：优先使用 V2Board 统计，其次使用节点近期上报的在线用户数
+func estimateUserImpact(t *Tenant, table string, id int, now int64) UserImpact {
+	counts, fetchedAt, err := v2boardOnlineUsers(t, now)
+	if err != nil {
+		log.Printf("获取 V2Board 在线人数失败: %v", err)
+	}
+	if n, ok := counts[table+":"+strconv.Itoa(id)]; ok {
+		return UserImpact{OnlineUsers: n, Source: impactSourceV2board, ReportedAt: fetchedAt}
+	}
+	var latest NodeMetric
+	err = t.DB.Where("server_table = ? AND server_id = ? AND online_users IS NOT NULL AND reported_at > ?", table, id, now-metricsStaleSeconds).
+		Order("reported_at DESC, id DESC").First(&latest).Error
+	if err == nil {
+		return UserImpact{OnlineUsers: *latest.OnlineUsers, Source: impactSourceNode, ReportedAt: latest.ReportedAt}
+	}
+	if err != gorm.ErrRecordNotFound {
+		log.Printf("获取节点在线人数失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+	}
+	return UserImpact{OnlineUsers: -1}
+}
+
+// 批量估算租户全部服务器的在线用户影响（键为 "表名:ID"），用于服务器列表等逐台查询代价过高的场景：
+// 一次查询取每台服务器近期最后一次上报的在线用户数，V2Board 统计优先；没有数据的服务器不在结果中
+func estimateUserImpacts(t *Tenant, now int64) map[string]UserImpact {
+	impacts := map[string]UserImpact{}
+	// 同一时间多条时取 ID 最大的，按 ID 升序读取，后读到的覆盖先读到的
+	var latest []NodeMetric
+	if err := readDB(t).Table("node_metrics AS m").Select("m.id, m.server_table, m.server_id, m.online_users, m.reported_at").
+		Joins("JOIN (SELECT server_table, server_id, MAX(reported_at) AS latest FROM node_metrics "+
+			"WHERE online_users IS NOT NULL AND reported_at > ? GROUP BY server_table, server_id) l "+
+			"ON m.server_table = l.server_table AND m.server_id = l.server_id AND m.reported_at = l.latest", now-metricsStaleSeconds).
+		Where("m.online_users IS NOT NULL").Order("m.id").Scan(&latest).Error; err != nil {
+		log.Printf("批量获取节点在线人数失败: 租户=%s, 错误=%v", t.Name, err)
+	}
+	for _, m := range latest {
+		impacts[m.ServerTable+":"+strconv.Itoa(m.ServerID)] = UserImpact{OnlineUsers: *m.OnlineUsers, Source: impactSourceNode, ReportedAt: m.ReportedAt}
+	}
+	counts, fetchedAt, err := v2boardOnlineUsers(t, now)
+	if err != nil {
+		log.Printf("获取 V2Board 在线人数失败: %v", err)
+	}
+	for key, n := range counts {
+		impacts[key] = UserImpact{OnlineUsers: n, Source: impactSourceV2board, ReportedAt: fetchedAt}
+	}
+	return impacts
+}
+
+// 在线用户数超过服务器的 max_online_users 设置时返回推迟原因，未设置或无数据时返回空字符串
+func onlineUsersGuardReason(setting ServerSetting, impact UserImpact) string {
+	if setting.MaxOnlineUsers <= 0 {
+		return ""
+	}
+	if impact.known() && impact.OnlineUsers > setting.MaxOnlineUsers {
+		return fmt.Sprintf("在线用户 %d 人超过 %d", impact.OnlineUsers, setting.MaxOnlineUsers)
+	}
+	return ""
+}
+
+// 注册用户影响估算路由
+func registerUserImpactRoutes(r *gin.Engine) {
+	// 查询轮换服务器预计影响的在线用户数，供立即更新前确认
+	r.GET("/user-impact", authMiddleware, func(c *gin.Context) {
+		t := currentTenant(c)
+		table := serverParam(c, "table")
+		idStr := serverParam(c, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			log.Printf("无效的ID: %s", idStr)
+			respondError(c, http.StatusBadRequest, codeInvalidID, "无效的ID")
+			return
+		}
+		if !isValidServerTable(table) {
+			log.Printf("无效的表名: %s", table)
+			respondError(c, http.StatusBadRequest, codeInvalidTable, "无效的表名")
+			return
+		}
+		setting := loadServerSetting(t.DB, table, id)
+		impact := estimateUserImpact(t, table, id, time.Now().Unix())
+		c.JSON(http.StatusOK, gin.H{
+			"impact":           impact,
+			"max_online_users": setting.MaxOnlineUsers,
+			"guard":            onlineUsersGuardReason(setting, impact),
+		})
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestEstimateUserImpacts(t *testing.T) {
+	const now = int64(1_000_000)
+	tdb := newTestDB(t, &NodeMetric{})
+	online := func(n int) *int { return &n }
+	metrics := []NodeMetric{
+		{ServerTable: "v2_server_vless", ServerID: 1, OnlineUsers: online(3), ReportedAt: now - 120},
+		{ServerTable: "v2_server_vless", ServerID: 1, OnlineUsers: online(7), ReportedAt: now - 60},
+		// 最近一次上报没有在线人数时使用之前的上报
+		{ServerTable: "v2_server_vless", ServerID: 2, OnlineUsers: online(4), ReportedAt: now - 90},
+		{ServerTable: "v2_server_vless", ServerID: 2, ReportedAt: now - 30},
+		// 同一时间的多条上报取 ID 最大的
+		{ServerTable: "v2_server_trojan", ServerID: 1, OnlineUsers: online(1), ReportedAt: now - 10},
+		{ServerTable: "v2_server_trojan", ServerID: 1, OnlineUsers: online(2), ReportedAt: now - 10},
+		// 过期的上报不参考
+		{ServerTable: "v2_server_vless", ServerID: 3, OnlineUsers: online(9), ReportedAt: now - metricsStaleSeconds - 1},
+	}
+	if err := tdb.Create(&metrics).Error; err != nil {
+		t.Fatalf("写入上报数据失败: %v", err)
+	}
+	impacts := estimateUserImpacts(&Tenant{Name: "test", DB: tdb}, now)
+	want := map[string]int{"v2_server_vless:1": 7, "v2_server_vless:2": 4, "v2_server_trojan:1": 2}
+	if len(impacts) != len(want) {
+		t.Fatalf("estimateUserImpacts = %+v，期望 %v", impacts, want)
+	}
+	for key, n := range want {
+		if got := impacts[key]; got.OnlineUsers != n || got.Source != impactSourceNode {
+			t.Errorf("%s = %+v，期望在线 %d 人", key, got, n)
+		}
+	}
+}
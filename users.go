@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 登录用户保存在默认租户的 users 表中：首次启动时由配置文件中的 auth.username、auth.password 创建管理员，
+// 之后登录只校验用户表。管理员（admin 角色）可创建用户、重置其他用户的密码及停用用户；
+// 操作员（operator 角色）只能修改自己的密码，不能管理用户及 API 令牌，可由管理员限定只管理部分服务器组（servers，格式同 API 令牌）
+
+// 用户角色
+const (
+	roleAdmin    = "admin"
+	roleOperator = "operator"
+)
+
+// 仅管理员可访问的路由前缀（会话登录的操作员访问时返回 403）
+var adminRoutePrefixes = []string{"/users", "/api-tokens"}
+
+// 用户名：字母、数字及 . _ -，最长 64 个字符
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// User 结构体，登录用户，仅保存密码的 bcrypt 哈希
+type User struct {
+	ID                uint   `gorm:"primaryKey" json:"id"`
+	Username          string `gorm:"column:username;type:varchar(64);uniqueIndex;not null" json:"username"`
+	PasswordHash      string `gorm:"column:password_hash;type:varchar(255);not null" json:"-"`
+	Role              string `gorm:"column:role;type:varchar(16);not null" json:"role"`
+	Servers           string `gorm:"column:servers;type:varchar(1024);default:''" json:"servers"`
+	DisabledAt        int64  `gorm:"column:disabled_at;default:0" json:"disabled_at"`
+	PasswordChangedAt int64  `gorm:"column:password_changed_at;default:0" json:"password_changed_at"`
+	CreatedBy         string `gorm:"column:created_by;type:varchar(255);default:''" json:"created_by"`
+	CreatedAt         int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// 用户不存在时用于比较的哈希，使登录耗时与用户是否存在无关
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("server_manager"), bcrypt.DefaultCost)
+
+// 用户表为空时由配置文件中的管理员账号创建第一个管理员，auth.password 可为明文或 bcrypt 哈希
+func bootstrapAdminUser(tdb *gorm.DB) {
+	var count int64
+	if err := tdb.Model(&User{}).Count(&count).Error; err != nil {
+		log.Fatalf("统计用户失败: %v", err)
+	}
+	if count > 0 {
+		return
+	}
+	username, password := viper.GetString("auth.username"), viper.GetString("auth.password")
+	if username == "" || password == "" {
+		log.Println("用户表为空且未配置 auth.username、auth.password，无法创建管理员")
+		return
+	}
+	hash := password
+	if !isPasswordHash(password) {
+		var err error
+		if hash, err = hashPassword(password); err != nil {
+			log.Fatalf("生成管理员密码哈希失败: %v", err)
+		}
+	}
+	now := time.Now().Unix()
+	if err := tdb.Create(&User{Username: username, PasswordHash: hash, Role: roleAdmin, PasswordChangedAt: now, CreatedBy: "config"}).Error; err != nil {
+		log.Fatalf("创建管理员失败: %v", err)
+	}
+	log.Printf("已由配置文件创建管理员: 用户=%s，之后登录以用户表为准，可从配置文件中删除 auth.password", username)
+}
+
+// 读取启用中的用户
+func loadUser(username string) (User, error) {
+	var user User
+	err := db.Where("username = ? AND disabled_at = 0", username).First(&user).Error
+	return user, err
+}
+
+// 校验用户名及密码，成功返回用户
+func checkUserPassword(username, password string) (User, bool) {
+	user, err := loadUser(username)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return User{}, false
+	}
+	return user, bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+// 按密码策略校验并保存用户的新密码
+func setUserPassword(user *User, password string) error {
+	if err := checkPasswordPolicy(user.Username, password); err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("生成密码哈希失败: %v", err)
+	}
+	now := time.Now().Unix()
+	if err := db.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"password_hash":       hash,
+		"password_changed_at": now,
+	}).Error; err != nil {
+		return err
+	}
+	user.PasswordHash, user.PasswordChangedAt = hash, now
+	return nil
+}
+
+// 吊销用户的会话（exceptHash 非空时保留该会话）及全部记住登录令牌，返回吊销的会话数
+func revokeUserLogins(username, exceptHash string) int64 {
+	revoked, err := revokeUserSessions(username, exceptHash)
+	if err != nil {
+		log.Printf("吊销会话失败: 用户=%s, 错误=%v", username, err)
+	}
+	if err := db.Where("username = ?", username).Delete(&RememberToken{}).Error; err != nil {
+		log.Printf("删除记住登录令牌失败: 用户=%s, 错误=%v", username, err)
+	}
+	return revoked
+}
+
+// 当前请求的登录用户（会话登录时由认证中间件设置）
+func currentUser(c *gin.Context) (User, bool) {
+	if v, ok := c.Get("user"); ok {
+		return v.(User), true
+	}
+	return User{}, false
+}
+
+// 是否为仅管理员可访问的路由
+func adminOnlyRoute(c *gin.Context) bool {
+	path := c.FullPath()
+	for _, prefix := range adminRoutePrefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// 用户管理须由管理员登录后操作，API 令牌不能管理用户；不满足时写入 403 响应并返回 false
+func requireAdminUser(c *gin.Context) (User, bool) {
+	user, ok := currentUser(c)
+	if !ok || user.Role != roleAdmin {
+		respondError(c, http.StatusForbidden, codeForbidden, "用户管理仅限管理员登录后操作")
+		return User{}, false
+	}
+	return user, true
+}
+
+// 启用中的管理员数量
+func activeAdminCount(tdb *gorm.DB) int64 {
+	var n int64
+	tdb.Model(&User{}).Where("role = ? AND disabled_at = 0", roleAdmin).Count(&n)
+	return n
+}
+
+// 解析用户的服务器组，管理员不能受限；失败时写入 400 响应并返回 false
+func userServersParam(c *gin.Context, role string) (string, bool) {
+	servers, err := parseServerGroups(c.PostForm("servers"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidArgument, err.Error())
+		return "", false
+	}
+	if servers != "" && role == roleAdmin {
+		respondError(c, http.StatusBadRequest, codeInvalidArgument, "管理员不能限定服务器组")
+		return "", false
+	}
+	return servers, true
+}
+
+// 由请求参数 id 读取用户，失败时写入错误响应并返回 false
+func userParam(c *gin.Context) (User, bool) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil || id <= 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "无效的用户ID")
+		return User{}, false
+	}
+	var user User
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, codeNotFound, "用户不存在")
+			return User{}, false
+		}
+		respondError(c, http.StatusInternalServerError, codeInternal, "获取用户失败："+err.Error())
+		return User{}, false
+	}
+	return user, true
+}
+
+// 注册用户管理路由（仅管理员）
+func registerUserRoutes(r *gin.Engine) {
+	// 列出所有用户
+	r.GET("/users", authMiddleware, func(c *gin.Context) {
+		if _, ok := requireAdminUser(c); !ok {
+			return
+		}
+		var users []User
+		if err := db.Order("id").Find(&users).Error; err != nil {
+			log.Printf("获取用户列表失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "获取用户列表失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"users": users, "password_policy": passwordPolicyHint()})
+	})
+
+	// 创建用户：username、password 必填，role 为 admin 或 operator（默认），servers 限定操作员可管理的服务器组
+	r.POST("/users", authMiddleware, func(c *gin.Context) {
+		admin, ok := requireAdminUser(c)
+		if !ok {
+			return
+		}
+		username := strings.TrimSpace(c.PostForm("username"))
+		if !usernamePattern.MatchString(username) {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的用户名（字母、数字及 . _ -，最长 64 个字符）")
+			return
+		}
+		role := c.DefaultPostForm("role", roleOperator)
+		if role != roleAdmin && role != roleOperator {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "无效的角色，可选值: admin, operator")
+			return
+		}
+		servers, ok := userServersParam(c, role)
+		if !ok {
+			return
+		}
+		password := c.PostForm("password")
+		if err := checkPasswordPolicy(username, password); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "密码不符合要求："+err.Error())
+			return
+		}
+		hash, err := hashPassword(password)
+		if err != nil {
+			log.Printf("生成密码哈希失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "保存用户失败")
+			return
+		}
+		var exists int64
+		db.Model(&User{}).Where("username = ?", username).Count(&exists)
+		if exists > 0 {
+			respondError(c, http.StatusConflict, codeConflict, "用户名已存在")
+			return
+		}
+		user := User{Username: username, PasswordHash: hash, Role: role, Servers: servers, PasswordChangedAt: time.Now().Unix(), CreatedBy: admin.Username}
+		if err := db.Create(&user).Error; err != nil {
+			log.Printf("创建用户失败: 用户=%s, 错误=%v", username, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "创建用户失败："+err.Error())
+			return
+		}
+		recordAudit(db, "create_user", username, operatorName(c), c.ClientIP(), "角色="+role+", 服务器组="+servers)
+		log.Printf("已创建用户: 用户=%s, 角色=%s, 操作者=%s", username, role, admin.Username)
+		c.JSON(http.StatusOK, gin.H{"message": "用户 " + username + " 已创建", "user": user})
+	})
+
+	// 重置其他用户的密码：id、new_password 必填，需确认令牌 reset-password；
+	// 重置后该用户的全部会话及记住登录令牌失效。修改自己的密码使用 /change-password
+	r.POST("/users/reset-password", authMiddleware, func(c *gin.Context) {
+		admin, ok := requireAdminUser(c)
+		if !ok {
+			return
+		}
+		user, ok := userParam(c)
+		if !ok {
+			return
+		}
+		if user.ID == admin.ID {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "修改自己的密码请使用修改密码功能")
+			return
+		}
+		if !consumeConfirmToken(c, confirmResetPassword) {
+			return
+		}
+		if err := setUserPassword(&user, c.PostForm("new_password")); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "新密码不符合要求："+err.Error())
+			return
+		}
+		revoked := revokeUserLogins(user.Username, "")
+		recordAudit(db, "reset_user_password", user.Username, operatorName(c), c.ClientIP(), fmt.Sprintf("吊销会话 %d 个", revoked))
+		log.Printf("已重置用户密码: 用户=%s, 操作者=%s, 吊销会话 %d 个", user.Username, admin.Username, revoked)
+		c.JSON(http.StatusOK, gin.H{"message": "用户 " + user.Username + " 的密码已重置，其登录已全部失效", "revoked_sessions": revoked})
+	})
+
+	// 修改操作员可管理的服务器组：id 必填，servers 为空表示不限制，立即对该用户的已有会话生效
+	r.POST("/users/servers", authMiddleware, func(c *gin.Context) {
+		admin, ok := requireAdminUser(c)
+		if !ok {
+			return
+		}
+		user, ok := userParam(c)
+		if !ok {
+			return
+		}
+		servers, ok := userServersParam(c, user.Role)
+		if !ok {
+			return
+		}
+		if err := db.Model(&User{}).Where("id = ?", user.ID).Update("servers", servers).Error; err != nil {
+			log.Printf("修改用户服务器组失败: 用户=%s, 错误=%v", user.Username, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "修改用户服务器组失败："+err.Error())
+			return
+		}
+		recordAudit(db, "set_user_servers", user.Username, operatorName(c), c.ClientIP(), fmt.Sprintf("服务器组 %q -> %q", user.Servers, servers))
+		log.Printf("已修改用户服务器组: 用户=%s, 服务器组=%q, 操作者=%s", user.Username, servers, admin.Username)
+		c.JSON(http.StatusOK, gin.H{"message": "用户 " + user.Username + " 的服务器组已更新", "servers": servers})
+	})
+
+	// 停用（disabled=1）或启用（disabled=0）用户：不能停用自己及最后一个管理员，停用后其登录立即失效
+	r.POST("/users/disable", authMiddleware, func(c *gin.Context) {
+		admin, ok := requireAdminUser(c)
+		if !ok {
+			return
+		}
+		user, ok := userParam(c)
+		if !ok {
+			return
+		}
+		disable := c.PostForm("disabled") != "0"
+		if disable && user.ID == admin.ID {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "不能停用自己")
+			return
+		}
+		if disable && user.Role == roleAdmin && user.DisabledAt == 0 && activeAdminCount(db) <= 1 {
+			respondError(c, http.StatusBadRequest, codeInvalidArgument, "不能停用最后一个管理员")
+			return
+		}
+		var disabledAt int64
+		if disable {
+			disabledAt = time.Now().Unix()
+		}
+		if err := db.Model(&User{}).Where("id = ?", user.ID).Update("disabled_at", disabledAt).Error; err != nil {
+			log.Printf("修改用户状态失败: 用户=%s, 错误=%v", user.Username, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "修改用户状态失败："+err.Error())
+			return
+		}
+		action, message := "enable_user", "用户 "+user.Username+" 已启用"
+		if disable {
+			revokeUserLogins(user.Username, "")
+			action, message = "disable_user", "用户 "+user.Username+" 已停用，其登录已全部失效"
+		}
+		recordAudit(db, action, user.Username, operatorName(c), c.ClientIP(), "")
+		log.Printf("%s: 操作者=%s", message, admin.Username)
+		c.JSON(http.StatusOK, gin.H{"message": message})
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestBootstrapAdminUser(t *testing.T) {
+	prevDB := db
+	db = newTestDB(t, &User{})
+	t.Cleanup(func() { db = prevDB })
+	for key, value := range map[string]interface{}{"auth.username": "admin", "auth.password": "first-secret"} {
+		prev := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, prev) })
+	}
+
+	bootstrapAdminUser(db)
+	user, ok := checkUserPassword("admin", "first-secret")
+	if !ok || user.Role != roleAdmin {
+		t.Fatalf("由配置创建的管理员应能登录: ok=%v, role=%s", ok, user.Role)
+	}
+	if user.PasswordHash == "first-secret" || !isPasswordHash(user.PasswordHash) {
+		t.Fatalf("用户表中应只保存密码哈希: %s", user.PasswordHash)
+	}
+
+	// 用户表非空后修改配置不再影响登录
+	viper.Set("auth.password", "changed-in-config")
+	bootstrapAdminUser(db)
+	if _, ok := checkUserPassword("admin", "changed-in-config"); ok {
+		t.Fatal("用户表非空时不应再由配置文件创建或修改管理员")
+	}
+	if activeAdminCount(db) != 1 {
+		t.Fatalf("管理员数量应为 1，实际为 %d", activeAdminCount(db))
+	}
+
+	// 停用后不能登录，不存在的用户不能登录
+	db.Model(&User{}).Where("id = ?", user.ID).Update("disabled_at", 1)
+	if _, ok := checkUserPassword("admin", "first-secret"); ok {
+		t.Fatal("已停用的用户不应能登录")
+	}
+	if _, ok := checkUserPassword("nobody", "first-secret"); ok {
+		t.Fatal("不存在的用户不应能登录")
+	}
+}
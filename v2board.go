@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// V2Board 管理接口客户端，用于面板数据库无法直连时通过 API 同步节点
+type v2boardClient struct {
+	baseURL    string
+	securePath string
+	authData   string
+	http       *http.Client
+}
+
+// V2Board 接口通用响应
+type v2boardResponse struct {
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"message"`
+}
+
+// 根据配置创建 V2Board 客户端，未配置时返回错误
+func newV2boardClient() (*v2boardClient, error) {
+	baseURL := strings.TrimRight(viper.GetString("v2board.url"), "/")
+	securePath := strings.Trim(viper.GetString("v2board.securePath"), "/")
+	if baseURL == "" || securePath == "" {
+		return nil, errors.New("未配置 v2board.url 或 v2board.securePath")
+	}
+	client := &v2boardClient{
+		baseURL:    baseURL,
+		securePath: securePath,
+		authData:   viper.GetString("v2board.authData"),
+		http:       &http.Client{Timeout: 30 * time.Second},
+	}
+	if client.authData == "" {
+		if err := client.login(viper.GetString("v2board.email"), viper.GetString("v2board.password")); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// 发送请求并解析 data 字段
+func (c *v2boardClient) do(method, path string, body io.Reader, contentType string, out interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.authData != "" {
+		req.Header.Set("Authorization", c.authData)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求 V2Board 失败: %v", err)
+	}
+	defer resp.Body.Close()
+	var result v2boardResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("解析 V2Board 响应失败: HTTP %d, %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("V2Board 返回错误: HTTP %d, %s", resp.StatusCode, result.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
+// 使用管理员账号登录获取 auth_data
+func (c *v2boardClient) login(email, password string) error {
+	if email == "" || password == "" {
+		return errors.New("未配置 v2board.authData，且缺少 v2board.email/v2board.password")
+	}
+	form := url.Values{"email": {email}, "password": {password}}
+	var data struct {
+		AuthData string `json:"auth_data"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/passport/auth/login", strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", &data); err != nil {
+		return fmt.Errorf("V2Board 登录失败: %v", err)
+	}
+	if data.AuthData == "" {
+		return errors.New("V2Board 登录失败: 未返回 auth_data")
+	}
+	c.authData = data.AuthData
+	return nil
+}
+
+// 获取全部节点原始数据
+func (c *v2boardClient) getNodes() ([]map[string]interface{}, error) {
+	var nodes []map[string]interface{}
+	err := c.do(http.MethodGet, "/api/v1/"+c.securePath+"/server/manage/getNodes", nil, "", &nodes)
+	return nodes, err
+}
+
+// 保存节点（V2Board 的 save 接口需要完整的节点数据）
+func (c *v2boardClient) saveNode(nodeType string, node map[string]interface{}) error {
+	body, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodPost, "/api/v1/"+c.securePath+"/server/"+nodeType+"/save", bytes.NewReader(body), "application/json", nil)
+}
+
+// 取节点字段的字符串形式
+func nodeString(node map[string]interface{}, key string) string {
+	switch v := node[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	return ""
+}
+
+// 取节点字段的整数形式
+func nodeInt(node map[string]interface{}, key string) int {
+	n, _ := strconv.Atoi(nodeString(node, key))
+	return n
+}
+
+// 从 V2Board 导入节点到本地服务器表：新节点整行插入，已有节点仅同步名称和显示状态（主机/端口由本程序管理）
+func importV2boardNodes() (int, int, error) {
+	if devMode {
+		return 0, 0, errors.New("开发模式下已禁用 V2Board 集成")
+	}
+	client, err := newV2boardClient()
+	if err != nil {
+		return 0, 0, err
+	}
+	nodes, err := client.getNodes()
+	if err != nil {
+		return 0, 0, err
+	}
+	created, updated := 0, 0
+	for _, node := range nodes {
+		table := "v2_server_" + nodeString(node, "type")
+		if !isValidServerTable(table) {
+			continue
+		}
+		id := nodeInt(node, "id")
+		if id <= 0 {
+			continue
+		}
+		fields := serverFields(table, map[string]interface{}{
+			"name": nodeString(node, "name"),
+			"show": nodeInt(node, "show") == 1,
+		})
+		var count int64
+		if err := db.Table(table).Where("id = ?", id).Count(&count).Error; err != nil {
+			return created, updated, fmt.Errorf("查询表 %s 失败: %v", table, err)
+		}
+		if count > 0 {
+			if err := db.Table(table).Where("id = ?", id).Updates(fields).Error; err != nil {
+				log.Printf("同步 V2Board 节点失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+				continue
+			}
+			updated++
+			continue
+		}
+		columns := "id"
+		for _, column := range []string{"name", "port", "server_port", "host", "show"} {
+			columns += ", " + quotedServerColumn(table, column)
+		}
+		if err := db.Exec("INSERT INTO "+table+" ("+columns+") VALUES (?, ?, ?, ?, ?, ?)",
+			id, nodeString(node, "name"), nodeString(node, "port"), nodeInt(node, "server_port"), nodeString(node, "host"), nodeInt(node, "show") == 1).Error; err != nil {
+			log.Printf("导入 V2Board 节点失败: 表=%s, ID=%d, 错误=%v", table, id, err)
+			continue
+		}
+		log.Printf("导入 V2Board 节点: 表=%s, ID=%d, 名称=%s", table, id, nodeString(node, "name"))
+		created++
+	}
+	log.Printf("V2Board 节点导入完成: 新增 %d, 更新 %d", created, updated)
+	return created, updated, nil
+}
+
+// 将本地轮换结果回写到 V2Board 面板（v2board.pushBack 开启时），面板 API 配置仅对应默认租户
+func pushServerToV2board(t *Tenant, table string, id int, host string, port int) error {
+	if devMode || !viper.GetBool("v2board.pushBack") || t.Name != defaultTenantName {
+		return nil
+	}
+	client, err := newV2boardClient()
+	if err != nil {
+		return err
+	}
+	nodes, err := client.getNodes()
+	if err != nil {
+		return err
+	}
+	nodeType := strings.TrimPrefix(table, "v2_server_")
+	for _, node := range nodes {
+		if nodeString(node, "type") != nodeType || nodeInt(node, "id") != id {
+			continue
+		}
+		node["host"] = host
+		node["port"] = strconv.Itoa(port)
+		node["server_port"] = port
+		rewriteNodeSettings(t, node, table, id, host, port)
+		if err := client.saveNode(nodeType, node); err != nil {
+			return err
+		}
+		log.Printf("回写 V2Board 节点成功: 表=%s, ID=%d, 主机=%s, 端口=%d", table, id, host, port)
+		return nil
+	}
+	return fmt.Errorf("V2Board 中未找到节点: 类型=%s, ID=%d", nodeType, id)
+}
+
+// 注册 V2Board 集成路由
+func registerV2boardRoutes(r *gin.Engine) {
+	// 立即从 V2Board 导入节点
+	r.POST("/v2board/import", authMiddleware, func(c *gin.Context) {
+		created, updated, err := importV2boardNodes()
+		if err != nil {
+			log.Printf("从 V2Board 导入节点失败: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "导入失败："+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("导入完成：新增 %d 个节点，更新 %d 个节点", created, updated),
+			"created": created,
+			"updated": updated,
+		})
+	})
+}